@@ -23,6 +23,7 @@ var (
 	_QKey        string
 	_QRedisDB    int
 	_QRand       bool
+	_QScan       string
 	_QPrintKey   bool
 	redisMap     = make(map[string]*RedisMap)
 	compress     = zlib.New()
@@ -44,6 +45,7 @@ func init() {
 	flag.StringVar(&_QKey, "k", "", "redis key")
 	flag.IntVar(&_QRedisDB, "d", 0, "redis db. default 0")
 	flag.BoolVar(&_QRand, "rand", false, "random key")
+	flag.StringVar(&_QScan, "scan", "", "print the keys matching the pattern")
 	flag.BoolVar(&_QPrintKey, "pk", false, "print key")
 }
 
@@ -56,7 +58,7 @@ func main() {
 		fmt.Println("need redis name.")
 		return
 	}
-	if _QKey == "" && !_QRand {
+	if _QKey == "" && !_QRand && _QScan == "" {
 		fmt.Println("need query key.")
 		return
 	}
@@ -66,6 +68,10 @@ func main() {
 		return
 	}
 	defer conn.Close()
+	if _QScan != "" {
+		execScan(conn, _QScan)
+		return
+	}
 	key := _prefix + _QKey + _suffix
 	if _QRand {
 		key = execRandomKey(conn)
@@ -81,6 +87,17 @@ func execRandomKey(conn redis.Conn) string {
 	return string(val)
 }
 
+func execScan(conn redis.Conn, pattern string) {
+	it := redis.NewCommands(redis.ConnDoer(conn)).Scan(context.Background(), redis.ScanMatch(pattern), redis.ScanCount(100), redis.ScanRate(100))
+	defer it.Close()
+	for it.Next() {
+		fmt.Println(it.Val())
+	}
+	if err := it.Err(); err != nil {
+		fmt.Println(err)
+	}
+}
+
 func exec2(conn redis.Conn, key string) {
 	val, err := redis.Bytes(conn.Do("GET", key))
 	if len(val) == 0 {
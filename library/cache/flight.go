@@ -0,0 +1,121 @@
+package cache
+
+import "sync"
+
+// call is an in-flight or completed load.
+type call struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// group collapses concurrent loads of the same key into one, the callers
+// waiting on it share its result.
+type group struct {
+	mu sync.Mutex
+	m  map[string]*call
+}
+
+// do executes fn once for the concurrent callers of key, shared reports
+// whether the result came from another caller.
+func (g *group) do(key string, fn func() (interface{}, error)) (val interface{}, shared bool, err error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, true, c.err
+	}
+	c := new(call)
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.m, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+	c.val, c.err = fn()
+	return c.val, false, c.err
+}
+
+// doMulti executes fn once for the keys no other caller is loading, and
+// waits for the calls of the others, so overlapping key sets share their
+// loads with each other and with do. The keys left out of the result of fn
+// fail with ErrNotFound. It returns the values of the keys and the first
+// error other than ErrNotFound.
+func (g *group) doMulti(keys []string, fn func(keys []string) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	calls := make(map[string]*call, len(keys))
+	var owned, waited []string
+	for _, key := range keys {
+		if _, ok := calls[key]; ok {
+			continue
+		}
+		c, ok := g.m[key]
+		if ok {
+			waited = append(waited, key)
+		} else {
+			c = new(call)
+			c.wg.Add(1)
+			g.m[key] = c
+			owned = append(owned, key)
+		}
+		calls[key] = c
+	}
+	g.mu.Unlock()
+
+	// the owned calls complete before waiting the others, so two callers
+	// never wait each other.
+	if len(owned) > 0 {
+		g.run(owned, calls, fn)
+	}
+	vals := make(map[string]interface{}, len(calls))
+	var err error
+	for _, key := range append(owned, waited...) {
+		c := calls[key]
+		c.wg.Wait()
+		switch {
+		case c.err == nil:
+			vals[key] = c.val
+		case c.err != ErrNotFound && err == nil:
+			err = c.err
+		}
+	}
+	return vals, err
+}
+
+// run executes fn for the owned calls of keys and completes them.
+func (g *group) run(keys []string, calls map[string]*call, fn func(keys []string) (map[string]interface{}, error)) {
+	var (
+		vals map[string]interface{}
+		err  error
+	)
+	defer func() {
+		g.mu.Lock()
+		for _, key := range keys {
+			c := calls[key]
+			switch v, ok := vals[key]; {
+			case err != nil:
+				c.err = err
+			case ok:
+				c.val = v
+			default:
+				c.err = ErrNotFound
+			}
+			delete(g.m, key)
+		}
+		g.mu.Unlock()
+		for _, key := range keys {
+			calls[key].wg.Done()
+		}
+	}()
+	vals, err = fn(keys)
+}
@@ -0,0 +1,268 @@
+// Package hotkey detects the hot keys and the big values of the cache
+// clients. Once enabled by Init, the redis and memcache connections feed the
+// Detector of their cache Name with a sample of the keys accessed and the
+// sizes of their values, the heaviest ones are logged every Config.Report
+// and served by Snapshots and Handler.
+package hotkey
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache/internal/cmsketch"
+	"github.com/zombie-k/kylin/library/log"
+	xtime "github.com/zombie-k/kylin/library/time"
+)
+
+const (
+	_defaultSample   = 100
+	_defaultTopK     = 20
+	_defaultWidth    = 4096
+	_defaultBigValue = 512 * 1024
+	_defaultReport   = xtime.Duration(time.Minute)
+)
+
+// Config is the config of the detectors.
+type Config struct {
+	// Sample records one access in Sample, 100 by default, 1 records all.
+	Sample int
+	// TopK is the number of hot keys and big keys kept, 20 by default.
+	TopK int
+	// Width is the counters of a row of the count-min sketch, 4096 by
+	// default.
+	Width int
+	// BigValue is the size in bytes of a big value, 512KB by default. The
+	// accesses of big values are always recorded.
+	BigValue int
+	// Report is the interval of the log reports, the counts are halved
+	// after a report so the old accesses fade out. 1m by default.
+	Report xtime.Duration
+	// Enable starts the detection, it is off by default.
+	Enable bool
+}
+
+func (c *Config) fix() {
+	if c.Sample <= 0 {
+		c.Sample = _defaultSample
+	}
+	if c.TopK <= 0 {
+		c.TopK = _defaultTopK
+	}
+	if c.Width <= 0 {
+		c.Width = _defaultWidth
+	}
+	if c.BigValue <= 0 {
+		c.BigValue = _defaultBigValue
+	}
+	if c.Report <= 0 {
+		c.Report = _defaultReport
+	}
+}
+
+var (
+	mu        sync.Mutex
+	conf      = &Config{}
+	detectors = make(map[string]*Detector)
+	reporting bool
+)
+
+func init() {
+	conf.fix()
+}
+
+// Init sets the config of the detectors, it must be called before the
+// cache clients are created.
+func Init(c *Config) {
+	if c == nil {
+		c = &Config{}
+	}
+	c.fix()
+	mu.Lock()
+	conf = c
+	mu.Unlock()
+}
+
+// Get returns the detector of the cache name, nil unless the detection is
+// enabled. A nil Detector records nothing.
+func Get(name string) *Detector {
+	mu.Lock()
+	defer mu.Unlock()
+	if !conf.Enable {
+		return nil
+	}
+	if d, ok := detectors[name]; ok {
+		return d
+	}
+	d := newDetector(name, conf)
+	detectors[name] = d
+	if !reporting {
+		reporting = true
+		go report(time.Duration(conf.Report))
+	}
+	return d
+}
+
+// Key is a hot key or a big key of a Snapshot.
+type Key struct {
+	Key string `json:"key"`
+	// Count estimates the accesses since the last halving, scaled by the
+	// sampling.
+	Count uint64 `json:"count"`
+	// Size is the largest value size seen.
+	Size int `json:"size"`
+}
+
+// Snapshot is the top keys of a cache.
+type Snapshot struct {
+	Name string `json:"name"`
+	// Hot is the keys accessed most, by count.
+	Hot []Key `json:"hot"`
+	// Big is the keys of the largest values, by size.
+	Big []Key `json:"big"`
+}
+
+// Snapshots returns the snapshots of every cache, by name.
+func Snapshots() []*Snapshot {
+	mu.Lock()
+	ds := make([]*Detector, 0, len(detectors))
+	for _, d := range detectors {
+		ds = append(ds, d)
+	}
+	mu.Unlock()
+	sort.Slice(ds, func(i, j int) bool { return ds[i].name < ds[j].name })
+	ss := make([]*Snapshot, len(ds))
+	for i, d := range ds {
+		ss[i] = d.Snapshot()
+	}
+	return ss
+}
+
+// Detector is the sketch of the keys of a cache.
+type Detector struct {
+	name     string
+	sample   uint64
+	bigValue int
+
+	n uint64 // accesses
+
+	mu  sync.Mutex
+	cms *cmsketch.CountMin
+	hot *topK
+	big *topK
+}
+
+func newDetector(name string, c *Config) *Detector {
+	return &Detector{
+		name:     name,
+		sample:   uint64(c.Sample),
+		bigValue: c.BigValue,
+		cms:      cmsketch.New(c.Width, ^uint32(0)),
+		hot:      newTopK(c.TopK, func(e *entry) uint64 { return uint64(e.count) }),
+		big:      newTopK(c.TopK, func(e *entry) uint64 { return uint64(e.size) }),
+	}
+}
+
+// Sample reports whether an access of a value of size bytes is recorded,
+// one in Config.Sample and every big value. The key is only built for the
+// accesses recorded.
+func (d *Detector) Sample(size int) bool {
+	if d == nil {
+		return false
+	}
+	return atomic.AddUint64(&d.n, 1)%d.sample == 0 || size >= d.bigValue
+}
+
+// Add records an access of key, size is the size of its value, 0 if
+// unknown.
+func (d *Detector) Add(key string, size int) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	count := d.cms.Add(key)
+	d.hot.update(key, count, size)
+	if _, ok := d.big.keys[key]; ok || size > 0 {
+		d.big.update(key, count, size)
+	}
+	d.mu.Unlock()
+}
+
+// Snapshot returns the top keys.
+func (d *Detector) Snapshot() *Snapshot {
+	s := &Snapshot{Name: d.name}
+	d.mu.Lock()
+	s.Hot = d.keys(d.hot)
+	s.Big = d.keys(d.big)
+	d.mu.Unlock()
+	sort.Slice(s.Hot, func(i, j int) bool { return s.Hot[i].Count > s.Hot[j].Count })
+	sort.Slice(s.Big, func(i, j int) bool { return s.Big[i].Size > s.Big[j].Size })
+	return s
+}
+
+// keys returns the entries of t as Keys, d.mu is held.
+func (d *Detector) keys(t *topK) []Key {
+	keys := make([]Key, len(t.entries))
+	for i, e := range t.entries {
+		keys[i] = Key{Key: e.key, Count: uint64(e.count) * d.sample, Size: e.size}
+	}
+	return keys
+}
+
+func (d *Detector) halve() {
+	d.mu.Lock()
+	d.cms.Halve()
+	d.hot.halve()
+	d.big.halve()
+	d.mu.Unlock()
+}
+
+// report logs the top keys of every cache every interval.
+func report(interval time.Duration) {
+	for range time.Tick(interval) {
+		mu.Lock()
+		ds := make([]*Detector, 0, len(detectors))
+		for _, d := range detectors {
+			ds = append(ds, d)
+		}
+		mu.Unlock()
+		for _, d := range ds {
+			d.report()
+		}
+	}
+}
+
+func (d *Detector) report() {
+	s := d.Snapshot()
+	d.halve()
+	if len(s.Hot) > 0 {
+		log.Info("hotkey: %s hot keys: %s", d.name, format(s.Hot))
+	}
+	var big []Key
+	for _, k := range s.Big {
+		if k.Size >= d.bigValue {
+			big = append(big, k)
+		}
+	}
+	if len(big) > 0 {
+		log.Warn("hotkey: %s big keys: %s", d.name, format(big))
+	}
+}
+
+func format(keys []Key) string {
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(k.Key)
+		b.WriteString(" count=")
+		b.WriteString(strconv.FormatUint(k.Count, 10))
+		b.WriteString(" size=")
+		b.WriteString(strconv.Itoa(k.Size))
+	}
+	return b.String()
+}
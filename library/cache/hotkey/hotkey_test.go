@@ -0,0 +1,81 @@
+package hotkey
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopK(t *testing.T) {
+	k := newTopK(2, func(e *entry) uint64 { return uint64(e.count) })
+	k.update("a", 1, 0)
+	k.update("b", 2, 0)
+	// c does not outscore a.
+	k.update("c", 1, 0)
+	assert.Len(t, k.keys, 2)
+	assert.NotContains(t, k.keys, "c")
+	k.update("c", 3, 0)
+	assert.NotContains(t, k.keys, "a")
+	k.update("b", 4, 10)
+	k.update("b", 5, 5)
+	assert.Equal(t, 10, k.keys["b"].size)
+	assert.Equal(t, "c", k.entries[0].key)
+	k.halve()
+	assert.Equal(t, uint32(2), k.keys["b"].count)
+}
+
+func TestDetector(t *testing.T) {
+	d := newDetector("test", &Config{Sample: 2, TopK: 3, Width: 64, BigValue: 1000})
+	var sampled int
+	for i := 0; i < 100; i++ {
+		key := "hot"
+		if i%10 == 1 {
+			key = fmt.Sprintf("cold%d", i)
+		}
+		if d.Sample(10) {
+			sampled++
+			d.Add(key, 10)
+		}
+	}
+	assert.Equal(t, 50, sampled)
+	// a big value is always recorded.
+	assert.True(t, d.Sample(1000))
+	d.Add("big", 1000)
+
+	s := d.Snapshot()
+	assert.Equal(t, "test", s.Name)
+	assert.Len(t, s.Hot, 3)
+	assert.Equal(t, "hot", s.Hot[0].Key)
+	assert.Equal(t, uint64(80), s.Hot[0].Count)
+	assert.Equal(t, Key{Key: "big", Count: 2, Size: 1000}, s.Big[0])
+
+	d.report()
+	assert.Equal(t, uint64(40), d.Snapshot().Hot[0].Count)
+
+	// a nil detector records nothing.
+	var nd *Detector
+	assert.False(t, nd.Sample(1000))
+	nd.Add("key", 1)
+}
+
+func TestHandler(t *testing.T) {
+	Init(&Config{Sample: 1, Enable: true})
+	Get("test_handler_a").Add("a", 1)
+	Get("test_handler_b").Add("b", 1)
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/cache/hotkeys?name=test_handler_b", nil))
+	var ss []*Snapshot
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &ss))
+	assert.Equal(t, []*Snapshot{{
+		Name: "test_handler_b",
+		Hot:  []Key{{Key: "b", Count: 1, Size: 1}},
+		Big:  []Key{{Key: "b", Count: 1, Size: 1}},
+	}}, ss)
+
+	Init(nil)
+	assert.Nil(t, Get("test_handler_c"))
+}
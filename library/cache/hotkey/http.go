@@ -0,0 +1,41 @@
+package hotkey
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Handler serves the snapshots as json, those of the caches of the name
+// query parameters if any:
+//
+//	GET /debug/cache/hotkeys?name=user&name=feed
+//
+// The keys may be sensitive, serve it on an internal ops listener rather
+// than on the business port:
+//
+//	mux := http.NewServeMux()
+//	mux.Handle("/debug/cache/hotkeys", hotkey.Handler())
+//	go http.ListenAndServe("127.0.0.1:2333", mux)
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ss := Snapshots()
+		if names := r.URL.Query()["name"]; len(names) > 0 {
+			want := make(map[string]struct{}, len(names))
+			for _, name := range names {
+				want[name] = struct{}{}
+			}
+			var filtered []*Snapshot
+			for _, s := range ss {
+				if _, ok := want[s.Name]; ok {
+					filtered = append(filtered, s)
+				}
+			}
+			ss = filtered
+		}
+		if ss == nil {
+			ss = []*Snapshot{}
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(ss)
+	})
+}
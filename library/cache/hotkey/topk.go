@@ -0,0 +1,81 @@
+package hotkey
+
+import "container/heap"
+
+// entry is a key of a topK.
+type entry struct {
+	key   string
+	count uint32
+	size  int
+	index int
+}
+
+// topK keeps the k entries of the largest score, by a min heap.
+type topK struct {
+	k       int
+	score   func(e *entry) uint64
+	entries []*entry
+	keys    map[string]*entry
+}
+
+func newTopK(k int, score func(e *entry) uint64) *topK {
+	return &topK{k: k, score: score, keys: make(map[string]*entry)}
+}
+
+// update sets the count and the size of key, it enters the top k if it
+// outscores the least entry.
+func (t *topK) update(key string, count uint32, size int) {
+	if e, ok := t.keys[key]; ok {
+		e.count = count
+		if size > e.size {
+			e.size = size
+		}
+		heap.Fix(t, e.index)
+		return
+	}
+	e := &entry{key: key, count: count, size: size}
+	if len(t.entries) < t.k {
+		heap.Push(t, e)
+		return
+	}
+	if t.k == 0 || t.score(e) <= t.score(t.entries[0]) {
+		return
+	}
+	delete(t.keys, t.entries[0].key)
+	e.index = 0
+	t.entries[0] = e
+	t.keys[key] = e
+	heap.Fix(t, 0)
+}
+
+// halve fades out the counts like the sketch.
+func (t *topK) halve() {
+	for _, e := range t.entries {
+		e.count >>= 1
+	}
+	heap.Init(t)
+}
+
+func (t *topK) Len() int { return len(t.entries) }
+
+func (t *topK) Less(i, j int) bool { return t.score(t.entries[i]) < t.score(t.entries[j]) }
+
+func (t *topK) Swap(i, j int) {
+	t.entries[i], t.entries[j] = t.entries[j], t.entries[i]
+	t.entries[i].index = i
+	t.entries[j].index = j
+}
+
+func (t *topK) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(t.entries)
+	t.entries = append(t.entries, e)
+	t.keys[e.key] = e
+}
+
+func (t *topK) Pop() interface{} {
+	e := t.entries[len(t.entries)-1]
+	t.entries = t.entries[:len(t.entries)-1]
+	delete(t.keys, e.key)
+	return e
+}
@@ -0,0 +1,84 @@
+// Package cmsketch is the count-min sketch shared by the cache packages: the
+// tinylfu admission of the local cache and the hot key detection.
+package cmsketch
+
+import "hash/fnv"
+
+const _depth = 4
+
+// CountMin is a count-min sketch estimating the accesses of keys, it
+// overestimates a key only by the collisions of its least collided row. The
+// counters saturate at the max of New. A CountMin is not safe for
+// concurrent use.
+type CountMin struct {
+	rows [_depth][]uint32
+	mask uint64
+	max  uint32
+}
+
+// New new a sketch of width counters per row, rounded up to a power of two
+// and at least 16, whose counters saturate at max.
+func New(width int, max uint32) *CountMin {
+	w := 16
+	for w < width {
+		w <<= 1
+	}
+	s := &CountMin{mask: uint64(w - 1), max: max}
+	for i := range s.rows {
+		s.rows[i] = make([]uint32, w)
+	}
+	return s
+}
+
+// Width returns the counters of a row.
+func (s *CountMin) Width() int {
+	return len(s.rows[0])
+}
+
+// Add counts an access of key and returns its estimate.
+func (s *CountMin) Add(key string) uint32 {
+	h := hash(key)
+	min := s.max
+	for i := range s.rows {
+		c := &s.rows[i][index(h, i)&s.mask]
+		if *c < s.max {
+			*c++
+		}
+		if *c < min {
+			min = *c
+		}
+	}
+	return min
+}
+
+// Estimate returns the estimate of key.
+func (s *CountMin) Estimate(key string) uint32 {
+	h := hash(key)
+	min := s.max
+	for i := range s.rows {
+		if c := s.rows[i][index(h, i)&s.mask]; c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+// Halve halves the counters, so the old accesses fade out.
+func (s *CountMin) Halve() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+}
+
+// index returns the counter of key in row i, by double hashing.
+func index(h uint64, i int) uint64 {
+	return h + uint64(i)*(h>>32|1)
+}
+
+func hash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
@@ -0,0 +1,31 @@
+package cmsketch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountMin(t *testing.T) {
+	s := New(100, ^uint32(0))
+	assert.Equal(t, 128, s.Width())
+	for i := 0; i < 10; i++ {
+		s.Add("a")
+	}
+	assert.Equal(t, uint32(11), s.Add("a"))
+	assert.Equal(t, uint32(1), s.Add("b"))
+	assert.Equal(t, uint32(11), s.Estimate("a"))
+	assert.Equal(t, uint32(0), s.Estimate("c"))
+	s.Halve()
+	assert.Equal(t, uint32(6), s.Add("a"))
+}
+
+func TestCountMinSaturate(t *testing.T) {
+	s := New(16, 15)
+	for i := 0; i < 20; i++ {
+		s.Add("a")
+	}
+	assert.Equal(t, uint32(15), s.Estimate("a"))
+	s.Halve()
+	assert.Equal(t, uint32(7), s.Estimate("a"))
+}
@@ -0,0 +1,173 @@
+// Package fakeserver is the plumbing shared by the in-process servers of
+// memcachetest and redistest: the listener and its connections, a clock
+// which can be advanced and the faults injected into the replies.
+package fakeserver
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Faults are injected into the replies of a server, the zero value injects
+// none.
+type Faults struct {
+	// Latency delays every reply.
+	Latency time.Duration
+	// Error is replied instead of executing commands, in the error syntax
+	// of the protocol.
+	Error string
+	// Drop closes the connection instead of replying.
+	Drop bool
+	// Commands limits faults to these commands, matched case insensitively,
+	// all commands are affected when empty.
+	Commands []string
+}
+
+func (f *Faults) match(cmd string) bool {
+	if len(f.Commands) == 0 {
+		return true
+	}
+	for _, c := range f.Commands {
+		if strings.EqualFold(c, cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+// Listener accepts the connections of a server, its clock and faults are
+// shared by all of them.
+type Listener struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	offset time.Duration
+	faults Faults
+}
+
+// Listen listens on a random local port.
+func Listen() (*Listener, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{ln: ln, conns: make(map[net.Conn]struct{})}, nil
+}
+
+// Addr returns the "host:port" address of the listener.
+func (l *Listener) Addr() string {
+	return l.ln.Addr().String()
+}
+
+// Serve accepts the connections in background, each is served by serve on
+// its own goroutine and closed once serve returns.
+func (l *Listener) Serve(serve func(nc net.Conn)) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		for {
+			nc, err := l.ln.Accept()
+			if err != nil {
+				return
+			}
+			l.mu.Lock()
+			if l.closed {
+				l.mu.Unlock()
+				nc.Close()
+				return
+			}
+			l.conns[nc] = struct{}{}
+			l.mu.Unlock()
+			l.wg.Add(1)
+			go func() {
+				defer l.wg.Done()
+				defer func() {
+					l.mu.Lock()
+					delete(l.conns, nc)
+					l.mu.Unlock()
+					nc.Close()
+				}()
+				serve(nc)
+			}()
+		}
+	}()
+}
+
+// Close stops accepting, closes all the connections and waits for them to
+// be served.
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	l.closed = true
+	for nc := range l.conns {
+		nc.Close()
+	}
+	l.mu.Unlock()
+	err := l.ln.Close()
+	l.wg.Wait()
+	return err
+}
+
+// Closed reports whether Close was called.
+func (l *Listener) Closed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closed
+}
+
+// Conns returns the number of open connections.
+func (l *Listener) Conns() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.conns)
+}
+
+// CloseConns closes all current connections, new ones are still accepted.
+func (l *Listener) CloseConns() {
+	l.mu.Lock()
+	for nc := range l.conns {
+		nc.Close()
+	}
+	l.mu.Unlock()
+}
+
+// Now returns the time of the clock.
+func (l *Listener) Now() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Now().Add(l.offset)
+}
+
+// Advance moves the clock forward by d.
+func (l *Listener) Advance(d time.Duration) {
+	l.mu.Lock()
+	l.offset += d
+	l.mu.Unlock()
+}
+
+// SetFaults replaces the injected faults.
+func (l *Listener) SetFaults(f Faults) {
+	l.mu.Lock()
+	l.faults = f
+	l.mu.Unlock()
+}
+
+// Inject injects the faults matching cmd before its reply: it sleeps the
+// latency, then reports whether the connection is dropped and the error to
+// reply instead of executing cmd, empty if none.
+func (l *Listener) Inject(cmd string) (drop bool, errText string) {
+	l.mu.Lock()
+	f := l.faults
+	l.mu.Unlock()
+	if !f.match(cmd) {
+		return false, ""
+	}
+	if f.Latency > 0 {
+		time.Sleep(f.Latency)
+	}
+	return f.Drop, f.Error
+}
@@ -0,0 +1,61 @@
+package fakeserver
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListener(t *testing.T) {
+	l, err := Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Serve(func(nc net.Conn) {
+		line, _ := bufio.NewReader(nc).ReadString('\n')
+		nc.Write([]byte(line))
+	})
+	nc, err := net.Dial("tcp", l.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc.Write([]byte("ping\n"))
+	line, err := bufio.NewReader(nc).ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "ping\n", line)
+	nc.Close()
+
+	before := l.Now()
+	l.Advance(time.Hour)
+	assert.True(t, l.Now().Sub(before) >= time.Hour)
+
+	assert.Nil(t, l.Close())
+	assert.True(t, l.Closed())
+	assert.Equal(t, 0, l.Conns())
+}
+
+func TestInject(t *testing.T) {
+	l, err := Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	drop, errText := l.Inject("GET")
+	assert.False(t, drop)
+	assert.Equal(t, "", errText)
+
+	l.SetFaults(Faults{Error: "down", Commands: []string{"get"}})
+	_, errText = l.Inject("GET")
+	assert.Equal(t, "down", errText)
+	_, errText = l.Inject("SET")
+	assert.Equal(t, "", errText)
+
+	l.SetFaults(Faults{Drop: true, Latency: 10 * time.Millisecond})
+	start := time.Now()
+	drop, _ = l.Inject("SET")
+	assert.True(t, drop)
+	assert.True(t, time.Since(start) >= 10*time.Millisecond)
+}
@@ -0,0 +1,364 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/zombie-k/kylin/library/log"
+	"github.com/zombie-k/kylin/library/sync/pipeline/fanout"
+	xtime "github.com/zombie-k/kylin/library/time"
+
+	pkgerr "github.com/pkg/errors"
+)
+
+var (
+	// ErrNotFound is returned by a load function when the origin holds no
+	// value for the key, the result is cached for Config.NotFoundExpire.
+	ErrNotFound = errors.New("cache: not found")
+)
+
+// entry kinds, an entry is the kind, the unix nano time to refresh it at
+// (0 never) and the json encoded value.
+const (
+	_kindValue    = byte(0)
+	_kindNotFound = byte(1)
+	_entryHeader  = 9
+)
+
+// Store is the backend of a Loader, memcache.NewStore and redis.NewStore
+// adapt the clients.
+type Store interface {
+	// GetMulti returns the values of the keys found, the missing keys are
+	// left out.
+	GetMulti(ctx context.Context, keys []string) (map[string][]byte, error)
+	// Set stores the value for ttl, zero means no expiration.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete deletes the key, a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// LoadFunc loads the value of key from the origin, it returns ErrNotFound
+// if there is none.
+type LoadFunc func(ctx context.Context, key string) (interface{}, error)
+
+// BatchLoadFunc loads the values of keys from the origin, the keys left
+// out of the result are not found.
+type BatchLoadFunc func(ctx context.Context, keys []string) (map[string]interface{}, error)
+
+// Config loader config.
+type Config struct {
+	// Name is the loader name, for log.
+	Name string
+	// Expire is the ttl of loaded values, zero means no expiration.
+	Expire xtime.Duration
+	// NotFoundExpire is the ttl of not found results, zero disables
+	// caching them.
+	NotFoundExpire xtime.Duration
+	// RefreshAhead reloads a value in background when it is read within
+	// RefreshAhead of its expiration, zero disables refreshing.
+	RefreshAhead xtime.Duration
+}
+
+// LoaderOption specifies an option for a Loader.
+type LoaderOption struct {
+	f func(*Loader)
+}
+
+// LoaderBatch specifies the function loading the keys GetMulti missed, if
+// this option is left out, they are loaded one by one.
+func LoaderBatch(batch BatchLoadFunc) LoaderOption {
+	return LoaderOption{func(l *Loader) {
+		l.batch = batch
+	}}
+}
+
+// Loader is a cache-aside loader, it reads the store and loads the misses
+// from the origin. Concurrent misses of a key are loaded once.
+type Loader struct {
+	c     *Config
+	store Store
+	load  LoadFunc
+	batch BatchLoadFunc
+
+	flight group
+	fanout *fanout.Fanout
+
+	mu         sync.Mutex
+	refreshing map[string]struct{}
+
+	now func() time.Time
+}
+
+// NewLoader new a loader of store, load or the LoaderBatch option must be
+// specified.
+func NewLoader(c *Config, store Store, load LoadFunc, options ...LoaderOption) *Loader {
+	l := &Loader{
+		c:          c,
+		store:      store,
+		load:       load,
+		refreshing: make(map[string]struct{}),
+		now:        time.Now,
+	}
+	for _, option := range options {
+		option.f(l)
+	}
+	if l.load == nil && l.batch == nil {
+		panic("cache: loader needs a load function")
+	}
+	l.fanout = fanout.New("cache-loader-" + c.Name)
+	return l
+}
+
+// Close stops the background refreshing.
+func (l *Loader) Close() error {
+	return l.fanout.Close()
+}
+
+// Delete deletes key from the store, the next read loads it again.
+func (l *Loader) Delete(ctx context.Context, key string) error {
+	return l.store.Delete(ctx, key)
+}
+
+// Get reads key into v, loading it from the origin on a miss. ErrNotFound
+// is returned if the origin holds no value.
+func (l *Loader) Get(ctx context.Context, key string, v interface{}) error {
+	values, err := l.store.GetMulti(ctx, []string{key})
+	if err != nil {
+		log.Warn("cache: loader %s get key %s error(%v), load it from origin", l.c.Name, key, err)
+	}
+	if data, ok := values[key]; ok {
+		if payload, ok, err := l.cached(key, data); ok {
+			if err != nil {
+				return err
+			}
+			return pkgerr.WithStack(json.Unmarshal(payload, v))
+		}
+	}
+	payload, _, err := l.flight.do(key, func() (interface{}, error) {
+		return l.loadKey(ctx, key)
+	})
+	if err != nil {
+		return err
+	}
+	return pkgerr.WithStack(json.Unmarshal(payload.([]byte), v))
+}
+
+// GetMulti reads keys into v, a pointer to a map[string]T, loading the
+// misses from the origin. The keys not found are left out of v.
+func (l *Loader) GetMulti(ctx context.Context, keys []string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Map || rv.Elem().Type().Key().Kind() != reflect.String {
+		return pkgerr.Errorf("cache: GetMulti needs a pointer to map[string]T, got %T", v)
+	}
+	payloads, err := l.getMulti(ctx, keys)
+	if err != nil {
+		return err
+	}
+	m := rv.Elem()
+	if m.IsNil() {
+		m.Set(reflect.MakeMap(m.Type()))
+	}
+	for key, payload := range payloads {
+		value := reflect.New(m.Type().Elem())
+		if err = json.Unmarshal(payload, value.Interface()); err != nil {
+			return pkgerr.WithStack(err)
+		}
+		m.SetMapIndex(reflect.ValueOf(key).Convert(m.Type().Key()), value.Elem())
+	}
+	return nil
+}
+
+func (l *Loader) getMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	values, err := l.store.GetMulti(ctx, keys)
+	if err != nil {
+		log.Warn("cache: loader %s get keys %v error(%v), load them from origin", l.c.Name, keys, err)
+	}
+	payloads := make(map[string][]byte, len(keys))
+	seen := make(map[string]struct{}, len(keys))
+	var missed []string
+	for _, key := range keys {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		if data, ok := values[key]; ok {
+			if payload, ok, err := l.cached(key, data); ok {
+				if err == nil {
+					payloads[key] = payload
+				}
+				continue
+			}
+		}
+		missed = append(missed, key)
+	}
+	if len(missed) == 0 {
+		return payloads, nil
+	}
+	loaded, err := l.loadKeys(ctx, missed)
+	if err != nil {
+		return nil, err
+	}
+	for key, payload := range loaded {
+		payloads[key] = payload
+	}
+	return payloads, nil
+}
+
+// cached returns the payload of a stored entry, ok is false if the entry is
+// malformed and must be loaded again. A not found entry returns ErrNotFound.
+func (l *Loader) cached(key string, data []byte) (payload []byte, ok bool, err error) {
+	if len(data) < _entryHeader {
+		return nil, false, nil
+	}
+	switch data[0] {
+	case _kindNotFound:
+		return nil, true, ErrNotFound
+	case _kindValue:
+	default:
+		return nil, false, nil
+	}
+	if refreshAt := int64(binary.BigEndian.Uint64(data[1:_entryHeader])); refreshAt != 0 && l.now().UnixNano() >= refreshAt {
+		l.refresh(key)
+	}
+	return data[_entryHeader:], true, nil
+}
+
+// refresh reloads key in background, once at a time.
+func (l *Loader) refresh(key string) {
+	l.mu.Lock()
+	if _, ok := l.refreshing[key]; ok {
+		l.mu.Unlock()
+		return
+	}
+	l.refreshing[key] = struct{}{}
+	l.mu.Unlock()
+	done := func() {
+		l.mu.Lock()
+		delete(l.refreshing, key)
+		l.mu.Unlock()
+	}
+	err := l.fanout.Do(context.Background(), func(ctx context.Context) {
+		defer done()
+		if _, _, err := l.flight.do(key, func() (interface{}, error) {
+			return l.loadKey(ctx, key)
+		}); err != nil && err != ErrNotFound {
+			log.Warn("cache: loader %s refresh key %s error(%v)", l.c.Name, key, err)
+		}
+	})
+	if err != nil {
+		done()
+	}
+}
+
+// loadKey loads key from the origin and stores the result.
+func (l *Loader) loadKey(ctx context.Context, key string) ([]byte, error) {
+	var (
+		value interface{}
+		err   error
+	)
+	if l.load != nil {
+		value, err = l.load(ctx, key)
+	} else {
+		var values map[string]interface{}
+		if values, err = l.batch(ctx, []string{key}); err == nil {
+			var ok bool
+			if value, ok = values[key]; !ok {
+				err = ErrNotFound
+			}
+		}
+	}
+	if err == ErrNotFound {
+		l.set(ctx, key, _kindNotFound, nil)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return nil, pkgerr.WithStack(err)
+	}
+	l.set(ctx, key, _kindValue, payload)
+	return payload, nil
+}
+
+// loadKeys loads the missed keys from the origin, the keys not found are
+// left out of the result.
+func (l *Loader) loadKeys(ctx context.Context, keys []string) (map[string][]byte, error) {
+	payloads := make(map[string][]byte, len(keys))
+	if l.batch == nil {
+		for _, key := range keys {
+			payload, _, err := l.flight.do(key, func() (interface{}, error) {
+				return l.loadKey(ctx, key)
+			})
+			if err == ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			payloads[key] = payload.([]byte)
+		}
+		return payloads, nil
+	}
+	loaded, err := l.flight.doMulti(keys, func(keys []string) (map[string]interface{}, error) {
+		values, err := l.batch(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+		loaded := make(map[string]interface{}, len(values))
+		for _, key := range keys {
+			value, ok := values[key]
+			if !ok {
+				l.set(ctx, key, _kindNotFound, nil)
+				continue
+			}
+			payload, err := json.Marshal(value)
+			if err != nil {
+				return nil, pkgerr.WithStack(err)
+			}
+			l.set(ctx, key, _kindValue, payload)
+			loaded[key] = payload
+		}
+		return loaded, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for key, payload := range loaded {
+		payloads[key] = payload.([]byte)
+	}
+	return payloads, nil
+}
+
+// set stores an entry, the store errors are only logged as the value is
+// served from the origin anyway.
+func (l *Loader) set(ctx context.Context, key string, kind byte, payload []byte) {
+	var (
+		ttl       time.Duration
+		refreshAt int64
+	)
+	switch kind {
+	case _kindNotFound:
+		if ttl = time.Duration(l.c.NotFoundExpire); ttl <= 0 {
+			return
+		}
+	case _kindValue:
+		ttl = time.Duration(l.c.Expire)
+		if ahead := time.Duration(l.c.RefreshAhead); ahead > 0 && ttl > ahead {
+			refreshAt = l.now().Add(ttl - ahead).UnixNano()
+		}
+	}
+	data := make([]byte, _entryHeader+len(payload))
+	data[0] = kind
+	binary.BigEndian.PutUint64(data[1:_entryHeader], uint64(refreshAt))
+	copy(data[_entryHeader:], payload)
+	if err := l.store.Set(ctx, key, data, ttl); err != nil {
+		log.Warn("cache: loader %s set key %s error(%v)", l.c.Name, key, err)
+	}
+}
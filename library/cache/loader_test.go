@@ -0,0 +1,259 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	xtime "github.com/zombie-k/kylin/library/time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memStore is an in-memory Store, expirations are not enforced.
+type memStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+	ttls map[string]time.Duration
+	err  error
+}
+
+func newMemStore() *memStore {
+	return &memStore{data: make(map[string][]byte), ttls: make(map[string]time.Duration)}
+}
+
+func (s *memStore) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	values := make(map[string][]byte)
+	for _, key := range keys {
+		if v, ok := s.data[key]; ok {
+			values[key] = v
+		}
+	}
+	return values, nil
+}
+
+func (s *memStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = value
+	s.ttls[key] = ttl
+	return nil
+}
+
+func (s *memStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func (s *memStore) ttl(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ttls[key]
+}
+
+type user struct {
+	Name string
+}
+
+var testConfig = &Config{
+	Name:           "test",
+	Expire:         xtime.Duration(time.Minute),
+	NotFoundExpire: xtime.Duration(time.Second),
+	RefreshAhead:   xtime.Duration(10 * time.Second),
+}
+
+func TestLoaderGet(t *testing.T) {
+	s := newMemStore()
+	var loads int32
+	l := NewLoader(testConfig, s, func(ctx context.Context, key string) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		if key == "miss" {
+			return nil, ErrNotFound
+		}
+		return &user{Name: key}, nil
+	})
+	defer l.Close()
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		var u user
+		assert.Nil(t, l.Get(ctx, "alice", &u))
+		assert.Equal(t, "alice", u.Name)
+		assert.Equal(t, ErrNotFound, l.Get(ctx, "miss", &u))
+	}
+	assert.Equal(t, int32(2), loads)
+	assert.Equal(t, time.Minute, s.ttl("alice"))
+	assert.Equal(t, time.Second, s.ttl("miss"))
+
+	assert.Nil(t, l.Delete(ctx, "alice"))
+	assert.Nil(t, l.Get(ctx, "alice", new(user)))
+	assert.Equal(t, int32(3), loads)
+
+	// the origin serves the reads while the store is down.
+	s.err = errors.New("store down")
+	assert.Nil(t, l.Get(ctx, "alice", new(user)))
+	assert.Equal(t, int32(4), loads)
+}
+
+func TestLoaderSingleflight(t *testing.T) {
+	s := newMemStore()
+	var loads int32
+	release := make(chan struct{})
+	l := NewLoader(testConfig, s, func(ctx context.Context, key string) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return key, nil
+	})
+	defer l.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var v string
+			assert.Nil(t, l.Get(context.Background(), "key", &v))
+			assert.Equal(t, "key", v)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), loads)
+}
+
+func TestLoaderRefreshAhead(t *testing.T) {
+	s := newMemStore()
+	var loads int32
+	loaded := make(chan struct{}, 10)
+	l := NewLoader(testConfig, s, func(ctx context.Context, key string) (interface{}, error) {
+		n := atomic.AddInt32(&loads, 1)
+		loaded <- struct{}{}
+		return n, nil
+	})
+	defer l.Close()
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	var v int32
+	assert.Nil(t, l.Get(ctx, "key", &v))
+	assert.Equal(t, int32(1), v)
+	<-loaded
+	now = now.Add(49 * time.Second)
+	assert.Nil(t, l.Get(ctx, "key", &v))
+	assert.Equal(t, int32(1), v)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+
+	// the stale value is served while it is reloaded in background.
+	now = now.Add(2 * time.Second)
+	assert.Nil(t, l.Get(ctx, "key", &v))
+	assert.Equal(t, int32(1), v)
+	select {
+	case <-loaded:
+	case <-time.After(time.Second):
+		t.Fatal("value not refreshed")
+	}
+	assert.Eventually(t, func() bool {
+		var v int32
+		return l.Get(ctx, "key", &v) == nil && v == 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestLoaderGetMulti(t *testing.T) {
+	s := newMemStore()
+	var batches [][]string
+	l := NewLoader(testConfig, s, nil, LoaderBatch(func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+		batches = append(batches, keys)
+		values := make(map[string]interface{})
+		for _, key := range keys {
+			if key != "miss" {
+				values[key] = &user{Name: key}
+			}
+		}
+		return values, nil
+	}))
+	defer l.Close()
+	ctx := context.Background()
+
+	var u user
+	assert.Nil(t, l.Get(ctx, "alice", &u))
+	assert.Equal(t, "alice", u.Name)
+	users := make(map[string]*user)
+	assert.Nil(t, l.GetMulti(ctx, []string{"alice", "bob", "miss", "bob"}, &users))
+	assert.Equal(t, map[string]*user{"alice": {Name: "alice"}, "bob": {Name: "bob"}}, users)
+	assert.Equal(t, [][]string{{"alice"}, {"bob", "miss"}}, batches)
+
+	var again map[string]user
+	assert.Nil(t, l.GetMulti(ctx, []string{"alice", "bob", "miss"}, &again))
+	assert.Equal(t, map[string]user{"alice": {Name: "alice"}, "bob": {Name: "bob"}}, again)
+	assert.Len(t, batches, 2)
+
+	assert.NotNil(t, l.GetMulti(ctx, []string{"alice"}, users))
+}
+
+func TestLoaderGetMultiOverlap(t *testing.T) {
+	s := newMemStore()
+	var (
+		mu      sync.Mutex
+		batches [][]string
+	)
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	l := NewLoader(testConfig, s, nil, LoaderBatch(func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+		mu.Lock()
+		batches = append(batches, keys)
+		mu.Unlock()
+		started <- struct{}{}
+		<-release
+		values := make(map[string]interface{})
+		for _, key := range keys {
+			if key != "miss" {
+				values[key] = key
+			}
+		}
+		return values, nil
+	}))
+	defer l.Close()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	getMulti := func(keys []string, want map[string]string) {
+		defer wg.Done()
+		var v map[string]string
+		assert.Nil(t, l.GetMulti(ctx, keys, &v))
+		assert.Equal(t, want, v)
+	}
+	wg.Add(1)
+	go getMulti([]string{"a", "b", "miss"}, map[string]string{"a": "a", "b": "b"})
+	<-started
+	// the keys already loading are waited, only the others are loaded.
+	wg.Add(3)
+	go getMulti([]string{"b", "c"}, map[string]string{"b": "b", "c": "c"})
+	go getMulti([]string{"miss", "a"}, map[string]string{"a": "a"})
+	go func() {
+		defer wg.Done()
+		var v string
+		assert.Nil(t, l.Get(ctx, "a", &v))
+		assert.Equal(t, "a", v)
+	}()
+	<-started
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, [][]string{{"a", "b", "miss"}, {"c"}}, batches)
+}
+
+func TestLoaderPanicWithoutLoad(t *testing.T) {
+	assert.Panics(t, func() { NewLoader(testConfig, newMemStore(), nil) })
+}
@@ -0,0 +1,152 @@
+package local
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache/redis"
+	"github.com/zombie-k/kylin/library/log"
+)
+
+const (
+	_defaultPingInterval = time.Second
+	_resubscribeInterval = time.Second
+)
+
+// Invalidator deletes the keys published on Config.Channel from a local
+// cache, so every instance drops a key written by one of them. The whole
+// cache is purged whenever the subscription is established again, as the
+// messages published meanwhile are lost.
+type Invalidator struct {
+	c *Cache
+	r *redis.Redis
+
+	ctx    context.Context
+	cancel func()
+	wg     sync.WaitGroup
+
+	mu  sync.Mutex
+	psc *redis.PubSubConn
+}
+
+// NewInvalidator subscribes Config.Channel of r for c.
+func NewInvalidator(c *Cache, r *redis.Redis) *Invalidator {
+	if c.c.Channel == "" {
+		panic("local: invalidator needs a channel")
+	}
+	i := &Invalidator{c: c, r: r}
+	i.ctx, i.cancel = context.WithCancel(context.Background())
+	i.wg.Add(1)
+	go i.serve()
+	return i
+}
+
+// Publish deletes the keys locally and publishes them to the other
+// instances.
+func (i *Invalidator) Publish(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		i.c.Delete(key)
+		if _, err := i.r.Do(ctx, "PUBLISH", i.c.c.Channel, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops the subscription.
+func (i *Invalidator) Close() error {
+	i.cancel()
+	i.mu.Lock()
+	if i.psc != nil {
+		// the reader returns on the unsubscribe reply.
+		i.psc.Unsubscribe()
+	}
+	i.mu.Unlock()
+	i.wg.Wait()
+	return nil
+}
+
+func (i *Invalidator) serve() {
+	defer i.wg.Done()
+	for {
+		err := i.subscribe()
+		if i.ctx.Err() != nil {
+			return
+		}
+		log.Warn("local: cache %s subscribe channel %s error(%v), resubscribe", i.c.c.Name, i.c.c.Channel, err)
+		select {
+		case <-time.After(_resubscribeInterval):
+		case <-i.ctx.Done():
+			return
+		}
+	}
+}
+
+// subscribe receives the messages of one subscription until it breaks.
+func (i *Invalidator) subscribe() error {
+	psc := &redis.PubSubConn{Conn: i.r.Conn(i.ctx)}
+	defer func() {
+		i.mu.Lock()
+		i.psc = nil
+		i.mu.Unlock()
+		psc.Close()
+	}()
+	i.mu.Lock()
+	if i.ctx.Err() != nil {
+		i.mu.Unlock()
+		return nil
+	}
+	i.psc = psc
+	err := psc.Subscribe(i.c.c.Channel)
+	i.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go i.ping(psc, done)
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Message:
+			i.c.Delete(string(v.Data))
+			_metricInvalidations.Inc(i.c.c.Name, "message")
+		case redis.Subscription:
+			switch v.Kind {
+			case "subscribe":
+				i.c.Purge()
+				_metricInvalidations.Inc(i.c.c.Name, "resubscribe")
+			case "unsubscribe":
+				if v.Count == 0 {
+					return nil
+				}
+			}
+		case error:
+			return v
+		}
+	}
+}
+
+// ping keeps the subscription reading within the read timeout, the sends
+// may run concurrently with the receives.
+func (i *Invalidator) ping(psc *redis.PubSubConn, done chan struct{}) {
+	interval := time.Duration(i.c.c.PingInterval)
+	if interval <= 0 {
+		interval = _defaultPingInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			i.mu.Lock()
+			err := psc.Ping("")
+			i.mu.Unlock()
+			if err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,307 @@
+// Package local is a bounded in-process cache, layered in front of memcache
+// or redis as an L1 with NewTier and invalidated through redis pub/sub with
+// NewInvalidator.
+package local
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	xtime "github.com/zombie-k/kylin/library/time"
+)
+
+const (
+	// PolicyLRU evicts the least recently used entry.
+	PolicyLRU = "lru"
+	// PolicyTinyLFU evicts the least recently used entry too, but a new
+	// entry is only admitted if it is accessed more often than the victim.
+	PolicyTinyLFU = "tinylfu"
+)
+
+// Config local cache config.
+type Config struct {
+	// Name is the cache name, for metrics.
+	Name string
+	// Policy is PolicyLRU or PolicyTinyLFU, PolicyLRU by default.
+	Policy string
+	// Size is the max number of entries.
+	Size int
+	// MaxBytes is the max total size of the keys and values, zero means no
+	// limit.
+	MaxBytes int64
+	// Expire is the ttl of entries, zero means no expiration.
+	Expire xtime.Duration
+	// Prefixes opts keys in, only the keys with one of the prefixes are held
+	// locally. Empty holds every key.
+	Prefixes []string
+
+	// Channel is the redis channel the Invalidator publishes and subscribes.
+	Channel string
+	// PingInterval is how often the Invalidator pings its subscription, it
+	// must be less than the redis ReadTimeout.
+	PingInterval xtime.Duration
+}
+
+type entry struct {
+	key      string
+	value    []byte
+	expireAt time.Time
+}
+
+func (e *entry) size() int64 {
+	return int64(len(e.key) + len(e.value))
+}
+
+// Stats local cache statistics.
+type Stats struct {
+	Hits       uint64
+	Misses     uint64
+	Evictions  uint64
+	Rejections uint64
+	Len        int
+	Bytes      int64
+}
+
+// HitRatio returns the ratio of hits to lookups.
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// Cache is a size and ttl bounded in-process cache, safe for concurrent use.
+// The values are shared and must not be modified.
+type Cache struct {
+	c *Config
+
+	mu     sync.Mutex
+	ll     *list.List
+	items  map[string]*list.Element
+	bytes  int64
+	sketch *sketch
+	stats  Stats
+	// seq counts the deletions, the fills of the keys deleted since they
+	// started are not cached.
+	seq      uint64
+	purgeSeq uint64
+	fills    map[string]*fill
+
+	now func() time.Time
+}
+
+// fill is the reads of a key from the next store in flight.
+type fill struct {
+	n   int
+	seq uint64 // of the last deletion of the key
+}
+
+// New new a local cache.
+func New(c *Config) *Cache {
+	if c.Size <= 0 {
+		panic("local: cache size should > 0")
+	}
+	cache := &Cache{
+		c:     c,
+		ll:    list.New(),
+		items: make(map[string]*list.Element, c.Size),
+		fills: make(map[string]*fill),
+		now:   time.Now,
+	}
+	switch c.Policy {
+	case "", PolicyLRU:
+	case PolicyTinyLFU:
+		cache.sketch = newSketch(c.Size)
+	default:
+		panic("local: unknown policy " + c.Policy)
+	}
+	return cache
+}
+
+// Holds reports whether key is opted in by Config.Prefixes.
+func (c *Cache) Holds(key string) bool {
+	if len(c.c.Prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range c.c.Prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the value of key.
+func (c *Cache) Get(key string) (value []byte, ok bool) {
+	c.mu.Lock()
+	if c.sketch != nil {
+		c.sketch.increment(key)
+	}
+	if el, hit := c.items[key]; hit {
+		e := el.Value.(*entry)
+		if e.expireAt.IsZero() || c.now().Before(e.expireAt) {
+			c.ll.MoveToFront(el)
+			value, ok = e.value, true
+		} else {
+			c.remove(el)
+		}
+	}
+	if ok {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+	ratio := c.stats.HitRatio()
+	c.mu.Unlock()
+	if ok {
+		_metricHits.Inc(c.c.Name)
+	} else {
+		_metricMisses.Inc(c.c.Name)
+	}
+	_metricHitRatio.Set(ratio, c.c.Name)
+	return
+}
+
+// Set stores the value of key, it reports whether the value is held: keys
+// not opted in, values larger than MaxBytes and values rejected by the
+// tinylfu admission are not.
+func (c *Cache) Set(key string, value []byte) bool {
+	e := c.newEntry(key, value)
+	if e == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.add(e)
+}
+
+// newEntry returns the entry of key, nil if it is not held.
+func (c *Cache) newEntry(key string, value []byte) *entry {
+	if !c.Holds(key) {
+		return nil
+	}
+	e := &entry{key: key, value: value}
+	if c.c.MaxBytes > 0 && e.size() > c.c.MaxBytes {
+		return nil
+	}
+	if expire := time.Duration(c.c.Expire); expire > 0 {
+		e.expireAt = c.now().Add(expire)
+	}
+	return e
+}
+
+// add stores e, c.mu is held.
+func (c *Cache) add(e *entry) bool {
+	key := e.key
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	if c.sketch != nil && c.full(e) {
+		if victim := c.ll.Back(); victim != nil && c.sketch.estimate(key) <= c.sketch.estimate(victim.Value.(*entry).key) {
+			c.stats.Rejections++
+			_metricRejections.Inc(c.c.Name)
+			return false
+		}
+	}
+	for c.full(e) {
+		c.remove(c.ll.Back())
+		c.stats.Evictions++
+		_metricEvictions.Inc(c.c.Name)
+	}
+	c.items[key] = c.ll.PushFront(e)
+	c.bytes += e.size()
+	return true
+}
+
+// beginFill starts the reads of keys from the next store, it returns the
+// sequence to end them with.
+func (c *Cache) beginFill(keys []string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		f := c.fills[key]
+		if f == nil {
+			f = &fill{}
+			c.fills[key] = f
+		}
+		f.n++
+	}
+	return c.seq
+}
+
+// endFill ends the read of key begun at seq, the value read is stored
+// unless the key was deleted or the cache purged meanwhile, as it may be
+// older than the deletion.
+func (c *Cache) endFill(key string, value []byte, ok bool, seq uint64) {
+	var e *entry
+	if ok {
+		e = c.newEntry(key, value)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := c.fills[key]
+	if e != nil && f.seq <= seq && c.purgeSeq <= seq {
+		c.add(e)
+	}
+	if f.n--; f.n == 0 {
+		delete(c.fills, key)
+	}
+}
+
+// full reports whether e does not fit without an eviction.
+func (c *Cache) full(e *entry) bool {
+	if c.ll.Len() == 0 {
+		return false
+	}
+	return c.ll.Len() >= c.c.Size || (c.c.MaxBytes > 0 && c.bytes+e.size() > c.c.MaxBytes)
+}
+
+func (c *Cache) remove(el *list.Element) {
+	e := c.ll.Remove(el).(*entry)
+	delete(c.items, e.key)
+	c.bytes -= e.size()
+}
+
+// Delete deletes key.
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	c.seq++
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	if f, ok := c.fills[key]; ok {
+		f.seq = c.seq
+	}
+	c.mu.Unlock()
+}
+
+// Purge deletes every key.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	c.seq++
+	c.purgeSeq = c.seq
+	c.ll.Init()
+	c.items = make(map[string]*list.Element, c.c.Size)
+	c.bytes = 0
+	c.mu.Unlock()
+}
+
+// Len returns the number of entries, including the expired ones not
+// evicted yet.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Stats returns the cache statistics.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Len = c.ll.Len()
+	s.Bytes = c.bytes
+	return s
+}
@@ -0,0 +1,112 @@
+package local
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	xtime "github.com/zombie-k/kylin/library/time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheLRU(t *testing.T) {
+	c := New(&Config{Name: "test_lru", Size: 2})
+	assert.True(t, c.Set("a", []byte("1")))
+	assert.True(t, c.Set("b", []byte("2")))
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.True(t, c.Set("c", []byte("3")))
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), v)
+
+	c.Delete("a")
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+	c.Purge()
+	assert.Equal(t, 0, c.Len())
+
+	s := c.Stats()
+	assert.Equal(t, uint64(2), s.Hits)
+	assert.Equal(t, uint64(2), s.Misses)
+	assert.Equal(t, uint64(1), s.Evictions)
+	assert.Equal(t, 0.5, s.HitRatio())
+}
+
+func TestCacheExpire(t *testing.T) {
+	c := New(&Config{Name: "test_expire", Size: 10, Expire: xtime.Duration(time.Second)})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	c.Set("a", []byte("1"))
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+	now = now.Add(time.Second)
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestCacheMaxBytes(t *testing.T) {
+	c := New(&Config{Name: "test_bytes", Size: 10, MaxBytes: 10})
+	assert.True(t, c.Set("a", []byte("1234")))
+	assert.True(t, c.Set("b", []byte("1234")))
+	assert.Equal(t, int64(10), c.Stats().Bytes)
+	assert.True(t, c.Set("c", []byte("1")))
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, int64(7), c.Stats().Bytes)
+	assert.False(t, c.Set("d", []byte("0123456789")))
+}
+
+func TestCachePrefixes(t *testing.T) {
+	c := New(&Config{Name: "test_prefixes", Size: 10, Prefixes: []string{"rec:", "hot:"}})
+	assert.True(t, c.Holds("rec:1"))
+	assert.False(t, c.Holds("user:1"))
+	assert.True(t, c.Set("hot:1", []byte("1")))
+	assert.False(t, c.Set("user:1", []byte("1")))
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestCacheTinyLFU(t *testing.T) {
+	c := New(&Config{Name: "test_tinylfu", Policy: PolicyTinyLFU, Size: 2})
+	for i := 0; i < 5; i++ {
+		c.Get("hot1")
+		c.Get("hot2")
+	}
+	assert.True(t, c.Set("hot1", []byte("1")))
+	assert.True(t, c.Set("hot2", []byte("2")))
+	// a key seen once does not evict the frequent ones.
+	for i := 0; i < 10; i++ {
+		assert.False(t, c.Set(fmt.Sprintf("cold%d", i), []byte("x")))
+	}
+	_, ok := c.Get("hot1")
+	assert.True(t, ok)
+	_, ok = c.Get("hot2")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(10), c.Stats().Rejections)
+
+	for i := 0; i < 10; i++ {
+		c.Get("warm")
+	}
+	assert.True(t, c.Set("warm", []byte("3")))
+	assert.Equal(t, uint64(1), c.Stats().Evictions)
+}
+
+func TestCachePanic(t *testing.T) {
+	assert.Panics(t, func() { New(&Config{}) })
+	assert.Panics(t, func() { New(&Config{Size: 1, Policy: "fifo"}) })
+}
+
+func TestSketch(t *testing.T) {
+	s := newSketch(16)
+	for i := 0; i < 20; i++ {
+		s.increment("a")
+	}
+	s.increment("b")
+	assert.Equal(t, uint8(_sketchMaxCount), s.estimate("a"))
+	assert.True(t, s.estimate("b") >= 1)
+	s.halve()
+	assert.Equal(t, uint8(_sketchMaxCount/2), s.estimate("a"))
+}
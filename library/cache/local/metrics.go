@@ -0,0 +1,50 @@
+package local
+
+import "github.com/zombie-k/kylin/library/stat/metric"
+
+const namespace = "cache_local"
+
+var (
+	_metricHits = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "",
+		Name:      "hits_total",
+		Help:      "local cache hits total.",
+		Labels:    []string{"name"},
+	})
+	_metricMisses = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "",
+		Name:      "misses_total",
+		Help:      "local cache misses total.",
+		Labels:    []string{"name"},
+	})
+	_metricEvictions = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "",
+		Name:      "evictions_total",
+		Help:      "local cache evictions total.",
+		Labels:    []string{"name"},
+	})
+	_metricRejections = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "",
+		Name:      "rejections_total",
+		Help:      "local cache entries rejected by the tinylfu admission total.",
+		Labels:    []string{"name"},
+	})
+	_metricHitRatio = metric.NewGaugeVec(&metric.GaugeVecOpts{
+		Namespace: namespace,
+		Subsystem: "",
+		Name:      "hit_ratio",
+		Help:      "local cache hit ratio since start.",
+		Labels:    []string{"name"},
+	})
+	_metricInvalidations = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "",
+		Name:      "invalidations_total",
+		Help:      "local cache invalidations total by source: message or resubscribe.",
+		Labels:    []string{"name", "source"},
+	})
+)
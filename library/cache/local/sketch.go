@@ -0,0 +1,36 @@
+package local
+
+import "github.com/zombie-k/kylin/library/cache/internal/cmsketch"
+
+// _sketchMaxCount saturates the counters, tinylfu only compares small
+// frequencies.
+const _sketchMaxCount = 15
+
+// sketch estimates the access frequency of keys for the tinylfu admission.
+// The counters are halved every reset additions so the old frequencies fade
+// out.
+type sketch struct {
+	cm        *cmsketch.CountMin
+	additions int
+	reset     int
+}
+
+func newSketch(size int) *sketch {
+	return &sketch{cm: cmsketch.New(size, _sketchMaxCount), reset: 10 * size}
+}
+
+func (s *sketch) increment(key string) {
+	s.cm.Add(key)
+	if s.additions++; s.additions >= s.reset {
+		s.halve()
+	}
+}
+
+func (s *sketch) estimate(key string) uint8 {
+	return uint8(s.cm.Estimate(key))
+}
+
+func (s *sketch) halve() {
+	s.cm.Halve()
+	s.additions /= 2
+}
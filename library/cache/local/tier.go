@@ -0,0 +1,80 @@
+package local
+
+import (
+	"context"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache"
+)
+
+// Tier is a cache.Store reading through the local cache to next, e.g. the
+// store of memcache.NewStore or redis.NewStore.
+type Tier struct {
+	c    *Cache
+	next cache.Store
+	inv  *Invalidator
+}
+
+// NewTier new a tier of c in front of next. The writes are published through
+// inv so the other instances drop the key, inv may be nil for a single
+// instance.
+func NewTier(c *Cache, next cache.Store, inv *Invalidator) *Tier {
+	return &Tier{c: c, next: next, inv: inv}
+}
+
+// GetMulti reads the keys held locally first and the rest from next.
+func (t *Tier) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	values := make(map[string][]byte, len(keys))
+	var missed []string
+	for _, key := range keys {
+		if t.c.Holds(key) {
+			if value, ok := t.c.Get(key); ok {
+				values[key] = value
+				continue
+			}
+		}
+		missed = append(missed, key)
+	}
+	if len(missed) == 0 {
+		return values, nil
+	}
+	// a key invalidated while it is read may be read before its write, it
+	// is not cached.
+	seq := t.c.beginFill(missed)
+	nexts, err := t.next.GetMulti(ctx, missed)
+	for _, key := range missed {
+		value, ok := nexts[key]
+		t.c.endFill(key, value, ok && err == nil, seq)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range nexts {
+		values[key] = value
+	}
+	return values, nil
+}
+
+// Set writes next and invalidates key.
+func (t *Tier) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := t.next.Set(ctx, key, value, ttl); err != nil {
+		return err
+	}
+	return t.invalidate(ctx, key)
+}
+
+// Delete deletes key from next and invalidates it.
+func (t *Tier) Delete(ctx context.Context, key string) error {
+	if err := t.next.Delete(ctx, key); err != nil {
+		return err
+	}
+	return t.invalidate(ctx, key)
+}
+
+func (t *Tier) invalidate(ctx context.Context, key string) error {
+	if t.inv != nil {
+		return t.inv.Publish(ctx, key)
+	}
+	t.c.Delete(key)
+	return nil
+}
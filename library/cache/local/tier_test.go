@@ -0,0 +1,119 @@
+package local
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memStore struct {
+	data  map[string][]byte
+	reads int
+}
+
+func (s *memStore) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	values := make(map[string][]byte)
+	for _, key := range keys {
+		s.reads++
+		if v, ok := s.data[key]; ok {
+			values[key] = v
+		}
+	}
+	return values, nil
+}
+
+func (s *memStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.data[key] = value
+	return nil
+}
+
+func (s *memStore) Delete(ctx context.Context, key string) error {
+	delete(s.data, key)
+	return nil
+}
+
+func TestTier(t *testing.T) {
+	next := &memStore{data: map[string][]byte{"hot:1": []byte("1"), "cold:1": []byte("2")}}
+	tier := NewTier(New(&Config{Name: "test_tier", Size: 10, Prefixes: []string{"hot:"}}), next, nil)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		values, err := tier.GetMulti(ctx, []string{"hot:1", "cold:1", "miss"})
+		assert.Nil(t, err)
+		assert.Equal(t, map[string][]byte{"hot:1": []byte("1"), "cold:1": []byte("2")}, values)
+	}
+	// hot:1 is read from next once, the others every time.
+	assert.Equal(t, 7, next.reads)
+
+	assert.Nil(t, tier.Set(ctx, "hot:1", []byte("3"), 0))
+	values, err := tier.GetMulti(ctx, []string{"hot:1"})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("3"), values["hot:1"])
+	assert.Nil(t, tier.Delete(ctx, "hot:1"))
+	values, err = tier.GetMulti(ctx, []string{"hot:1"})
+	assert.Nil(t, err)
+	assert.Empty(t, values)
+}
+
+// slowStore blocks its reads after reading until released.
+type slowStore struct {
+	*memStore
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (s *slowStore) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	values, err := s.memStore.GetMulti(ctx, keys)
+	s.read <- struct{}{}
+	<-s.release
+	return values, err
+}
+
+func TestTierInvalidateWhileReading(t *testing.T) {
+	next := &slowStore{
+		memStore: &memStore{data: map[string][]byte{"a": []byte("1")}},
+		read:     make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	tier := NewTier(New(&Config{Name: "test_tier", Size: 10}), next, nil)
+	ctx := context.Background()
+	get := func() chan map[string][]byte {
+		ch := make(chan map[string][]byte, 1)
+		go func() {
+			values, err := tier.GetMulti(ctx, []string{"a"})
+			assert.Nil(t, err)
+			ch <- values
+		}()
+		return ch
+	}
+
+	// a write invalidating the key while its old value is read.
+	ch := get()
+	<-next.read
+	assert.Nil(t, tier.Set(ctx, "a", []byte("2"), 0))
+	next.release <- struct{}{}
+	assert.Equal(t, []byte("1"), (<-ch)["a"])
+	_, ok := tier.c.Get("a")
+	assert.False(t, ok)
+
+	// a purge while reading.
+	ch = get()
+	<-next.read
+	tier.c.Purge()
+	next.release <- struct{}{}
+	<-ch
+	_, ok = tier.c.Get("a")
+	assert.False(t, ok)
+
+	// an undisturbed read is cached.
+	ch = get()
+	<-next.read
+	next.release <- struct{}{}
+	<-ch
+	value, ok := tier.c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("2"), value)
+	assert.Empty(t, tier.c.fills)
+}
@@ -27,6 +27,9 @@ var (
 	replyTouched           = []byte("TOUCHED\r\n")
 	replyClientErrorPrefix = []byte("CLIENT_ERROR ")
 	replyServerErrorPrefix = []byte("SERVER_ERROR ")
+	replyError             = []byte("ERROR")
+	replyStatPrefix        = []byte("STAT ")
+	replyVersionPrefix     = []byte("VERSION ")
 )
 
 var (
@@ -239,6 +242,108 @@ func (c *asiiConn) IncrDecr(ctx context.Context, cmd, key string, delta uint64)
 	return val, nil
 }
 
+// IncrDecrInitial emulates the binary protocol incr/decr with initial value,
+// the key is created by add when missing, an add lost to a concurrent writer
+// falls back to incr/decr again.
+func (c *asiiConn) IncrDecrInitial(ctx context.Context, cmd, key string, delta, initial uint64, expiration int32) (uint64, error) {
+	val, err := c.IncrDecr(ctx, cmd, key, delta)
+	if err != ErrNotFound {
+		return val, err
+	}
+	err = c.Populate(ctx, "add", key, 0, expiration, 0, []byte(strconv.FormatUint(initial, 10)))
+	if err == nil {
+		return initial, nil
+	}
+	if err != ErrNotStored {
+		return 0, err
+	}
+	return c.IncrDecr(ctx, cmd, key, delta)
+}
+
+// GetAndTouch uses gats, which unlike gat returns the cas of the items.
+func (c *asiiConn) GetAndTouch(ctx context.Context, expire int32, keys ...string) (map[string]*Item, error) {
+	c.conn.SetWriteDeadline(shrinkDeadline(ctx, c.writeTimeout))
+	if _, err := fmt.Fprintf(c.rw, "gats %d %s\r\n", expire, strings.Join(keys, " ")); err != nil {
+		return nil, c.fatal(err)
+	}
+	if err := c.rw.Flush(); err != nil {
+		return nil, c.fatal(err)
+	}
+	results := make(map[string]*Item, len(keys))
+	if err := c.parseGetReply(ctx, func(it *Item) {
+		results[it.Key] = it
+	}); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (c *asiiConn) Stats(ctx context.Context, args string) (map[string]string, error) {
+	cmd := "stats\r\n"
+	if args != "" {
+		cmd = "stats " + args + "\r\n"
+	}
+	line, err := c.writeReadLine(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[string]string)
+	for {
+		switch {
+		case bytes.Equal(line, replyEnd):
+			return stats, nil
+		case bytes.HasPrefix(line, replyStatPrefix):
+			// STAT <name> <value>\r\n
+			fields := strings.SplitN(strings.TrimSpace(string(line[len(replyStatPrefix):])), " ", 2)
+			if len(fields) != 2 {
+				return nil, c.fatal(protocolError(fmt.Sprintf("corrupt stats reply %q", line)))
+			}
+			stats[fields[0]] = fields[1]
+		default:
+			// an error reply comes before any STAT line.
+			return nil, pkgerr.WithStack(protocolError(bytes.TrimSpace(line)))
+		}
+		if line, err = c.rw.ReadSlice('\n'); err != nil {
+			return nil, c.fatal(err)
+		}
+	}
+}
+
+func (c *asiiConn) Version(ctx context.Context) (string, error) {
+	line, err := c.writeReadLine(ctx, "version\r\n")
+	if err != nil {
+		return "", err
+	}
+	if !bytes.HasPrefix(line, replyVersionPrefix) {
+		return "", pkgerr.WithStack(protocolError(bytes.TrimSpace(line)))
+	}
+	return string(bytes.TrimSpace(line[len(replyVersionPrefix):])), nil
+}
+
+func (c *asiiConn) FlushAll(ctx context.Context, delay int32) error {
+	var (
+		line []byte
+		err  error
+	)
+	if delay > 0 {
+		line, err = c.writeReadLine(ctx, "flush_all %d\r\n", delay)
+	} else {
+		line, err = c.writeReadLine(ctx, "flush_all\r\n")
+	}
+	if err != nil {
+		return err
+	}
+	return replyToError(line)
+}
+
+func (c *asiiConn) Verbosity(ctx context.Context, level uint32) error {
+	line, err := c.writeReadLine(ctx, "verbosity %d\r\n", level)
+	if err != nil {
+		return err
+	}
+	return replyToError(line)
+}
+
 func (c *asiiConn) Delete(ctx context.Context, key string) error {
 	line, err := c.writeReadLine(ctx, "delete %s\r\n", key)
 	if err != nil {
@@ -0,0 +1,248 @@
+package memcache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	pkgerr "github.com/pkg/errors"
+)
+
+// meta command return codes.
+const (
+	metaValue    = "VA"
+	metaHit      = "HD"
+	metaMiss     = "EN"
+	metaNotStore = "NS"
+	metaExists   = "EX"
+	metaNotFound = "NF"
+)
+
+type metaReply struct {
+	code  string
+	flags []string
+	value []byte
+}
+
+// flag returns the token of the return flag f.
+func (r *metaReply) flag(f byte) (string, bool) {
+	for _, fl := range r.flags {
+		if fl[0] == f {
+			return fl[1:], true
+		}
+	}
+	return "", false
+}
+
+func (r *metaReply) toError() error {
+	switch r.code {
+	case metaValue, metaHit:
+		return nil
+	case metaMiss, metaNotFound:
+		return ErrNotFound
+	case metaNotStore:
+		return ErrNotStored
+	case metaExists:
+		return ErrCASConflict
+	}
+	return pkgerr.WithStack(protocolError(r.code))
+}
+
+// metaRoundTrip sends a meta command line and data, and reads its reply.
+func (c *asiiConn) metaRoundTrip(ctx context.Context, line string, data []byte) (*metaReply, error) {
+	c.conn.SetWriteDeadline(shrinkDeadline(ctx, c.writeTimeout))
+	if _, err := c.rw.WriteString(line); err != nil {
+		return nil, c.fatal(err)
+	}
+	if data != nil {
+		c.rw.Write(data)
+		c.rw.Write(crlf)
+	}
+	if err := c.rw.Flush(); err != nil {
+		return nil, c.fatal(err)
+	}
+	c.conn.SetReadDeadline(shrinkDeadline(ctx, c.readTimeout))
+	l, err := c.rw.ReadSlice('\n')
+	if err != nil {
+		return nil, c.fatal(err)
+	}
+	if bytes.HasPrefix(l, replyClientErrorPrefix) || bytes.HasPrefix(l, replyServerErrorPrefix) || bytes.HasPrefix(l, replyError) {
+		if data != nil {
+			// the server may have rejected the line before reading the data
+			// block, which it then parses as commands.
+			return nil, c.fatal(protocolError(bytes.TrimSpace(l)))
+		}
+		return nil, pkgerr.WithStack(protocolError(bytes.TrimSpace(l)))
+	}
+	fields := strings.Fields(string(l))
+	if len(fields) == 0 {
+		return nil, c.fatal(protocolError("corrupt meta reply, empty line"))
+	}
+	r := &metaReply{code: fields[0], flags: fields[1:]}
+	switch r.code {
+	case metaValue:
+		if len(r.flags) == 0 {
+			return nil, c.fatal(protocolError("corrupt meta reply, no value size"))
+		}
+		size, err := strconv.Atoi(r.flags[0])
+		if err != nil {
+			return nil, c.fatal(protocolError("corrupt meta reply, bad value size"))
+		}
+		r.flags = r.flags[1:]
+		r.value = make([]byte, size+2)
+		if _, err = io.ReadFull(c.rw, r.value); err != nil {
+			return nil, c.fatal(err)
+		}
+		if !bytes.HasSuffix(r.value, crlf) {
+			return nil, c.fatal(protocolError("corrupt meta reply, no except CRLF"))
+		}
+		r.value = r.value[:size]
+	case metaHit, metaMiss, metaNotStore, metaExists, metaNotFound:
+	default:
+		return nil, c.fatal(protocolError(fmt.Sprintf("unexpected meta reply %q", l)))
+	}
+	return r, nil
+}
+
+func (c *asiiConn) MetaGet(ctx context.Context, key string, opts *MetaGetOptions) (*Item, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "mg %s f c t l", key)
+	if !opts.NoValue {
+		b.WriteString(" v")
+	}
+	if opts.Touch {
+		fmt.Fprintf(&b, " T%d", opts.TTL)
+	}
+	if opts.Vivify {
+		fmt.Fprintf(&b, " N%d", opts.VivifyTTL)
+	}
+	if opts.Recache > 0 {
+		fmt.Fprintf(&b, " R%d", opts.Recache)
+	}
+	if opts.Base64Key {
+		b.WriteString(" b")
+	}
+	b.Write(crlf)
+	r, err := c.metaRoundTrip(ctx, b.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.toError(); err != nil {
+		return nil, err
+	}
+	it := &Item{Key: key, Value: r.value}
+	for _, fl := range r.flags {
+		switch fl[0] {
+		case 'f':
+			flags, e := strconv.ParseUint(fl[1:], 10, 32)
+			it.Flags, err = uint32(flags), e
+		case 'c':
+			it.cas, err = strconv.ParseUint(fl[1:], 10, 64)
+		case 't':
+			var ttl int64
+			ttl, err = strconv.ParseInt(fl[1:], 10, 32)
+			it.TTLRemaining = int32(ttl)
+		case 'l':
+			var la int64
+			la, err = strconv.ParseInt(fl[1:], 10, 32)
+			it.LastAccess = int32(la)
+		case 'W':
+			it.Won = true
+		case 'X':
+			it.Stale = true
+		case 'Z':
+			it.Recaching = true
+		}
+		if err != nil {
+			return nil, c.fatal(protocolError(fmt.Sprintf("corrupt meta reply, bad flag %q", fl)))
+		}
+	}
+	return it, nil
+}
+
+func (c *asiiConn) MetaSet(ctx context.Context, key string, item *Item, flags uint32, data []byte, opts *MetaSetOptions) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ms %s %d c F%d T%d", key, len(data), flags, item.Expiration)
+	if opts.Mode != "" {
+		fmt.Fprintf(&b, " M%s", opts.Mode)
+	}
+	if opts.CompareAndSwap {
+		fmt.Fprintf(&b, " C%d", item.cas)
+	}
+	if opts.Invalidate {
+		b.WriteString(" I")
+	}
+	if opts.Base64Key {
+		b.WriteString(" b")
+	}
+	b.Write(crlf)
+	r, err := c.metaRoundTrip(ctx, b.String(), data)
+	if err != nil {
+		return err
+	}
+	if err = r.toError(); err != nil {
+		return err
+	}
+	if cas, ok := r.flag('c'); ok {
+		item.cas, _ = strconv.ParseUint(cas, 10, 64)
+	}
+	return nil
+}
+
+func (c *asiiConn) MetaDelete(ctx context.Context, key string, opts *MetaDeleteOptions) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "md %s", key)
+	if opts.Invalidate {
+		b.WriteString(" I")
+		if opts.TTL != 0 {
+			fmt.Fprintf(&b, " T%d", opts.TTL)
+		}
+	}
+	if opts.Base64Key {
+		b.WriteString(" b")
+	}
+	b.Write(crlf)
+	r, err := c.metaRoundTrip(ctx, b.String(), nil)
+	if err != nil {
+		return err
+	}
+	return r.toError()
+}
+
+func (c *asiiConn) MetaArithmetic(ctx context.Context, key string, opts *MetaArithmeticOptions) (uint64, error) {
+	var b strings.Builder
+	delta := opts.Delta
+	if delta == 0 {
+		delta = 1
+	}
+	mode := "I"
+	if opts.Decrement {
+		mode = "D"
+	}
+	fmt.Fprintf(&b, "ma %s v M%s D%d", key, mode, delta)
+	if opts.Vivify {
+		fmt.Fprintf(&b, " N%d J%d", opts.VivifyTTL, opts.Initial)
+	}
+	if opts.Touch {
+		fmt.Fprintf(&b, " T%d", opts.TTL)
+	}
+	if opts.Base64Key {
+		b.WriteString(" b")
+	}
+	b.Write(crlf)
+	r, err := c.metaRoundTrip(ctx, b.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	if err = r.toError(); err != nil {
+		return 0, err
+	}
+	val, err := strconv.ParseUint(string(r.value), 10, 64)
+	if err != nil {
+		return 0, pkgerr.WithStack(protocolError("corrupt meta arithmetic reply"))
+	}
+	return val, nil
+}
@@ -0,0 +1,148 @@
+package memcache
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// scriptedServer replies to every request line with the next reply of
+// script, recording the requests, data blocks of ms and storage commands
+// are skipped.
+func scriptedServer(t *testing.T, script []string) (protocolConn, *[]string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reqs []string
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		br := bufio.NewReader(conn)
+		for _, reply := range script {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSuffix(line, "\r\n")
+			reqs = append(reqs, line)
+			switch fields := strings.Fields(line); fields[0] {
+			case "ms":
+				n, _ := strconv.Atoi(fields[2])
+				io.CopyN(io.Discard, br, int64(n+2))
+			case "set", "add", "replace", "cas":
+				n, _ := strconv.Atoi(fields[4])
+				io.CopyN(io.Discard, br, int64(n+2))
+			}
+			conn.Write([]byte(reply))
+		}
+	}()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pconn, err := newASCIIConn(client, time.Second, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pconn, &reqs
+}
+
+func TestASCIIConnMetaGet(t *testing.T) {
+	c, reqs := scriptedServer(t, []string{
+		"VA 2 f1 c5 t30 l2 W\r\nhi\r\n",
+		"EN\r\n",
+		"HD f0 c6 t-1 l0 Z\r\n",
+		"SERVER_ERROR out of memory\r\n",
+	})
+	defer c.Close()
+	ctx := context.Background()
+
+	it, err := c.MetaGet(ctx, "test", &MetaGetOptions{Recache: 30})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hi"), it.Value)
+	assert.Equal(t, uint32(1), it.Flags)
+	assert.Equal(t, uint64(5), it.cas)
+	assert.Equal(t, int32(30), it.TTLRemaining)
+	assert.Equal(t, int32(2), it.LastAccess)
+	assert.True(t, it.Won)
+	assert.False(t, it.Stale)
+
+	_, err = c.MetaGet(ctx, "test", &MetaGetOptions{})
+	assert.Equal(t, ErrNotFound, err)
+
+	it, err = c.MetaGet(ctx, "test", &MetaGetOptions{NoValue: true, Vivify: true, VivifyTTL: 10, Touch: true, TTL: 60})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(-1), it.TTLRemaining)
+	assert.True(t, it.Recaching)
+
+	_, err = c.MetaGet(ctx, "test", &MetaGetOptions{})
+	assert.NotNil(t, err)
+	assert.Nil(t, c.Err())
+
+	assert.Equal(t, []string{
+		"mg test f c t l v R30",
+		"mg test f c t l v",
+		"mg test f c t l T60 N10",
+		"mg test f c t l v",
+	}, *reqs)
+}
+
+func TestASCIIConnMetaSetDelete(t *testing.T) {
+	c, reqs := scriptedServer(t, []string{
+		"HD c9\r\n",
+		"EX\r\n",
+		"NS\r\n",
+		"HD\r\n",
+		"NF\r\n",
+		"VA 2\r\n11\r\n",
+		"CLIENT_ERROR bad data chunk\r\n",
+	})
+	defer c.Close()
+	ctx := context.Background()
+
+	item := &Item{Key: "test", Flags: 2, Expiration: 60}
+	assert.Nil(t, c.MetaSet(ctx, "test", item, item.Flags, []byte("hi"), &MetaSetOptions{}))
+	assert.Equal(t, uint64(9), item.cas)
+	assert.Equal(t, ErrCASConflict, c.MetaSet(ctx, "test", item, item.Flags, []byte("hi"), &MetaSetOptions{CompareAndSwap: true, Invalidate: true}))
+	assert.Equal(t, ErrNotStored, c.MetaSet(ctx, "dGVzdA==", item, item.Flags, []byte("hi"), &MetaSetOptions{Mode: MetaModeAdd, Base64Key: true}))
+	assert.Nil(t, c.MetaDelete(ctx, "test", &MetaDeleteOptions{Invalidate: true, TTL: 30}))
+	assert.Equal(t, ErrNotFound, c.MetaDelete(ctx, "test", &MetaDeleteOptions{}))
+	v, err := c.MetaArithmetic(ctx, "test", &MetaArithmeticOptions{Delta: 2, Vivify: true, Initial: 9})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(11), v)
+	// an error of a set may leave its data unread, the conn is unusable.
+	assert.NotNil(t, c.MetaSet(ctx, "test", item, item.Flags, []byte("hi"), &MetaSetOptions{}))
+	assert.NotNil(t, c.Err())
+
+	assert.Equal(t, []string{
+		"ms test 2 c F2 T60",
+		"ms test 2 c F2 T60 C9 I",
+		"ms dGVzdA== 2 c F2 T60 ME b",
+		"md test I T30",
+		"md test",
+		"ma test v MI D2 N0 J9",
+		"ms test 2 c F2 T60",
+	}, *reqs)
+}
+
+func TestMetaKey(t *testing.T) {
+	key, ok := metaKey("hello world", true)
+	assert.True(t, ok)
+	assert.Equal(t, "aGVsbG8gd29ybGQ=", key)
+	_, ok = metaKey("hello world", false)
+	assert.False(t, ok)
+	_, ok = metaKey("", true)
+	assert.False(t, ok)
+}
@@ -0,0 +1,426 @@
+package memcache
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+
+	pkgerr "github.com/pkg/errors"
+)
+
+// Binary protocol reference: https://github.com/memcached/memcached/wiki/BinaryProtocolRevamped
+const (
+	_binaryMagicReq  = 0x80
+	_binaryMagicRes  = 0x81
+	_binaryHeaderLen = 24
+	// _binaryNoCreate expiration makes incr/decr fail on missing keys.
+	_binaryNoCreate = 0xffffffff
+)
+
+const (
+	opGet       = 0x00
+	opSet       = 0x01
+	opAdd       = 0x02
+	opReplace   = 0x03
+	opDelete    = 0x04
+	opIncrement = 0x05
+	opDecrement = 0x06
+	opFlush     = 0x08
+	opNoop      = 0x0a
+	opVersion   = 0x0b
+	opGetKQ     = 0x0d
+	opStat      = 0x10
+	opVerbosity = 0x1b
+	opTouch     = 0x1c
+	opGATKQ     = 0x24
+)
+
+const (
+	statusOK            = 0x0000
+	statusKeyNotFound   = 0x0001
+	statusKeyExists     = 0x0002
+	statusValueTooLarge = 0x0003
+	statusItemNotStored = 0x0005
+)
+
+var _ protocolConn = &binaryConn{}
+
+// binaryConn is the low-level implementation of Conn over the binary protocol.
+type binaryConn struct {
+	err  error
+	conn net.Conn
+	// Read & Write
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	rw           *bufio.ReadWriter
+	// header scratch space.
+	hdr [_binaryHeaderLen]byte
+}
+
+type binaryResponse struct {
+	opcode byte
+	status uint16
+	opaque uint32
+	cas    uint64
+	extras []byte
+	key    []byte
+	value  []byte
+}
+
+// newBinaryConn returns a new memcache connection for the given net connection.
+func newBinaryConn(netConn net.Conn, readTimeout, writeTimeout time.Duration) (protocolConn, error) {
+	if writeTimeout <= 0 || readTimeout <= 0 {
+		return nil, pkgerr.Errorf("readTimeout writeTimeout can't be zero")
+	}
+	c := &binaryConn{
+		conn: netConn,
+		rw: bufio.NewReadWriter(bufio.NewReader(netConn),
+			bufio.NewWriter(netConn)),
+		readTimeout:  readTimeout,
+		writeTimeout: writeTimeout,
+	}
+	return c, nil
+}
+
+func (c *binaryConn) Close() error {
+	if c.err == nil {
+		c.err = pkgerr.New("memcache: closed")
+	}
+	return c.conn.Close()
+}
+
+func (c *binaryConn) fatal(err error) error {
+	if c.err == nil {
+		c.err = pkgerr.WithStack(err)
+		// Close connection to force errors on subsequent calls and to unblock
+		// other reader or writer.
+		c.conn.Close()
+	}
+	return c.err
+}
+
+func (c *binaryConn) Err() error {
+	return c.err
+}
+
+// statusToError maps a response status to the errors returned by the ascii
+// protocol for the same command.
+func statusToError(cmd string, res *binaryResponse) error {
+	switch res.status {
+	case statusOK:
+		return nil
+	case statusKeyNotFound:
+		if cmd == "replace" {
+			return ErrNotStored
+		}
+		return ErrNotFound
+	case statusKeyExists:
+		if cmd == "cas" {
+			return ErrCASConflict
+		}
+		return ErrNotStored
+	case statusItemNotStored:
+		return ErrNotStored
+	case statusValueTooLarge:
+		return ErrValueSize
+	}
+	return pkgerr.WithStack(protocolError(res.value))
+}
+
+func (c *binaryConn) writeRequest(opcode byte, key string, extras, value []byte, opaque uint32, cas uint64) error {
+	c.hdr[0] = _binaryMagicReq
+	c.hdr[1] = opcode
+	binary.BigEndian.PutUint16(c.hdr[2:4], uint16(len(key)))
+	c.hdr[4] = byte(len(extras))
+	// data type and vbucket id are unused.
+	c.hdr[5], c.hdr[6], c.hdr[7] = 0, 0, 0
+	binary.BigEndian.PutUint32(c.hdr[8:12], uint32(len(extras)+len(key)+len(value)))
+	binary.BigEndian.PutUint32(c.hdr[12:16], opaque)
+	binary.BigEndian.PutUint64(c.hdr[16:24], cas)
+	c.rw.Write(c.hdr[:])
+	c.rw.Write(extras)
+	c.rw.WriteString(key)
+	if _, err := c.rw.Write(value); err != nil {
+		return c.fatal(err)
+	}
+	return nil
+}
+
+func (c *binaryConn) flush(ctx context.Context) error {
+	c.conn.SetWriteDeadline(shrinkDeadline(ctx, c.writeTimeout))
+	if err := c.rw.Flush(); err != nil {
+		return c.fatal(err)
+	}
+	c.conn.SetReadDeadline(shrinkDeadline(ctx, c.readTimeout))
+	return nil
+}
+
+func (c *binaryConn) readResponse() (*binaryResponse, error) {
+	if _, err := io.ReadFull(c.rw, c.hdr[:]); err != nil {
+		return nil, c.fatal(err)
+	}
+	if c.hdr[0] != _binaryMagicRes {
+		return nil, c.fatal(protocolError("corrupt binary reply, bad magic"))
+	}
+	res := &binaryResponse{
+		opcode: c.hdr[1],
+		status: binary.BigEndian.Uint16(c.hdr[6:8]),
+		opaque: binary.BigEndian.Uint32(c.hdr[12:16]),
+		cas:    binary.BigEndian.Uint64(c.hdr[16:24]),
+	}
+	keyLen := int(binary.BigEndian.Uint16(c.hdr[2:4]))
+	extLen := int(c.hdr[4])
+	bodyLen := int(binary.BigEndian.Uint32(c.hdr[8:12]))
+	if extLen+keyLen > bodyLen {
+		return nil, c.fatal(protocolError("corrupt binary reply, bad body length"))
+	}
+	body := make([]byte, bodyLen)
+	if _, err := io.ReadFull(c.rw, body); err != nil {
+		return nil, c.fatal(err)
+	}
+	res.extras = body[:extLen]
+	res.key = body[extLen : extLen+keyLen]
+	res.value = body[extLen+keyLen:]
+	return res, nil
+}
+
+// roundTrip sends a single request and reads its response.
+func (c *binaryConn) roundTrip(ctx context.Context, opcode byte, key string, extras, value []byte, cas uint64) (*binaryResponse, error) {
+	if err := c.writeRequest(opcode, key, extras, value, 0, cas); err != nil {
+		return nil, err
+	}
+	if err := c.flush(ctx); err != nil {
+		return nil, err
+	}
+	return c.readResponse()
+}
+
+func (c *binaryConn) Populate(ctx context.Context, cmd string, key string, flags uint32, expiration int32, cas uint64, data []byte) error {
+	var opcode byte
+	switch cmd {
+	case "set":
+		opcode, cas = opSet, 0
+	case "cas":
+		opcode = opSet
+	case "add":
+		opcode, cas = opAdd, 0
+	case "replace":
+		opcode, cas = opReplace, 0
+	default:
+		return pkgerr.Errorf("memcache: unknown populate command %s", cmd)
+	}
+	var extras [8]byte
+	binary.BigEndian.PutUint32(extras[0:4], flags)
+	binary.BigEndian.PutUint32(extras[4:8], uint32(expiration))
+	res, err := c.roundTrip(ctx, opcode, key, extras[:], data, cas)
+	if err != nil {
+		return err
+	}
+	return statusToError(cmd, res)
+}
+
+func (c *binaryConn) Get(ctx context.Context, key string) (*Item, error) {
+	res, err := c.roundTrip(ctx, opGet, key, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err = statusToError(keyWordGet, res); err != nil {
+		return nil, err
+	}
+	return responseItem(key, res)
+}
+
+func (c *binaryConn) GetMulti(ctx context.Context, keys ...string) (map[string]*Item, error) {
+	return c.getQuiet(ctx, opGetKQ, nil, keys)
+}
+
+func (c *binaryConn) GetAndTouch(ctx context.Context, expire int32, keys ...string) (map[string]*Item, error) {
+	var extras [4]byte
+	binary.BigEndian.PutUint32(extras[:], uint32(expire))
+	return c.getQuiet(ctx, opGATKQ, extras[:], keys)
+}
+
+// getQuiet sends a quiet get of opcode per key, quiet gets only reply on
+// hit, the trailing noop marks the end.
+func (c *binaryConn) getQuiet(ctx context.Context, opcode byte, extras []byte, keys []string) (map[string]*Item, error) {
+	for i, key := range keys {
+		if err := c.writeRequest(opcode, key, extras, nil, uint32(i), 0); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.writeRequest(opNoop, "", nil, nil, uint32(len(keys)), 0); err != nil {
+		return nil, err
+	}
+	if err := c.flush(ctx); err != nil {
+		return nil, err
+	}
+	var firstErr error
+	results := make(map[string]*Item, len(keys))
+	for {
+		res, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if res.opcode == opNoop {
+			break
+		}
+		if int(res.opaque) >= len(keys) {
+			return nil, c.fatal(protocolError("corrupt binary reply, unexpected opaque"))
+		}
+		if err = statusToError(keyWordGet, res); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		key := keys[res.opaque]
+		it, err := responseItem(key, res)
+		if err != nil {
+			return nil, c.fatal(err)
+		}
+		results[key] = it
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
+}
+
+func responseItem(key string, res *binaryResponse) (*Item, error) {
+	if len(res.extras) != 4 {
+		return nil, protocolError("corrupt get reply, no flags in extras")
+	}
+	return &Item{
+		Key:   key,
+		Value: res.value,
+		Flags: binary.BigEndian.Uint32(res.extras),
+		cas:   res.cas,
+	}, nil
+}
+
+func (c *binaryConn) Touch(ctx context.Context, key string, expire int32) error {
+	var extras [4]byte
+	binary.BigEndian.PutUint32(extras[:], uint32(expire))
+	res, err := c.roundTrip(ctx, opTouch, key, extras[:], nil, 0)
+	if err != nil {
+		return err
+	}
+	return statusToError("touch", res)
+}
+
+func (c *binaryConn) IncrDecr(ctx context.Context, cmd, key string, delta uint64) (uint64, error) {
+	return c.incrDecr(ctx, cmd, key, delta, 0, _binaryNoCreate)
+}
+
+func (c *binaryConn) IncrDecrInitial(ctx context.Context, cmd, key string, delta, initial uint64, expiration int32) (uint64, error) {
+	return c.incrDecr(ctx, cmd, key, delta, initial, uint32(expiration))
+}
+
+func (c *binaryConn) incrDecr(ctx context.Context, cmd, key string, delta, initial uint64, expiration uint32) (uint64, error) {
+	opcode := byte(opIncrement)
+	if cmd == "decr" {
+		opcode = opDecrement
+	}
+	var extras [20]byte
+	binary.BigEndian.PutUint64(extras[0:8], delta)
+	binary.BigEndian.PutUint64(extras[8:16], initial)
+	binary.BigEndian.PutUint32(extras[16:20], expiration)
+	res, err := c.roundTrip(ctx, opcode, key, extras[:], nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	if err = statusToError(cmd, res); err != nil {
+		return 0, err
+	}
+	if len(res.value) != 8 {
+		return 0, pkgerr.WithStack(protocolError("corrupt incr/decr reply"))
+	}
+	return binary.BigEndian.Uint64(res.value), nil
+}
+
+// meta commands are an ascii protocol extension.
+
+func (c *binaryConn) MetaGet(ctx context.Context, key string, opts *MetaGetOptions) (*Item, error) {
+	return nil, ErrNotSupported
+}
+
+func (c *binaryConn) MetaSet(ctx context.Context, key string, item *Item, flags uint32, data []byte, opts *MetaSetOptions) error {
+	return ErrNotSupported
+}
+
+func (c *binaryConn) MetaDelete(ctx context.Context, key string, opts *MetaDeleteOptions) error {
+	return ErrNotSupported
+}
+
+func (c *binaryConn) MetaArithmetic(ctx context.Context, key string, opts *MetaArithmeticOptions) (uint64, error) {
+	return 0, ErrNotSupported
+}
+
+// Stats reads the stat responses, the one with an empty key marks the end.
+func (c *binaryConn) Stats(ctx context.Context, args string) (map[string]string, error) {
+	if err := c.writeRequest(opStat, args, nil, nil, 0, 0); err != nil {
+		return nil, err
+	}
+	if err := c.flush(ctx); err != nil {
+		return nil, err
+	}
+	stats := make(map[string]string)
+	for {
+		res, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if err = statusToError("stats", res); err != nil {
+			return nil, err
+		}
+		if len(res.key) == 0 {
+			return stats, nil
+		}
+		stats[string(res.key)] = string(res.value)
+	}
+}
+
+func (c *binaryConn) Version(ctx context.Context) (string, error) {
+	res, err := c.roundTrip(ctx, opVersion, "", nil, nil, 0)
+	if err != nil {
+		return "", err
+	}
+	if err = statusToError("version", res); err != nil {
+		return "", err
+	}
+	return string(res.value), nil
+}
+
+func (c *binaryConn) FlushAll(ctx context.Context, delay int32) error {
+	var extras []byte
+	if delay > 0 {
+		extras = make([]byte, 4)
+		binary.BigEndian.PutUint32(extras, uint32(delay))
+	}
+	res, err := c.roundTrip(ctx, opFlush, "", extras, nil, 0)
+	if err != nil {
+		return err
+	}
+	return statusToError("flush_all", res)
+}
+
+func (c *binaryConn) Verbosity(ctx context.Context, level uint32) error {
+	var extras [4]byte
+	binary.BigEndian.PutUint32(extras[:], level)
+	res, err := c.roundTrip(ctx, opVerbosity, "", extras[:], nil, 0)
+	if err != nil {
+		return err
+	}
+	return statusToError("verbosity", res)
+}
+
+func (c *binaryConn) Delete(ctx context.Context, key string) error {
+	res, err := c.roundTrip(ctx, opDelete, key, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	return statusToError("delete", res)
+}
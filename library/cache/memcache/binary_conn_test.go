@@ -0,0 +1,226 @@
+package memcache
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type binaryTestEntry struct {
+	flags uint32
+	value []byte
+	cas   uint64
+}
+
+// serveBinary speaks a subset of the binary protocol over conn, enough to
+// exercise binaryConn.
+func serveBinary(conn net.Conn) {
+	store := make(map[string]*binaryTestEntry)
+	var cas uint64
+	hdr := make([]byte, _binaryHeaderLen)
+	write := func(opcode byte, status uint16, opaque uint32, cas uint64, extras, key, value []byte) {
+		res := make([]byte, _binaryHeaderLen)
+		res[0] = _binaryMagicRes
+		res[1] = opcode
+		binary.BigEndian.PutUint16(res[2:4], uint16(len(key)))
+		res[4] = byte(len(extras))
+		binary.BigEndian.PutUint16(res[6:8], status)
+		binary.BigEndian.PutUint32(res[8:12], uint32(len(extras)+len(key)+len(value)))
+		binary.BigEndian.PutUint32(res[12:16], opaque)
+		binary.BigEndian.PutUint64(res[16:24], cas)
+		res = append(res, extras...)
+		res = append(res, key...)
+		res = append(res, value...)
+		conn.Write(res)
+	}
+	for {
+		if _, err := io.ReadFull(conn, hdr); err != nil {
+			return
+		}
+		opcode := hdr[1]
+		keyLen := int(binary.BigEndian.Uint16(hdr[2:4]))
+		extLen := int(hdr[4])
+		body := make([]byte, binary.BigEndian.Uint32(hdr[8:12]))
+		opaque := binary.BigEndian.Uint32(hdr[12:16])
+		reqCas := binary.BigEndian.Uint64(hdr[16:24])
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+		extras, key, value := body[:extLen], string(body[extLen:extLen+keyLen]), body[extLen+keyLen:]
+		e, ok := store[key]
+		switch opcode {
+		case opSet, opAdd, opReplace:
+			switch {
+			case opcode == opAdd && ok:
+				write(opcode, statusKeyExists, opaque, 0, nil, nil, nil)
+			case opcode == opReplace && !ok, reqCas != 0 && !ok:
+				write(opcode, statusKeyNotFound, opaque, 0, nil, nil, nil)
+			case reqCas != 0 && e.cas != reqCas:
+				write(opcode, statusKeyExists, opaque, 0, nil, nil, nil)
+			default:
+				cas++
+				store[key] = &binaryTestEntry{flags: binary.BigEndian.Uint32(extras), value: value, cas: cas}
+				write(opcode, statusOK, opaque, cas, nil, nil, nil)
+			}
+		case opGet, opGetKQ, opGATKQ:
+			if !ok {
+				if opcode == opGet {
+					write(opcode, statusKeyNotFound, opaque, 0, nil, nil, []byte("Not found"))
+				}
+				continue
+			}
+			var flags [4]byte
+			binary.BigEndian.PutUint32(flags[:], e.flags)
+			var k []byte
+			if opcode != opGet {
+				k = []byte(key)
+			}
+			write(opcode, statusOK, opaque, e.cas, flags[:], k, e.value)
+		case opIncrement:
+			var val [8]byte
+			if !ok {
+				if binary.BigEndian.Uint32(extras[16:20]) == _binaryNoCreate {
+					write(opcode, statusKeyNotFound, opaque, 0, nil, nil, nil)
+					continue
+				}
+				copy(val[:], extras[8:16])
+			} else {
+				binary.BigEndian.PutUint64(val[:], binary.BigEndian.Uint64(e.value)+binary.BigEndian.Uint64(extras[0:8]))
+			}
+			cas++
+			store[key] = &binaryTestEntry{value: val[:], cas: cas}
+			write(opcode, statusOK, opaque, cas, nil, nil, val[:])
+		case opDelete, opTouch:
+			if !ok {
+				write(opcode, statusKeyNotFound, opaque, 0, nil, nil, nil)
+				continue
+			}
+			if opcode == opDelete {
+				delete(store, key)
+			}
+			write(opcode, statusOK, opaque, 0, nil, nil, nil)
+		case opNoop, opVerbosity:
+			write(opcode, statusOK, opaque, 0, nil, nil, nil)
+		case opFlush:
+			store = make(map[string]*binaryTestEntry)
+			write(opcode, statusOK, opaque, 0, nil, nil, nil)
+		case opVersion:
+			write(opcode, statusOK, opaque, 0, nil, nil, []byte("1.6.21"))
+		case opStat:
+			write(opcode, statusOK, opaque, 0, nil, []byte("pid"), []byte("1"))
+			write(opcode, statusOK, opaque, 0, nil, []byte("version"), []byte("1.6.21"))
+			write(opcode, statusOK, opaque, 0, nil, nil, nil)
+		default:
+			write(opcode, 0x81, opaque, 0, nil, nil, []byte("Unknown command"))
+		}
+	}
+}
+
+func newTestBinaryConn(t *testing.T) protocolConn {
+	// NOTE: net.Pipe has no buffer, pipelined quiet gets would deadlock.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer ln.Close()
+		if server, err := ln.Accept(); err == nil {
+			serveBinary(server)
+		}
+	}()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pconn, err := newBinaryConn(client, time.Second, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pconn
+}
+
+func TestBinaryConnPopulate(t *testing.T) {
+	c := newTestBinaryConn(t)
+	defer c.Close()
+	ctx := context.Background()
+
+	assert.Equal(t, ErrNotStored, c.Populate(ctx, "replace", "test", 0, 0, 0, []byte("0")))
+	assert.Nil(t, c.Populate(ctx, "add", "test", 1, 0, 0, []byte("0")))
+	assert.Equal(t, ErrNotStored, c.Populate(ctx, "add", "test", 1, 0, 0, []byte("0")))
+	assert.Nil(t, c.Populate(ctx, "set", "test", 2, 0, 0, []byte("1")))
+
+	it, err := c.Get(ctx, "test")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), it.Value)
+	assert.Equal(t, uint32(2), it.Flags)
+
+	assert.Equal(t, ErrCASConflict, c.Populate(ctx, "cas", "test", 0, 0, it.cas+1, []byte("2")))
+	assert.Nil(t, c.Populate(ctx, "cas", "test", 0, 0, it.cas, []byte("2")))
+	assert.Equal(t, ErrNotFound, c.Populate(ctx, "cas", "test_missing", 0, 0, 1, []byte("2")))
+
+	_, err = c.Get(ctx, "test_missing")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, c.Err())
+}
+
+func TestBinaryConnGetMulti(t *testing.T) {
+	c := newTestBinaryConn(t)
+	defer c.Close()
+	ctx := context.Background()
+
+	assert.Nil(t, c.Populate(ctx, "set", "test1", 0, 0, 0, []byte("1")))
+	assert.Nil(t, c.Populate(ctx, "set", "test3", 0, 0, 0, []byte("3")))
+	items, err := c.GetMulti(ctx, "test1", "test2", "test3")
+	assert.Nil(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, []byte("1"), items["test1"].Value)
+	assert.Equal(t, []byte("3"), items["test3"].Value)
+}
+
+func TestBinaryConnIncrDecr(t *testing.T) {
+	c := newTestBinaryConn(t)
+	defer c.Close()
+	ctx := context.Background()
+
+	_, err := c.IncrDecr(ctx, "incr", "counter", 1)
+	assert.Equal(t, ErrNotFound, err)
+	v, err := c.IncrDecrInitial(ctx, "incr", "counter", 1, 10, 60)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10), v)
+	v, err = c.IncrDecr(ctx, "incr", "counter", 5)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(15), v)
+
+	assert.Nil(t, c.Touch(ctx, "counter", 60))
+	assert.Nil(t, c.Delete(ctx, "counter"))
+	assert.Equal(t, ErrNotFound, c.Delete(ctx, "counter"))
+	assert.Equal(t, ErrNotFound, c.Touch(ctx, "counter", 60))
+}
+
+func TestBinaryConnGetAndTouchAdmin(t *testing.T) {
+	c := newTestBinaryConn(t)
+	defer c.Close()
+	ctx := context.Background()
+
+	assert.Nil(t, c.Populate(ctx, "set", "test1", 0, 0, 0, []byte("1")))
+	items, err := c.GetAndTouch(ctx, 60, "test1", "test2")
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, []byte("1"), items["test1"].Value)
+
+	stats, err := c.Stats(ctx, "")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"pid": "1", "version": "1.6.21"}, stats)
+	version, err := c.Version(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.6.21", version)
+	assert.Nil(t, c.Verbosity(ctx, 1))
+	assert.Nil(t, c.FlushAll(ctx, 0))
+	_, err = c.Get(ctx, "test1")
+	assert.Equal(t, ErrNotFound, err)
+}
@@ -0,0 +1,120 @@
+package memcache
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	// _flagCodecReserved flag bits free for registered codecs.
+	_flagCodecReserved = uint32(0x7FF0)
+	// _flagCompressReserved flag bits free for registered compressors.
+	_flagCompressReserved = uint32(0x3FFF0000)
+)
+
+// Codec encodes Item.Object into Item.Value and back, see RegisterCodec.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Compressor compresses encoded values, see RegisterCompressor.
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	_codecMu     sync.RWMutex
+	_codecs      = make(map[uint32]Codec)
+	_compressors = make(map[uint32]Compressor)
+	// _compressThresholds min value size to compress by compress flag.
+	_compressThresholds = make(map[uint32]int)
+)
+
+// RegisterCodec registers c as the codec of items whose Flags contain flag.
+// flag must be a single bit of 0x7FF0 (bits 4 to 14), the lower bits are
+// used by FlagGOB, FlagJSON, FlagProtobuf and FlagZlib. It panics if flag
+// is invalid or already registered, call it from init. Flags with several
+// registered codec bits use the codec of the lowest one.
+func RegisterCodec(flag uint32, c Codec) {
+	if !singleBit(flag, _flagCodecReserved) {
+		panic(fmt.Sprintf("memcache: codec flag %#x out of reserved bits %#x", flag, _flagCodecReserved))
+	}
+	_codecMu.Lock()
+	defer _codecMu.Unlock()
+	if _, ok := _codecs[flag]; ok {
+		panic(fmt.Sprintf("memcache: codec flag %#x registered twice", flag))
+	}
+	_codecs[flag] = c
+}
+
+// RegisterCompressor registers c as the compressor of items whose Flags
+// contain flag, values shorter than threshold bytes are stored uncompressed.
+// flag must be a single bit of 0x3FFF0000 (bits 16 to 29), FlagGzip uses
+// bit 15 and bit 30 is used for large values. It panics if flag is invalid
+// or already registered, call it from init. Flags with several registered
+// compressor bits use the compressor of the lowest one.
+func RegisterCompressor(flag uint32, c Compressor, threshold int) {
+	if !singleBit(flag, _flagCompressReserved) {
+		panic(fmt.Sprintf("memcache: compressor flag %#x out of reserved bits %#x", flag, _flagCompressReserved))
+	}
+	_codecMu.Lock()
+	defer _codecMu.Unlock()
+	if _, ok := _compressors[flag]; ok {
+		panic(fmt.Sprintf("memcache: compressor flag %#x registered twice", flag))
+	}
+	_compressors[flag] = c
+	_compressThresholds[flag] = threshold
+}
+
+// SetCompressThreshold sets the min value size compressed with flag, for
+// FlagGzip, FlagZlib or a registered compressor. Smaller values are stored
+// uncompressed with flag cleared, so they stay readable by older clients.
+func SetCompressThreshold(flag uint32, threshold int) {
+	_codecMu.Lock()
+	_compressThresholds[flag] = threshold
+	_codecMu.Unlock()
+}
+
+func singleBit(flag, reserved uint32) bool {
+	return flag != 0 && flag&(flag-1) == 0 && flag&reserved == flag
+}
+
+// lookupCodec returns the codec of the lowest registered bit of flags.
+func lookupCodec(flags uint32) Codec {
+	if flags&_flagCodecReserved == 0 {
+		return nil
+	}
+	_codecMu.RLock()
+	defer _codecMu.RUnlock()
+	for bits := flags & _flagCodecReserved; bits != 0; bits &= bits - 1 {
+		if c, ok := _codecs[bits&-bits]; ok {
+			return c
+		}
+	}
+	return nil
+}
+
+// lookupCompressor returns the compressor of the lowest registered bit of
+// flags.
+func lookupCompressor(flags uint32) (uint32, Compressor) {
+	if flags&_flagCompressReserved == 0 {
+		return 0, nil
+	}
+	_codecMu.RLock()
+	defer _codecMu.RUnlock()
+	for bits := flags & _flagCompressReserved; bits != 0; bits &= bits - 1 {
+		flag := bits & -bits
+		if c, ok := _compressors[flag]; ok {
+			return flag, c
+		}
+	}
+	return 0, nil
+}
+
+func compressThreshold(flag uint32) int {
+	_codecMu.RLock()
+	defer _codecMu.RUnlock()
+	return _compressThresholds[flag]
+}
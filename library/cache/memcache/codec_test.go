@@ -0,0 +1,116 @@
+package memcache
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testFlagCodec     = uint32(1) << 4
+	testFlagCodec2    = uint32(1) << 5
+	testFlagCompress  = uint32(1) << 16
+	testFlagCompress2 = uint32(1) << 17
+)
+
+// upperCodec stores json upper cased, so values only round trip through it.
+type upperCodec struct{}
+
+func (upperCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	return bytes.ToUpper(data), err
+}
+
+func (upperCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(bytes.ToLower(data), v)
+}
+
+// reverseCompressor reverses the value.
+type reverseCompressor struct{}
+
+func (reverseCompressor) Compress(data []byte) ([]byte, error) {
+	return reverse(data), nil
+}
+
+func (reverseCompressor) Decompress(data []byte) ([]byte, error) {
+	return reverse(data), nil
+}
+
+func reverse(data []byte) []byte {
+	r := make([]byte, len(data))
+	for i, b := range data {
+		r[len(data)-1-i] = b
+	}
+	return r
+}
+
+func init() {
+	RegisterCodec(testFlagCodec, upperCodec{})
+	RegisterCompressor(testFlagCompress, reverseCompressor{}, 8)
+	RegisterCodec(testFlagCodec2, otherCodec{})
+	RegisterCompressor(testFlagCompress2, otherCompressor{}, 0)
+}
+
+// otherCodec and otherCompressor only differ from upperCodec and
+// reverseCompressor by type, to tell which one a lookup picks.
+type otherCodec struct{ upperCodec }
+
+type otherCompressor struct{ reverseCompressor }
+
+func TestCodecLookupOrder(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, upperCodec{}, lookupCodec(testFlagCodec|testFlagCodec2))
+		flag, c := lookupCompressor(testFlagCompress | testFlagCompress2)
+		assert.Equal(t, testFlagCompress, flag)
+		assert.Equal(t, reverseCompressor{}, c)
+	}
+	assert.Equal(t, otherCodec{}, lookupCodec(testFlagCodec2|FlagJSON))
+	flag, _ := lookupCompressor(testFlagCompress2)
+	assert.Equal(t, testFlagCompress2, flag)
+	assert.Nil(t, lookupCodec(uint32(1)<<6))
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	ed := newEncodeDecoder()
+	item := &Item{Key: "test", Object: map[string]string{"key": "value"}, Flags: testFlagCodec | testFlagCompress}
+	data, flags, err := ed.encode(item)
+	assert.Nil(t, err)
+	assert.Equal(t, testFlagCodec|testFlagCompress, flags)
+	assert.Equal(t, []byte(`}"EULAV":"YEK"{`), data)
+
+	var v map[string]string
+	assert.Nil(t, ed.decode(&Item{Value: data, Flags: flags}, &v))
+	assert.Equal(t, map[string]string{"key": "value"}, v)
+}
+
+func TestCodecCompressThreshold(t *testing.T) {
+	ed := newEncodeDecoder()
+	data, flags, err := ed.encode(&Item{Value: []byte("short"), Flags: testFlagCompress})
+	assert.Nil(t, err)
+	assert.Equal(t, FlagRAW, flags)
+	assert.Equal(t, []byte("short"), data)
+
+	data, flags, err = ed.encode(&Item{Value: []byte("long enough"), Flags: testFlagCompress})
+	assert.Nil(t, err)
+	assert.Equal(t, testFlagCompress, flags)
+	var s string
+	assert.Nil(t, ed.decode(&Item{Value: data, Flags: flags}, &s))
+	assert.Equal(t, "long enough", s)
+
+	SetCompressThreshold(FlagGzip, 100)
+	defer SetCompressThreshold(FlagGzip, 0)
+	data, flags, err = ed.encode(&Item{Value: []byte("short"), Flags: FlagGzip})
+	assert.Nil(t, err)
+	assert.Equal(t, FlagRAW, flags)
+	assert.Equal(t, []byte("short"), data)
+}
+
+func TestRegisterCodecPanic(t *testing.T) {
+	assert.Panics(t, func() { RegisterCodec(testFlagCodec, upperCodec{}) })
+	assert.Panics(t, func() { RegisterCodec(FlagJSON, upperCodec{}) })
+	assert.Panics(t, func() { RegisterCodec(uint32(3)<<4, upperCodec{}) })
+	assert.Panics(t, func() { RegisterCompressor(FlagGzip, reverseCompressor{}, 0) })
+	assert.Panics(t, func() { RegisterCompressor(flagLargeValue, reverseCompressor{}, 0) })
+}
@@ -2,19 +2,12 @@ package memcache
 
 import (
 	"context"
-	"fmt"
 	"net"
-	"strconv"
 	"time"
 
 	pkgerr "github.com/pkg/errors"
 )
 
-const (
-	// 1024*1024 - 1, set error???
-	_largeValue = 1000 * 1000 // 1MB
-)
-
 // low level connection that implement memcache protocol provide basic operation.
 type protocolConn interface {
 	Populate(ctx context.Context, cmd string, key string, flags uint32, expiration int32, cas uint64, data []byte) error
@@ -22,7 +15,18 @@ type protocolConn interface {
 	GetMulti(ctx context.Context, keys ...string) (map[string]*Item, error)
 	Touch(ctx context.Context, key string, expire int32) error
 	IncrDecr(ctx context.Context, cmd, key string, delta uint64) (uint64, error)
+	IncrDecrInitial(ctx context.Context, cmd, key string, delta, initial uint64, expiration int32) (uint64, error)
 	Delete(ctx context.Context, key string) error
+	MetaGet(ctx context.Context, key string, opts *MetaGetOptions) (*Item, error)
+	MetaSet(ctx context.Context, key string, item *Item, flags uint32, data []byte, opts *MetaSetOptions) error
+	MetaDelete(ctx context.Context, key string, opts *MetaDeleteOptions) error
+	MetaArithmetic(ctx context.Context, key string, opts *MetaArithmeticOptions) (uint64, error)
+	GetAndTouch(ctx context.Context, expire int32, keys ...string) (map[string]*Item, error)
+	// Stats returns the stats by name, args selects the group, e.g. "slabs".
+	Stats(ctx context.Context, args string) (map[string]string, error)
+	Version(ctx context.Context) (string, error)
+	FlushAll(ctx context.Context, delay int32) error
+	Verbosity(ctx context.Context, level uint32) error
 	Close() error
 	Err() error
 }
@@ -61,6 +65,15 @@ func DialConnectTimeout(d time.Duration) DialOption {
 	}}
 }
 
+// DialProtocol specifies the memcache protocol spoken on the connection,
+// ProtocolASCII or ProtocolBinary. If this option is left out, then the
+// ascii protocol is used.
+func DialProtocol(protocol string) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.protocol = protocol
+	}}
+}
+
 // DialNetDial specifies a custom dial function for creating TCP
 // connections. If this option is left out, then net.Dial is
 // used. DialNetDial overrides DialConnectTimeout.
@@ -83,14 +96,28 @@ func Dial(network, address string, options ...DialOption) (Conn, error) {
 	if err != nil {
 		return nil, pkgerr.WithStack(err)
 	}
-	pconn, err := newASCIIConn(netConn, do.readTimeout, do.writeTimeout)
-	return &conn{pconn: pconn, ed: newEncodeDecoder()}, err
+	var pconn protocolConn
+	switch do.protocol {
+	case "", ProtocolASCII:
+		pconn, err = newASCIIConn(netConn, do.readTimeout, do.writeTimeout)
+	case ProtocolBinary:
+		pconn, err = newBinaryConn(netConn, do.readTimeout, do.writeTimeout)
+	default:
+		err = pkgerr.Errorf("memcache: unknown protocol %s", do.protocol)
+	}
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return &conn{pconn: pconn, ed: newEncodeDecoder()}, nil
 }
 
 type conn struct {
 	// low level connection.
 	pconn protocolConn
 	ed    *encodeDecode
+	// noMeta is set once the server rejects the meta commands.
+	noMeta bool
 }
 
 func (c *conn) Close() error {
@@ -121,31 +148,14 @@ func (c *conn) populate(ctx context.Context, cmd string, item *Item) error {
 	if !legalKey(item.Key) {
 		return ErrMalformedKey
 	}
-	data, err := c.ed.encode(item)
+	data, flags, err := c.ed.encode(item)
 	if err != nil {
 		return err
 	}
-	length := len(data)
-	if length < _largeValue {
-		return c.pconn.Populate(ctx, cmd, item.Key, item.Flags, item.Expiration, item.cas, data)
+	if len(data) < _largeValue {
+		return c.pconn.Populate(ctx, cmd, item.Key, flags, item.Expiration, item.cas, data)
 	}
-	count := length/_largeValue + 1
-	if err = c.pconn.Populate(ctx, cmd, item.Key, item.Flags|flagLargeValue, item.Expiration, item.cas, []byte(strconv.Itoa(length))); err != nil {
-		return err
-	}
-	var chunk []byte
-	for i := 1; i <= count; i++ {
-		if i == count {
-			chunk = data[_largeValue*(count-1):]
-		} else {
-			chunk = data[_largeValue*(i-1) : _largeValue*i]
-		}
-		key := fmt.Sprintf("%s%d", item.Key, i)
-		if err = c.pconn.Populate(ctx, cmd, key, item.Flags, item.Expiration, item.cas, chunk); err != nil {
-			return err
-		}
-	}
-	return nil
+	return c.populateLarge(ctx, cmd, item, flags, data)
 }
 
 func (c *conn) GetContext(ctx context.Context, key string) (*Item, error) {
@@ -162,35 +172,6 @@ func (c *conn) GetContext(ctx context.Context, key string) (*Item, error) {
 	return c.getLargeItem(ctx, result)
 }
 
-func (c *conn) getLargeItem(ctx context.Context, result *Item) (*Item, error) {
-	length, err := strconv.Atoi(string(result.Value))
-	if err != nil {
-		return nil, err
-	}
-	count := length/_largeValue + 1
-	keys := make([]string, 0, count)
-	for i := 1; i <= count; i++ {
-		keys = append(keys, fmt.Sprintf("%s%d", result.Key, i))
-	}
-	var results map[string]*Item
-	if results, err = c.pconn.GetMulti(ctx, keys...); err != nil {
-		return nil, err
-	}
-	if len(results) < count {
-		return nil, ErrNotFound
-	}
-	result.Value = make([]byte, 0, length)
-	for _, k := range keys {
-		ti := results[k]
-		if ti == nil || ti.Value == nil {
-			return nil, ErrNotFound
-		}
-		result.Value = append(result.Value, ti.Value...)
-	}
-	result.Flags = result.Flags ^ flagLargeValue
-	return result, nil
-}
-
 func (c *conn) GetMultiContext(ctx context.Context, keys []string) (map[string]*Item, error) {
 	// TODO: move to protocolConn?
 	for _, key := range keys {
@@ -214,6 +195,8 @@ func (c *conn) GetMultiContext(ctx context.Context, keys []string) (map[string]*
 	return results, nil
 }
 
+// DeleteContext deletes the header of a large item, its chunks are left to
+// expire or be evicted.
 func (c *conn) DeleteContext(ctx context.Context, key string) error {
 	if !legalKey(key) {
 		return ErrMalformedKey
@@ -235,11 +218,83 @@ func (c *conn) DecrementContext(ctx context.Context, key string, delta uint64) (
 	return c.pconn.IncrDecr(ctx, "decr", key, delta)
 }
 
+func (c *conn) IncrementWithInitialContext(ctx context.Context, key string, delta, initial uint64, expiration int32) (uint64, error) {
+	if !legalKey(key) {
+		return 0, ErrMalformedKey
+	}
+	return c.pconn.IncrDecrInitial(ctx, "incr", key, delta, initial, expiration)
+}
+
+func (c *conn) DecrementWithInitialContext(ctx context.Context, key string, delta, initial uint64, expiration int32) (uint64, error) {
+	if !legalKey(key) {
+		return 0, ErrMalformedKey
+	}
+	return c.pconn.IncrDecrInitial(ctx, "decr", key, delta, initial, expiration)
+}
+
+// TouchContext touches the item by a meta get returning its flags, a large
+// item then has its chunks touched too. On a server without the meta
+// commands only the header of a large item is touched, GetAndTouchContext
+// touches its chunks.
 func (c *conn) TouchContext(ctx context.Context, key string, seconds int32) error {
 	if !legalKey(key) {
 		return ErrMalformedKey
 	}
-	return c.pconn.Touch(ctx, key, seconds)
+	head, err := c.largeHead(ctx, key, &MetaGetOptions{Touch: true, TTL: seconds})
+	if err == ErrNotSupported {
+		return c.pconn.Touch(ctx, key, seconds)
+	}
+	if err != nil || head == nil {
+		return err
+	}
+	h, err := parseLargeHeader(head.Value)
+	if err != nil {
+		return err
+	}
+	return c.touchChunks(ctx, h, key, seconds)
+}
+
+func (c *conn) GetAndTouchContext(ctx context.Context, key string, seconds int32) (*Item, error) {
+	results, err := c.GetMultiAndTouchContext(ctx, []string{key}, seconds)
+	if err != nil {
+		return nil, err
+	}
+	result, ok := results[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return result, nil
+}
+
+// GetMultiAndTouchContext touches the chunks of large items along with
+// their header.
+func (c *conn) GetMultiAndTouchContext(ctx context.Context, keys []string, seconds int32) (map[string]*Item, error) {
+	for _, key := range keys {
+		if !legalKey(key) {
+			return nil, ErrMalformedKey
+		}
+	}
+	results, err := c.pconn.GetAndTouch(ctx, seconds, keys...)
+	if err != nil {
+		return results, err
+	}
+	for k, v := range results {
+		if v.Flags&flagLargeValue != flagLargeValue {
+			continue
+		}
+		h, err := parseLargeHeader(v.Value)
+		if err != nil {
+			return results, err
+		}
+		if err = c.touchChunks(ctx, h, k, seconds); err != nil {
+			return results, err
+		}
+		if v, err = c.getLargeItem(ctx, v); err != nil {
+			return results, err
+		}
+		results[k] = v
+	}
+	return results, nil
 }
 
 func (c *conn) Add(item *Item) error {
@@ -274,6 +329,14 @@ func (c *conn) Decrement(key string, delta uint64) (newValue uint64, err error)
 	return c.DecrementContext(context.TODO(), key, delta)
 }
 
+func (c *conn) IncrementWithInitial(key string, delta, initial uint64, expiration int32) (uint64, error) {
+	return c.IncrementWithInitialContext(context.TODO(), key, delta, initial, expiration)
+}
+
+func (c *conn) DecrementWithInitial(key string, delta, initial uint64, expiration int32) (uint64, error) {
+	return c.DecrementWithInitialContext(context.TODO(), key, delta, initial, expiration)
+}
+
 func (c *conn) CompareAndSwap(item *Item) error {
 	return c.CompareAndSwapContext(context.TODO(), item)
 }
@@ -282,6 +345,14 @@ func (c *conn) Touch(key string, seconds int32) (err error) {
 	return c.TouchContext(context.TODO(), key, seconds)
 }
 
+func (c *conn) GetAndTouch(key string, seconds int32) (*Item, error) {
+	return c.GetAndTouchContext(context.TODO(), key, seconds)
+}
+
+func (c *conn) GetMultiAndTouch(keys []string, seconds int32) (map[string]*Item, error) {
+	return c.GetMultiAndTouchContext(context.TODO(), keys, seconds)
+}
+
 func (c *conn) Scan(item *Item, v interface{}) (err error) {
 	return pkgerr.WithStack(c.ed.decode(item, v))
 }
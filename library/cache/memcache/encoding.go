@@ -53,14 +53,17 @@ func newEncodeDecoder() *encodeDecode {
 	return ed
 }
 
-func (ed *encodeDecode) encode(item *Item) (data []byte, err error) {
+// encode returns the encoded value of item and the flags to store it with,
+// compress flags are cleared when the value is below the compress threshold.
+func (ed *encodeDecode) encode(item *Item) (data []byte, flags uint32, err error) {
 	if (item.Flags | _flagEncoding) == _flagEncoding {
 		if item.Value == nil {
-			return nil, ErrItem
+			return nil, 0, ErrItem
 		}
 	} else if item.Object == nil {
-		return nil, ErrItem
+		return nil, 0, ErrItem
 	}
+	flags = item.Flags
 	// encoding
 	switch {
 	case item.Flags&FlagGOB == FlagGOB:
@@ -88,29 +91,49 @@ func (ed *encodeDecode) encode(item *Item) (data []byte, err error) {
 		}
 		data = ed.edb.Bytes()
 	default:
-		data = item.Value
+		if codec := lookupCodec(item.Flags); codec != nil {
+			if data, err = codec.Marshal(item.Object); err != nil {
+				return
+			}
+		} else {
+			data = item.Value
+		}
 	}
 	// compress
 	if item.Flags&FlagGzip == FlagGzip {
-		ed.cb.Reset()
-		ed.gw.Reset(&ed.cb)
-		if _, err = ed.gw.Write(data); err != nil {
-			return
-		}
-		if err = ed.gw.Close(); err != nil {
-			return
+		if len(data) < compressThreshold(FlagGzip) {
+			flags &^= FlagGzip
+		} else {
+			ed.cb.Reset()
+			ed.gw.Reset(&ed.cb)
+			if _, err = ed.gw.Write(data); err != nil {
+				return
+			}
+			if err = ed.gw.Close(); err != nil {
+				return
+			}
+			data = ed.cb.Bytes()
 		}
-		data = ed.cb.Bytes()
 	} else if item.Flags&FlagZlib == FlagZlib {
-		ed.cb.Reset()
-		ed.zw.Reset(&ed.cb)
-		if _, err = ed.zw.Write(data); err != nil {
-			return
+		if len(data) < compressThreshold(FlagZlib) {
+			flags &^= FlagZlib
+		} else {
+			ed.cb.Reset()
+			ed.zw.Reset(&ed.cb)
+			if _, err = ed.zw.Write(data); err != nil {
+				return
+			}
+			if err = ed.zw.Close(); err != nil {
+				return
+			}
+			data = ed.cb.Bytes()
 		}
-		if err = ed.zw.Close(); err != nil {
+	} else if flag, c := lookupCompressor(item.Flags); c != nil {
+		if len(data) < compressThreshold(flag) {
+			flags &^= flag
+		} else if data, err = c.Compress(data); err != nil {
 			return
 		}
-		data = ed.cb.Bytes()
 	}
 	if len(data) > 8000000 {
 		err = ErrValueSize
@@ -123,7 +146,13 @@ func (ed *encodeDecode) decode(item *Item, v interface{}) (err error) {
 		data []byte
 		rd   io.Reader
 	)
-	ed.ir.Reset(item.Value)
+	value := item.Value
+	if _, c := lookupCompressor(item.Flags); c != nil {
+		if value, err = c.Decompress(item.Value); err != nil {
+			return
+		}
+	}
+	ed.ir.Reset(value)
 	rd = &ed.ir
 	if item.Flags&FlagGzip == FlagGzip {
 		rd = &ed.gr
@@ -142,7 +171,7 @@ func (ed *encodeDecode) decode(item *Item, v interface{}) (err error) {
 			zr.Close()
 			io.Copy(&ed.cb, zr)
 		} else {
-			ed.ir.Reset(item.Value)
+			ed.ir.Reset(value)
 		}
 	}
 	switch {
@@ -152,7 +181,7 @@ func (ed *encodeDecode) decode(item *Item, v interface{}) (err error) {
 		ed.jr.Reset(rd)
 		err = ed.jd.Decode(v)
 	default:
-		data = item.Value
+		data = value
 		if item.Flags&FlagZlib == FlagZlib {
 			ed.edb.Reset()
 			if _, err = io.Copy(&ed.edb, rd); err != nil {
@@ -174,6 +203,8 @@ func (ed *encodeDecode) decode(item *Item, v interface{}) (err error) {
 			}
 			ed.ped.SetBuf(data)
 			err = ed.ped.Unmarshal(m)
+		} else if codec := lookupCodec(item.Flags); codec != nil {
+			err = codec.Unmarshal(data, v)
 		} else {
 			switch v.(type) {
 			case *[]byte:
@@ -114,7 +114,7 @@ func TestEncode(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			if r, err := ed.encode(test.a); err != test.e {
+			if r, _, err := ed.encode(test.a); err != test.e {
 				t.Fatal(err)
 			} else {
 				if err == nil {
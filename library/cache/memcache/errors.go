@@ -1,8 +1,11 @@
 package memcache
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"strings"
 
 	pkgerr "github.com/pkg/errors"
@@ -41,6 +44,10 @@ var (
 	ErrItem = errors.New("memcache: item object nil")
 	// ErrItemObject object type Assertion failed
 	ErrItemObject = errors.New("memcache: item object protobuf type assertion failed")
+	// ErrNotSupported command not supported by the connection protocol.
+	ErrNotSupported = errors.New("memcache: command not supported by protocol")
+	// ErrNoServers no server available for the key in a sharded memcache.
+	ErrNoServers = errors.New("memcache: no servers configured or available")
 )
 
 type protocolError string
@@ -53,9 +60,6 @@ func (pc *poolConn) formatErr(err error) string {
 	e := pkgerr.Cause(err)
 	switch e {
 	case ErrNotFound, ErrExists, ErrNotStored, nil:
-		if e == ErrNotFound {
-			_metricMisses.Inc(pc.p.c.Name, pc.p.c.Addr)
-		}
 		return ""
 	default:
 		es := e.Error()
@@ -77,3 +81,34 @@ func (pc *poolConn) formatErr(err error) string {
 		}
 	}
 }
+
+// errClass classifies err for the error class metric, results like
+// ErrNotStored or ErrCASConflict are not failures and have no class.
+func errClass(err error) string {
+	e := pkgerr.Cause(err)
+	switch e {
+	case nil, ErrExists, ErrNotStored, ErrCASConflict:
+		return ""
+	case ErrNotFound:
+		return "not_found"
+	case ErrMalformedKey:
+		return "malformed_key"
+	case ErrPoolExhausted, ErrPoolClosed, ErrConnClosed:
+		return "pool"
+	case context.DeadlineExceeded:
+		return "timeout"
+	}
+	switch e := e.(type) {
+	case protocolError:
+		return "protocol"
+	case net.Error:
+		if e.Timeout() {
+			return "timeout"
+		}
+		return "network"
+	}
+	if e == io.EOF || e == io.ErrUnexpectedEOF {
+		return "network"
+	}
+	return "other"
+}
@@ -0,0 +1,127 @@
+package memcache
+
+import (
+	"crypto/md5"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const (
+	// _ketamaPoints number of md5 digests per server of average weight,
+	// every digest gives 4 points on the ring.
+	_ketamaPoints = 40
+)
+
+// Selector maps a key to one of the servers of a sharded memcache.
+type Selector interface {
+	// Set rebuilds the selector with the servers currently alive.
+	Set(servers []*Server)
+
+	// Pick returns the address of the server key belongs to.
+	// ErrNoServers is returned if there is no server alive.
+	Pick(key string) (addr string, err error)
+}
+
+// SelectorFunc adapts a plain key to server function into a Selector.
+// fn receives the servers currently alive and returns the index of the
+// server the key belongs to.
+func SelectorFunc(fn func(key string, servers []*Server) int) Selector {
+	return &funcSelector{fn: fn}
+}
+
+type funcSelector struct {
+	mu      sync.RWMutex
+	fn      func(key string, servers []*Server) int
+	servers []*Server
+}
+
+func (s *funcSelector) Set(servers []*Server) {
+	s.mu.Lock()
+	s.servers = servers
+	s.mu.Unlock()
+}
+
+func (s *funcSelector) Pick(key string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.servers) == 0 {
+		return "", ErrNoServers
+	}
+	i := s.fn(key, s.servers)
+	if i < 0 || i >= len(s.servers) {
+		return "", ErrNoServers
+	}
+	return s.servers[i].Addr, nil
+}
+
+type ketamaPoint struct {
+	hash uint32
+	addr string
+}
+
+// Ketama is a consistent hashing Selector compatible with libketama: a
+// server owns floor(weight/total*40*servers) digests of "addr-i", so the
+// keys map to the same servers as in the other libketama clients given the
+// same addresses and weights.
+type Ketama struct {
+	mu     sync.RWMutex
+	points []ketamaPoint
+}
+
+// NewKetama new a ketama selector.
+func NewKetama() *Ketama {
+	return &Ketama{}
+}
+
+// Set rebuilds the ring.
+func (k *Ketama) Set(servers []*Server) {
+	points := make([]ketamaPoint, 0, len(servers)*_ketamaPoints*4)
+	total := 0
+	for _, s := range servers {
+		total += ketamaWeight(s)
+	}
+	for _, s := range servers {
+		// floorf(pct * 40.0 * numservers) of libketama, for the same
+		// rounding.
+		pct := float32(ketamaWeight(s)) / float32(total)
+		digests := int(float32(float64(pct) * _ketamaPoints * float64(len(servers))))
+		for i := 0; i < digests; i++ {
+			digest := md5.Sum([]byte(s.Addr + "-" + strconv.Itoa(i)))
+			for j := 0; j < 4; j++ {
+				points = append(points, ketamaPoint{hash: ketamaHash(digest[j*4:]), addr: s.Addr})
+			}
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].hash < points[j].hash })
+	k.mu.Lock()
+	k.points = points
+	k.mu.Unlock()
+}
+
+// Pick returns the first server clockwise from the key's point.
+func (k *Ketama) Pick(key string) (string, error) {
+	digest := md5.Sum([]byte(key))
+	h := ketamaHash(digest[:])
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if len(k.points) == 0 {
+		return "", ErrNoServers
+	}
+	i := sort.Search(len(k.points), func(i int) bool { return k.points[i].hash >= h })
+	if i == len(k.points) {
+		i = 0
+	}
+	return k.points[i].addr, nil
+}
+
+func ketamaWeight(s *Server) int {
+	if s.Weight <= 0 {
+		return 1
+	}
+	return s.Weight
+}
+
+func ketamaHash(b []byte) uint32 {
+	return uint32(b[3])<<24 | uint32(b[2])<<16 | uint32(b[1])<<8 | uint32(b[0])
+}
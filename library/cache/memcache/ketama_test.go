@@ -0,0 +1,76 @@
+package memcache
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKetamaPick(t *testing.T) {
+	k := NewKetama()
+	_, err := k.Pick("test")
+	assert.Equal(t, ErrNoServers, err)
+
+	servers := []*Server{{Addr: "127.0.0.1:11211"}, {Addr: "127.0.0.1:11212"}, {Addr: "127.0.0.1:11213"}}
+	k.Set(servers)
+	owners := make(map[string]string)
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprintf("key_%d", i)
+		addr, err := k.Pick(key)
+		assert.Nil(t, err)
+		owners[key] = addr
+		counts[addr]++
+	}
+	for _, s := range servers {
+		assert.InDelta(t, 1000, counts[s.Addr], 300, "server %s", s.Addr)
+	}
+
+	// only the keys of the removed server move.
+	k.Set(servers[:2])
+	for key, owner := range owners {
+		addr, _ := k.Pick(key)
+		if owner != servers[2].Addr {
+			assert.Equal(t, owner, addr)
+		} else {
+			assert.NotEqual(t, owner, addr)
+		}
+	}
+}
+
+func TestKetamaWeight(t *testing.T) {
+	k := NewKetama()
+	k.Set([]*Server{{Addr: "127.0.0.1:11211", Weight: 3}, {Addr: "127.0.0.1:11212", Weight: 1}})
+	counts := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		addr, _ := k.Pick(fmt.Sprintf("key_%d", i))
+		counts[addr]++
+	}
+	assert.InDelta(t, 3000, counts["127.0.0.1:11211"], 400)
+}
+
+func TestSelectorFunc(t *testing.T) {
+	s := SelectorFunc(func(key string, servers []*Server) int {
+		return len(key) % len(servers)
+	})
+	_, err := s.Pick("a")
+	assert.Equal(t, ErrNoServers, err)
+	s.Set([]*Server{{Addr: "a"}, {Addr: "b"}})
+	addr, err := s.Pick("a")
+	assert.Nil(t, err)
+	assert.Equal(t, "b", addr)
+	addr, _ = s.Pick("ab")
+	assert.Equal(t, "a", addr)
+}
+
+func TestKetamaPoints(t *testing.T) {
+	k := NewKetama()
+	// libketama gives floor(weight/total*40*servers) digests to a server.
+	k.Set([]*Server{{Addr: "a", Weight: 1}, {Addr: "b", Weight: 2}, {Addr: "c", Weight: 4}})
+	counts := make(map[string]int)
+	for _, p := range k.points {
+		counts[p.addr]++
+	}
+	assert.Equal(t, map[string]int{"a": 17 * 4, "b": 34 * 4, "c": 68 * 4}, counts)
+}
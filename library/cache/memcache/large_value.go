@@ -0,0 +1,224 @@
+package memcache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"time"
+
+	pkgerr "github.com/pkg/errors"
+)
+
+const (
+	// 1024*1024 - 1, set error???
+	_largeValue = 1000 * 1000 // 1MB
+	// _largeGens is the number of 6 characters base36 generations.
+	_largeGens = 36 * 36 * 36 * 36 * 36 * 36
+)
+
+// Values over _largeValue are split into chunks stored under their own keys,
+// the item key holds a header "<length>:<generation>:<crc32>" flagged with
+// flagLargeValue. Every write uses a new generation in its chunk keys and
+// writes the header last, so a reader never mixes chunks of concurrent
+// writers and add/replace/cas on the header apply to the whole chunk set.
+//
+// The chunks of a generation are stored under key_<gen><n>, the generation
+// being 6 base36 characters, so the key of a large value must leave room for
+// 7 bytes and the chunk number: 241 bytes for values under 10MB. Headers
+// written by older clients only hold the length, their chunks are stored
+// under key1..keyN.
+type largeHeader struct {
+	length int
+	// gen is empty for legacy headers.
+	gen string
+	sum uint32
+}
+
+func newLargeHeader(data []byte) *largeHeader {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		binary.LittleEndian.PutUint32(b[:], uint32(time.Now().UnixNano()))
+	}
+	gen := strconv.FormatUint(uint64(binary.LittleEndian.Uint32(b[:])%_largeGens), 36)
+	return &largeHeader{
+		length: len(data),
+		gen:    strings.Repeat("0", 6-len(gen)) + gen,
+		sum:    crc32.ChecksumIEEE(data),
+	}
+}
+
+func parseLargeHeader(v []byte) (h *largeHeader, err error) {
+	h = new(largeHeader)
+	parts := strings.Split(string(v), ":")
+	if h.length, err = strconv.Atoi(parts[0]); err != nil {
+		return nil, protocolError("corrupt large value header")
+	}
+	if len(parts) == 1 {
+		return h, nil
+	}
+	if len(parts) != 3 || parts[1] == "" {
+		return nil, protocolError("corrupt large value header")
+	}
+	h.gen = parts[1]
+	sum, err := strconv.ParseUint(parts[2], 16, 32)
+	if err != nil {
+		return nil, protocolError("corrupt large value header")
+	}
+	h.sum = uint32(sum)
+	return h, nil
+}
+
+func (h *largeHeader) bytes() []byte {
+	return []byte(fmt.Sprintf("%d:%s:%08x", h.length, h.gen, h.sum))
+}
+
+func (h *largeHeader) chunkKeys(key string) []string {
+	if h.gen == "" {
+		count := h.length/_largeValue + 1
+		keys := make([]string, 0, count)
+		for i := 1; i <= count; i++ {
+			keys = append(keys, fmt.Sprintf("%s%d", key, i))
+		}
+		return keys
+	}
+	count := (h.length + _largeValue - 1) / _largeValue
+	keys := make([]string, 0, count)
+	for i := 1; i <= count; i++ {
+		keys = append(keys, fmt.Sprintf("%s_%s%d", key, h.gen, i))
+	}
+	return keys
+}
+
+// populateLarge writes the chunks then the header with cmd, the chunks are
+// removed again if the header is not stored. The chunks of the large item
+// overwritten are removed once the new header is stored. A small value
+// overwriting a large item, or any overwrite on a server without the meta
+// commands, leaves the old chunks to expire or be evicted.
+func (c *conn) populateLarge(ctx context.Context, cmd string, item *Item, flags uint32, data []byte) error {
+	h := newLargeHeader(data)
+	keys := h.chunkKeys(item.Key)
+	for _, key := range keys {
+		if !legalKey(key) {
+			return ErrMalformedKey
+		}
+	}
+	var prev *largeHeader
+	if cmd != "add" {
+		head, err := c.largeHead(ctx, item.Key, &MetaGetOptions{})
+		if err != nil && pkgerr.Cause(err) != ErrNotFound && err != ErrNotSupported {
+			return err
+		}
+		if head != nil {
+			// a corrupt header has no chunks to remove.
+			prev, _ = parseLargeHeader(head.Value)
+		}
+	}
+	for i, key := range keys {
+		end := (i + 1) * _largeValue
+		if end > len(data) {
+			end = len(data)
+		}
+		if err := c.pconn.Populate(ctx, "set", key, flags, item.Expiration, 0, data[i*_largeValue:end]); err != nil {
+			c.deleteChunks(ctx, keys[:i])
+			return err
+		}
+	}
+	if err := c.pconn.Populate(ctx, cmd, item.Key, flags|flagLargeValue, item.Expiration, item.cas, h.bytes()); err != nil {
+		c.deleteChunks(ctx, keys)
+		return err
+	}
+	if prev != nil && prev.gen != h.gen {
+		c.deleteChunks(ctx, prev.chunkKeys(item.Key))
+	}
+	return nil
+}
+
+// getLargeItem reads the chunks of the header item result. ErrNotFound is
+// returned if a chunk is missing or the value doesn't match its checksum.
+func (c *conn) getLargeItem(ctx context.Context, result *Item) (*Item, error) {
+	h, err := parseLargeHeader(result.Value)
+	if err != nil {
+		return nil, err
+	}
+	keys := h.chunkKeys(result.Key)
+	results, err := c.pconn.GetMulti(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) < len(keys) {
+		return nil, ErrNotFound
+	}
+	value := make([]byte, 0, h.length)
+	for _, k := range keys {
+		ti := results[k]
+		if ti == nil || ti.Value == nil {
+			return nil, ErrNotFound
+		}
+		value = append(value, ti.Value...)
+	}
+	if h.gen != "" && (len(value) != h.length || crc32.ChecksumIEEE(value) != h.sum) {
+		return nil, ErrNotFound
+	}
+	result.Value = value
+	result.Flags = result.Flags ^ flagLargeValue
+	return result, nil
+}
+
+// largeHead returns the header item of key, nil if it is not a large item.
+// Only the flags are read by a meta get without value, the value of a small
+// item is never transferred. opts may touch the item too. The servers
+// without the meta commands return ErrNotSupported.
+func (c *conn) largeHead(ctx context.Context, key string, opts *MetaGetOptions) (*Item, error) {
+	if c.noMeta {
+		return nil, ErrNotSupported
+	}
+	opts.NoValue = true
+	item, err := c.pconn.MetaGet(ctx, key, opts)
+	if metaUnsupported(err) {
+		c.noMeta = true
+		return nil, ErrNotSupported
+	}
+	if err != nil || item.Flags&flagLargeValue != flagLargeValue {
+		return nil, err
+	}
+	head, err := c.pconn.Get(ctx, key)
+	if err != nil || head.Flags&flagLargeValue != flagLargeValue {
+		return nil, err
+	}
+	return head, nil
+}
+
+// metaUnsupported reports whether err rejects a meta command: the binary
+// protocol, or an ascii server before 1.6 replying ERROR.
+func metaUnsupported(err error) bool {
+	err = pkgerr.Cause(err)
+	if err == ErrNotSupported {
+		return true
+	}
+	e, ok := err.(protocolError)
+	return ok && string(e) == "ERROR"
+}
+
+// deleteChunks deletes chunks best effort, the ones left behind stay until
+// they expire or are evicted.
+func (c *conn) deleteChunks(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if c.pconn.Err() != nil {
+			return
+		}
+		c.pconn.Delete(ctx, key)
+	}
+}
+
+func (c *conn) touchChunks(ctx context.Context, h *largeHeader, key string, seconds int32) error {
+	for _, key := range h.chunkKeys(key) {
+		if err := c.pconn.Touch(ctx, key, seconds); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package memcache
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLargeHeader(t *testing.T) {
+	h := newLargeHeader(bytes.Repeat([]byte{1}, _largeValue+1))
+	h1, err := parseLargeHeader(h.bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, h, h1)
+	assert.Len(t, h1.chunkKeys("test"), 2)
+	assert.Len(t, h1.gen, 6)
+	// the chunk keys append 7 bytes and the chunk number.
+	for i, key := range h1.chunkKeys("test") {
+		assert.Equal(t, "test_"+h1.gen+strconv.Itoa(i+1), key)
+	}
+
+	legacy, err := parseLargeHeader([]byte("2000000"))
+	assert.Nil(t, err)
+	assert.Equal(t, "", legacy.gen)
+	assert.Equal(t, []string{"test1", "test2", "test3"}, legacy.chunkKeys("test"))
+
+	for _, v := range []string{"", "abc", "1:", "1:gen", "1:gen:xyz"} {
+		_, err = parseLargeHeader([]byte(v))
+		assert.NotNil(t, err, v)
+	}
+}
+
+func TestConnLargeValue(t *testing.T) {
+	c := &conn{pconn: newTestBinaryConn(t), ed: newEncodeDecoder()}
+	defer c.Close()
+	ctx := context.Background()
+	value := bytes.Repeat([]byte("0123456789"), _largeValue/5)
+
+	assert.Nil(t, c.SetContext(ctx, &Item{Key: "test_large", Value: value}))
+	it, err := c.GetContext(ctx, "test_large")
+	assert.Nil(t, err)
+	assert.Equal(t, value, it.Value)
+	assert.Equal(t, FlagRAW, it.Flags)
+	assert.Equal(t, ErrNotStored, c.AddContext(ctx, &Item{Key: "test_large", Value: value}))
+
+	// cas applies to the whole chunk set through the header.
+	assert.Nil(t, c.CompareAndSwapContext(ctx, &Item{Key: "test_large", Value: value[1:], cas: it.cas}))
+	assert.Equal(t, ErrCASConflict, c.CompareAndSwapContext(ctx, &Item{Key: "test_large", Value: value, cas: it.cas}))
+	it, err = c.GetContext(ctx, "test_large")
+	assert.Nil(t, err)
+	assert.Equal(t, value[1:], it.Value)
+	assert.Nil(t, c.TouchContext(ctx, "test_large", 60))
+
+	// a chunk overwritten behind our back fails the checksum.
+	head, err := c.pconn.Get(ctx, "test_large")
+	assert.Nil(t, err)
+	h, err := parseLargeHeader(head.Value)
+	assert.Nil(t, err)
+	keys := h.chunkKeys("test_large")
+	assert.Nil(t, c.pconn.Populate(ctx, "set", keys[0], 0, 0, 0, bytes.Repeat([]byte("x"), _largeValue)))
+	_, err = c.GetContext(ctx, "test_large")
+	assert.Equal(t, ErrNotFound, err)
+
+	// delete removes the header, the chunks are left to expire.
+	assert.Nil(t, c.DeleteContext(ctx, "test_large"))
+	_, err = c.GetContext(ctx, "test_large")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, c.DeleteContext(ctx, "test_large"))
+
+	// a key too long for the chunk keys.
+	long := strings.Repeat("k", 250-len("_")-6-len("1")+1)
+	assert.Equal(t, ErrMalformedKey, c.SetContext(ctx, &Item{Key: long, Value: value}))
+	assert.Nil(t, c.SetContext(ctx, &Item{Key: long[1:], Value: value}))
+}
+
+func TestConnLargeValueOverwrite(t *testing.T) {
+	large := strconv.FormatUint(uint64(flagLargeValue), 10)
+	pconn, reqs := scriptedServer(t, []string{
+		"HD f" + large + "\r\n",
+		"VALUE test " + large + " 16\r\n1000001:00000a:0\r\nEND\r\n",
+		"STORED\r\n",
+		"STORED\r\n",
+		"STORED\r\n",
+		"DELETED\r\n",
+		"DELETED\r\n",
+	})
+	c := &conn{pconn: pconn, ed: newEncodeDecoder()}
+	defer c.Close()
+	ctx := context.Background()
+
+	// the chunks of the previous generation are removed.
+	assert.Nil(t, c.SetContext(ctx, &Item{Key: "test", Value: make([]byte, _largeValue+1)}))
+	assert.Len(t, *reqs, 7)
+	assert.Equal(t, []string{"mg test f c t l", keyWordGet + " test"}, (*reqs)[:2])
+	assert.Equal(t, []string{"delete test_00000a1", "delete test_00000a2"}, (*reqs)[5:])
+
+	// a server without the meta commands leaves them to expire.
+	c = &conn{pconn: newTestBinaryConn(t), ed: newEncodeDecoder()}
+	defer c.Close()
+	value := bytes.Repeat([]byte("0123456789"), _largeValue/5)
+	assert.Nil(t, c.SetContext(ctx, &Item{Key: "test", Value: value}))
+	head, err := c.pconn.Get(ctx, "test")
+	assert.Nil(t, err)
+	h, err := parseLargeHeader(head.Value)
+	assert.Nil(t, err)
+	assert.Nil(t, c.SetContext(ctx, &Item{Key: "test", Value: value[1:]}))
+	for _, key := range h.chunkKeys("test") {
+		_, err = c.pconn.Get(ctx, key)
+		assert.Nil(t, err)
+	}
+	it, err := c.GetContext(ctx, "test")
+	assert.Nil(t, err)
+	assert.Equal(t, value[1:], it.Value)
+}
+
+func TestConnDeleteTouch(t *testing.T) {
+	pconn, reqs := scriptedServer(t, []string{
+		"DELETED\r\n",
+		"NOT_FOUND\r\n",
+		"HD f0\r\n",
+		"EN\r\n",
+		// a large item reads its header to touch its chunks.
+		"HD f" + strconv.FormatUint(uint64(flagLargeValue), 10) + "\r\n",
+		"VALUE large " + strconv.FormatUint(uint64(flagLargeValue), 10) + " 16\r\n1000001:00000a:0\r\nEND\r\n",
+		"TOUCHED\r\n",
+		"TOUCHED\r\n",
+		// a server without the meta commands touches the item only.
+		"ERROR\r\n",
+		"TOUCHED\r\n",
+		"TOUCHED\r\n",
+	})
+	c := &conn{pconn: pconn, ed: newEncodeDecoder()}
+	defer c.Close()
+	ctx := context.Background()
+	assert.Nil(t, c.DeleteContext(ctx, "small"))
+	assert.Equal(t, ErrNotFound, c.DeleteContext(ctx, "small"))
+	assert.Nil(t, c.TouchContext(ctx, "small", 60))
+	assert.Equal(t, ErrNotFound, c.TouchContext(ctx, "small", 60))
+	assert.Nil(t, c.TouchContext(ctx, "large", 60))
+	assert.Nil(t, c.TouchContext(ctx, "small", 60))
+	assert.Nil(t, c.TouchContext(ctx, "small", 60))
+	assert.Equal(t, []string{
+		"delete small",
+		"delete small",
+		"mg small f c t l T60",
+		"mg small f c t l T60",
+		"mg large f c t l T60",
+		keyWordGet + " large",
+		"touch large_00000a1 60",
+		"touch large_00000a2 60",
+		"mg small f c t l T60",
+		"touch small 60",
+		"touch small 60",
+	}, *reqs)
+}
@@ -2,6 +2,7 @@ package memcache
 
 import (
 	"context"
+	"sync"
 
 	"github.com/zombie-k/kylin/library/container/pool"
 	xtime "github.com/zombie-k/kylin/library/time"
@@ -31,6 +32,13 @@ const (
 	flagLargeValue = uint32(1) << 30
 )
 
+const (
+	// ProtocolASCII memcache text protocol.
+	ProtocolASCII = "ascii"
+	// ProtocolBinary memcache binary protocol.
+	ProtocolBinary = "binary"
+)
+
 // Item is an reply to be got or stored in a memcached server.
 type Item struct {
 	// Key is the Item's key (250 bytes maximum).
@@ -51,6 +59,26 @@ type Item struct {
 	// Zero means the Item has no expiration time.
 	Expiration int32
 
+	// TTLRemaining is the remaining time to live in seconds, -1 means the
+	// item never expires. Only filled by MetaGet.
+	TTLRemaining int32
+
+	// LastAccess is the number of seconds since the item was last accessed.
+	// Only filled by MetaGet.
+	LastAccess int32
+
+	// Won means the caller holds the token to recompute the item, the other
+	// callers see Recaching until it is set. Only filled by MetaGet.
+	Won bool
+
+	// Stale means the item was invalidated and should be recomputed.
+	// Only filled by MetaGet.
+	Stale bool
+
+	// Recaching means another caller holds the token to recompute the item.
+	// Only filled by MetaGet.
+	Recaching bool
+
 	// Compare and swap ID.
 	cas uint64
 }
@@ -106,6 +134,16 @@ type Conn interface {
 	// value is capped at zero and does not wrap around.
 	Decrement(key string, delta uint64) (newValue uint64, err error)
 
+	// IncrementWithInitial atomically increments key by delta like Increment,
+	// but if the value didn't exist in memcached it is created with initial
+	// value and expiration, and initial is returned.
+	IncrementWithInitial(key string, delta, initial uint64, expiration int32) (newValue uint64, err error)
+
+	// DecrementWithInitial atomically decrements key by delta like Decrement,
+	// but if the value didn't exist in memcached it is created with initial
+	// value and expiration, and initial is returned.
+	DecrementWithInitial(key string, delta, initial uint64, expiration int32) (newValue uint64, err error)
+
 	// CompareAndSwap writes the given item that was previously returned by
 	// Get, if the value was neither modified or evicted between the Get and
 	// the CompareAndSwap calls. The item's Key should not change between calls
@@ -130,6 +168,48 @@ type Conn interface {
 	//
 	Scan(item *Item, v interface{}) (err error)
 
+	// MetaGet gets the item with the meta protocol, which additionally fills
+	// TTLRemaining, LastAccess, Won, Stale and Recaching of the item.
+	// ErrNotFound is returned on miss, unless opts.Vivify is set.
+	// Requires memcached 1.6 and the ascii protocol.
+	MetaGet(key string, opts *MetaGetOptions) (*Item, error)
+
+	// MetaSet writes the given item with the meta protocol, the item cas is
+	// updated to the one of the stored value.
+	MetaSet(item *Item, opts *MetaSetOptions) error
+
+	// MetaDelete deletes or invalidates the item with the provided key.
+	MetaDelete(key string, opts *MetaDeleteOptions) error
+
+	// MetaArithmetic atomically increments or decrements key and returns
+	// the new value.
+	MetaArithmetic(key string, opts *MetaArithmeticOptions) (uint64, error)
+
+	// GetAndTouch gets the item with the provided key and updates its expiry
+	// like Touch in a single round trip. The item has its cas filled, so it
+	// can be used with CompareAndSwap.
+	GetAndTouch(key string, seconds int32) (*Item, error)
+
+	// GetMultiAndTouch is a batch version of GetAndTouch. The returned map
+	// may have fewer elements than the input slice, due to cache misses.
+	GetMultiAndTouch(keys []string, seconds int32) (map[string]*Item, error)
+
+	// Stats returns the general-purpose statistics of the server.
+	Stats() (*Stats, error)
+
+	// StatsSlabs returns the statistics of the slab classes of the server.
+	StatsSlabs() (*SlabStats, error)
+
+	// Version returns the version string of the server.
+	Version() (string, error)
+
+	// FlushAll invalidates all existing items, in delay seconds if delay is
+	// positive.
+	FlushAll(delay int32) error
+
+	// Verbosity sets the logging verbosity level of the server.
+	Verbosity(level uint32) error
+
 	// AddContext writes the given item, if no value already exists for its key.
 	// ErrNotStored is returned if that condition is not met.
 	AddContext(ctx context.Context, item *Item) error
@@ -169,6 +249,16 @@ type Conn interface {
 	// value is capped at zero and does not wrap around.
 	DecrementContext(ctx context.Context, key string, delta uint64) (newValue uint64, err error)
 
+	// IncrementWithInitialContext atomically increments key by delta like Increment,
+	// but if the value didn't exist in memcached it is created with initial
+	// value and expiration, and initial is returned.
+	IncrementWithInitialContext(ctx context.Context, key string, delta, initial uint64, expiration int32) (newValue uint64, err error)
+
+	// DecrementWithInitialContext atomically decrements key by delta like Decrement,
+	// but if the value didn't exist in memcached it is created with initial
+	// value and expiration, and initial is returned.
+	DecrementWithInitialContext(ctx context.Context, key string, delta, initial uint64, expiration int32) (newValue uint64, err error)
+
 	// CompareAndSwapContext writes the given item that was previously returned by
 	// Get, if the value was neither modified or evicted between the Get and
 	// the CompareAndSwap calls. The item's Key should not change between calls
@@ -183,6 +273,48 @@ type Conn interface {
 	// ErrNotFound is returned if the key is not in the cache. The key must be
 	// at most 250 bytes in length.
 	TouchContext(ctx context.Context, key string, seconds int32) (err error)
+
+	// MetaGetContext gets the item with the meta protocol, which additionally fills
+	// TTLRemaining, LastAccess, Won, Stale and Recaching of the item.
+	// ErrNotFound is returned on miss, unless opts.Vivify is set.
+	// Requires memcached 1.6 and the ascii protocol.
+	MetaGetContext(ctx context.Context, key string, opts *MetaGetOptions) (*Item, error)
+
+	// MetaSetContext writes the given item with the meta protocol, the item cas is
+	// updated to the one of the stored value.
+	MetaSetContext(ctx context.Context, item *Item, opts *MetaSetOptions) error
+
+	// MetaDeleteContext deletes or invalidates the item with the provided key.
+	MetaDeleteContext(ctx context.Context, key string, opts *MetaDeleteOptions) error
+
+	// MetaArithmeticContext atomically increments or decrements key and returns
+	// the new value.
+	MetaArithmeticContext(ctx context.Context, key string, opts *MetaArithmeticOptions) (uint64, error)
+
+	// GetAndTouchContext gets the item with the provided key and updates its expiry
+	// like Touch in a single round trip. The item has its cas filled, so it
+	// can be used with CompareAndSwap.
+	GetAndTouchContext(ctx context.Context, key string, seconds int32) (*Item, error)
+
+	// GetMultiAndTouchContext is a batch version of GetAndTouch. The returned map
+	// may have fewer elements than the input slice, due to cache misses.
+	GetMultiAndTouchContext(ctx context.Context, keys []string, seconds int32) (map[string]*Item, error)
+
+	// StatsContext returns the general-purpose statistics of the server.
+	StatsContext(ctx context.Context) (*Stats, error)
+
+	// StatsSlabsContext returns the statistics of the slab classes of the server.
+	StatsSlabsContext(ctx context.Context) (*SlabStats, error)
+
+	// VersionContext returns the version string of the server.
+	VersionContext(ctx context.Context) (string, error)
+
+	// FlushAllContext invalidates all existing items, in delay seconds if delay is
+	// positive.
+	FlushAllContext(ctx context.Context, delay int32) error
+
+	// VerbosityContext sets the logging verbosity level of the server.
+	VerbosityContext(ctx context.Context, level uint32) error
 }
 
 // Config memcache config.
@@ -191,6 +323,7 @@ type Config struct {
 
 	Name         string // memcache name, for trace
 	Proto        string
+	Protocol     string // ProtocolASCII or ProtocolBinary, default ascii
 	Addr         string
 	DialTimeout  xtime.Duration
 	ReadTimeout  xtime.Duration
@@ -199,7 +332,16 @@ type Config struct {
 
 // Memcache memcache client
 type Memcache struct {
-	pool *Pool
+	pool connPool
+}
+
+// connPool is the source of connections used by Memcache, either a single
+// node Pool or a sharded ring of them.
+type connPool interface {
+	Get(ctx context.Context) Conn
+	Close() error
+	// servers returns the pool of every server by address.
+	servers() map[string]*Pool
 }
 
 // Reply is the result of Get
@@ -378,3 +520,188 @@ func (mc *Memcache) Decrement(ctx context.Context, key string, delta uint64) (ne
 	conn.Close()
 	return
 }
+
+// IncrementWithInitial atomically increments key by delta, creating it with initial if missing.
+func (mc *Memcache) IncrementWithInitial(ctx context.Context, key string, delta, initial uint64, expiration int32) (newValue uint64, err error) {
+	conn := mc.pool.Get(ctx)
+	newValue, err = conn.IncrementWithInitialContext(ctx, key, delta, initial, expiration)
+	conn.Close()
+	return
+}
+
+// DecrementWithInitial atomically decrements key by delta, creating it with initial if missing.
+func (mc *Memcache) DecrementWithInitial(ctx context.Context, key string, delta, initial uint64, expiration int32) (newValue uint64, err error) {
+	conn := mc.pool.Get(ctx)
+	newValue, err = conn.DecrementWithInitialContext(ctx, key, delta, initial, expiration)
+	conn.Close()
+	return
+}
+
+// MetaGet gets the item with the meta protocol, see MetaGetOptions.
+func (mc *Memcache) MetaGet(ctx context.Context, key string, opts *MetaGetOptions) *Reply {
+	conn := mc.pool.Get(ctx)
+	item, err := conn.MetaGetContext(ctx, key, opts)
+	if err != nil {
+		conn.Close()
+	}
+	return &Reply{err: err, item: item, conn: conn}
+}
+
+// MetaSet writes the given item with the meta protocol, see MetaSetOptions.
+func (mc *Memcache) MetaSet(ctx context.Context, item *Item, opts *MetaSetOptions) (err error) {
+	conn := mc.pool.Get(ctx)
+	err = conn.MetaSetContext(ctx, item, opts)
+	conn.Close()
+	return
+}
+
+// MetaDelete deletes or invalidates the item with the provided key.
+func (mc *Memcache) MetaDelete(ctx context.Context, key string, opts *MetaDeleteOptions) (err error) {
+	conn := mc.pool.Get(ctx)
+	err = conn.MetaDeleteContext(ctx, key, opts)
+	conn.Close()
+	return
+}
+
+// MetaArithmetic atomically increments or decrements key.
+func (mc *Memcache) MetaArithmetic(ctx context.Context, key string, opts *MetaArithmeticOptions) (newValue uint64, err error) {
+	conn := mc.pool.Get(ctx)
+	newValue, err = conn.MetaArithmeticContext(ctx, key, opts)
+	conn.Close()
+	return
+}
+
+// GetAndTouch gets the item with the provided key and updates its expiry.
+func (mc *Memcache) GetAndTouch(ctx context.Context, key string, seconds int32) *Reply {
+	conn := mc.pool.Get(ctx)
+	item, err := conn.GetAndTouchContext(ctx, key, seconds)
+	if err != nil {
+		conn.Close()
+	}
+	return &Reply{err: err, item: item, conn: conn}
+}
+
+// GetMultiAndTouch is a batch version of GetAndTouch.
+func (mc *Memcache) GetMultiAndTouch(ctx context.Context, keys []string, seconds int32) (*Replies, error) {
+	conn := mc.pool.Get(ctx)
+	items, err := conn.GetMultiAndTouchContext(ctx, keys, seconds)
+	rs := &Replies{err: err, items: items, conn: conn, usedItems: make(map[string]struct{}, len(keys))}
+	if (err != nil) || (len(items) == 0) {
+		rs.Close()
+	}
+	return rs, err
+}
+
+// Stats returns the general-purpose statistics of the server.
+// ErrNotSupported is returned by a sharded memcache, see ServerStats.
+func (mc *Memcache) Stats(ctx context.Context) (stats *Stats, err error) {
+	conn := mc.pool.Get(ctx)
+	stats, err = conn.StatsContext(ctx)
+	conn.Close()
+	return
+}
+
+// StatsSlabs returns the statistics of the slab classes of the server.
+// ErrNotSupported is returned by a sharded memcache, see ServerStatsSlabs.
+func (mc *Memcache) StatsSlabs(ctx context.Context) (stats *SlabStats, err error) {
+	conn := mc.pool.Get(ctx)
+	stats, err = conn.StatsSlabsContext(ctx)
+	conn.Close()
+	return
+}
+
+// Version returns the version string of the server.
+// ErrNotSupported is returned by a sharded memcache, see ServerVersions.
+func (mc *Memcache) Version(ctx context.Context) (version string, err error) {
+	conn := mc.pool.Get(ctx)
+	version, err = conn.VersionContext(ctx)
+	conn.Close()
+	return
+}
+
+// ServerStats returns the general-purpose statistics of every server by
+// address, the servers of a sharded memcache are queried in parallel. The
+// stats of the servers replying are returned along with the first error.
+func (mc *Memcache) ServerStats(ctx context.Context) (map[string]*Stats, error) {
+	results, err := mc.eachServer(ctx, func(c Conn) (interface{}, error) {
+		return c.StatsContext(ctx)
+	})
+	stats := make(map[string]*Stats, len(results))
+	for addr, r := range results {
+		stats[addr] = r.(*Stats)
+	}
+	return stats, err
+}
+
+// ServerStatsSlabs returns the statistics of the slab classes of every
+// server by address, see ServerStats.
+func (mc *Memcache) ServerStatsSlabs(ctx context.Context) (map[string]*SlabStats, error) {
+	results, err := mc.eachServer(ctx, func(c Conn) (interface{}, error) {
+		return c.StatsSlabsContext(ctx)
+	})
+	stats := make(map[string]*SlabStats, len(results))
+	for addr, r := range results {
+		stats[addr] = r.(*SlabStats)
+	}
+	return stats, err
+}
+
+// ServerVersions returns the version string of every server by address,
+// see ServerStats.
+func (mc *Memcache) ServerVersions(ctx context.Context) (map[string]string, error) {
+	results, err := mc.eachServer(ctx, func(c Conn) (interface{}, error) {
+		return c.VersionContext(ctx)
+	})
+	versions := make(map[string]string, len(results))
+	for addr, r := range results {
+		versions[addr] = r.(string)
+	}
+	return versions, err
+}
+
+// eachServer runs fn on a conn of every server at once, returning the
+// results of the servers succeeded by address and the first error.
+func (mc *Memcache) eachServer(ctx context.Context, fn func(c Conn) (interface{}, error)) (map[string]interface{}, error) {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		results  = make(map[string]interface{})
+		firstErr error
+	)
+	for addr, p := range mc.pool.servers() {
+		wg.Add(1)
+		go func(addr string, p *Pool) {
+			defer wg.Done()
+			conn := p.Get(ctx)
+			r, err := fn(conn)
+			conn.Close()
+			mu.Lock()
+			if err == nil {
+				results[addr] = r
+			} else if firstErr == nil {
+				firstErr = err
+			}
+			mu.Unlock()
+		}(addr, p)
+	}
+	wg.Wait()
+	return results, firstErr
+}
+
+// FlushAll invalidates all existing items, a sharded memcache flushes all
+// of its servers.
+func (mc *Memcache) FlushAll(ctx context.Context, delay int32) (err error) {
+	conn := mc.pool.Get(ctx)
+	err = conn.FlushAllContext(ctx, delay)
+	conn.Close()
+	return
+}
+
+// Verbosity sets the logging verbosity level of the server, a sharded
+// memcache sets it on all of its servers.
+func (mc *Memcache) Verbosity(ctx context.Context, level uint32) (err error) {
+	conn := mc.pool.Get(ctx)
+	err = conn.VerbosityContext(ctx, level)
+	conn.Close()
+	return
+}
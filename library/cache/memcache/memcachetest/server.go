@@ -0,0 +1,539 @@
+// Package memcachetest provides an in-process memcached server speaking the
+// ascii protocol, for tests of code using the memcache package without a
+// real memcached.
+package memcachetest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache/internal/fakeserver"
+)
+
+const (
+	// _maxKeyLen max key length accepted by memcached.
+	_maxKeyLen = 250
+	// _relativeExpire expirations up to 30 days are relative seconds,
+	// larger ones are unix timestamps.
+	_relativeExpire = 60 * 60 * 24 * 30
+	// DefaultItemSizeMax memcached default max item size.
+	DefaultItemSizeMax = 1024 * 1024
+	// Version reported by the version and stats commands.
+	Version = "1.6.21"
+)
+
+// Faults are injected into the replies of the server, the zero value
+// injects none.
+type Faults struct {
+	// Latency delays every reply.
+	Latency time.Duration
+	// ServerError replies "SERVER_ERROR <ServerError>" instead of executing
+	// commands.
+	ServerError string
+	// Drop closes the connection instead of replying.
+	Drop bool
+	// Commands limits faults to these commands, e.g. "get" or "set", all
+	// commands are affected when empty.
+	Commands []string
+}
+
+type item struct {
+	value []byte
+	flags uint32
+	cas   uint64
+	// expire zero never expires.
+	expire time.Time
+}
+
+// Server is an in-process memcached server.
+type Server struct {
+	// ItemSizeMax max value size, larger values are rejected with
+	// "SERVER_ERROR object too large for cache". Set before use.
+	ItemSizeMax int
+
+	l *fakeserver.Listener
+
+	mu    sync.Mutex
+	items map[string]*item
+	casID uint64
+	start time.Time
+	// stats by name, see stats.
+	stats     map[string]uint64
+	verbosity uint64
+}
+
+// NewServer starts a server listening on a random local port.
+func NewServer() (*Server, error) {
+	l, err := fakeserver.Listen()
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ItemSizeMax: DefaultItemSizeMax,
+		l:           l,
+		items:       make(map[string]*item),
+		start:       time.Now(),
+		stats:       make(map[string]uint64),
+	}
+	l.Serve(s.serveConn)
+	return s, nil
+}
+
+// Addr returns the "host:port" address of the server.
+func (s *Server) Addr() string {
+	return s.l.Addr()
+}
+
+// Close stops the server and closes all its connections.
+func (s *Server) Close() error {
+	return s.l.Close()
+}
+
+// Now returns the time of the server clock.
+func (s *Server) Now() time.Time {
+	return s.l.Now()
+}
+
+func (s *Server) now() time.Time {
+	return s.l.Now()
+}
+
+// Advance moves the server clock forward by d, expiring items.
+func (s *Server) Advance(d time.Duration) {
+	s.l.Advance(d)
+}
+
+// SetFaults replaces the injected faults.
+func (s *Server) SetFaults(f Faults) {
+	s.l.SetFaults(fakeserver.Faults{
+		Latency:  f.Latency,
+		Error:    f.ServerError,
+		Drop:     f.Drop,
+		Commands: f.Commands,
+	})
+}
+
+// CloseConns closes all current client connections, the server keeps
+// accepting new ones.
+func (s *Server) CloseConns() {
+	s.l.CloseConns()
+}
+
+// Flush removes all items.
+func (s *Server) Flush() {
+	s.mu.Lock()
+	s.items = make(map[string]*item)
+	s.mu.Unlock()
+}
+
+// Keys returns the sorted keys of all unexpired items.
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.items))
+	for k := range s.items {
+		if s.lookup(k) != nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) serveConn(c net.Conn) {
+	s.mu.Lock()
+	s.stats["total_connections"]++
+	s.mu.Unlock()
+	rw := bufio.NewReadWriter(bufio.NewReader(c), bufio.NewWriter(c))
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			rw.WriteString("ERROR\r\n")
+			rw.Flush()
+			continue
+		}
+		req := &request{cmd: fields[0], args: fields[1:]}
+		if isStorage(req.cmd) {
+			if req.data, err = readData(rw.Reader, req.args); err != nil {
+				rw.WriteString("CLIENT_ERROR " + err.Error() + "\r\n")
+				rw.Flush()
+				if err != errBadFormat {
+					return
+				}
+				continue
+			}
+		}
+		var reply string
+		drop, errText := s.l.Inject(req.cmd)
+		if drop {
+			return
+		}
+		if errText != "" {
+			reply = "SERVER_ERROR " + errText + "\r\n"
+		}
+		if reply == "" {
+			reply = s.exec(req)
+		}
+		if req.noreply() {
+			continue
+		}
+		rw.WriteString(reply)
+		if err = rw.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+var (
+	errBadFormat = fmt.Errorf("bad command line format")
+	errBadChunk  = fmt.Errorf("bad data chunk")
+)
+
+type request struct {
+	cmd  string
+	args []string
+	data []byte
+}
+
+func (r *request) noreply() bool {
+	if r.cmd == "get" || r.cmd == "gets" {
+		return false
+	}
+	return len(r.args) > 0 && r.args[len(r.args)-1] == "noreply"
+}
+
+func isStorage(cmd string) bool {
+	switch cmd {
+	case "set", "add", "replace", "cas":
+		return true
+	}
+	return false
+}
+
+// readData reads the data block of a storage command.
+func readData(r *bufio.Reader, args []string) ([]byte, error) {
+	if len(args) < 4 {
+		return nil, errBadFormat
+	}
+	size, err := strconv.Atoi(args[3])
+	if err != nil || size < 0 {
+		return nil, errBadFormat
+	}
+	data := make([]byte, size+2)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		return nil, errBadChunk
+	}
+	return data[:size], nil
+}
+
+func (s *Server) exec(req *request) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch req.cmd {
+	case "get", "gets", "gat", "gats":
+		return s.get(req)
+	case "set", "add", "replace", "cas":
+		return s.store(req)
+	case "incr", "decr":
+		return s.incrDecr(req)
+	case "touch":
+		return s.touch(req)
+	case "delete":
+		return s.delete(req)
+	case "stats":
+		return s.statsReply(req)
+	case "version":
+		return "VERSION " + Version + "\r\n"
+	case "flush_all":
+		return s.flushAll(req)
+	case "verbosity":
+		return s.setVerbosity(req)
+	}
+	return "ERROR\r\n"
+}
+
+// lookup returns the unexpired item of key, expired items are removed.
+func (s *Server) lookup(key string) *item {
+	it, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	if !it.expire.IsZero() && !s.now().Before(it.expire) {
+		delete(s.items, key)
+		return nil
+	}
+	return it
+}
+
+// expireTime converts a protocol expiration to the time the item expires.
+func (s *Server) expireTime(exp int64) time.Time {
+	switch {
+	case exp == 0:
+		return time.Time{}
+	case exp < 0:
+		return s.now()
+	case exp <= _relativeExpire:
+		return s.now().Add(time.Duration(exp) * time.Second)
+	}
+	return time.Unix(exp, 0)
+}
+
+func (s *Server) nextCAS() uint64 {
+	s.casID++
+	return s.casID
+}
+
+// get executes get|gets <key>* and gat|gats <exptime> <key>*.
+func (s *Server) get(req *request) string {
+	keys, touch := req.args, req.cmd == "gat" || req.cmd == "gats"
+	var exp int64
+	if touch {
+		if len(keys) == 0 {
+			return "ERROR\r\n"
+		}
+		var err error
+		if exp, err = strconv.ParseInt(keys[0], 10, 64); err != nil {
+			return "CLIENT_ERROR invalid exptime argument\r\n"
+		}
+		keys = keys[1:]
+	}
+	if len(keys) == 0 {
+		return "ERROR\r\n"
+	}
+	var b strings.Builder
+	for _, key := range keys {
+		if len(key) > _maxKeyLen {
+			return "CLIENT_ERROR bad command line format\r\n"
+		}
+		s.stats["cmd_get"]++
+		if touch {
+			s.stats["cmd_touch"]++
+		}
+		it := s.lookup(key)
+		if it == nil {
+			s.stats["get_misses"]++
+			if touch {
+				s.stats["touch_misses"]++
+			}
+			continue
+		}
+		s.stats["get_hits"]++
+		if touch {
+			s.stats["touch_hits"]++
+			it.expire = s.expireTime(exp)
+		}
+		if req.cmd == "gets" || req.cmd == "gats" {
+			fmt.Fprintf(&b, "VALUE %s %d %d %d\r\n", key, it.flags, len(it.value), it.cas)
+		} else {
+			fmt.Fprintf(&b, "VALUE %s %d %d\r\n", key, it.flags, len(it.value))
+		}
+		b.Write(it.value)
+		b.WriteString("\r\n")
+	}
+	b.WriteString("END\r\n")
+	return b.String()
+}
+
+// store executes <cmd> <key> <flags> <exptime> <bytes> [<cas>] [noreply].
+func (s *Server) store(req *request) string {
+	args := req.args
+	if req.cmd == "cas" && len(args) < 5 {
+		return "ERROR\r\n"
+	}
+	key := args[0]
+	if len(key) > _maxKeyLen {
+		return "CLIENT_ERROR bad command line format\r\n"
+	}
+	flags, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil {
+		return "CLIENT_ERROR bad command line format\r\n"
+	}
+	exp, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return "CLIENT_ERROR bad command line format\r\n"
+	}
+	s.stats["cmd_set"]++
+	if len(req.data) > s.ItemSizeMax {
+		delete(s.items, key)
+		return "SERVER_ERROR object too large for cache\r\n"
+	}
+	old := s.lookup(key)
+	switch req.cmd {
+	case "add":
+		if old != nil {
+			return "NOT_STORED\r\n"
+		}
+	case "replace":
+		if old == nil {
+			return "NOT_STORED\r\n"
+		}
+	case "cas":
+		cas, err := strconv.ParseUint(args[4], 10, 64)
+		if err != nil {
+			return "CLIENT_ERROR bad command line format\r\n"
+		}
+		if old == nil {
+			return "NOT_FOUND\r\n"
+		}
+		if old.cas != cas {
+			return "EXISTS\r\n"
+		}
+	}
+	s.items[key] = &item{
+		value:  req.data,
+		flags:  uint32(flags),
+		cas:    s.nextCAS(),
+		expire: s.expireTime(exp),
+	}
+	s.stats["total_items"]++
+	return "STORED\r\n"
+}
+
+// incrDecr executes incr|decr <key> <value> [noreply], decr stops at zero
+// and incr wraps around at 64 bits as memcached does.
+func (s *Server) incrDecr(req *request) string {
+	if len(req.args) < 2 {
+		return "ERROR\r\n"
+	}
+	delta, err := strconv.ParseUint(req.args[1], 10, 64)
+	if err != nil {
+		return "CLIENT_ERROR invalid numeric delta argument\r\n"
+	}
+	it := s.lookup(req.args[0])
+	if it == nil {
+		return "NOT_FOUND\r\n"
+	}
+	val, err := strconv.ParseUint(string(it.value), 10, 64)
+	if err != nil {
+		return "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n"
+	}
+	if req.cmd == "incr" {
+		val += delta
+	} else if delta > val {
+		val = 0
+	} else {
+		val -= delta
+	}
+	it.value = []byte(strconv.FormatUint(val, 10))
+	it.cas = s.nextCAS()
+	return string(it.value) + "\r\n"
+}
+
+func (s *Server) touch(req *request) string {
+	if len(req.args) < 2 {
+		return "ERROR\r\n"
+	}
+	exp, err := strconv.ParseInt(req.args[1], 10, 64)
+	if err != nil {
+		return "CLIENT_ERROR invalid exptime argument\r\n"
+	}
+	s.stats["cmd_touch"]++
+	it := s.lookup(req.args[0])
+	if it == nil {
+		s.stats["touch_misses"]++
+		return "NOT_FOUND\r\n"
+	}
+	s.stats["touch_hits"]++
+	it.expire = s.expireTime(exp)
+	return "TOUCHED\r\n"
+}
+
+func (s *Server) delete(req *request) string {
+	if len(req.args) < 1 {
+		return "ERROR\r\n"
+	}
+	if s.lookup(req.args[0]) == nil {
+		return "NOT_FOUND\r\n"
+	}
+	delete(s.items, req.args[0])
+	return "DELETED\r\n"
+}
+
+// statsReply executes stats [slabs], the server has no slab allocator so
+// its slab stats are empty.
+func (s *Server) statsReply(req *request) string {
+	var b strings.Builder
+	switch {
+	case len(req.args) == 0:
+		var size uint64
+		for k := range s.items {
+			if it := s.lookup(k); it != nil {
+				size += uint64(len(k) + len(it.value))
+			}
+		}
+		now := s.now()
+		fmt.Fprintf(&b, "STAT pid 1\r\n")
+		fmt.Fprintf(&b, "STAT uptime %d\r\n", int64(now.Sub(s.start)/time.Second))
+		fmt.Fprintf(&b, "STAT time %d\r\n", now.Unix())
+		fmt.Fprintf(&b, "STAT version %s\r\n", Version)
+		fmt.Fprintf(&b, "STAT curr_connections %d\r\n", s.l.Conns())
+		fmt.Fprintf(&b, "STAT curr_items %d\r\n", len(s.items))
+		fmt.Fprintf(&b, "STAT bytes %d\r\n", size)
+		fmt.Fprintf(&b, "STAT limit_maxbytes %d\r\n", 64*1024*1024)
+		fmt.Fprintf(&b, "STAT verbosity %d\r\n", s.verbosity)
+		names := make([]string, 0, len(s.stats))
+		for name := range s.stats {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&b, "STAT %s %d\r\n", name, s.stats[name])
+		}
+	case req.args[0] == "slabs":
+		b.WriteString("STAT active_slabs 0\r\nSTAT total_malloced 0\r\n")
+	default:
+		return "ERROR\r\n"
+	}
+	b.WriteString("END\r\n")
+	return b.String()
+}
+
+// flushAll executes flush_all [delay] [noreply].
+func (s *Server) flushAll(req *request) string {
+	s.stats["cmd_flush"]++
+	var delay int64
+	if len(req.args) > 0 && req.args[0] != "noreply" {
+		var err error
+		if delay, err = strconv.ParseInt(req.args[0], 10, 64); err != nil {
+			return "CLIENT_ERROR bad command line format\r\n"
+		}
+	}
+	if delay <= 0 {
+		s.items = make(map[string]*item)
+		return "OK\r\n"
+	}
+	at := s.expireTime(delay)
+	for _, it := range s.items {
+		if it.expire.IsZero() || it.expire.After(at) {
+			it.expire = at
+		}
+	}
+	return "OK\r\n"
+}
+
+func (s *Server) setVerbosity(req *request) string {
+	if len(req.args) == 0 {
+		return "ERROR\r\n"
+	}
+	level, err := strconv.ParseUint(req.args[0], 10, 32)
+	if err != nil {
+		return "CLIENT_ERROR bad command line format\r\n"
+	}
+	s.verbosity = level
+	return "OK\r\n"
+}
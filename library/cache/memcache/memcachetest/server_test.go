@@ -0,0 +1,218 @@
+package memcachetest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache/memcache"
+	"github.com/zombie-k/kylin/library/container/pool"
+	xtime "github.com/zombie-k/kylin/library/time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMemcache(t *testing.T) (*Server, *memcache.Memcache) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mc := memcache.New(&memcache.Config{
+		Config: &pool.Config{
+			Active:      10,
+			Idle:        5,
+			IdleTimeout: xtime.Duration(time.Minute),
+		},
+		Name:         "memcachetest",
+		Proto:        "tcp",
+		Addr:         s.Addr(),
+		DialTimeout:  xtime.Duration(time.Second),
+		ReadTimeout:  xtime.Duration(time.Second),
+		WriteTimeout: xtime.Duration(time.Second),
+	})
+	return s, mc
+}
+
+func TestServerCommands(t *testing.T) {
+	s, mc := newTestMemcache(t)
+	defer s.Close()
+	defer mc.Close()
+	ctx := context.Background()
+
+	assert.Nil(t, mc.Set(ctx, &memcache.Item{Key: "test", Value: []byte("hello"), Flags: memcache.FlagRAW}))
+	assert.Equal(t, memcache.ErrNotStored, mc.Add(ctx, &memcache.Item{Key: "test", Value: []byte("v")}))
+	assert.Equal(t, memcache.ErrNotStored, mc.Replace(ctx, &memcache.Item{Key: "miss", Value: []byte("v")}))
+	var v string
+	assert.Nil(t, mc.Get(ctx, "test").Scan(&v))
+	assert.Equal(t, "hello", v)
+
+	rs, err := mc.GetMulti(ctx, []string{"test", "miss"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"test"}, rs.Keys())
+	rs.Close()
+
+	// get replies carry no cas unique.
+	it := mc.Get(ctx, "test").Item()
+	it.Value = []byte("world")
+	assert.Equal(t, memcache.ErrCASConflict, mc.CompareAndSwap(ctx, it))
+
+	assert.Nil(t, mc.Set(ctx, &memcache.Item{Key: "counter", Value: []byte("10")}))
+	n, err := mc.Increment(ctx, "counter", 5)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(15), n)
+	n, err = mc.Decrement(ctx, "counter", 20)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), n)
+	_, err = mc.Increment(ctx, "test", 1)
+	assert.NotNil(t, err)
+	_, err = mc.Increment(ctx, "miss", 1)
+	assert.Equal(t, memcache.ErrNotFound, err)
+
+	assert.Nil(t, mc.Touch(ctx, "test", 10))
+	assert.Equal(t, memcache.ErrNotFound, mc.Touch(ctx, "miss", 10))
+	assert.Nil(t, mc.Delete(ctx, "test"))
+	assert.Equal(t, memcache.ErrNotFound, mc.Delete(ctx, "test"))
+	assert.Equal(t, []string{"counter"}, s.Keys())
+}
+
+func TestServerExpire(t *testing.T) {
+	s, mc := newTestMemcache(t)
+	defer s.Close()
+	defer mc.Close()
+	ctx := context.Background()
+
+	assert.Nil(t, mc.Set(ctx, &memcache.Item{Key: "ttl", Value: []byte("v"), Expiration: 10}))
+	assert.Nil(t, mc.Set(ctx, &memcache.Item{Key: "forever", Value: []byte("v")}))
+	s.Advance(9 * time.Second)
+	assert.Nil(t, mc.Get(ctx, "ttl").Scan(new(string)))
+	assert.Nil(t, mc.Touch(ctx, "ttl", 10))
+	s.Advance(9 * time.Second)
+	assert.Nil(t, mc.Get(ctx, "ttl").Scan(new(string)))
+	s.Advance(time.Second)
+	assert.Equal(t, memcache.ErrNotFound, mc.Get(ctx, "ttl").Scan(new(string)))
+
+	abs := s.Now().Add(time.Minute).Unix()
+	assert.Nil(t, mc.Set(ctx, &memcache.Item{Key: "abs", Value: []byte("v"), Expiration: int32(abs)}))
+	s.Advance(2 * time.Minute)
+	assert.Equal(t, []string{"forever"}, s.Keys())
+}
+
+func TestServerLargeValue(t *testing.T) {
+	s, mc := newTestMemcache(t)
+	defer s.Close()
+	defer mc.Close()
+	ctx := context.Background()
+
+	value := bytes.Repeat([]byte("0123456789"), 250*1000)
+	assert.Nil(t, mc.Set(ctx, &memcache.Item{Key: "large", Value: value}))
+	assert.Len(t, s.Keys(), 4)
+	var got []byte
+	assert.Nil(t, mc.Get(ctx, "large").Scan(&got))
+	assert.Equal(t, value, got)
+	// delete removes the header, the chunks are left to expire.
+	assert.Nil(t, mc.Delete(ctx, "large"))
+	assert.Equal(t, memcache.ErrNotFound, mc.Get(ctx, "large").Scan(&got))
+	assert.Len(t, s.Keys(), 3)
+}
+
+func TestServerFaults(t *testing.T) {
+	s, mc := newTestMemcache(t)
+	defer s.Close()
+	defer mc.Close()
+	ctx := context.Background()
+	item := &memcache.Item{Key: "test", Value: []byte("v")}
+
+	s.SetFaults(Faults{ServerError: "out of memory", Commands: []string{"set"}})
+	assert.NotNil(t, mc.Set(ctx, item))
+	assert.Equal(t, memcache.ErrNotFound, mc.Get(ctx, "test").Scan(new(string)))
+
+	s.SetFaults(Faults{Drop: true})
+	assert.NotNil(t, mc.Set(ctx, item))
+
+	s.SetFaults(Faults{Latency: 50 * time.Millisecond})
+	start := time.Now()
+	assert.Nil(t, mc.Set(ctx, item))
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	s.SetFaults(Faults{})
+	s.CloseConns()
+	// the first call may get a broken idle conn from the pool.
+	mc.Get(ctx, "test")
+	assert.Nil(t, mc.Get(ctx, "test").Scan(new(string)))
+}
+
+func TestServerGets(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	br := bufio.NewReader(c)
+	roundTrip := func(req string, lines int) (reply string) {
+		c.Write([]byte(req))
+		for i := 0; i < lines; i++ {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			reply += line
+		}
+		return
+	}
+	assert.Equal(t, "STORED\r\n", roundTrip("set test 3 0 2\r\nhi\r\n", 1))
+	assert.Equal(t, "VALUE test 3 2 1\r\nhi\r\nEND\r\n", roundTrip("gets test\r\n", 3))
+	assert.Equal(t, "EXISTS\r\n", roundTrip("cas test 3 0 2 9\r\nho\r\n", 1))
+	assert.Equal(t, "STORED\r\n", roundTrip("cas test 3 0 2 1\r\nho\r\n", 1))
+	assert.Equal(t, "NOT_FOUND\r\n", roundTrip("cas miss 3 0 2 1\r\nho\r\n", 1))
+	// noreply commands are executed silently.
+	assert.Equal(t, "DELETED\r\n", roundTrip("set test 0 0 1 noreply\r\nx\r\ndelete test\r\n", 1))
+	assert.Equal(t, "ERROR\r\n", roundTrip("unknown\r\n", 1))
+	assert.Equal(t, "CLIENT_ERROR bad data chunk\r\n", roundTrip("set test 0 0 1\r\nxyz\r\n", 1))
+}
+
+func TestServerGetAndTouchAdmin(t *testing.T) {
+	s, mc := newTestMemcache(t)
+	defer s.Close()
+	defer mc.Close()
+	ctx := context.Background()
+
+	assert.Nil(t, mc.Set(ctx, &memcache.Item{Key: "session", Value: []byte("v"), Expiration: 10}))
+	s.Advance(9 * time.Second)
+	var v string
+	assert.Nil(t, mc.GetAndTouch(ctx, "session", 10).Scan(&v))
+	assert.Equal(t, "v", v)
+	s.Advance(9 * time.Second)
+	rs, err := mc.GetMultiAndTouch(ctx, []string{"session", "miss"}, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"session"}, rs.Keys())
+	rs.Close()
+	assert.Equal(t, memcache.ErrNotFound, mc.GetAndTouch(ctx, "miss", 10).Scan(&v))
+
+	version, err := mc.Version(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, Version, version)
+	stats, err := mc.Stats(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, Version, stats.Version)
+	assert.Equal(t, uint64(1), stats.CurrItems)
+	assert.Equal(t, uint64(4), stats.CmdGet)
+	assert.Equal(t, uint64(2), stats.GetHits)
+	assert.Equal(t, uint64(2), stats.TouchHits)
+	slabs, err := mc.StatsSlabs(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, slabs.Slabs)
+
+	assert.Nil(t, mc.Verbosity(ctx, 1))
+	assert.Nil(t, mc.FlushAll(ctx, 5))
+	assert.Equal(t, []string{"session"}, s.Keys())
+	s.Advance(5 * time.Second)
+	assert.Empty(t, s.Keys())
+}
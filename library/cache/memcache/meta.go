@@ -0,0 +1,165 @@
+package memcache
+
+import (
+	"context"
+	"encoding/base64"
+)
+
+// Meta command modes of MetaSetOptions.Mode.
+const (
+	MetaModeSet     = "S"
+	MetaModeAdd     = "E"
+	MetaModeReplace = "R"
+	MetaModeAppend  = "A"
+	MetaModePrepend = "P"
+)
+
+// MetaGetOptions options of a meta get (mg).
+// Command Reference: https://github.com/memcached/memcached/wiki/MetaCommands
+type MetaGetOptions struct {
+	// NoValue only returns the item metadata.
+	NoValue bool
+	// Touch updates the item expiration to TTL.
+	Touch bool
+	TTL   int32
+	// Vivify creates an empty item with VivifyTTL on miss and hands the win
+	// token to this client, the others see Recaching until it is set.
+	Vivify    bool
+	VivifyTTL int32
+	// Recache hands the win token to the first client fetching the item
+	// when its remaining ttl drops below Recache seconds. Zero disables.
+	Recache int32
+	// Base64Key sends the key base64 encoded, so it may hold binary data.
+	Base64Key bool
+}
+
+// MetaSetOptions options of a meta set (ms).
+type MetaSetOptions struct {
+	// Mode is one of MetaModeSet (default), MetaModeAdd, MetaModeReplace,
+	// MetaModeAppend and MetaModePrepend.
+	Mode string
+	// CompareAndSwap only stores the item if its cas is unchanged since it
+	// was read, like CompareAndSwap.
+	CompareAndSwap bool
+	// Invalidate with CompareAndSwap stores the item as stale when its cas
+	// is older than the one in the cache, instead of failing.
+	Invalidate bool
+	// Base64Key sends the key base64 encoded, so it may hold binary data.
+	Base64Key bool
+}
+
+// MetaDeleteOptions options of a meta delete (md).
+type MetaDeleteOptions struct {
+	// Invalidate marks the item as stale instead of deleting it, the next
+	// MetaGet wins the token to recache it.
+	Invalidate bool
+	// TTL updates the expiration of an invalidated item, zero keeps it.
+	TTL int32
+	// Base64Key sends the key base64 encoded, so it may hold binary data.
+	Base64Key bool
+}
+
+// MetaArithmeticOptions options of a meta arithmetic (ma).
+type MetaArithmeticOptions struct {
+	// Decrement decrements instead of increments.
+	Decrement bool
+	// Delta defaults to 1 when zero.
+	Delta uint64
+	// Vivify creates the item with Initial and VivifyTTL on miss.
+	Vivify    bool
+	VivifyTTL int32
+	Initial   uint64
+	// Touch updates the item expiration to TTL.
+	Touch bool
+	TTL   int32
+	// Base64Key sends the key base64 encoded, so it may hold binary data.
+	Base64Key bool
+}
+
+// metaKey returns the key as sent over the wire.
+func metaKey(key string, b64 bool) (string, bool) {
+	if b64 {
+		if len(key) == 0 {
+			return "", false
+		}
+		key = base64.StdEncoding.EncodeToString([]byte(key))
+	}
+	return key, legalKey(key)
+}
+
+func (c *conn) MetaGetContext(ctx context.Context, key string, opts *MetaGetOptions) (*Item, error) {
+	if opts == nil {
+		opts = &MetaGetOptions{}
+	}
+	wkey, ok := metaKey(key, opts.Base64Key)
+	if !ok {
+		return nil, ErrMalformedKey
+	}
+	result, err := c.pconn.MetaGet(ctx, wkey, opts)
+	if err != nil {
+		return nil, err
+	}
+	result.Key = key
+	if opts.NoValue || opts.Base64Key || result.Flags&flagLargeValue != flagLargeValue {
+		return result, nil
+	}
+	return c.getLargeItem(ctx, result)
+}
+
+// MetaSetContext doesn't split large values, ErrValueSize is returned for
+// values over 1MB.
+func (c *conn) MetaSetContext(ctx context.Context, item *Item, opts *MetaSetOptions) error {
+	if opts == nil {
+		opts = &MetaSetOptions{}
+	}
+	wkey, ok := metaKey(item.Key, opts.Base64Key)
+	if !ok {
+		return ErrMalformedKey
+	}
+	data, flags, err := c.ed.encode(item)
+	if err != nil {
+		return err
+	}
+	if len(data) >= _largeValue {
+		return ErrValueSize
+	}
+	return c.pconn.MetaSet(ctx, wkey, item, flags, data, opts)
+}
+
+func (c *conn) MetaDeleteContext(ctx context.Context, key string, opts *MetaDeleteOptions) error {
+	if opts == nil {
+		opts = &MetaDeleteOptions{}
+	}
+	wkey, ok := metaKey(key, opts.Base64Key)
+	if !ok {
+		return ErrMalformedKey
+	}
+	return c.pconn.MetaDelete(ctx, wkey, opts)
+}
+
+func (c *conn) MetaArithmeticContext(ctx context.Context, key string, opts *MetaArithmeticOptions) (uint64, error) {
+	if opts == nil {
+		opts = &MetaArithmeticOptions{}
+	}
+	wkey, ok := metaKey(key, opts.Base64Key)
+	if !ok {
+		return 0, ErrMalformedKey
+	}
+	return c.pconn.MetaArithmetic(ctx, wkey, opts)
+}
+
+func (c *conn) MetaGet(key string, opts *MetaGetOptions) (*Item, error) {
+	return c.MetaGetContext(context.TODO(), key, opts)
+}
+
+func (c *conn) MetaSet(item *Item, opts *MetaSetOptions) error {
+	return c.MetaSetContext(context.TODO(), item, opts)
+}
+
+func (c *conn) MetaDelete(key string, opts *MetaDeleteOptions) error {
+	return c.MetaDeleteContext(context.TODO(), key, opts)
+}
+
+func (c *conn) MetaArithmetic(key string, opts *MetaArithmeticOptions) (uint64, error) {
+	return c.MetaArithmeticContext(context.TODO(), key, opts)
+}
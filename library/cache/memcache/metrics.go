@@ -20,6 +20,13 @@ var (
 		Help:      "memcache client requests error count.",
 		Labels:    []string{"name", "addr", "command", "error"},
 	})
+	_metricReqErrClass = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "requests",
+		Name:      "error_class_total",
+		Help:      "memcache client requests error count by class: timeout, network, protocol, pool, not_found, malformed_key or other.",
+		Labels:    []string{"name", "addr", "command", "class"},
+	})
 	_metricConnTotal = metric.NewCounterVec(&metric.CounterVecOpts{
 		Namespace: namespace,
 		Subsystem: "connections",
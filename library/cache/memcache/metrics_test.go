@@ -0,0 +1,111 @@
+package memcache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache/memcache/memcachetest"
+	"github.com/zombie-k/kylin/library/container/pool"
+	xtime "github.com/zombie-k/kylin/library/time"
+
+	pkgerr "github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+// counterValue reads a counter of the default prometheus registry.
+func counterValue(t *testing.T, name string, labels map[string]string) float64 {
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+	next:
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if v, ok := labels[lp.GetName()]; ok && v != lp.GetValue() {
+					continue next
+				}
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestPoolHitMiss(t *testing.T) {
+	s, err := memcachetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	mc := New(&Config{
+		Config:       &pool.Config{Active: 1, Idle: 1, IdleTimeout: xtime.Duration(time.Minute)},
+		Name:         "test_hit_miss",
+		Proto:        "tcp",
+		Addr:         s.Addr(),
+		DialTimeout:  xtime.Duration(time.Second),
+		ReadTimeout:  xtime.Duration(time.Second),
+		WriteTimeout: xtime.Duration(time.Second),
+	})
+	defer mc.Close()
+	ctx := context.Background()
+	name := map[string]string{"name": "test_hit_miss"}
+
+	assert.Nil(t, mc.Set(ctx, &Item{Key: "test1", Value: []byte("1")}))
+	assert.Nil(t, mc.Set(ctx, &Item{Key: "test2", Value: []byte("2")}))
+	assert.Nil(t, mc.Get(ctx, "test1").Scan(new(string)))
+	assert.Equal(t, ErrNotFound, mc.Get(ctx, "miss").Scan(new(string)))
+	rs, err := mc.GetMulti(ctx, []string{"test1", "test2", "miss1", "miss2"})
+	assert.Nil(t, err)
+	rs.Close()
+	assert.Equal(t, ErrNotFound, mc.Delete(ctx, "miss"))
+	assert.Equal(t, ErrMalformedKey, mc.Set(ctx, &Item{Key: "bad key", Value: []byte("1")}))
+
+	assert.Equal(t, float64(3), counterValue(t, "cache_hits_total", name))
+	assert.Equal(t, float64(3), counterValue(t, "cache_misses_total", name))
+	assert.Equal(t, float64(3), counterValue(t, "memcache_client_hits_total", name))
+	assert.Equal(t, float64(3), counterValue(t, "memcache_client_misses_total", name))
+	assert.Equal(t, float64(0), counterValue(t, "memcache_client_requests_error_class_total",
+		map[string]string{"name": "test_hit_miss", "command": "get"}))
+	assert.Equal(t, float64(1), counterValue(t, "memcache_client_requests_error_class_total",
+		map[string]string{"name": "test_hit_miss", "command": "delete", "class": "not_found"}))
+	assert.Equal(t, float64(1), counterValue(t, "memcache_client_requests_error_class_total",
+		map[string]string{"name": "test_hit_miss", "command": "set", "class": "malformed_key"}))
+}
+
+func TestErrClass(t *testing.T) {
+	tests := []struct {
+		err   error
+		class string
+	}{
+		{nil, ""},
+		{ErrNotStored, ""},
+		{ErrCASConflict, ""},
+		{ErrNotFound, "not_found"},
+		{ErrMalformedKey, "malformed_key"},
+		{ErrPoolExhausted, "pool"},
+		{context.DeadlineExceeded, "timeout"},
+		{pkgerr.WithStack(&net.OpError{Op: "read", Err: timeoutErr{}}), "timeout"},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "network"},
+		{pkgerr.WithStack(io.EOF), "network"},
+		{pkgerr.WithStack(protocolError("corrupt get reply")), "protocol"},
+		{ErrValueSize, "other"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.class, errClass(test.err), "%v", test.err)
+	}
+}
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
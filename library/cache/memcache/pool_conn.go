@@ -6,7 +6,11 @@ import (
 	"io"
 	"time"
 
+	"github.com/zombie-k/kylin/library/cache"
+	"github.com/zombie-k/kylin/library/cache/hotkey"
 	"github.com/zombie-k/kylin/library/container/pool"
+
+	pkgerr "github.com/pkg/errors"
 )
 
 // Pool memcache connection pool struct.
@@ -26,9 +30,11 @@ func NewPool(cfg *Config) (p *Pool) {
 	cnop := DialConnectTimeout(time.Duration(cfg.DialTimeout))
 	rdop := DialReadTimeout(time.Duration(cfg.ReadTimeout))
 	wrop := DialWriteTimeout(time.Duration(cfg.WriteTimeout))
+	prop := DialProtocol(cfg.Protocol)
+	hot := hotkey.Get(cfg.Name)
 	p1.New = func(ctx context.Context) (io.Closer, error) {
-		conn, err := Dial(cfg.Proto, cfg.Addr, cnop, rdop, wrop)
-		return newTraceConn(conn, fmt.Sprintf("%s://%s", cfg.Proto, cfg.Addr)), err
+		conn, err := Dial(cfg.Proto, cfg.Addr, cnop, rdop, wrop, prop)
+		return newTraceConn(conn, fmt.Sprintf("%s://%s", cfg.Proto, cfg.Addr), hot), err
 	}
 	p = &Pool{p: p1, c: cfg}
 	return
@@ -53,6 +59,10 @@ func (p *Pool) Close() error {
 	return p.p.Close()
 }
 
+func (p *Pool) servers() map[string]*Pool {
+	return map[string]*Pool{p.c.Addr: p}
+}
+
 type poolConn struct {
 	c   Conn
 	p   *Pool
@@ -65,9 +75,44 @@ func (pc *poolConn) pstat(key string, t time.Time, err error) {
 		if msg := pc.formatErr(err); msg != "" {
 			_metricReqErr.Inc(pc.p.c.Name, pc.p.c.Addr, key, msg)
 		}
-		return
+		if class := errClass(err); class != "" {
+			_metricReqErrClass.Inc(pc.p.c.Name, pc.p.c.Addr, key, class)
+		}
+	}
+}
+
+// hitMiss counts the keys found and missing by a get command, by the cache
+// name and by the server address.
+func (pc *poolConn) hitMiss(hits, misses int) {
+	if hits > 0 {
+		_metricHits.Add(float64(hits), pc.p.c.Name, pc.p.c.Addr)
+		cache.MetricHits.Add(float64(hits), pc.p.c.Name)
+	}
+	if misses > 0 {
+		_metricMisses.Add(float64(misses), pc.p.c.Name, pc.p.c.Addr)
+		cache.MetricMisses.Add(float64(misses), pc.p.c.Name)
+	}
+}
+
+// getStat records a get of a single key, ErrNotFound is a miss.
+func (pc *poolConn) getStat(key string, t time.Time, err error) {
+	switch pkgerr.Cause(err) {
+	case nil:
+		pc.hitMiss(1, 0)
+	case ErrNotFound:
+		pc.hitMiss(0, 1)
+		// a miss is not a failure of the request.
+		err = nil
+	}
+	pc.pstat(key, t, err)
+}
+
+// getMultiStat records a get of keys.
+func (pc *poolConn) getMultiStat(key string, t time.Time, keys []string, items map[string]*Item, err error) {
+	if err == nil {
+		pc.hitMiss(len(items), len(keys)-len(items))
 	}
-	_metricHits.Inc(pc.p.c.Name, pc.p.c.Addr)
+	pc.pstat(key, t, err)
 }
 
 func (pc *poolConn) Close() error {
@@ -128,6 +173,58 @@ func (pc *poolConn) Decrement(key string, delta uint64) (newValue uint64, err er
 	return pc.DecrementContext(pc.ctx, key, delta)
 }
 
+func (pc *poolConn) IncrementWithInitial(key string, delta, initial uint64, expiration int32) (newValue uint64, err error) {
+	return pc.IncrementWithInitialContext(pc.ctx, key, delta, initial, expiration)
+}
+
+func (pc *poolConn) DecrementWithInitial(key string, delta, initial uint64, expiration int32) (newValue uint64, err error) {
+	return pc.DecrementWithInitialContext(pc.ctx, key, delta, initial, expiration)
+}
+
+func (pc *poolConn) MetaGet(key string, opts *MetaGetOptions) (*Item, error) {
+	return pc.MetaGetContext(pc.ctx, key, opts)
+}
+
+func (pc *poolConn) MetaSet(item *Item, opts *MetaSetOptions) error {
+	return pc.MetaSetContext(pc.ctx, item, opts)
+}
+
+func (pc *poolConn) MetaDelete(key string, opts *MetaDeleteOptions) error {
+	return pc.MetaDeleteContext(pc.ctx, key, opts)
+}
+
+func (pc *poolConn) MetaArithmetic(key string, opts *MetaArithmeticOptions) (uint64, error) {
+	return pc.MetaArithmeticContext(pc.ctx, key, opts)
+}
+
+func (pc *poolConn) GetAndTouch(key string, seconds int32) (*Item, error) {
+	return pc.GetAndTouchContext(pc.ctx, key, seconds)
+}
+
+func (pc *poolConn) GetMultiAndTouch(keys []string, seconds int32) (map[string]*Item, error) {
+	return pc.GetMultiAndTouchContext(pc.ctx, keys, seconds)
+}
+
+func (pc *poolConn) Stats() (*Stats, error) {
+	return pc.StatsContext(pc.ctx)
+}
+
+func (pc *poolConn) StatsSlabs() (*SlabStats, error) {
+	return pc.StatsSlabsContext(pc.ctx)
+}
+
+func (pc *poolConn) Version() (string, error) {
+	return pc.VersionContext(pc.ctx)
+}
+
+func (pc *poolConn) FlushAll(delay int32) error {
+	return pc.FlushAllContext(pc.ctx, delay)
+}
+
+func (pc *poolConn) Verbosity(level uint32) error {
+	return pc.VerbosityContext(pc.ctx, level)
+}
+
 func (pc *poolConn) AddContext(ctx context.Context, item *Item) error {
 	now := time.Now()
 	err := pc.c.AddContext(ctx, item)
@@ -152,7 +249,7 @@ func (pc *poolConn) ReplaceContext(ctx context.Context, item *Item) error {
 func (pc *poolConn) GetContext(ctx context.Context, key string) (*Item, error) {
 	now := time.Now()
 	item, err := pc.c.Get(key)
-	pc.pstat("get", now, err)
+	pc.getStat("get", now, err)
 	return item, err
 }
 
@@ -163,7 +260,7 @@ func (pc *poolConn) GetMultiContext(ctx context.Context, keys []string) (map[str
 	}
 	now := time.Now()
 	items, err := pc.c.GetMulti(keys)
-	pc.pstat(keyWordGet, now, err)
+	pc.getMultiStat(keyWordGet, now, keys, items, err)
 	return items, err
 }
 
@@ -188,6 +285,20 @@ func (pc *poolConn) DecrementContext(ctx context.Context, key string, delta uint
 	return newValue, err
 }
 
+func (pc *poolConn) IncrementWithInitialContext(ctx context.Context, key string, delta, initial uint64, expiration int32) (uint64, error) {
+	now := time.Now()
+	newValue, err := pc.c.IncrementWithInitialContext(ctx, key, delta, initial, expiration)
+	pc.pstat("increment", now, err)
+	return newValue, err
+}
+
+func (pc *poolConn) DecrementWithInitialContext(ctx context.Context, key string, delta, initial uint64, expiration int32) (uint64, error) {
+	now := time.Now()
+	newValue, err := pc.c.DecrementWithInitialContext(ctx, key, delta, initial, expiration)
+	pc.pstat("decrement", now, err)
+	return newValue, err
+}
+
 func (pc *poolConn) CompareAndSwapContext(ctx context.Context, item *Item) error {
 	now := time.Now()
 	err := pc.c.CompareAndSwap(item)
@@ -201,3 +312,84 @@ func (pc *poolConn) TouchContext(ctx context.Context, key string, seconds int32)
 	pc.pstat("touch", now, err)
 	return err
 }
+
+func (pc *poolConn) MetaGetContext(ctx context.Context, key string, opts *MetaGetOptions) (*Item, error) {
+	now := time.Now()
+	item, err := pc.c.MetaGetContext(ctx, key, opts)
+	pc.getStat("mg", now, err)
+	return item, err
+}
+
+func (pc *poolConn) MetaSetContext(ctx context.Context, item *Item, opts *MetaSetOptions) error {
+	now := time.Now()
+	err := pc.c.MetaSetContext(ctx, item, opts)
+	pc.pstat("ms", now, err)
+	return err
+}
+
+func (pc *poolConn) MetaDeleteContext(ctx context.Context, key string, opts *MetaDeleteOptions) error {
+	now := time.Now()
+	err := pc.c.MetaDeleteContext(ctx, key, opts)
+	pc.pstat("md", now, err)
+	return err
+}
+
+func (pc *poolConn) MetaArithmeticContext(ctx context.Context, key string, opts *MetaArithmeticOptions) (uint64, error) {
+	now := time.Now()
+	newValue, err := pc.c.MetaArithmeticContext(ctx, key, opts)
+	pc.pstat("ma", now, err)
+	return newValue, err
+}
+
+func (pc *poolConn) GetAndTouchContext(ctx context.Context, key string, seconds int32) (*Item, error) {
+	now := time.Now()
+	item, err := pc.c.GetAndTouchContext(ctx, key, seconds)
+	pc.getStat("gat", now, err)
+	return item, err
+}
+
+func (pc *poolConn) GetMultiAndTouchContext(ctx context.Context, keys []string, seconds int32) (map[string]*Item, error) {
+	// if keys is empty slice returns empty map direct
+	if len(keys) == 0 {
+		return make(map[string]*Item), nil
+	}
+	now := time.Now()
+	items, err := pc.c.GetMultiAndTouchContext(ctx, keys, seconds)
+	pc.getMultiStat("gat", now, keys, items, err)
+	return items, err
+}
+
+func (pc *poolConn) StatsContext(ctx context.Context) (*Stats, error) {
+	now := time.Now()
+	stats, err := pc.c.StatsContext(ctx)
+	pc.pstat("stats", now, err)
+	return stats, err
+}
+
+func (pc *poolConn) StatsSlabsContext(ctx context.Context) (*SlabStats, error) {
+	now := time.Now()
+	stats, err := pc.c.StatsSlabsContext(ctx)
+	pc.pstat("stats", now, err)
+	return stats, err
+}
+
+func (pc *poolConn) VersionContext(ctx context.Context) (string, error) {
+	now := time.Now()
+	version, err := pc.c.VersionContext(ctx)
+	pc.pstat("version", now, err)
+	return version, err
+}
+
+func (pc *poolConn) FlushAllContext(ctx context.Context, delay int32) error {
+	now := time.Now()
+	err := pc.c.FlushAllContext(ctx, delay)
+	pc.pstat("flush_all", now, err)
+	return err
+}
+
+func (pc *poolConn) VerbosityContext(ctx context.Context, level uint32) error {
+	now := time.Now()
+	err := pc.c.VerbosityContext(ctx, level)
+	pc.pstat("verbosity", now, err)
+	return err
+}
@@ -0,0 +1,572 @@
+package memcache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zombie-k/kylin/library/log"
+	xtime "github.com/zombie-k/kylin/library/time"
+
+	pkgerr "github.com/pkg/errors"
+)
+
+// Server is a node of a sharded memcache.
+type Server struct {
+	Addr string
+	// Weight is the share of keys routed to the server relative to the
+	// others, zero is treated as one.
+	Weight int
+}
+
+// ShardedConfig sharded memcache config, the embedded Config is shared by
+// every server except for Addr.
+type ShardedConfig struct {
+	*Config
+
+	Servers []*Server
+	// EjectFailures is the number of consecutive connection failures after
+	// which a server is ejected from the ring. Zero means never eject.
+	EjectFailures int
+	// EjectTimeout is how long an ejected server stays out of the ring
+	// before it is tried again.
+	EjectTimeout xtime.Duration
+}
+
+// ShardOption specifies an option for a sharded memcache.
+type ShardOption struct {
+	f func(*shardOptions)
+}
+
+type shardOptions struct {
+	selector Selector
+}
+
+// ShardSelector specifies the Selector used to route keys to servers.
+// If this option is left out, a Ketama ring is used.
+func ShardSelector(s Selector) ShardOption {
+	return ShardOption{func(so *shardOptions) {
+		so.selector = s
+	}}
+}
+
+// NewSharded get a memcache client which spreads keys over cfg.Servers.
+// The returned client has the same behaviour as New, except that GetMulti
+// queries the servers in parallel and merges the results.
+func NewSharded(cfg *ShardedConfig, options ...ShardOption) *Memcache {
+	return &Memcache{pool: newShardPool(cfg, options...)}
+}
+
+type shardNode struct {
+	server *Server
+	pool   *Pool
+	// failures consecutive connection failures.
+	failures int32
+	// protected by shardPool.mu
+	ejected bool
+	retryAt time.Time
+}
+
+type shardPool struct {
+	c        *ShardedConfig
+	selector Selector
+	nodes    map[string]*shardNode
+
+	mu      sync.Mutex
+	ejected int32
+}
+
+func newShardPool(cfg *ShardedConfig, options ...ShardOption) *shardPool {
+	if len(cfg.Servers) == 0 {
+		panic("must config memcache servers")
+	}
+	so := shardOptions{selector: NewKetama()}
+	for _, option := range options {
+		option.f(&so)
+	}
+	p := &shardPool{
+		c:        cfg,
+		selector: so.selector,
+		nodes:    make(map[string]*shardNode, len(cfg.Servers)),
+	}
+	for _, s := range cfg.Servers {
+		c := *cfg.Config
+		c.Addr = s.Addr
+		p.nodes[s.Addr] = &shardNode{server: s, pool: NewPool(&c)}
+	}
+	p.selector.Set(cfg.Servers)
+	return p
+}
+
+// Get gets a connection which routes every command to the server owning
+// its key. The application must close the returned connection.
+func (p *shardPool) Get(ctx context.Context) Conn {
+	return &shardConn{p: p, ctx: ctx, conns: make(map[*shardNode]Conn, len(p.nodes))}
+}
+
+// Close release the resources used by the pool.
+func (p *shardPool) Close() (err error) {
+	for _, n := range p.nodes {
+		if e := n.pool.Close(); e != nil {
+			err = e
+		}
+	}
+	return
+}
+
+func (p *shardPool) servers() map[string]*Pool {
+	pools := make(map[string]*Pool, len(p.nodes))
+	for addr, n := range p.nodes {
+		pools[addr] = n.pool
+	}
+	return pools
+}
+
+func (p *shardPool) pick(key string) (*shardNode, error) {
+	if atomic.LoadInt32(&p.ejected) > 0 {
+		p.revive()
+	}
+	addr, err := p.selector.Pick(key)
+	if err != nil {
+		return nil, err
+	}
+	n, ok := p.nodes[addr]
+	if !ok {
+		return nil, pkgerr.Wrapf(ErrNoServers, "unknown server %s", addr)
+	}
+	return n, nil
+}
+
+// report records the result of a command sent to n, ejecting n once it
+// failed EjectFailures times in a row.
+func (p *shardPool) report(n *shardNode, err error) {
+	if p.c.EjectFailures <= 0 {
+		return
+	}
+	if err == nil {
+		if atomic.LoadInt32(&n.failures) != 0 {
+			atomic.StoreInt32(&n.failures, 0)
+		}
+		return
+	}
+	if atomic.AddInt32(&n.failures, 1) < int32(p.c.EjectFailures) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n.ejected {
+		return
+	}
+	n.ejected = true
+	n.retryAt = time.Now().Add(time.Duration(p.c.EjectTimeout))
+	atomic.AddInt32(&p.ejected, 1)
+	p.rebuildLocked()
+	log.Warn("memcache: %s eject server %s after %d failures, last error: %v", p.c.Name, n.server.Addr, p.c.EjectFailures, err)
+}
+
+// revive puts back the ejected servers whose EjectTimeout elapsed. A revived
+// server is ejected again on its first failure.
+func (p *shardPool) revive() {
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var changed bool
+	for _, n := range p.nodes {
+		if n.ejected && now.After(n.retryAt) {
+			n.ejected = false
+			atomic.StoreInt32(&n.failures, int32(p.c.EjectFailures-1))
+			atomic.AddInt32(&p.ejected, -1)
+			changed = true
+			log.Info("memcache: %s retry ejected server %s", p.c.Name, n.server.Addr)
+		}
+	}
+	if changed {
+		p.rebuildLocked()
+	}
+}
+
+func (p *shardPool) rebuildLocked() {
+	servers := make([]*Server, 0, len(p.c.Servers))
+	for _, s := range p.c.Servers {
+		if !p.nodes[s.Addr].ejected {
+			servers = append(servers, s)
+		}
+	}
+	p.selector.Set(servers)
+}
+
+// shardConn holds at most one pooled connection per server, opened on the
+// first command routed to it.
+type shardConn struct {
+	p      *shardPool
+	ctx    context.Context
+	conns  map[*shardNode]Conn
+	ed     *encodeDecode
+	closed bool
+}
+
+func (sc *shardConn) conn(key string) (Conn, *shardNode) {
+	if sc.closed {
+		return errConn{ErrConnClosed}, nil
+	}
+	n, err := sc.p.pick(key)
+	if err != nil {
+		return errConn{err}, nil
+	}
+	return sc.nodeConn(n), n
+}
+
+func (sc *shardConn) nodeConn(n *shardNode) Conn {
+	if c, ok := sc.conns[n]; ok {
+		return c
+	}
+	c := n.pool.Get(sc.ctx)
+	sc.conns[n] = c
+	return c
+}
+
+func (sc *shardConn) release(n *shardNode, c Conn) {
+	if n == nil {
+		return
+	}
+	err := c.Err()
+	sc.p.report(n, err)
+	if err != nil {
+		c.Close()
+		delete(sc.conns, n)
+	}
+}
+
+func (sc *shardConn) do(key string, fn func(c Conn) error) error {
+	c, n := sc.conn(key)
+	err := fn(c)
+	sc.release(n, c)
+	return err
+}
+
+func (sc *shardConn) Close() error {
+	if sc.closed {
+		return nil
+	}
+	sc.closed = true
+	for n, c := range sc.conns {
+		c.Close()
+		delete(sc.conns, n)
+	}
+	return nil
+}
+
+func (sc *shardConn) Err() error {
+	if sc.closed {
+		return ErrConnClosed
+	}
+	for _, c := range sc.conns {
+		if err := c.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sc *shardConn) AddContext(ctx context.Context, item *Item) error {
+	return sc.do(item.Key, func(c Conn) error { return c.AddContext(ctx, item) })
+}
+
+func (sc *shardConn) SetContext(ctx context.Context, item *Item) error {
+	return sc.do(item.Key, func(c Conn) error { return c.SetContext(ctx, item) })
+}
+
+func (sc *shardConn) ReplaceContext(ctx context.Context, item *Item) error {
+	return sc.do(item.Key, func(c Conn) error { return c.ReplaceContext(ctx, item) })
+}
+
+func (sc *shardConn) CompareAndSwapContext(ctx context.Context, item *Item) error {
+	return sc.do(item.Key, func(c Conn) error { return c.CompareAndSwapContext(ctx, item) })
+}
+
+func (sc *shardConn) GetContext(ctx context.Context, key string) (item *Item, err error) {
+	err = sc.do(key, func(c Conn) (e error) {
+		item, e = c.GetContext(ctx, key)
+		return
+	})
+	return
+}
+
+func (sc *shardConn) GetMultiContext(ctx context.Context, keys []string) (map[string]*Item, error) {
+	return sc.getMulti(keys, func(c Conn, keys []string) (map[string]*Item, error) {
+		return c.GetMultiContext(ctx, keys)
+	})
+}
+
+// getMulti groups keys by server and runs get on the groups in parallel.
+// A failing server does not discard the others: the hits of the healthy
+// servers are returned along with the first error.
+func (sc *shardConn) getMulti(keys []string, get func(c Conn, keys []string) (map[string]*Item, error)) (map[string]*Item, error) {
+	type batch struct {
+		n    *shardNode
+		c    Conn
+		keys []string
+	}
+	batches := make(map[*shardNode]*batch)
+	for _, key := range keys {
+		c, n := sc.conn(key)
+		if n == nil {
+			for _, b := range batches {
+				sc.release(b.n, b.c)
+			}
+			return nil, c.Err()
+		}
+		b, ok := batches[n]
+		if !ok {
+			b = &batch{n: n, c: c}
+			batches[n] = b
+		}
+		b.keys = append(b.keys, key)
+	}
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+		results  = make(map[string]*Item, len(keys))
+	)
+	for _, b := range batches {
+		wg.Add(1)
+		go func(b *batch) {
+			defer wg.Done()
+			items, err := get(b.c, b.keys)
+			mu.Lock()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			for k, v := range items {
+				results[k] = v
+			}
+			mu.Unlock()
+		}(b)
+	}
+	wg.Wait()
+	for _, b := range batches {
+		sc.release(b.n, b.c)
+	}
+	return results, firstErr
+}
+
+func (sc *shardConn) DeleteContext(ctx context.Context, key string) error {
+	return sc.do(key, func(c Conn) error { return c.DeleteContext(ctx, key) })
+}
+
+func (sc *shardConn) IncrementContext(ctx context.Context, key string, delta uint64) (newValue uint64, err error) {
+	err = sc.do(key, func(c Conn) (e error) {
+		newValue, e = c.IncrementContext(ctx, key, delta)
+		return
+	})
+	return
+}
+
+func (sc *shardConn) DecrementContext(ctx context.Context, key string, delta uint64) (newValue uint64, err error) {
+	err = sc.do(key, func(c Conn) (e error) {
+		newValue, e = c.DecrementContext(ctx, key, delta)
+		return
+	})
+	return
+}
+
+func (sc *shardConn) IncrementWithInitialContext(ctx context.Context, key string, delta, initial uint64, expiration int32) (newValue uint64, err error) {
+	err = sc.do(key, func(c Conn) (e error) {
+		newValue, e = c.IncrementWithInitialContext(ctx, key, delta, initial, expiration)
+		return
+	})
+	return
+}
+
+func (sc *shardConn) DecrementWithInitialContext(ctx context.Context, key string, delta, initial uint64, expiration int32) (newValue uint64, err error) {
+	err = sc.do(key, func(c Conn) (e error) {
+		newValue, e = c.DecrementWithInitialContext(ctx, key, delta, initial, expiration)
+		return
+	})
+	return
+}
+
+func (sc *shardConn) TouchContext(ctx context.Context, key string, seconds int32) error {
+	return sc.do(key, func(c Conn) error { return c.TouchContext(ctx, key, seconds) })
+}
+
+func (sc *shardConn) MetaGetContext(ctx context.Context, key string, opts *MetaGetOptions) (item *Item, err error) {
+	err = sc.do(key, func(c Conn) (e error) {
+		item, e = c.MetaGetContext(ctx, key, opts)
+		return
+	})
+	return
+}
+
+func (sc *shardConn) MetaSetContext(ctx context.Context, item *Item, opts *MetaSetOptions) error {
+	return sc.do(item.Key, func(c Conn) error { return c.MetaSetContext(ctx, item, opts) })
+}
+
+func (sc *shardConn) MetaDeleteContext(ctx context.Context, key string, opts *MetaDeleteOptions) error {
+	return sc.do(key, func(c Conn) error { return c.MetaDeleteContext(ctx, key, opts) })
+}
+
+func (sc *shardConn) MetaArithmeticContext(ctx context.Context, key string, opts *MetaArithmeticOptions) (newValue uint64, err error) {
+	err = sc.do(key, func(c Conn) (e error) {
+		newValue, e = c.MetaArithmeticContext(ctx, key, opts)
+		return
+	})
+	return
+}
+
+func (sc *shardConn) GetAndTouchContext(ctx context.Context, key string, seconds int32) (item *Item, err error) {
+	err = sc.do(key, func(c Conn) (e error) {
+		item, e = c.GetAndTouchContext(ctx, key, seconds)
+		return
+	})
+	return
+}
+
+func (sc *shardConn) GetMultiAndTouchContext(ctx context.Context, keys []string, seconds int32) (map[string]*Item, error) {
+	return sc.getMulti(keys, func(c Conn, keys []string) (map[string]*Item, error) {
+		return c.GetMultiAndTouchContext(ctx, keys, seconds)
+	})
+}
+
+// StatsContext is not supported, stats are per server, use
+// Memcache.ServerStats instead.
+func (sc *shardConn) StatsContext(ctx context.Context) (*Stats, error) {
+	return nil, ErrNotSupported
+}
+
+// StatsSlabsContext is not supported, see StatsContext.
+func (sc *shardConn) StatsSlabsContext(ctx context.Context) (*SlabStats, error) {
+	return nil, ErrNotSupported
+}
+
+// VersionContext is not supported, see StatsContext.
+func (sc *shardConn) VersionContext(ctx context.Context) (string, error) {
+	return "", ErrNotSupported
+}
+
+// FlushAllContext flushes every server, including ejected ones.
+func (sc *shardConn) FlushAllContext(ctx context.Context, delay int32) error {
+	return sc.broadcast(func(c Conn) error { return c.FlushAllContext(ctx, delay) })
+}
+
+// VerbosityContext sets the verbosity of every server, including ejected ones.
+func (sc *shardConn) VerbosityContext(ctx context.Context, level uint32) error {
+	return sc.broadcast(func(c Conn) error { return c.VerbosityContext(ctx, level) })
+}
+
+// broadcast runs fn on every server, returning the first error.
+func (sc *shardConn) broadcast(fn func(c Conn) error) (err error) {
+	if sc.closed {
+		return ErrConnClosed
+	}
+	for _, n := range sc.p.nodes {
+		c := sc.nodeConn(n)
+		if e := fn(c); e != nil && err == nil {
+			err = e
+		}
+		sc.release(n, c)
+	}
+	return
+}
+
+func (sc *shardConn) Add(item *Item) error {
+	return sc.AddContext(sc.ctx, item)
+}
+
+func (sc *shardConn) Set(item *Item) error {
+	return sc.SetContext(sc.ctx, item)
+}
+
+func (sc *shardConn) Replace(item *Item) error {
+	return sc.ReplaceContext(sc.ctx, item)
+}
+
+func (sc *shardConn) CompareAndSwap(item *Item) error {
+	return sc.CompareAndSwapContext(sc.ctx, item)
+}
+
+func (sc *shardConn) Get(key string) (*Item, error) {
+	return sc.GetContext(sc.ctx, key)
+}
+
+func (sc *shardConn) GetMulti(keys []string) (map[string]*Item, error) {
+	return sc.GetMultiContext(sc.ctx, keys)
+}
+
+func (sc *shardConn) Delete(key string) error {
+	return sc.DeleteContext(sc.ctx, key)
+}
+
+func (sc *shardConn) Increment(key string, delta uint64) (uint64, error) {
+	return sc.IncrementContext(sc.ctx, key, delta)
+}
+
+func (sc *shardConn) Decrement(key string, delta uint64) (uint64, error) {
+	return sc.DecrementContext(sc.ctx, key, delta)
+}
+
+func (sc *shardConn) IncrementWithInitial(key string, delta, initial uint64, expiration int32) (uint64, error) {
+	return sc.IncrementWithInitialContext(sc.ctx, key, delta, initial, expiration)
+}
+
+func (sc *shardConn) DecrementWithInitial(key string, delta, initial uint64, expiration int32) (uint64, error) {
+	return sc.DecrementWithInitialContext(sc.ctx, key, delta, initial, expiration)
+}
+
+func (sc *shardConn) Touch(key string, seconds int32) error {
+	return sc.TouchContext(sc.ctx, key, seconds)
+}
+
+func (sc *shardConn) MetaGet(key string, opts *MetaGetOptions) (*Item, error) {
+	return sc.MetaGetContext(sc.ctx, key, opts)
+}
+
+func (sc *shardConn) MetaSet(item *Item, opts *MetaSetOptions) error {
+	return sc.MetaSetContext(sc.ctx, item, opts)
+}
+
+func (sc *shardConn) MetaDelete(key string, opts *MetaDeleteOptions) error {
+	return sc.MetaDeleteContext(sc.ctx, key, opts)
+}
+
+func (sc *shardConn) MetaArithmetic(key string, opts *MetaArithmeticOptions) (uint64, error) {
+	return sc.MetaArithmeticContext(sc.ctx, key, opts)
+}
+
+func (sc *shardConn) GetAndTouch(key string, seconds int32) (*Item, error) {
+	return sc.GetAndTouchContext(sc.ctx, key, seconds)
+}
+
+func (sc *shardConn) GetMultiAndTouch(keys []string, seconds int32) (map[string]*Item, error) {
+	return sc.GetMultiAndTouchContext(sc.ctx, keys, seconds)
+}
+
+func (sc *shardConn) Stats() (*Stats, error) {
+	return sc.StatsContext(sc.ctx)
+}
+
+func (sc *shardConn) StatsSlabs() (*SlabStats, error) {
+	return sc.StatsSlabsContext(sc.ctx)
+}
+
+func (sc *shardConn) Version() (string, error) {
+	return sc.VersionContext(sc.ctx)
+}
+
+func (sc *shardConn) FlushAll(delay int32) error {
+	return sc.FlushAllContext(sc.ctx, delay)
+}
+
+func (sc *shardConn) Verbosity(level uint32) error {
+	return sc.VerbosityContext(sc.ctx, level)
+}
+
+func (sc *shardConn) Scan(item *Item, v interface{}) error {
+	// NOTE: items may come from several servers, decode with an own codec.
+	if sc.ed == nil {
+		sc.ed = newEncodeDecoder()
+	}
+	return pkgerr.WithStack(sc.ed.decode(item, v))
+}
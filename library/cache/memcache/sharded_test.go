@@ -0,0 +1,193 @@
+package memcache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache/memcache/memcachetest"
+	"github.com/zombie-k/kylin/library/container/pool"
+	xtime "github.com/zombie-k/kylin/library/time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testShardedConfig(addrs ...string) *ShardedConfig {
+	cfg := &ShardedConfig{
+		Config: &Config{
+			Config: &pool.Config{
+				Active:      10,
+				Idle:        5,
+				IdleTimeout: xtime.Duration(90 * time.Second),
+			},
+			Name:         "test_sharded",
+			Proto:        "tcp",
+			DialTimeout:  xtime.Duration(100 * time.Millisecond),
+			ReadTimeout:  xtime.Duration(time.Second),
+			WriteTimeout: xtime.Duration(time.Second),
+		},
+		EjectFailures: 2,
+		EjectTimeout:  xtime.Duration(100 * time.Millisecond),
+	}
+	for _, addr := range addrs {
+		cfg.Servers = append(cfg.Servers, &Server{Addr: addr})
+	}
+	return cfg
+}
+
+func TestShardedEject(t *testing.T) {
+	// nothing listens on port 1, every dial fails.
+	p := newShardPool(testShardedConfig("127.0.0.1:1"))
+	defer p.Close()
+
+	c := p.Get(context.Background())
+	for i := 0; i < 2; i++ {
+		_, err := c.Get("test")
+		assert.NotNil(t, err)
+	}
+	_, err := c.Get("test")
+	assert.Equal(t, ErrNoServers, err)
+	c.Close()
+
+	time.Sleep(150 * time.Millisecond)
+	c = p.Get(context.Background())
+	_, err = c.Get("test")
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrNoServers, err)
+	// revived server is ejected again on its first failure.
+	_, err = c.Get("test")
+	assert.Equal(t, ErrNoServers, err)
+	c.Close()
+}
+
+func TestShardedConnClosed(t *testing.T) {
+	mc := NewSharded(testShardedConfig("127.0.0.1:1", "127.0.0.1:2"))
+	defer mc.Close()
+
+	c := mc.Conn(context.Background())
+	c.Close()
+	assert.Equal(t, ErrConnClosed, c.Err())
+	_, err := c.Get("test")
+	assert.Equal(t, ErrConnClosed, err)
+
+	rs, err := mc.GetMulti(context.Background(), []string{})
+	assert.Nil(t, err)
+	assert.Empty(t, rs.Keys())
+}
+
+func TestShardedGetAndTouchAdmin(t *testing.T) {
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		s, err := memcachetest.NewServer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		addrs = append(addrs, s.Addr())
+	}
+	mc := NewSharded(testShardedConfig(addrs...))
+	defer mc.Close()
+	ctx := context.Background()
+
+	keys := []string{"test1", "test2", "test3", "test4"}
+	for _, key := range keys {
+		assert.Nil(t, mc.Set(ctx, &Item{Key: key, Value: []byte(key)}))
+	}
+	rs, err := mc.GetMultiAndTouch(ctx, keys, 60)
+	assert.Nil(t, err)
+	assert.Len(t, rs.Keys(), 4)
+	rs.Close()
+	_, err = mc.Stats(ctx)
+	assert.Equal(t, ErrNotSupported, err)
+	assert.Nil(t, mc.FlushAll(ctx, 0))
+	rs, err = mc.GetMulti(ctx, keys)
+	assert.Nil(t, err)
+	assert.Empty(t, rs.Keys())
+}
+
+func TestShardedGetMultiPartial(t *testing.T) {
+	var (
+		servers []*memcachetest.Server
+		addrs   []string
+	)
+	for i := 0; i < 2; i++ {
+		s, err := memcachetest.NewServer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		servers = append(servers, s)
+		addrs = append(addrs, s.Addr())
+	}
+	mc := NewSharded(testShardedConfig(addrs...))
+	defer mc.Close()
+	ctx := context.Background()
+
+	var keys []string
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("test%d", i)
+		keys = append(keys, key)
+		assert.Nil(t, mc.Set(ctx, &Item{Key: key, Value: []byte(key)}))
+	}
+	servers[1].SetFaults(memcachetest.Faults{ServerError: "down", Commands: []string{"get", "gets"}})
+
+	// the hits of the healthy server are returned with the error.
+	c := mc.Conn(ctx)
+	defer c.Close()
+	items, err := c.GetMultiContext(ctx, keys)
+	assert.NotNil(t, err)
+	assert.NotEmpty(t, items)
+	assert.True(t, len(items) < len(keys))
+	assert.Equal(t, len(items), len(servers[0].Keys()))
+	for key, item := range items {
+		assert.Equal(t, key, string(item.Value))
+	}
+}
+
+func TestShardedServerStats(t *testing.T) {
+	var (
+		servers []*memcachetest.Server
+		addrs   []string
+	)
+	for i := 0; i < 2; i++ {
+		s, err := memcachetest.NewServer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		servers = append(servers, s)
+		addrs = append(addrs, s.Addr())
+	}
+	mc := NewSharded(testShardedConfig(addrs...))
+	defer mc.Close()
+	ctx := context.Background()
+
+	stats, err := mc.ServerStats(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, stats, 2)
+	for _, addr := range addrs {
+		assert.Equal(t, memcachetest.Version, stats[addr].Version)
+	}
+	slabs, err := mc.ServerStatsSlabs(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, slabs, 2)
+	versions, err := mc.ServerVersions(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{addrs[0]: memcachetest.Version, addrs[1]: memcachetest.Version}, versions)
+
+	// the servers replying are returned with the error.
+	servers[1].SetFaults(memcachetest.Faults{ServerError: "down", Commands: []string{"version"}})
+	versions, err = mc.ServerVersions(ctx)
+	assert.NotNil(t, err)
+	assert.Equal(t, map[string]string{addrs[0]: memcachetest.Version}, versions)
+
+	// a single server is keyed by its address too.
+	cfg := testShardedConfig().Config
+	cfg.Addr = addrs[0]
+	single := New(cfg)
+	defer single.Close()
+	versions, err = single.ServerVersions(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{addrs[0]: memcachetest.Version}, versions)
+}
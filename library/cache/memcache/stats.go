@@ -0,0 +1,231 @@
+package memcache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// Stats general-purpose statistics of a memcached server.
+// Stats reference: https://github.com/memcached/memcached/blob/master/doc/protocol.txt
+type Stats struct {
+	Pid              uint64
+	Uptime           uint64
+	Time             uint64
+	Version          string
+	Threads          uint64
+	CurrConnections  uint64
+	TotalConnections uint64
+	CmdGet           uint64
+	CmdSet           uint64
+	CmdFlush         uint64
+	CmdTouch         uint64
+	GetHits          uint64
+	GetMisses        uint64
+	GetExpired       uint64
+	DeleteHits       uint64
+	DeleteMisses     uint64
+	IncrHits         uint64
+	IncrMisses       uint64
+	DecrHits         uint64
+	DecrMisses       uint64
+	CasHits          uint64
+	CasMisses        uint64
+	CasBadval        uint64
+	TouchHits        uint64
+	TouchMisses      uint64
+	BytesRead        uint64
+	BytesWritten     uint64
+	LimitMaxbytes    uint64
+	CurrItems        uint64
+	TotalItems       uint64
+	Bytes            uint64
+	Evictions        uint64
+	Reclaimed        uint64
+
+	// Raw holds every stat by name, including the ones not parsed above.
+	Raw map[string]string
+}
+
+func (s *Stats) fields() map[string]*uint64 {
+	return map[string]*uint64{
+		"pid":               &s.Pid,
+		"uptime":            &s.Uptime,
+		"time":              &s.Time,
+		"threads":           &s.Threads,
+		"curr_connections":  &s.CurrConnections,
+		"total_connections": &s.TotalConnections,
+		"cmd_get":           &s.CmdGet,
+		"cmd_set":           &s.CmdSet,
+		"cmd_flush":         &s.CmdFlush,
+		"cmd_touch":         &s.CmdTouch,
+		"get_hits":          &s.GetHits,
+		"get_misses":        &s.GetMisses,
+		"get_expired":       &s.GetExpired,
+		"delete_hits":       &s.DeleteHits,
+		"delete_misses":     &s.DeleteMisses,
+		"incr_hits":         &s.IncrHits,
+		"incr_misses":       &s.IncrMisses,
+		"decr_hits":         &s.DecrHits,
+		"decr_misses":       &s.DecrMisses,
+		"cas_hits":          &s.CasHits,
+		"cas_misses":        &s.CasMisses,
+		"cas_badval":        &s.CasBadval,
+		"touch_hits":        &s.TouchHits,
+		"touch_misses":      &s.TouchMisses,
+		"bytes_read":        &s.BytesRead,
+		"bytes_written":     &s.BytesWritten,
+		"limit_maxbytes":    &s.LimitMaxbytes,
+		"curr_items":        &s.CurrItems,
+		"total_items":       &s.TotalItems,
+		"bytes":             &s.Bytes,
+		"evictions":         &s.Evictions,
+		"reclaimed":         &s.Reclaimed,
+	}
+}
+
+// SlabStats statistics of the slab classes of a memcached server.
+type SlabStats struct {
+	ActiveSlabs   uint64
+	TotalMalloced uint64
+	// Slabs are the slab classes by id.
+	Slabs map[int]*SlabClass
+}
+
+// SlabClass statistics of a slab class.
+type SlabClass struct {
+	ChunkSize     uint64
+	ChunksPerPage uint64
+	TotalPages    uint64
+	TotalChunks   uint64
+	UsedChunks    uint64
+	FreeChunks    uint64
+	FreeChunksEnd uint64
+	GetHits       uint64
+	CmdSet        uint64
+	DeleteHits    uint64
+	IncrHits      uint64
+	DecrHits      uint64
+	CasHits       uint64
+	CasBadval     uint64
+	TouchHits     uint64
+
+	// Raw holds every stat of the class by name.
+	Raw map[string]string
+}
+
+func (s *SlabClass) fields() map[string]*uint64 {
+	return map[string]*uint64{
+		"chunk_size":      &s.ChunkSize,
+		"chunks_per_page": &s.ChunksPerPage,
+		"total_pages":     &s.TotalPages,
+		"total_chunks":    &s.TotalChunks,
+		"used_chunks":     &s.UsedChunks,
+		"free_chunks":     &s.FreeChunks,
+		"free_chunks_end": &s.FreeChunksEnd,
+		"get_hits":        &s.GetHits,
+		"cmd_set":         &s.CmdSet,
+		"delete_hits":     &s.DeleteHits,
+		"incr_hits":       &s.IncrHits,
+		"decr_hits":       &s.DecrHits,
+		"cas_hits":        &s.CasHits,
+		"cas_badval":      &s.CasBadval,
+		"touch_hits":      &s.TouchHits,
+	}
+}
+
+// parseStat sets the field of name, unknown names and malformed values are
+// only kept raw, servers add stats between versions.
+func parseStat(fields map[string]*uint64, name, value string) {
+	if f, ok := fields[name]; ok {
+		*f, _ = strconv.ParseUint(value, 10, 64)
+	}
+}
+
+func newStats(raw map[string]string) *Stats {
+	s := &Stats{Raw: raw, Version: raw["version"]}
+	fields := s.fields()
+	for name, value := range raw {
+		parseStat(fields, name, value)
+	}
+	return s
+}
+
+func newSlabStats(raw map[string]string) *SlabStats {
+	s := &SlabStats{Slabs: make(map[int]*SlabClass)}
+	for name, value := range raw {
+		switch name {
+		case "active_slabs":
+			s.ActiveSlabs, _ = strconv.ParseUint(value, 10, 64)
+			continue
+		case "total_malloced":
+			s.TotalMalloced, _ = strconv.ParseUint(value, 10, 64)
+			continue
+		}
+		// class stats are named <class id>:<name>.
+		i := strings.IndexByte(name, ':')
+		if i < 0 {
+			continue
+		}
+		id, err := strconv.Atoi(name[:i])
+		if err != nil {
+			continue
+		}
+		class, ok := s.Slabs[id]
+		if !ok {
+			class = &SlabClass{Raw: make(map[string]string)}
+			s.Slabs[id] = class
+		}
+		class.Raw[name[i+1:]] = value
+		parseStat(class.fields(), name[i+1:], value)
+	}
+	return s
+}
+
+func (c *conn) StatsContext(ctx context.Context) (*Stats, error) {
+	raw, err := c.pconn.Stats(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	return newStats(raw), nil
+}
+
+func (c *conn) StatsSlabsContext(ctx context.Context) (*SlabStats, error) {
+	raw, err := c.pconn.Stats(ctx, "slabs")
+	if err != nil {
+		return nil, err
+	}
+	return newSlabStats(raw), nil
+}
+
+func (c *conn) VersionContext(ctx context.Context) (string, error) {
+	return c.pconn.Version(ctx)
+}
+
+func (c *conn) FlushAllContext(ctx context.Context, delay int32) error {
+	return c.pconn.FlushAll(ctx, delay)
+}
+
+func (c *conn) VerbosityContext(ctx context.Context, level uint32) error {
+	return c.pconn.Verbosity(ctx, level)
+}
+
+func (c *conn) Stats() (*Stats, error) {
+	return c.StatsContext(context.TODO())
+}
+
+func (c *conn) StatsSlabs() (*SlabStats, error) {
+	return c.StatsSlabsContext(context.TODO())
+}
+
+func (c *conn) Version() (string, error) {
+	return c.VersionContext(context.TODO())
+}
+
+func (c *conn) FlushAll(delay int32) error {
+	return c.FlushAllContext(context.TODO(), delay)
+}
+
+func (c *conn) Verbosity(level uint32) error {
+	return c.VerbosityContext(context.TODO(), level)
+}
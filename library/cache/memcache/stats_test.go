@@ -0,0 +1,79 @@
+package memcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStats(t *testing.T) {
+	s := newStats(map[string]string{
+		"pid":       "42",
+		"version":   "1.6.21",
+		"get_hits":  "7",
+		"rusage_us": "0.5",
+		"evictions": "bad",
+	})
+	assert.Equal(t, uint64(42), s.Pid)
+	assert.Equal(t, "1.6.21", s.Version)
+	assert.Equal(t, uint64(7), s.GetHits)
+	assert.Equal(t, uint64(0), s.Evictions)
+	assert.Equal(t, "0.5", s.Raw["rusage_us"])
+}
+
+func TestNewSlabStats(t *testing.T) {
+	s := newSlabStats(map[string]string{
+		"1:chunk_size":   "96",
+		"1:used_chunks":  "3",
+		"1:mem_used":     "288",
+		"5:chunk_size":   "240",
+		"active_slabs":   "2",
+		"total_malloced": "2097152",
+	})
+	assert.Equal(t, uint64(2), s.ActiveSlabs)
+	assert.Equal(t, uint64(2097152), s.TotalMalloced)
+	assert.Len(t, s.Slabs, 2)
+	assert.Equal(t, uint64(96), s.Slabs[1].ChunkSize)
+	assert.Equal(t, uint64(3), s.Slabs[1].UsedChunks)
+	assert.Equal(t, "288", s.Slabs[1].Raw["mem_used"])
+	assert.Equal(t, uint64(240), s.Slabs[5].ChunkSize)
+}
+
+func TestASCIIConnGetAndTouchAdmin(t *testing.T) {
+	c, reqs := scriptedServer(t, []string{
+		"VALUE test 1 2 7\r\nhi\r\nEND\r\n",
+		"STAT pid 1\r\nSTAT version 1.6.21\r\nEND\r\n",
+		"ERROR\r\n",
+		"VERSION 1.6.21\r\n",
+		"OK\r\n",
+		"OK\r\n",
+	})
+	defer c.Close()
+	ctx := context.Background()
+
+	items, err := c.GetAndTouch(ctx, 60, "test", "miss")
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, uint64(7), items["test"].cas)
+	stats, err := c.Stats(ctx, "")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"pid": "1", "version": "1.6.21"}, stats)
+	_, err = c.Stats(ctx, "unknown")
+	assert.NotNil(t, err)
+	assert.Nil(t, c.Err())
+	version, err := c.Version(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.6.21", version)
+	assert.Nil(t, c.FlushAll(ctx, 10))
+	assert.Nil(t, c.Verbosity(ctx, 1))
+
+	assert.Equal(t, []string{
+		"gats 60 test miss",
+		"stats",
+		"stats unknown",
+		"version",
+		"flush_all 10",
+		"verbosity 1",
+	}, *reqs)
+}
@@ -0,0 +1,57 @@
+package memcache
+
+import (
+	"context"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache"
+)
+
+// _maxRelativeExpire is the largest expiration memcached reads as relative,
+// larger ones are unix times.
+const _maxRelativeExpire = 30 * 24 * 60 * 60
+
+type store struct {
+	mc *Memcache
+}
+
+// NewStore adapts mc to a cache.Store, the values are stored raw.
+func NewStore(mc *Memcache) cache.Store {
+	return &store{mc: mc}
+}
+
+func (s *store) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	rs, err := s.mc.GetMulti(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	values := make(map[string][]byte, len(keys))
+	for _, key := range rs.Keys() {
+		values[key] = rs.Item(key).Value
+	}
+	return values, nil
+}
+
+func (s *store) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.mc.Set(ctx, &Item{Key: key, Value: value, Flags: FlagRAW, Expiration: expiration(ttl)})
+}
+
+func (s *store) Delete(ctx context.Context, key string) error {
+	if err := s.mc.Delete(ctx, key); err != nil && err != ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// expiration converts ttl to a memcached expiration, rounding up to seconds.
+func expiration(ttl time.Duration) int32 {
+	if ttl <= 0 {
+		return 0
+	}
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	if seconds > _maxRelativeExpire {
+		return int32(time.Now().Unix() + seconds)
+	}
+	return int32(seconds)
+}
@@ -0,0 +1,54 @@
+package memcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache/memcache/memcachetest"
+	"github.com/zombie-k/kylin/library/container/pool"
+	xtime "github.com/zombie-k/kylin/library/time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	s, err := memcachetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	mc := New(&Config{
+		Config:       &pool.Config{Active: 1, Idle: 1, IdleTimeout: xtime.Duration(time.Minute)},
+		Name:         "test_store",
+		Proto:        "tcp",
+		Addr:         s.Addr(),
+		DialTimeout:  xtime.Duration(time.Second),
+		ReadTimeout:  xtime.Duration(time.Second),
+		WriteTimeout: xtime.Duration(time.Second),
+	})
+	defer mc.Close()
+	st := NewStore(mc)
+	ctx := context.Background()
+
+	assert.Nil(t, st.Set(ctx, "a", []byte("1"), 1500*time.Millisecond))
+	assert.Nil(t, st.Set(ctx, "b", []byte("2"), 0))
+	values, err := st.GetMulti(ctx, []string{"a", "b", "c"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]byte{"a": []byte("1"), "b": []byte("2")}, values)
+
+	s.Advance(2 * time.Second)
+	values, err = st.GetMulti(ctx, []string{"a", "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]byte{"b": []byte("2")}, values)
+	assert.Nil(t, st.Delete(ctx, "b"))
+	assert.Nil(t, st.Delete(ctx, "b"))
+	assert.Empty(t, s.Keys())
+}
+
+func TestExpiration(t *testing.T) {
+	assert.Equal(t, int32(0), expiration(0))
+	assert.Equal(t, int32(1), expiration(time.Millisecond))
+	assert.Equal(t, int32(60), expiration(time.Minute))
+	assert.True(t, expiration(31*24*time.Hour) > _maxRelativeExpire)
+}
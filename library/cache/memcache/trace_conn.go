@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/zombie-k/kylin/library/cache/hotkey"
 	"github.com/zombie-k/kylin/library/log"
 	"github.com/zombie-k/kylin/library/net/trace"
 )
@@ -14,19 +15,44 @@ const (
 	_slowLogDuration = time.Millisecond * 250
 )
 
-func newTraceConn(conn Conn, address string) Conn {
+func newTraceConn(conn Conn, address string, hot *hotkey.Detector) Conn {
 	tags := []trace.Tag{
 		trace.String(trace.TagSpanKind, "client"),
 		trace.String(trace.TagComponent, "cache/memcache"),
 		trace.String(trace.TagPeerService, "memcache"),
 		trace.String(trace.TagPeerAddress, address),
 	}
-	return &traceConn{Conn: conn, tags: tags}
+	return &traceConn{Conn: conn, tags: tags, hot: hot}
 }
 
 type traceConn struct {
 	Conn
 	tags []trace.Tag
+	// hot is the hot key detector of the memcache, nil if disabled.
+	hot *hotkey.Detector
+}
+
+// observe feeds the hot key detector with a key and the size of its value.
+func (t *traceConn) observe(key string, size int) {
+	if t.hot.Sample(size) {
+		t.hot.Add(key, size)
+	}
+}
+
+// observeItem observes the key of an item, nil if missing.
+func (t *traceConn) observeItem(key string, item *Item) {
+	size := 0
+	if item != nil {
+		size = len(item.Value)
+	}
+	t.observe(key, size)
+}
+
+// observeItems observes the keys of a multi get.
+func (t *traceConn) observeItems(keys []string, items map[string]*Item) {
+	for _, key := range keys {
+		t.observeItem(key, items[key])
+	}
 }
 
 func (t *traceConn) setTrace(ctx context.Context, action, statement string) func(error) error {
@@ -49,16 +75,19 @@ func (t *traceConn) setTrace(ctx context.Context, action, statement string) func
 }
 
 func (t *traceConn) AddContext(ctx context.Context, item *Item) error {
+	t.observeItem(item.Key, item)
 	finishFn := t.setTrace(ctx, "Add", item.Key)
 	return finishFn(t.Conn.Add(item))
 }
 
 func (t *traceConn) SetContext(ctx context.Context, item *Item) error {
+	t.observeItem(item.Key, item)
 	finishFn := t.setTrace(ctx, "Set", item.Key)
 	return finishFn(t.Conn.Set(item))
 }
 
 func (t *traceConn) ReplaceContext(ctx context.Context, item *Item) error {
+	t.observeItem(item.Key, item)
 	finishFn := t.setTrace(ctx, "Replace", item.Key)
 	return finishFn(t.Conn.Replace(item))
 }
@@ -66,38 +95,127 @@ func (t *traceConn) ReplaceContext(ctx context.Context, item *Item) error {
 func (t *traceConn) GetContext(ctx context.Context, key string) (*Item, error) {
 	finishFn := t.setTrace(ctx, "Get", key)
 	item, err := t.Conn.Get(key)
+	t.observeItem(key, item)
 	return item, finishFn(err)
 }
 
 func (t *traceConn) GetMultiContext(ctx context.Context, keys []string) (map[string]*Item, error) {
 	finishFn := t.setTrace(ctx, "GetMulti", strings.Join(keys, " "))
 	items, err := t.Conn.GetMulti(keys)
+	t.observeItems(keys, items)
 	return items, finishFn(err)
 }
 
 func (t *traceConn) DeleteContext(ctx context.Context, key string) error {
+	t.observe(key, 0)
 	finishFn := t.setTrace(ctx, "Delete", key)
 	return finishFn(t.Conn.Delete(key))
 }
 
 func (t *traceConn) IncrementContext(ctx context.Context, key string, delta uint64) (newValue uint64, err error) {
+	t.observe(key, 0)
 	finishFn := t.setTrace(ctx, "Increment", key+" "+strconv.FormatUint(delta, 10))
 	newValue, err = t.Conn.Increment(key, delta)
 	return newValue, finishFn(err)
 }
 
 func (t *traceConn) DecrementContext(ctx context.Context, key string, delta uint64) (newValue uint64, err error) {
+	t.observe(key, 0)
 	finishFn := t.setTrace(ctx, "Decrement", key+" "+strconv.FormatUint(delta, 10))
 	newValue, err = t.Conn.Decrement(key, delta)
 	return newValue, finishFn(err)
 }
 
+func (t *traceConn) IncrementWithInitialContext(ctx context.Context, key string, delta, initial uint64, expiration int32) (newValue uint64, err error) {
+	t.observe(key, 0)
+	finishFn := t.setTrace(ctx, "IncrementWithInitial", key+" "+strconv.FormatUint(delta, 10))
+	newValue, err = t.Conn.IncrementWithInitial(key, delta, initial, expiration)
+	return newValue, finishFn(err)
+}
+
+func (t *traceConn) DecrementWithInitialContext(ctx context.Context, key string, delta, initial uint64, expiration int32) (newValue uint64, err error) {
+	t.observe(key, 0)
+	finishFn := t.setTrace(ctx, "DecrementWithInitial", key+" "+strconv.FormatUint(delta, 10))
+	newValue, err = t.Conn.DecrementWithInitial(key, delta, initial, expiration)
+	return newValue, finishFn(err)
+}
+
 func (t *traceConn) CompareAndSwapContext(ctx context.Context, item *Item) error {
+	t.observeItem(item.Key, item)
 	finishFn := t.setTrace(ctx, "CompareAndSwap", item.Key)
 	return finishFn(t.Conn.CompareAndSwap(item))
 }
 
 func (t *traceConn) TouchContext(ctx context.Context, key string, seconds int32) (err error) {
+	t.observe(key, 0)
 	finishFn := t.setTrace(ctx, "Touch", key+" "+strconv.Itoa(int(seconds)))
 	return finishFn(t.Conn.Touch(key, seconds))
 }
+
+func (t *traceConn) MetaGetContext(ctx context.Context, key string, opts *MetaGetOptions) (*Item, error) {
+	finishFn := t.setTrace(ctx, "MetaGet", key)
+	item, err := t.Conn.MetaGet(key, opts)
+	t.observeItem(key, item)
+	return item, finishFn(err)
+}
+
+func (t *traceConn) MetaSetContext(ctx context.Context, item *Item, opts *MetaSetOptions) error {
+	t.observeItem(item.Key, item)
+	finishFn := t.setTrace(ctx, "MetaSet", item.Key)
+	return finishFn(t.Conn.MetaSet(item, opts))
+}
+
+func (t *traceConn) MetaDeleteContext(ctx context.Context, key string, opts *MetaDeleteOptions) error {
+	t.observe(key, 0)
+	finishFn := t.setTrace(ctx, "MetaDelete", key)
+	return finishFn(t.Conn.MetaDelete(key, opts))
+}
+
+func (t *traceConn) MetaArithmeticContext(ctx context.Context, key string, opts *MetaArithmeticOptions) (newValue uint64, err error) {
+	t.observe(key, 0)
+	finishFn := t.setTrace(ctx, "MetaArithmetic", key)
+	newValue, err = t.Conn.MetaArithmetic(key, opts)
+	return newValue, finishFn(err)
+}
+
+func (t *traceConn) GetAndTouchContext(ctx context.Context, key string, seconds int32) (*Item, error) {
+	finishFn := t.setTrace(ctx, "GetAndTouch", key+" "+strconv.Itoa(int(seconds)))
+	item, err := t.Conn.GetAndTouchContext(ctx, key, seconds)
+	t.observeItem(key, item)
+	return item, finishFn(err)
+}
+
+func (t *traceConn) GetMultiAndTouchContext(ctx context.Context, keys []string, seconds int32) (map[string]*Item, error) {
+	finishFn := t.setTrace(ctx, "GetMultiAndTouch", strings.Join(keys, " ")+" "+strconv.Itoa(int(seconds)))
+	items, err := t.Conn.GetMultiAndTouchContext(ctx, keys, seconds)
+	t.observeItems(keys, items)
+	return items, finishFn(err)
+}
+
+func (t *traceConn) StatsContext(ctx context.Context) (*Stats, error) {
+	finishFn := t.setTrace(ctx, "Stats", "")
+	stats, err := t.Conn.StatsContext(ctx)
+	return stats, finishFn(err)
+}
+
+func (t *traceConn) StatsSlabsContext(ctx context.Context) (*SlabStats, error) {
+	finishFn := t.setTrace(ctx, "Stats", "slabs")
+	stats, err := t.Conn.StatsSlabsContext(ctx)
+	return stats, finishFn(err)
+}
+
+func (t *traceConn) VersionContext(ctx context.Context) (string, error) {
+	finishFn := t.setTrace(ctx, "Version", "")
+	version, err := t.Conn.VersionContext(ctx)
+	return version, finishFn(err)
+}
+
+func (t *traceConn) FlushAllContext(ctx context.Context, delay int32) error {
+	finishFn := t.setTrace(ctx, "FlushAll", strconv.Itoa(int(delay)))
+	return finishFn(t.Conn.FlushAllContext(ctx, delay))
+}
+
+func (t *traceConn) VerbosityContext(ctx context.Context, level uint32) error {
+	finishFn := t.setTrace(ctx, "Verbosity", strconv.FormatUint(uint64(level), 10))
+	return finishFn(t.Conn.VerbosityContext(ctx, level))
+}
@@ -48,9 +48,55 @@ func (c errConn) CompareAndSwapContext(context.Context, *Item) error
 func (c errConn) TouchContext(context.Context, string, int32) error                { return c.err }
 func (c errConn) DeleteContext(context.Context, string) error                      { return c.err }
 func (c errConn) IncrementContext(context.Context, string, uint64) (uint64, error) { return 0, c.err }
+func (c errConn) IncrementWithInitial(string, uint64, uint64, int32) (uint64, error) {
+	return 0, c.err
+}
+func (c errConn) DecrementWithInitial(string, uint64, uint64, int32) (uint64, error) {
+	return 0, c.err
+}
+func (c errConn) IncrementWithInitialContext(context.Context, string, uint64, uint64, int32) (uint64, error) {
+	return 0, c.err
+}
+func (c errConn) DecrementWithInitialContext(context.Context, string, uint64, uint64, int32) (uint64, error) {
+	return 0, c.err
+}
+func (c errConn) MetaGet(string, *MetaGetOptions) (*Item, error)                { return nil, c.err }
+func (c errConn) MetaSet(*Item, *MetaSetOptions) error                          { return c.err }
+func (c errConn) MetaDelete(string, *MetaDeleteOptions) error                   { return c.err }
+func (c errConn) MetaArithmetic(string, *MetaArithmeticOptions) (uint64, error) { return 0, c.err }
+func (c errConn) MetaGetContext(context.Context, string, *MetaGetOptions) (*Item, error) {
+	return nil, c.err
+}
+func (c errConn) MetaSetContext(context.Context, *Item, *MetaSetOptions) error { return c.err }
+func (c errConn) MetaDeleteContext(context.Context, string, *MetaDeleteOptions) error {
+	return c.err
+}
+func (c errConn) MetaArithmeticContext(context.Context, string, *MetaArithmeticOptions) (uint64, error) {
+	return 0, c.err
+}
 func (c errConn) GetMultiContext(context.Context, []string) (map[string]*Item, error) {
 	return nil, c.err
 }
+func (c errConn) GetAndTouch(string, int32) (*Item, error) { return nil, c.err }
+func (c errConn) GetMultiAndTouch([]string, int32) (map[string]*Item, error) {
+	return nil, c.err
+}
+func (c errConn) GetAndTouchContext(context.Context, string, int32) (*Item, error) {
+	return nil, c.err
+}
+func (c errConn) GetMultiAndTouchContext(context.Context, []string, int32) (map[string]*Item, error) {
+	return nil, c.err
+}
+func (c errConn) Stats() (*Stats, error)                                { return nil, c.err }
+func (c errConn) StatsSlabs() (*SlabStats, error)                       { return nil, c.err }
+func (c errConn) Version() (string, error)                              { return "", c.err }
+func (c errConn) FlushAll(int32) error                                  { return c.err }
+func (c errConn) Verbosity(uint32) error                                { return c.err }
+func (c errConn) StatsContext(context.Context) (*Stats, error)          { return nil, c.err }
+func (c errConn) StatsSlabsContext(context.Context) (*SlabStats, error) { return nil, c.err }
+func (c errConn) VersionContext(context.Context) (string, error)        { return "", c.err }
+func (c errConn) FlushAllContext(context.Context, int32) error          { return c.err }
+func (c errConn) VerbosityContext(context.Context, uint32) error        { return c.err }
 
 // RawItem item with FlagRAW flag.
 //
@@ -0,0 +1,405 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	pkgerr "github.com/pkg/errors"
+)
+
+const (
+	_defaultBatchCommands = 128
+	_defaultBatchBytes    = 64 * 1024
+	_defaultBatchParallel = 4
+	_defaultBatchWindow   = time.Millisecond
+)
+
+// ErrBatcherClosed is returned by the commands queued to a closed
+// AutoBatcher.
+var ErrBatcherClosed = errors.New("redis: batcher closed")
+
+// BatchOption specifies an option of Batch and AutoBatcher.
+type BatchOption struct {
+	f func(*batchOptions)
+}
+
+type batchOptions struct {
+	commands int
+	bytes    int
+	parallel int
+	window   time.Duration
+}
+
+// BatchMaxCommands specifies the max commands of a pipeline, 128 by
+// default.
+func BatchMaxCommands(n int) BatchOption {
+	return BatchOption{func(o *batchOptions) {
+		o.commands = n
+	}}
+}
+
+// BatchMaxBytes specifies the max size of the arguments of a pipeline, 64KB
+// by default. A command larger than it is sent alone.
+func BatchMaxBytes(n int) BatchOption {
+	return BatchOption{func(o *batchOptions) {
+		o.bytes = n
+	}}
+}
+
+// BatchParallel specifies how many pipelines are executed at once, each on
+// a connection of the pool, 4 by default.
+func BatchParallel(n int) BatchOption {
+	return BatchOption{func(o *batchOptions) {
+		o.parallel = n
+	}}
+}
+
+// BatchWindow specifies how long an AutoBatcher waits for more commands
+// before sending a pipeline, 1ms by default.
+func BatchWindow(d time.Duration) BatchOption {
+	return BatchOption{func(o *batchOptions) {
+		o.window = d
+	}}
+}
+
+func newBatchOptions(options []BatchOption) batchOptions {
+	o := batchOptions{
+		commands: _defaultBatchCommands,
+		bytes:    _defaultBatchBytes,
+		parallel: _defaultBatchParallel,
+		window:   _defaultBatchWindow,
+	}
+	for _, option := range options {
+		option.f(&o)
+	}
+	if o.commands < 1 {
+		o.commands = 1
+	}
+	if o.parallel < 1 {
+		o.parallel = 1
+	}
+	return o
+}
+
+// Future is the pending reply of a queued command, its methods wait for the
+// command to be executed and convert the reply like the functions of the
+// same names.
+type Future struct {
+	cmd  cmd
+	size int
+
+	done  chan struct{}
+	reply interface{}
+	err   error
+}
+
+func newFuture(commandName string, args []interface{}) *Future {
+	size := len(commandName)
+	for _, arg := range args {
+		size += len(argString(arg))
+	}
+	return &Future{
+		cmd:  cmd{commandName: commandName, args: args},
+		size: size,
+		done: make(chan struct{}),
+	}
+}
+
+func (f *Future) resolve(reply interface{}, err error) {
+	f.reply, f.err = reply, err
+	close(f.done)
+}
+
+// Done is closed once the command is executed.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Reply returns the reply of the command, an Error if redis replied an
+// error.
+func (f *Future) Reply() (interface{}, error) {
+	<-f.done
+	return f.reply, f.err
+}
+
+// Err returns the error of the command.
+func (f *Future) Err() error {
+	_, err := f.Reply()
+	return err
+}
+
+// Int returns the reply as an int.
+func (f *Future) Int() (int, error) {
+	return Int(f.Reply())
+}
+
+// Int64 returns the reply as an int64.
+func (f *Future) Int64() (int64, error) {
+	return Int64(f.Reply())
+}
+
+// Uint64 returns the reply as an uint64.
+func (f *Future) Uint64() (uint64, error) {
+	return Uint64(f.Reply())
+}
+
+// Float64 returns the reply as a float64.
+func (f *Future) Float64() (float64, error) {
+	return Float64(f.Reply())
+}
+
+// String returns the reply as a string.
+func (f *Future) String() (string, error) {
+	return String(f.Reply())
+}
+
+// Bytes returns the reply as a []byte.
+func (f *Future) Bytes() ([]byte, error) {
+	return Bytes(f.Reply())
+}
+
+// Bool returns the reply as a bool.
+func (f *Future) Bool() (bool, error) {
+	return Bool(f.Reply())
+}
+
+// Values returns the reply as a []interface{}.
+func (f *Future) Values() ([]interface{}, error) {
+	return Values(f.Reply())
+}
+
+// Strings returns the reply as a []string.
+func (f *Future) Strings() ([]string, error) {
+	return Strings(f.Reply())
+}
+
+// Int64s returns the reply as a []int64.
+func (f *Future) Int64s() ([]int64, error) {
+	return Int64s(f.Reply())
+}
+
+// StringMap returns the reply of field value pairs as a map[string]string.
+func (f *Future) StringMap() (map[string]string, error) {
+	return StringMap(f.Reply())
+}
+
+// Batch queues commands and executes them in pipelines bounded by
+// BatchMaxCommands and BatchMaxBytes, the pipelines are executed at once on
+// BatchParallel connections:
+//
+//	b := r.Batch()
+//	get := b.Queue("GET", "key")
+//	incr := b.Queue("INCR", "counter")
+//	if err := b.Exec(ctx); err != nil {
+//		// handle the error
+//	}
+//	v, err := get.String()
+//	n, err := incr.Int64()
+//
+// The commands of different pipelines are not ordered, the dependent
+// commands must be queued to different batches. A Batch is not safe for
+// concurrent use.
+type Batch struct {
+	pool connPool
+	o    batchOptions
+	fs   []*Future
+}
+
+// Batch new a batch of the commands executed by r.
+func (r *Redis) Batch(options ...BatchOption) *Batch {
+	return &Batch{pool: r.pool, o: newBatchOptions(options)}
+}
+
+// Queue queues a command, its reply is ready once Exec returns.
+func (b *Batch) Queue(commandName string, args ...interface{}) *Future {
+	f := newFuture(commandName, args)
+	b.fs = append(b.fs, f)
+	return f
+}
+
+// Len returns the commands queued.
+func (b *Batch) Len() int {
+	return len(b.fs)
+}
+
+// Exec executes the commands queued and resolves their futures. The error
+// is the first one of a connection, the futures of its pipeline get it too,
+// the errors replied by redis are only returned by their futures.
+func (b *Batch) Exec(ctx context.Context) error {
+	fs := b.fs
+	b.fs = nil
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, b.o.parallel)
+	)
+	for _, batch := range splitBatches(fs, b.o) {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(batch []*Future) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := execBatch(ctx, b.pool, batch); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(batch)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// splitBatches splits fs into pipelines of at most o.commands commands and
+// o.bytes bytes.
+func splitBatches(fs []*Future, o batchOptions) (batches [][]*Future) {
+	start, size := 0, 0
+	for i, f := range fs {
+		if i > start && (i-start >= o.commands || (o.bytes > 0 && size+f.size > o.bytes)) {
+			batches = append(batches, fs[start:i])
+			start, size = i, 0
+		}
+		size += f.size
+	}
+	if start < len(fs) {
+		batches = append(batches, fs[start:])
+	}
+	return
+}
+
+// execBatch executes a pipeline on a connection of p and resolves the
+// futures.
+func execBatch(ctx context.Context, p connPool, fs []*Future) error {
+	cmds := make([]*cmd, len(fs))
+	for i, f := range fs {
+		cmds[i] = &f.cmd
+	}
+	c := p.Get(ctx)
+	defer c.Close()
+	rps, err := execCmds(c, cmds)
+	if err != nil {
+		for _, f := range fs {
+			f.resolve(nil, err)
+		}
+		return err
+	}
+	for i, f := range fs {
+		f.resolve(rps[i].reply, rps[i].err)
+		if _, server := pkgerr.Cause(rps[i].err).(Error); rps[i].err != nil && !server && err == nil {
+			err = rps[i].err
+		}
+	}
+	return err
+}
+
+// AutoBatcher coalesces the commands of concurrent callers into pipelines:
+// a pipeline is sent after BatchWindow, or at once when it reaches
+// BatchMaxCommands or BatchMaxBytes. It trades the latency of the window
+// for fewer round trips and connections under load.
+//
+// An AutoBatcher is a Doer, so NewCommands(b) is the typed API of the
+// commands batched. The commands are executed with the timeouts of the
+// pool, the context of a caller only bounds its wait. Blocking commands,
+// transactions and pub/sub must not be batched.
+type AutoBatcher struct {
+	pool connPool
+	o    batchOptions
+	sem  chan struct{}
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	pending []*Future
+	size    int
+	timer   *time.Timer
+	// gen counts the flushes, a timer of a flushed pipeline is stale.
+	gen    uint64
+	closed bool
+}
+
+// AutoBatch new an AutoBatcher of the commands executed by r, it must be
+// closed after use.
+func (r *Redis) AutoBatch(options ...BatchOption) *AutoBatcher {
+	o := newBatchOptions(options)
+	return &AutoBatcher{pool: r.pool, o: o, sem: make(chan struct{}, o.parallel)}
+}
+
+// Queue queues a command to the next pipeline.
+func (b *AutoBatcher) Queue(commandName string, args ...interface{}) *Future {
+	f := newFuture(commandName, args)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		f.resolve(nil, ErrBatcherClosed)
+		return f
+	}
+	if len(b.pending) > 0 && b.o.bytes > 0 && b.size+f.size > b.o.bytes {
+		b.flush()
+	}
+	b.pending = append(b.pending, f)
+	b.size += f.size
+	if len(b.pending) >= b.o.commands || (b.o.bytes > 0 && b.size >= b.o.bytes) {
+		b.flush()
+	} else if b.timer == nil {
+		gen := b.gen
+		b.timer = time.AfterFunc(b.o.window, func() { b.onTimer(gen) })
+	}
+	return f
+}
+
+// Do queues a command and waits for its reply.
+func (b *AutoBatcher) Do(ctx context.Context, commandName string, args ...interface{}) (interface{}, error) {
+	f := b.Queue(commandName, args...)
+	select {
+	case <-f.done:
+		return f.reply, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close sends the commands pending and waits for the pipelines in flight,
+// the commands queued afterwards fail with ErrBatcherClosed.
+func (b *AutoBatcher) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.flush()
+	b.mu.Unlock()
+	b.wg.Wait()
+	return nil
+}
+
+func (b *AutoBatcher) onTimer(gen uint64) {
+	b.mu.Lock()
+	if b.gen == gen {
+		b.flush()
+	}
+	b.mu.Unlock()
+}
+
+// flush sends the pending commands, b.mu is held.
+func (b *AutoBatcher) flush() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.pending) == 0 {
+		return
+	}
+	fs := b.pending
+	b.pending, b.size = nil, 0
+	b.gen++
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		b.sem <- struct{}{}
+		defer func() { <-b.sem }()
+		execBatch(context.Background(), b.pool, fs)
+	}()
+}
@@ -0,0 +1,139 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache/redis/redistest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newBatchServer starts a redistest server and a Redis of it.
+func newBatchServer(t *testing.T) (*redistest.Server, *Redis) {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, newTestRedis("test_batch", s.Addr())
+}
+
+func TestSplitBatches(t *testing.T) {
+	var fs []*Future
+	for _, v := range []string{"a", "bb", "ccc", "d", "eeeeeeeee", "f"} {
+		fs = append(fs, newFuture("GET", []interface{}{v}))
+	}
+	lens := func(batches [][]*Future) (n []int) {
+		for _, b := range batches {
+			n = append(n, len(b))
+		}
+		return
+	}
+	assert.Equal(t, []int{2, 2, 2}, lens(splitBatches(fs, newBatchOptions([]BatchOption{BatchMaxCommands(2)}))))
+	// GET a, GET bb | GET ccc, GET d | GET eeeeeeeee | GET f
+	assert.Equal(t, []int{2, 2, 1, 1}, lens(splitBatches(fs, newBatchOptions([]BatchOption{BatchMaxBytes(10)}))))
+	assert.Nil(t, splitBatches(nil, newBatchOptions(nil)))
+}
+
+func TestBatch(t *testing.T) {
+	s, r := newBatchServer(t)
+	defer s.Close()
+	defer r.Close()
+	ctx := context.Background()
+
+	b := r.Batch(BatchMaxCommands(3), BatchParallel(2))
+	for i := 0; i < 10; i++ {
+		b.Queue("SET", fmt.Sprintf("key%d", i), i)
+	}
+	assert.Equal(t, 10, b.Len())
+	assert.Nil(t, b.Exec(ctx))
+	assert.Equal(t, 0, b.Len())
+
+	gets := make([]*Future, 10)
+	for i := range gets {
+		gets[i] = b.Queue("GET", fmt.Sprintf("key%d", i))
+	}
+	missing := b.Queue("GET", "missing")
+	bad := b.Queue("BAD")
+	assert.Nil(t, b.Exec(ctx))
+	for i, f := range gets {
+		n, err := f.Int64()
+		assert.Nil(t, err)
+		assert.Equal(t, int64(i), n)
+	}
+	_, err := missing.String()
+	assert.Equal(t, ErrNil, err)
+	assert.EqualError(t, bad.Err(), "ERR unknown command 'BAD'")
+
+	// a connection error fails the pipeline.
+	s.Close()
+	r2 := newTestRedis("test_batch", s.Addr())
+	defer r2.Close()
+	b = r2.Batch()
+	f := b.Queue("GET", "key0")
+	assert.NotNil(t, b.Exec(ctx))
+	assert.NotNil(t, f.Err())
+}
+
+func TestAutoBatcher(t *testing.T) {
+	s, r := newBatchServer(t)
+	defer s.Close()
+	defer r.Close()
+	ctx := context.Background()
+
+	b := r.AutoBatch(BatchMaxCommands(3), BatchWindow(time.Hour))
+	f1 := b.Queue("SET", "a", "1")
+	f2 := b.Queue("SET", "b", "2")
+	b.mu.Lock()
+	assert.Len(t, b.pending, 2)
+	b.mu.Unlock()
+	// the third command sends the pipeline.
+	f3 := b.Queue("GET", "a")
+	v, err := f3.String()
+	assert.Nil(t, err)
+	assert.Equal(t, "1", v)
+	assert.Nil(t, f1.Err())
+	assert.Nil(t, f2.Err())
+
+	// the context bounds the wait.
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = b.Do(cctx, "GET", "b")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// close sends the pending commands.
+	f4 := b.Queue("GET", "b")
+	assert.Nil(t, b.Close())
+	v, err = f4.String()
+	assert.Nil(t, err)
+	assert.Equal(t, "2", v)
+	_, err = b.Do(ctx, "GET", "b")
+	assert.Equal(t, ErrBatcherClosed, err)
+}
+
+func TestAutoBatcherConcurrent(t *testing.T) {
+	s, r := newBatchServer(t)
+	defer s.Close()
+	defer r.Close()
+	b := r.AutoBatch(BatchMaxCommands(8), BatchWindow(5*time.Millisecond))
+	defer b.Close()
+	c := NewCommands(b)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key%d", i)
+			assert.Nil(t, c.Set(ctx, key, i, 0))
+			n, err := Int(c.Do(ctx, "GET", key))
+			assert.Nil(t, err)
+			assert.Equal(t, i, n)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,619 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zombie-k/kylin/library/log"
+
+	pkgerr "github.com/pkg/errors"
+)
+
+const (
+	// ClusterSlots is the number of hash slots of a redis cluster.
+	ClusterSlots = 16384
+
+	_defaultMaxRedirects = 5
+	// _minRefreshInterval limits the slot map refreshes triggered by
+	// redirects and network errors.
+	_minRefreshInterval = time.Second
+	// _poolRetireDelay is how long the pool of a node gone from the slot map
+	// lives on, the commands queued on it complete meanwhile.
+	_poolRetireDelay = time.Minute
+)
+
+var (
+	errClusterState = errors.New("redis: cluster conn does not support transactions, pub/sub and monitor")
+)
+
+// commands routed to any node, their first argument is not a key.
+var clusterKeylessCommands = map[string]struct{}{
+	"PING":      {},
+	"ECHO":      {},
+	"INFO":      {},
+	"TIME":      {},
+	"DBSIZE":    {},
+	"CLUSTER":   {},
+	"COMMAND":   {},
+	"CONFIG":    {},
+	"CLIENT":    {},
+	"SCRIPT":    {},
+	"SLOWLOG":   {},
+	"LASTSAVE":  {},
+	"RANDOMKEY": {},
+	"FLUSHALL":  {},
+	"FLUSHDB":   {},
+	"PUBLISH":   {},
+}
+
+// ClusterConfig redis cluster client config. Config.Addr is unused, every
+// node gets a pool of Config dialing its address.
+type ClusterConfig struct {
+	*Config
+
+	// Addrs are the seed nodes the slot map is discovered from.
+	Addrs []string
+	// MaxRedirects is the max MOVED and ASK redirects followed by a command,
+	// 5 by default.
+	MaxRedirects int
+}
+
+// Cluster redis cluster client, it routes the commands by the slot of their
+// key and follows the MOVED and ASK redirects. The commands of several keys
+// must hash their keys to one slot, e.g. with {hash tags}.
+type Cluster struct {
+	c       *ClusterConfig
+	options []DialOption
+
+	mu    sync.RWMutex
+	slots [ClusterSlots]string
+	pools map[string]*Pool
+	// nodes is the addrs of the slot map and the seed nodes, the pools of
+	// the others are retiring.
+	nodes       map[string]struct{}
+	retiring    map[string]struct{}
+	retireDelay time.Duration
+
+	refreshing int32
+	refreshed  int64
+}
+
+// NewCluster new a redis cluster client, the slot map is discovered from the
+// seed nodes. If none answers, the commands are sent to a seed node until a
+// refresh succeeds.
+func NewCluster(c *ClusterConfig, options ...DialOption) *Cluster {
+	if len(c.Addrs) == 0 {
+		panic("redis: cluster needs seed addrs")
+	}
+	cl := &Cluster{
+		c: c,
+		// the TLS config is built once for the pools of every node.
+		options:     append(c.tlsOptions(), options...),
+		pools:       make(map[string]*Pool),
+		retiring:    make(map[string]struct{}),
+		retireDelay: _poolRetireDelay,
+	}
+	if err := cl.refresh(context.Background()); err != nil {
+		log.Error("redis: cluster %s discover slots error(%v)", c.Name, err)
+	}
+	return cl
+}
+
+// KeySlot returns the hash slot of key, only the {hash tag} of key is hashed
+// if it has one.
+func KeySlot(key string) int {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			key = key[s+1 : s+1+e]
+		}
+	}
+	return int(crc16(key)) % ClusterSlots
+}
+
+// Do gets a connection of the node serving the key of the command and
+// executes it, following the redirects.
+func (c *Cluster) Do(ctx context.Context, commandName string, args ...interface{}) (reply interface{}, err error) {
+	addr := c.addr(commandName, args)
+	asking := false
+	for i := 0; ; i++ {
+		reply, err = c.doNode(ctx, addr, asking, commandName, args...)
+		kind, slot, to := parseRedirect(err)
+		if kind == "" || i >= c.maxRedirects() {
+			if errClass(err) == "network" {
+				c.refreshAsync()
+			}
+			return
+		}
+		_metricClusterRedirects.Inc(c.c.Name, strings.ToLower(kind))
+		if asking = kind == "ASK"; !asking {
+			c.setSlot(slot, to)
+			c.refreshAsync()
+		}
+		addr = to
+	}
+}
+
+func (c *Cluster) doNode(ctx context.Context, addr string, asking bool, commandName string, args ...interface{}) (interface{}, error) {
+	conn := c.pool(addr).Get(ctx)
+	defer conn.Close()
+	if asking {
+		if _, err := conn.Do("ASKING"); err != nil {
+			return nil, err
+		}
+	}
+	return conn.Do(commandName, args...)
+}
+
+// Conn gets a connection routing every command on its own, the pipelined
+// commands are sent to their nodes on Flush. Transactions, pub/sub and
+// monitor are not supported.
+func (c *Cluster) Conn(ctx context.Context) Conn {
+	return &clusterConn{c: c, ctx: ctx}
+}
+
+// Pipeline new a pipeline, its commands are split by node and the replies
+// reassembled in order.
+func (c *Cluster) Pipeline() Pipeliner {
+	return &clusterPipeliner{c: c}
+}
+
+// Close closes the pools of every node.
+func (c *Cluster) Close() (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for addr, p := range c.pools {
+		if e := p.Close(); e != nil {
+			err = e
+		}
+		delete(c.pools, addr)
+	}
+	return
+}
+
+func (c *Cluster) maxRedirects() int {
+	if c.c.MaxRedirects > 0 {
+		return c.c.MaxRedirects
+	}
+	return _defaultMaxRedirects
+}
+
+// pool returns the pool of addr, creating it on first use.
+func (c *Cluster) pool(addr string) *Pool {
+	c.mu.RLock()
+	p, ok := c.pools[addr]
+	c.mu.RUnlock()
+	if ok {
+		return p
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok = c.pools[addr]; ok {
+		return p
+	}
+	conf := *c.c.Config
+	conf.Addr = addr
+	conf.TLS = nil
+	p = NewPool(&conf, c.options...)
+	c.pools[addr] = p
+	return p
+}
+
+// addr returns the node serving the key of the command, a seed node if the
+// slot is unknown or the command has no key.
+func (c *Cluster) addr(commandName string, args []interface{}) string {
+	if key, ok := commandKey(commandName, args); ok {
+		c.mu.RLock()
+		addr := c.slots[KeySlot(key)]
+		c.mu.RUnlock()
+		if addr != "" {
+			return addr
+		}
+	}
+	return c.c.Addrs[0]
+}
+
+func (c *Cluster) setSlot(slot int, addr string) {
+	c.mu.Lock()
+	c.slots[slot] = addr
+	c.mu.Unlock()
+}
+
+// refreshAsync refreshes the slot map in background, at most once per
+// _minRefreshInterval.
+func (c *Cluster) refreshAsync() {
+	if time.Since(time.Unix(0, atomic.LoadInt64(&c.refreshed))) < _minRefreshInterval {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&c.refreshing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&c.refreshing, 0)
+		if err := c.refresh(context.Background()); err != nil {
+			log.Error("redis: cluster %s refresh slots error(%v)", c.c.Name, err)
+		}
+	}()
+}
+
+// refresh asks the known nodes and the seed nodes for the slot map until one
+// answers, the pools of the nodes left out of it are closed.
+func (c *Cluster) refresh(ctx context.Context) (err error) {
+	atomic.StoreInt64(&c.refreshed, time.Now().UnixNano())
+	c.mu.RLock()
+	addrs := make([]string, 0, len(c.pools)+len(c.c.Addrs))
+	for addr := range c.pools {
+		addrs = append(addrs, addr)
+	}
+	c.mu.RUnlock()
+	addrs = append(addrs, c.c.Addrs...)
+	for _, addr := range addrs {
+		var ranges []slotRange
+		conn := c.pool(addr).Get(ctx)
+		ranges, err = parseSlots(conn.Do("CLUSTER", "SLOTS"))
+		conn.Close()
+		if err != nil {
+			continue
+		}
+		c.apply(addr, ranges)
+		_metricClusterRefreshes.Inc(c.c.Name, "ok")
+		return nil
+	}
+	_metricClusterRefreshes.Inc(c.c.Name, "error")
+	return
+}
+
+func (c *Cluster) apply(from string, ranges []slotRange) {
+	var slots [ClusterSlots]string
+	used := make(map[string]struct{})
+	for _, r := range ranges {
+		addr := r.addr
+		if strings.HasPrefix(addr, ":") {
+			// the node asked does not know its own ip.
+			host, _, _ := net.SplitHostPort(from)
+			_, port, _ := net.SplitHostPort(addr)
+			addr = net.JoinHostPort(host, port)
+		}
+		for s := r.start; s <= r.end && s < ClusterSlots; s++ {
+			slots[s] = addr
+		}
+		used[addr] = struct{}{}
+	}
+	// the seed nodes serve the keyless commands.
+	for _, addr := range c.c.Addrs {
+		used[addr] = struct{}{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.slots = slots
+	c.nodes = used
+	for addr, p := range c.pools {
+		if _, ok := used[addr]; ok {
+			continue
+		}
+		if _, ok := c.retiring[addr]; ok {
+			continue
+		}
+		c.retiring[addr] = struct{}{}
+		addr, p := addr, p
+		time.AfterFunc(c.retireDelay, func() { c.retire(addr, p) })
+	}
+}
+
+// retire closes the pool p of addr unless addr is back in the slot map.
+func (c *Cluster) retire(addr string, p *Pool) {
+	c.mu.Lock()
+	delete(c.retiring, addr)
+	_, used := c.nodes[addr]
+	if used || c.pools[addr] != p {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.pools, addr)
+	c.mu.Unlock()
+	p.Close()
+}
+
+// exec sends cmds to their nodes concurrently, one flush per node, and
+// returns the replies in order. The redirected commands are retried one by
+// one.
+func (c *Cluster) exec(ctx context.Context, cmds []*cmd) ([]*reply, error) {
+	nodes := make(map[string][]int)
+	for i, cmd := range cmds {
+		if LookupCommandInfo(cmd.commandName).Set != 0 {
+			return nil, pkgerr.WithStack(errClusterState)
+		}
+		addr := c.addr(cmd.commandName, cmd.args)
+		nodes[addr] = append(nodes[addr], i)
+	}
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		err  error
+		rps  = make([]*reply, len(cmds))
+		send = func(addr string, idx []int) {
+			defer wg.Done()
+			node := make([]*cmd, len(idx))
+			for j, i := range idx {
+				node[j] = cmds[i]
+			}
+			conn := c.pool(addr).Get(ctx)
+			defer conn.Close()
+			nrps, e := execCmds(conn, node)
+			if e != nil {
+				mu.Lock()
+				err = e
+				mu.Unlock()
+				return
+			}
+			for j, i := range idx {
+				rps[i] = nrps[j]
+			}
+		}
+	)
+	for addr, idx := range nodes {
+		wg.Add(1)
+		go send(addr, idx)
+	}
+	wg.Wait()
+	if err != nil {
+		if errClass(err) == "network" {
+			c.refreshAsync()
+		}
+		return nil, err
+	}
+	for i, rp := range rps {
+		if kind, _, _ := parseRedirect(rp.err); kind != "" {
+			rp.reply, rp.err = c.Do(ctx, cmds[i].commandName, cmds[i].args...)
+		}
+	}
+	return rps, nil
+}
+
+type slotRange struct {
+	start, end int
+	// addr is the master serving the slots.
+	addr string
+}
+
+// parseSlots parses a CLUSTER SLOTS reply, each range is the start slot,
+// the end slot, the master and the replicas.
+func parseSlots(reply interface{}, err error) ([]slotRange, error) {
+	values, err := Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	ranges := make([]slotRange, 0, len(values))
+	for _, v := range values {
+		r, err := Values(v, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(r) < 3 {
+			return nil, pkgerr.Errorf("redis: cluster slots unexpected range %v", r)
+		}
+		var sr slotRange
+		if sr.start, err = Int(r[0], nil); err != nil {
+			return nil, err
+		}
+		if sr.end, err = Int(r[1], nil); err != nil {
+			return nil, err
+		}
+		node, err := Values(r[2], nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(node) < 2 {
+			return nil, pkgerr.Errorf("redis: cluster slots unexpected node %v", node)
+		}
+		host, err := String(node[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		port, err := Int(node[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		sr.addr = net.JoinHostPort(host, strconv.Itoa(port))
+		ranges = append(ranges, sr)
+	}
+	return ranges, nil
+}
+
+// parseRedirect parses a "MOVED <slot> <addr>" or "ASK <slot> <addr>"
+// error, kind is empty for other errors.
+func parseRedirect(err error) (kind string, slot int, addr string) {
+	e, ok := pkgerr.Cause(err).(Error)
+	if !ok {
+		return
+	}
+	fields := strings.Fields(string(e))
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return
+	}
+	slot, perr := strconv.Atoi(fields[1])
+	if perr != nil {
+		return "", 0, ""
+	}
+	return fields[0], slot, fields[2]
+}
+
+// commandKey returns the key the command is routed by, ok is false for
+// commands without keys.
+func commandKey(commandName string, args []interface{}) (key string, ok bool) {
+	name := strings.ToUpper(commandName)
+	if _, keyless := clusterKeylessCommands[name]; keyless {
+		return "", false
+	}
+	switch name {
+	case "EVAL", "EVALSHA":
+		// EVAL script numkeys key [key ...] arg [arg ...]
+		if len(args) < 3 {
+			return "", false
+		}
+		if n, err := strconv.Atoi(argString(args[1])); err != nil || n == 0 {
+			return "", false
+		}
+		return argString(args[2]), true
+	case "XREAD", "XREADGROUP":
+		// XREAD ... STREAMS key [key ...] id [id ...]
+		for i, arg := range args {
+			if strings.EqualFold(argString(arg), "STREAMS") && i+1 < len(args) {
+				return argString(args[i+1]), true
+			}
+		}
+		return "", false
+	}
+	if len(args) == 0 {
+		return "", false
+	}
+	return argString(args[0]), true
+}
+
+func argString(arg interface{}) string {
+	switch arg := arg.(type) {
+	case string:
+		return arg
+	case []byte:
+		return string(arg)
+	default:
+		return fmt.Sprint(arg)
+	}
+}
+
+type clusterPipeliner struct {
+	c    *Cluster
+	cmds []*cmd
+}
+
+func (p *clusterPipeliner) Send(commandName string, args ...interface{}) {
+	p.cmds = append(p.cmds, &cmd{commandName: commandName, args: args})
+}
+
+func (p *clusterPipeliner) Exec(ctx context.Context) (rs *Replies, err error) {
+	if len(p.cmds) == 0 {
+		return &Replies{}, nil
+	}
+	cmds := p.cmds
+	p.cmds = nil
+	rps, err := p.c.exec(ctx, cmds)
+	if err != nil {
+		return nil, err
+	}
+	return &Replies{replies: rps}, nil
+}
+
+// clusterConn is the Conn of a Cluster, the sent commands are pending until
+// Flush and their replies are received in order.
+type clusterConn struct {
+	c       *Cluster
+	ctx     context.Context
+	pending []*cmd
+	replies []*reply
+	err     error
+}
+
+func (cc *clusterConn) Close() error {
+	cc.err = errConnClosed
+	cc.pending, cc.replies = nil, nil
+	return nil
+}
+
+func (cc *clusterConn) Err() error {
+	return cc.err
+}
+
+// Do executes the pending commands along with the command, like conn.Do it
+// returns the first error of the pending replies. Do("") executes the
+// pending commands only and returns their replies.
+func (cc *clusterConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	if cc.err != nil {
+		return nil, cc.err
+	}
+	if LookupCommandInfo(commandName).Set != 0 {
+		return nil, pkgerr.WithStack(errClusterState)
+	}
+	if len(cc.pending) == 0 {
+		if commandName == "" {
+			return nil, nil
+		}
+		return cc.c.Do(cc.ctx, commandName, args...)
+	}
+	cmds := cc.pending
+	cc.pending = nil
+	if commandName != "" {
+		cmds = append(cmds, &cmd{commandName: commandName, args: args})
+	}
+	rps, err := cc.c.exec(cc.ctx, cmds)
+	if err != nil {
+		return nil, err
+	}
+	if commandName == "" {
+		values := make([]interface{}, len(rps))
+		for i, rp := range rps {
+			if values[i] = rp.reply; rp.err != nil {
+				values[i] = rp.err
+			}
+		}
+		return values, nil
+	}
+	last := rps[len(rps)-1]
+	for _, rp := range rps[:len(rps)-1] {
+		if e, ok := pkgerr.Cause(rp.err).(Error); ok {
+			return last.reply, e
+		}
+	}
+	return last.reply, last.err
+}
+
+func (cc *clusterConn) Send(commandName string, args ...interface{}) error {
+	if cc.err != nil {
+		return cc.err
+	}
+	if LookupCommandInfo(commandName).Set != 0 {
+		return pkgerr.WithStack(errClusterState)
+	}
+	cc.pending = append(cc.pending, &cmd{commandName: commandName, args: args})
+	return nil
+}
+
+func (cc *clusterConn) Flush() error {
+	if cc.err != nil {
+		return cc.err
+	}
+	if len(cc.pending) == 0 {
+		return nil
+	}
+	cmds := cc.pending
+	cc.pending = nil
+	rps, err := cc.c.exec(cc.ctx, cmds)
+	if err != nil {
+		return err
+	}
+	cc.replies = append(cc.replies, rps...)
+	return nil
+}
+
+func (cc *clusterConn) Receive() (interface{}, error) {
+	if cc.err != nil {
+		return nil, cc.err
+	}
+	if len(cc.replies) == 0 {
+		return nil, pkgerr.WithStack(ErrNoReply)
+	}
+	rp := cc.replies[0]
+	cc.replies = cc.replies[1:]
+	return rp.reply, rp.err
+}
+
+func (cc *clusterConn) WithContext(ctx context.Context) Conn {
+	cc2 := *cc
+	cc2.ctx = ctx
+	return &cc2
+}
@@ -0,0 +1,309 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCluster serves GET, SET and SCAN on nodes owning half of the slots each,
+// the keys of other nodes are MOVED and the keys of a migrating slot ASK.
+type fakeCluster struct {
+	mu        sync.Mutex
+	lns       []net.Listener
+	owners    [ClusterSlots]int
+	migrating map[int]int
+	data      []map[string][]byte
+	slotsReqs int
+}
+
+func newFakeCluster(t *testing.T, nodes int) *fakeCluster {
+	fc := &fakeCluster{migrating: make(map[int]int)}
+	for i := 0; i < nodes; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fc.lns = append(fc.lns, ln)
+		fc.data = append(fc.data, make(map[string][]byte))
+		go fc.serve(i, ln)
+	}
+	for s := range fc.owners {
+		fc.owners[s] = s * nodes / ClusterSlots
+	}
+	return fc
+}
+
+func (fc *fakeCluster) addr(node int) string {
+	return fc.lns[node].Addr().String()
+}
+
+func (fc *fakeCluster) close() {
+	for _, ln := range fc.lns {
+		ln.Close()
+	}
+}
+
+// move moves slot to node without telling the clients.
+func (fc *fakeCluster) move(slot, node int) {
+	fc.mu.Lock()
+	fc.owners[slot] = node
+	fc.mu.Unlock()
+}
+
+func (fc *fakeCluster) serve(node int, ln net.Listener) {
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go fc.serveConn(node, nc)
+	}
+}
+
+func (fc *fakeCluster) serveConn(node int, nc net.Conn) {
+	defer nc.Close()
+	c := &conn{conn: nc, br: bufio.NewReader(nc), bw: bufio.NewWriter(nc)}
+	asking := false
+	for {
+		req, err := Strings(c.readReply())
+		if err != nil {
+			return
+		}
+		fc.mu.Lock()
+		reply := fc.handle(node, req, asking)
+		fc.mu.Unlock()
+		asking = req[0] == "ASKING"
+		writeFakeReply(c.bw, reply)
+		if c.bw.Flush() != nil {
+			return
+		}
+	}
+}
+
+func (fc *fakeCluster) handle(node int, req []string, asking bool) interface{} {
+	switch req[0] {
+	case "ASKING":
+		return "OK"
+	case "CLUSTER":
+		fc.slotsReqs++
+		var ranges []interface{}
+		for start := 0; start < ClusterSlots; {
+			end := start
+			for end+1 < ClusterSlots && fc.owners[end+1] == fc.owners[start] {
+				end++
+			}
+			host, port, _ := net.SplitHostPort(fc.addr(fc.owners[start]))
+			if fc.owners[start] == node {
+				host = ""
+			}
+			p, _ := strconv.Atoi(port)
+			ranges = append(ranges, []interface{}{int64(start), int64(end), []interface{}{[]byte(host), int64(p)}})
+			start = end + 1
+		}
+		return ranges
+	case "GET", "SET":
+		slot := KeySlot(req[1])
+		owner := fc.owners[slot]
+		if owner != node {
+			if to, ok := fc.migrating[slot]; !ok || to != node || !asking {
+				return Error(fmt.Sprintf("MOVED %d %s", slot, fc.addr(owner)))
+			}
+		} else if to, ok := fc.migrating[slot]; ok {
+			if _, found := fc.data[node][req[1]]; !found {
+				return Error(fmt.Sprintf("ASK %d %s", slot, fc.addr(to)))
+			}
+		}
+		if req[0] == "SET" {
+			fc.data[node][req[1]] = []byte(req[2])
+			return "OK"
+		}
+		if v, ok := fc.data[node][req[1]]; ok {
+			return v
+		}
+		return nil
+	case "SCAN":
+		// every key in a single page.
+		keys := []interface{}{}
+		for key := range fc.data[node] {
+			keys = append(keys, []byte(key))
+		}
+		return []interface{}{[]byte("0"), keys}
+	}
+	return Error("ERR unknown command " + req[0])
+}
+
+func newTestCluster(fc *fakeCluster) *Cluster {
+	return NewCluster(&ClusterConfig{
+		Config: newFakeConfig("test_cluster", ""),
+		Addrs:  []string{fc.addr(0)},
+	})
+}
+
+func TestKeySlot(t *testing.T) {
+	assert.Equal(t, uint16(0x31C3), crc16("123456789"))
+	assert.Equal(t, 12182, KeySlot("foo"))
+	assert.Equal(t, KeySlot("user1000"), KeySlot("{user1000}.following"))
+	assert.Equal(t, KeySlot("{}.x"), KeySlot("{}.x"))
+	assert.NotEqual(t, KeySlot(""), KeySlot("{}.x"))
+}
+
+func TestCommandKey(t *testing.T) {
+	for _, test := range []struct {
+		cmd  string
+		args []interface{}
+		key  string
+		ok   bool
+	}{
+		{"GET", []interface{}{"a"}, "a", true},
+		{"set", []interface{}{[]byte("b"), 1}, "b", true},
+		{"PING", nil, "", false},
+		{"EVALSHA", []interface{}{"sha", 1, "c", "arg"}, "c", true},
+		{"EVAL", []interface{}{"script", "0"}, "", false},
+		{"XREADGROUP", []interface{}{"GROUP", "g", "c", "STREAMS", "d", ">"}, "d", true},
+	} {
+		key, ok := commandKey(test.cmd, test.args)
+		assert.Equal(t, test.key, key, test.cmd)
+		assert.Equal(t, test.ok, ok, test.cmd)
+	}
+}
+
+func TestParseRedirect(t *testing.T) {
+	kind, slot, addr := parseRedirect(Error("MOVED 3999 127.0.0.1:6381"))
+	assert.Equal(t, "MOVED", kind)
+	assert.Equal(t, 3999, slot)
+	assert.Equal(t, "127.0.0.1:6381", addr)
+	kind, _, _ = parseRedirect(Error("ASK 1 127.0.0.1:6381"))
+	assert.Equal(t, "ASK", kind)
+	kind, _, _ = parseRedirect(Error("ERR wrong"))
+	assert.Equal(t, "", kind)
+	kind, _, _ = parseRedirect(ErrNil)
+	assert.Equal(t, "", kind)
+}
+
+func TestCluster(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	defer fc.close()
+	c := newTestCluster(fc)
+	defer c.Close()
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		_, err := c.Do(ctx, "SET", key, i)
+		assert.Nil(t, err)
+		n, err := Int(c.Do(ctx, "GET", key))
+		assert.Nil(t, err)
+		assert.Equal(t, i, n)
+	}
+	for node := range fc.data {
+		assert.NotEmpty(t, fc.data[node])
+	}
+
+	// a moved slot is followed and learnt.
+	slot := KeySlot("moved")
+	from := fc.owners[slot]
+	to := (from + 1) % 3
+	fc.move(slot, to)
+	_, err := c.Do(ctx, "SET", "moved", "v")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), fc.data[to]["moved"])
+	assert.Equal(t, fc.addr(to), c.addr("GET", []interface{}{"moved"}))
+
+	// a migrating slot is asked without being learnt.
+	slot = KeySlot("asked")
+	from = fc.owners[slot]
+	to = (from + 1) % 3
+	fc.mu.Lock()
+	fc.migrating[slot] = to
+	fc.mu.Unlock()
+	_, err = c.Do(ctx, "SET", "asked", "v")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), fc.data[to]["asked"])
+	assert.Equal(t, fc.addr(from), c.addr("GET", []interface{}{"asked"}))
+}
+
+func TestClusterRetirePools(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	defer fc.close()
+	c := newTestCluster(fc)
+	defer c.Close()
+	c.retireDelay = 50 * time.Millisecond
+	pool := func(addr string) *Pool {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return c.pools[addr]
+	}
+	seed := c.pool(fc.addr(0))
+	gone := c.pool("127.0.0.1:1")
+	back := c.pool("127.0.0.1:2")
+
+	// the seed is kept out of the slot map, the others retire after a delay.
+	all := []slotRange{{start: 0, end: ClusterSlots - 1, addr: fc.addr(1)}}
+	c.apply(fc.addr(1), all)
+	assert.Equal(t, gone, pool("127.0.0.1:1"))
+	c.apply(fc.addr(1), append(all, slotRange{start: 0, end: 0, addr: "127.0.0.1:2"}))
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, pool("127.0.0.1:1"))
+	assert.Equal(t, back, pool("127.0.0.1:2"))
+	assert.Equal(t, seed, pool(fc.addr(0)))
+	conn := seed.Get(context.Background())
+	assert.Nil(t, conn.Err())
+	conn.Close()
+}
+
+func TestClusterPipeline(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	defer fc.close()
+	c := newTestCluster(fc)
+	defer c.Close()
+	ctx := context.Background()
+
+	fc.move(KeySlot("key3"), (fc.owners[KeySlot("key3")]+1)%3)
+	p := c.Pipeline()
+	for i := 0; i < 10; i++ {
+		p.Send("SET", fmt.Sprintf("key%d", i), i)
+	}
+	for i := 0; i < 10; i++ {
+		p.Send("GET", fmt.Sprintf("key%d", i))
+	}
+	rs, err := p.Exec(ctx)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		s, err := String(rs.Scan())
+		assert.Nil(t, err)
+		assert.Equal(t, "OK", s)
+	}
+	for i := 0; i < 10; i++ {
+		n, err := Int(rs.Scan())
+		assert.Nil(t, err)
+		assert.Equal(t, i, n)
+	}
+	assert.False(t, rs.Next())
+
+	conn := c.Conn(ctx)
+	defer conn.Close()
+	assert.Nil(t, conn.Send("SET", "a", "1"))
+	assert.Nil(t, conn.Send("SET", "b", "2"))
+	assert.Nil(t, conn.Flush())
+	for i := 0; i < 2; i++ {
+		s, err := String(conn.Receive())
+		assert.Nil(t, err)
+		assert.Equal(t, "OK", s)
+	}
+	_, err = conn.Receive()
+	assert.NotNil(t, err)
+	assert.Nil(t, conn.Send("GET", "a"))
+	s, err := String(conn.Do("GET", "b"))
+	assert.Nil(t, err)
+	assert.Equal(t, "2", s)
+	_, err = conn.Do("MULTI")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,119 @@
+package redis
+
+import (
+	"context"
+	"time"
+)
+
+// Doer executes a command, Redis and Cluster are Doers and ConnDoer turns a
+// Conn into one.
+type Doer interface {
+	Do(ctx context.Context, commandName string, args ...interface{}) (reply interface{}, err error)
+}
+
+type connDoer struct {
+	c Conn
+}
+
+// ConnDoer returns a Doer executing the commands on c, e.g. a conn of a
+// transaction or a conn selecting another db. The caller still closes c.
+func ConnDoer(c Conn) Doer {
+	return connDoer{c: c}
+}
+
+func (d connDoer) Do(ctx context.Context, commandName string, args ...interface{}) (interface{}, error) {
+	return d.c.WithContext(ctx).Do(commandName, args...)
+}
+
+// Commands is the typed API of the commands of strings, hashes, lists, sets,
+// sorted sets, keys, bitmaps and HyperLogLogs. The methods return the reply
+// converted to Go types, ErrNil is returned when the key or the member does
+// not exist for the commands replying a single value.
+type Commands struct {
+	d Doer
+}
+
+// NewCommands new the commands executed by d.
+func NewCommands(d Doer) *Commands {
+	return &Commands{d: d}
+}
+
+// Commands returns the commands executed by r.
+func (r *Redis) Commands() *Commands {
+	return NewCommands(r)
+}
+
+// Commands returns the commands executed by the cluster.
+func (c *Cluster) Commands() *Commands {
+	return NewCommands(c)
+}
+
+// Do executes a command not covered by the typed API.
+func (c *Commands) Do(ctx context.Context, commandName string, args ...interface{}) (interface{}, error) {
+	return c.d.Do(ctx, commandName, args...)
+}
+
+func ms(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
+
+// status converts a status reply, e.g. OK.
+func status(reply interface{}, err error) error {
+	_, err = String(reply, err)
+	return err
+}
+
+// Del removes the keys and returns how many existed.
+func (c *Commands) Del(ctx context.Context, keys ...string) (int64, error) {
+	return Int64(c.d.Do(ctx, "DEL", stringArgs(keys)...))
+}
+
+// Unlink removes the keys like Del, their memory is reclaimed in background.
+func (c *Commands) Unlink(ctx context.Context, keys ...string) (int64, error) {
+	return Int64(c.d.Do(ctx, "UNLINK", stringArgs(keys)...))
+}
+
+// Exists returns how many of the keys exist.
+func (c *Commands) Exists(ctx context.Context, keys ...string) (int64, error) {
+	return Int64(c.d.Do(ctx, "EXISTS", stringArgs(keys)...))
+}
+
+// Expire sets the TTL of key in milliseconds, false if key does not exist.
+func (c *Commands) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return Bool(c.d.Do(ctx, "PEXPIRE", key, ms(ttl)))
+}
+
+// ExpireAt sets when key expires, false if key does not exist.
+func (c *Commands) ExpireAt(ctx context.Context, key string, t time.Time) (bool, error) {
+	return Bool(c.d.Do(ctx, "PEXPIREAT", key, t.UnixNano()/int64(time.Millisecond)))
+}
+
+// Persist removes the TTL of key, false if key does not exist or has no TTL.
+func (c *Commands) Persist(ctx context.Context, key string) (bool, error) {
+	return Bool(c.d.Do(ctx, "PERSIST", key))
+}
+
+// TTL returns the TTL of key in milliseconds, -1 if key has no TTL and -2 if
+// it does not exist.
+func (c *Commands) TTL(ctx context.Context, key string) (time.Duration, error) {
+	n, err := Int64(c.d.Do(ctx, "PTTL", key))
+	if err != nil || n < 0 {
+		return time.Duration(n), err
+	}
+	return time.Duration(n) * time.Millisecond, nil
+}
+
+// Type returns the type of key, "none" if it does not exist.
+func (c *Commands) Type(ctx context.Context, key string) (string, error) {
+	return String(c.d.Do(ctx, "TYPE", key))
+}
+
+// Rename renames key to newKey, overwriting it.
+func (c *Commands) Rename(ctx context.Context, key, newKey string) error {
+	return status(c.d.Do(ctx, "RENAME", key, newKey))
+}
+
+// RenameNX renames key to newKey if it does not exist.
+func (c *Commands) RenameNX(ctx context.Context, key, newKey string) (bool, error) {
+	return Bool(c.d.Do(ctx, "RENAMENX", key, newKey))
+}
@@ -0,0 +1,82 @@
+package redis
+
+import "context"
+
+// HGet returns the value of field in the hash of key.
+func (c *Commands) HGet(ctx context.Context, key, field string) (string, error) {
+	return String(c.d.Do(ctx, "HGET", key, field))
+}
+
+// HGetAll returns the fields and values of the hash of key.
+func (c *Commands) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return StringMap(c.d.Do(ctx, "HGETALL", key))
+}
+
+// HGetAllStruct scans the hash of key into the struct pointed by dest by
+// ScanStruct, ErrNil is returned if the hash does not exist.
+func (c *Commands) HGetAllStruct(ctx context.Context, key string, dest interface{}) error {
+	values, err := Values(c.d.Do(ctx, "HGETALL", key))
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return ErrNil
+	}
+	return ScanStruct(values, dest)
+}
+
+// HMGet returns the values of the fields, nil for the fields not existing.
+func (c *Commands) HMGet(ctx context.Context, key string, fields ...string) ([][]byte, error) {
+	return ByteSlices(c.d.Do(ctx, "HMGET", Args{}.Add(key).Add(stringArgs(fields)...)...))
+}
+
+// HSet sets field in the hash of key, true if the field is new.
+func (c *Commands) HSet(ctx context.Context, key, field string, value interface{}) (bool, error) {
+	return Bool(c.d.Do(ctx, "HSET", key, field, value))
+}
+
+// HSetAll sets the fields of v, flattened by Args.AddFlat: a map or a struct
+// with redis field tags, and returns how many are new.
+func (c *Commands) HSetAll(ctx context.Context, key string, v interface{}) (int64, error) {
+	return Int64(c.d.Do(ctx, "HSET", Args{}.Add(key).AddFlat(v)...))
+}
+
+// HSetNX sets field in the hash of key if it does not exist.
+func (c *Commands) HSetNX(ctx context.Context, key, field string, value interface{}) (bool, error) {
+	return Bool(c.d.Do(ctx, "HSETNX", key, field, value))
+}
+
+// HDel removes the fields and returns how many existed.
+func (c *Commands) HDel(ctx context.Context, key string, fields ...string) (int64, error) {
+	return Int64(c.d.Do(ctx, "HDEL", Args{}.Add(key).Add(stringArgs(fields)...)...))
+}
+
+// HExists reports whether field exists in the hash of key.
+func (c *Commands) HExists(ctx context.Context, key, field string) (bool, error) {
+	return Bool(c.d.Do(ctx, "HEXISTS", key, field))
+}
+
+// HIncrBy increments the integer value of field by n.
+func (c *Commands) HIncrBy(ctx context.Context, key, field string, n int64) (int64, error) {
+	return Int64(c.d.Do(ctx, "HINCRBY", key, field, n))
+}
+
+// HIncrByFloat increments the float value of field by f.
+func (c *Commands) HIncrByFloat(ctx context.Context, key, field string, f float64) (float64, error) {
+	return Float64(c.d.Do(ctx, "HINCRBYFLOAT", key, field, f))
+}
+
+// HLen returns how many fields the hash of key has.
+func (c *Commands) HLen(ctx context.Context, key string) (int64, error) {
+	return Int64(c.d.Do(ctx, "HLEN", key))
+}
+
+// HKeys returns the fields of the hash of key.
+func (c *Commands) HKeys(ctx context.Context, key string) ([]string, error) {
+	return Strings(c.d.Do(ctx, "HKEYS", key))
+}
+
+// HVals returns the values of the hash of key.
+func (c *Commands) HVals(ctx context.Context, key string) ([]string, error) {
+	return Strings(c.d.Do(ctx, "HVALS", key))
+}
@@ -0,0 +1,118 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	pkgerr "github.com/pkg/errors"
+)
+
+// LPush prepends the values to the list of key and returns its length.
+func (c *Commands) LPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	return Int64(c.d.Do(ctx, "LPUSH", Args{}.Add(key).Add(values...)...))
+}
+
+// RPush appends the values to the list of key and returns its length.
+func (c *Commands) RPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	return Int64(c.d.Do(ctx, "RPUSH", Args{}.Add(key).Add(values...)...))
+}
+
+// LPushX prepends the values to the list of key if it exists.
+func (c *Commands) LPushX(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	return Int64(c.d.Do(ctx, "LPUSHX", Args{}.Add(key).Add(values...)...))
+}
+
+// RPushX appends the values to the list of key if it exists.
+func (c *Commands) RPushX(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	return Int64(c.d.Do(ctx, "RPUSHX", Args{}.Add(key).Add(values...)...))
+}
+
+// LPop removes and returns the first element of the list of key.
+func (c *Commands) LPop(ctx context.Context, key string) (string, error) {
+	return String(c.d.Do(ctx, "LPOP", key))
+}
+
+// RPop removes and returns the last element of the list of key.
+func (c *Commands) RPop(ctx context.Context, key string) (string, error) {
+	return String(c.d.Do(ctx, "RPOP", key))
+}
+
+// popArgs rounds timeout up to seconds, the unit of redis before 6.
+func popArgs(keys []string, timeout time.Duration) Args {
+	return Args{}.Add(stringArgs(keys)...).Add(int64((timeout + time.Second - 1) / time.Second))
+}
+
+// blockingPop converts the key and the element of a blocking pop.
+func blockingPop(reply interface{}, err error) (string, string, error) {
+	values, err := Strings(reply, err)
+	if err != nil {
+		return "", "", err
+	}
+	if len(values) != 2 {
+		return "", "", pkgerr.Errorf("redigo: unexpected reply for blocking pop, got %d values", len(values))
+	}
+	return values[0], values[1], nil
+}
+
+// BLPop pops the first element of the first non empty list of the keys, it
+// waits up to timeout, 0 for ever, then ErrNil is returned. The read timeout
+// of the conn must be longer than timeout.
+func (c *Commands) BLPop(ctx context.Context, timeout time.Duration, keys ...string) (key, value string, err error) {
+	return blockingPop(c.d.Do(ctx, "BLPOP", popArgs(keys, timeout)...))
+}
+
+// BRPop pops the last element of the first non empty list of the keys like
+// BLPop.
+func (c *Commands) BRPop(ctx context.Context, timeout time.Duration, keys ...string) (key, value string, err error) {
+	return blockingPop(c.d.Do(ctx, "BRPOP", popArgs(keys, timeout)...))
+}
+
+// RPopLPush moves the last element of the list of src to the head of the list
+// of dest and returns it.
+func (c *Commands) RPopLPush(ctx context.Context, src, dest string) (string, error) {
+	return String(c.d.Do(ctx, "RPOPLPUSH", src, dest))
+}
+
+// LRange returns the elements of the list of key between the indexes start
+// and stop, both included, negative from the end.
+func (c *Commands) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return Strings(c.d.Do(ctx, "LRANGE", key, start, stop))
+}
+
+// LLen returns the length of the list of key.
+func (c *Commands) LLen(ctx context.Context, key string) (int64, error) {
+	return Int64(c.d.Do(ctx, "LLEN", key))
+}
+
+// LIndex returns the element at index of the list of key.
+func (c *Commands) LIndex(ctx context.Context, key string, index int64) (string, error) {
+	return String(c.d.Do(ctx, "LINDEX", key, index))
+}
+
+// LSet sets the element at index of the list of key.
+func (c *Commands) LSet(ctx context.Context, key string, index int64, value interface{}) error {
+	return status(c.d.Do(ctx, "LSET", key, index, value))
+}
+
+// LInsertBefore inserts value before pivot in the list of key and returns its
+// length, -1 if pivot is not found.
+func (c *Commands) LInsertBefore(ctx context.Context, key string, pivot, value interface{}) (int64, error) {
+	return Int64(c.d.Do(ctx, "LINSERT", key, "BEFORE", pivot, value))
+}
+
+// LInsertAfter inserts value after pivot like LInsertBefore.
+func (c *Commands) LInsertAfter(ctx context.Context, key string, pivot, value interface{}) (int64, error) {
+	return Int64(c.d.Do(ctx, "LINSERT", key, "AFTER", pivot, value))
+}
+
+// LRem removes count elements equal to value from the head, from the tail if
+// count is negative, all of them if it is 0, and returns how many are removed.
+func (c *Commands) LRem(ctx context.Context, key string, count int64, value interface{}) (int64, error) {
+	return Int64(c.d.Do(ctx, "LREM", key, count, value))
+}
+
+// LTrim trims the list of key to the elements between the indexes start and
+// stop, both included.
+func (c *Commands) LTrim(ctx context.Context, key string, start, stop int64) error {
+	return status(c.d.Do(ctx, "LTRIM", key, start, stop))
+}
@@ -0,0 +1,78 @@
+package redis
+
+import "context"
+
+// SAdd adds the members to the set of key and returns how many are new.
+func (c *Commands) SAdd(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	return Int64(c.d.Do(ctx, "SADD", Args{}.Add(key).Add(members...)...))
+}
+
+// SRem removes the members from the set of key and returns how many existed.
+func (c *Commands) SRem(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	return Int64(c.d.Do(ctx, "SREM", Args{}.Add(key).Add(members...)...))
+}
+
+// SMembers returns the members of the set of key.
+func (c *Commands) SMembers(ctx context.Context, key string) ([]string, error) {
+	return Strings(c.d.Do(ctx, "SMEMBERS", key))
+}
+
+// SIsMember reports whether member is in the set of key.
+func (c *Commands) SIsMember(ctx context.Context, key string, member interface{}) (bool, error) {
+	return Bool(c.d.Do(ctx, "SISMEMBER", key, member))
+}
+
+// SCard returns how many members the set of key has.
+func (c *Commands) SCard(ctx context.Context, key string) (int64, error) {
+	return Int64(c.d.Do(ctx, "SCARD", key))
+}
+
+// SPop removes and returns a random member of the set of key.
+func (c *Commands) SPop(ctx context.Context, key string) (string, error) {
+	return String(c.d.Do(ctx, "SPOP", key))
+}
+
+// SRandMember returns count distinct random members of the set of key, a
+// negative count allows the same member many times.
+func (c *Commands) SRandMember(ctx context.Context, key string, count int64) ([]string, error) {
+	return Strings(c.d.Do(ctx, "SRANDMEMBER", key, count))
+}
+
+// SMove moves member from the set of src to the set of dest, false if it is
+// not in src.
+func (c *Commands) SMove(ctx context.Context, src, dest string, member interface{}) (bool, error) {
+	return Bool(c.d.Do(ctx, "SMOVE", src, dest, member))
+}
+
+// SInter returns the intersection of the sets of the keys.
+func (c *Commands) SInter(ctx context.Context, keys ...string) ([]string, error) {
+	return Strings(c.d.Do(ctx, "SINTER", stringArgs(keys)...))
+}
+
+// SUnion returns the union of the sets of the keys.
+func (c *Commands) SUnion(ctx context.Context, keys ...string) ([]string, error) {
+	return Strings(c.d.Do(ctx, "SUNION", stringArgs(keys)...))
+}
+
+// SDiff returns the members of the set of the first key not in the others.
+func (c *Commands) SDiff(ctx context.Context, keys ...string) ([]string, error) {
+	return Strings(c.d.Do(ctx, "SDIFF", stringArgs(keys)...))
+}
+
+// SInterStore stores the intersection of the sets of the keys in dest and
+// returns its size.
+func (c *Commands) SInterStore(ctx context.Context, dest string, keys ...string) (int64, error) {
+	return Int64(c.d.Do(ctx, "SINTERSTORE", Args{}.Add(dest).Add(stringArgs(keys)...)...))
+}
+
+// SUnionStore stores the union of the sets of the keys in dest and returns
+// its size.
+func (c *Commands) SUnionStore(ctx context.Context, dest string, keys ...string) (int64, error) {
+	return Int64(c.d.Do(ctx, "SUNIONSTORE", Args{}.Add(dest).Add(stringArgs(keys)...)...))
+}
+
+// SDiffStore stores the difference of the sets of the keys in dest and
+// returns its size.
+func (c *Commands) SDiffStore(ctx context.Context, dest string, keys ...string) (int64, error) {
+	return Int64(c.d.Do(ctx, "SDIFFSTORE", Args{}.Add(dest).Add(stringArgs(keys)...)...))
+}
@@ -0,0 +1,161 @@
+package redis
+
+import (
+	"context"
+	"time"
+)
+
+// Get returns the value of key.
+func (c *Commands) Get(ctx context.Context, key string) (string, error) {
+	return String(c.d.Do(ctx, "GET", key))
+}
+
+// GetBytes returns the value of key as bytes.
+func (c *Commands) GetBytes(ctx context.Context, key string) ([]byte, error) {
+	return Bytes(c.d.Do(ctx, "GET", key))
+}
+
+// GetSet sets the value of key and returns its old value.
+func (c *Commands) GetSet(ctx context.Context, key string, value interface{}) (string, error) {
+	return String(c.d.Do(ctx, "GETSET", key, value))
+}
+
+// MGet returns the values of the keys, nil for the keys not existing.
+func (c *Commands) MGet(ctx context.Context, keys ...string) ([][]byte, error) {
+	return ByteSlices(c.d.Do(ctx, "MGET", stringArgs(keys)...))
+}
+
+func setArgs(key string, value interface{}, ttl time.Duration, cond string) Args {
+	args := Args{}.Add(key, value)
+	if ttl > 0 {
+		args = args.Add("PX", ms(ttl))
+	}
+	if cond != "" {
+		args = args.Add(cond)
+	}
+	return args
+}
+
+// Set sets the value of key, ttl <= 0 means no TTL.
+func (c *Commands) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return status(c.d.Do(ctx, "SET", setArgs(key, value, ttl, "")...))
+}
+
+// SetNX sets the value of key if it does not exist.
+func (c *Commands) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	return setCond(c.d.Do(ctx, "SET", setArgs(key, value, ttl, "NX")...))
+}
+
+// SetXX sets the value of key if it exists.
+func (c *Commands) SetXX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	return setCond(c.d.Do(ctx, "SET", setArgs(key, value, ttl, "XX")...))
+}
+
+// setCond converts the reply of a conditional SET, nil if it is not set.
+func setCond(reply interface{}, err error) (bool, error) {
+	if err = status(reply, err); err == ErrNil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// MSet sets the values of v, flattened by Args.AddFlat: a map or a struct
+// with redis field tags.
+func (c *Commands) MSet(ctx context.Context, v interface{}) error {
+	return status(c.d.Do(ctx, "MSET", Args{}.AddFlat(v)...))
+}
+
+// Incr increments the integer value of key by one.
+func (c *Commands) Incr(ctx context.Context, key string) (int64, error) {
+	return Int64(c.d.Do(ctx, "INCR", key))
+}
+
+// IncrBy increments the integer value of key by n.
+func (c *Commands) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	return Int64(c.d.Do(ctx, "INCRBY", key, n))
+}
+
+// IncrByFloat increments the float value of key by f.
+func (c *Commands) IncrByFloat(ctx context.Context, key string, f float64) (float64, error) {
+	return Float64(c.d.Do(ctx, "INCRBYFLOAT", key, f))
+}
+
+// Decr decrements the integer value of key by one.
+func (c *Commands) Decr(ctx context.Context, key string) (int64, error) {
+	return Int64(c.d.Do(ctx, "DECR", key))
+}
+
+// DecrBy decrements the integer value of key by n.
+func (c *Commands) DecrBy(ctx context.Context, key string, n int64) (int64, error) {
+	return Int64(c.d.Do(ctx, "DECRBY", key, n))
+}
+
+// Append appends value to the value of key and returns its length.
+func (c *Commands) Append(ctx context.Context, key, value string) (int64, error) {
+	return Int64(c.d.Do(ctx, "APPEND", key, value))
+}
+
+// StrLen returns the length of the value of key.
+func (c *Commands) StrLen(ctx context.Context, key string) (int64, error) {
+	return Int64(c.d.Do(ctx, "STRLEN", key))
+}
+
+// GetRange returns the substring of the value of key between the offsets
+// start and end, both included.
+func (c *Commands) GetRange(ctx context.Context, key string, start, end int64) (string, error) {
+	return String(c.d.Do(ctx, "GETRANGE", key, start, end))
+}
+
+// SetRange overwrites the value of key from offset and returns its length.
+func (c *Commands) SetRange(ctx context.Context, key string, offset int64, value string) (int64, error) {
+	return Int64(c.d.Do(ctx, "SETRANGE", key, offset, value))
+}
+
+// SetBit sets the bit at offset of key to value and returns its old value.
+func (c *Commands) SetBit(ctx context.Context, key string, offset int64, value int) (int, error) {
+	return Int(c.d.Do(ctx, "SETBIT", key, offset, value))
+}
+
+// GetBit returns the bit at offset of key.
+func (c *Commands) GetBit(ctx context.Context, key string, offset int64) (int, error) {
+	return Int(c.d.Do(ctx, "GETBIT", key, offset))
+}
+
+// BitCount returns how many bits of key are set.
+func (c *Commands) BitCount(ctx context.Context, key string) (int64, error) {
+	return Int64(c.d.Do(ctx, "BITCOUNT", key))
+}
+
+// BitCountRange returns how many bits are set between the bytes start and
+// end of key, both included.
+func (c *Commands) BitCountRange(ctx context.Context, key string, start, end int64) (int64, error) {
+	return Int64(c.d.Do(ctx, "BITCOUNT", key, start, end))
+}
+
+// BitPos returns the position of the first bit of key set to bit, -1 if
+// there is none.
+func (c *Commands) BitPos(ctx context.Context, key string, bit int) (int64, error) {
+	return Int64(c.d.Do(ctx, "BITPOS", key, bit))
+}
+
+// BitOp stores the bitwise op, AND, OR, XOR or NOT, of the keys in dest and
+// returns its length.
+func (c *Commands) BitOp(ctx context.Context, op, dest string, keys ...string) (int64, error) {
+	return Int64(c.d.Do(ctx, "BITOP", Args{}.Add(op, dest).Add(stringArgs(keys)...)...))
+}
+
+// PFAdd adds the elements to the HyperLogLog of key, true if its estimate
+// changed.
+func (c *Commands) PFAdd(ctx context.Context, key string, elements ...interface{}) (bool, error) {
+	return Bool(c.d.Do(ctx, "PFADD", Args{}.Add(key).Add(elements...)...))
+}
+
+// PFCount returns the estimated cardinality of the union of the keys.
+func (c *Commands) PFCount(ctx context.Context, keys ...string) (int64, error) {
+	return Int64(c.d.Do(ctx, "PFCOUNT", stringArgs(keys)...))
+}
+
+// PFMerge stores the union of the keys in dest.
+func (c *Commands) PFMerge(ctx context.Context, dest string, keys ...string) error {
+	return status(c.d.Do(ctx, "PFMERGE", Args{}.Add(dest).Add(stringArgs(keys)...)...))
+}
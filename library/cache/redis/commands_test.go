@@ -0,0 +1,214 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testUser struct {
+	Name string `redis:"name"`
+	Age  int    `redis:"age"`
+}
+
+func TestCommands(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// the replies of the fake server by request.
+	replies := map[string]interface{}{
+		"DEL a b":                     int64(2),
+		"PEXPIRE a 1500":              int64(1),
+		"PTTL a":                      int64(1500),
+		"PTTL b":                      int64(-2),
+		"TYPE a":                      "string",
+		"RENAME a b":                  "OK",
+		"GET a":                       []byte("1"),
+		"GET b":                       nil,
+		"MGET a b":                    []interface{}{[]byte("1"), nil},
+		"SET a 1 PX 2000":             "OK",
+		"SET a 1 NX":                  nil,
+		"SET a 1 PX 1000 XX":          "OK",
+		"MSET name tom age 3":         "OK",
+		"INCRBYFLOAT a 0.5":           []byte("1.5"),
+		"SETBIT bits 7 1":             int64(0),
+		"BITOP AND dest a b":          int64(1),
+		"PFADD hll x y":               int64(1),
+		"PFCOUNT hll":                 int64(2),
+		"HGETALL user":                []interface{}{[]byte("name"), []byte("tom"), []byte("age"), []byte("3")},
+		"HGETALL none":                []interface{}{},
+		"HSET user name tom age 3":    int64(2),
+		"HMGET user name sex":         []interface{}{[]byte("tom"), nil},
+		"HEXISTS user name":           int64(1),
+		"RPUSH list x y":              int64(2),
+		"LRANGE list 0 -1":            []interface{}{[]byte("x"), []byte("y")},
+		"BLPOP l1 l2 2":               []interface{}{[]byte("l2"), []byte("x")},
+		"BRPOP l1 1":                  nil,
+		"LINSERT list BEFORE y z":     int64(3),
+		"SADD set x y":                int64(2),
+		"SISMEMBER set z":             int64(0),
+		"SINTERSTORE dest s1 s2":      int64(1),
+		"ZADD zset 1 x 2.5 y":         int64(2),
+		"ZSCORE zset y":               []byte("2.5"),
+		"ZSCORE zset z":               nil,
+		"ZRANGE zset 0 -1 WITHSCORES": []interface{}{[]byte("x"), []byte("1"), []byte("y"), []byte("2.5")},
+		"ZREVRANGEBYSCORE zset +inf (1 LIMIT 0 10": []interface{}{[]byte("y")},
+		"ZRANGEBYSCORE zset -inf +inf WITHSCORES":  []interface{}{[]byte("x"), []byte("1")},
+		"ZPOPMIN zset 2": []interface{}{[]interface{}{[]byte("x"), []byte("1")}, []interface{}{[]byte("y"), []byte("2.5")}},
+		"ZRANK zset x":   int64(0),
+		"ZREVRANGEBYSCORE zset 3 1 WITHSCORES LIMIT 1 1": []interface{}{[]byte("x"), []byte("1")},
+	}
+	go serveFake(ln, func(w *fakeWriter, req []string) {
+		cmd := strings.Join(req, " ")
+		reply, ok := replies[cmd]
+		if !ok {
+			reply = Error("ERR unexpected " + cmd)
+		}
+		w.write(reply)
+	})
+	r := newTestRedis("test_commands", ln.Addr().String())
+	defer r.Close()
+	ctx := context.Background()
+	c := r.Commands()
+
+	// keys.
+	n, err := c.Del(ctx, "a", "b")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	ok, err := c.Expire(ctx, "a", 1500*time.Millisecond)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ttl, err := c.TTL(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, 1500*time.Millisecond, ttl)
+	ttl, err = c.TTL(ctx, "b")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(-2), ttl)
+	typ, err := c.Type(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "string", typ)
+	assert.Nil(t, c.Rename(ctx, "a", "b"))
+
+	// strings.
+	s, err := c.Get(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", s)
+	_, err = c.Get(ctx, "b")
+	assert.Equal(t, ErrNil, err)
+	values, err := c.MGet(ctx, "a", "b")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("1"), nil}, values)
+	assert.Nil(t, c.Set(ctx, "a", 1, 2*time.Second))
+	ok, err = c.SetNX(ctx, "a", 1, 0)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = c.SetXX(ctx, "a", 1, time.Second)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Nil(t, c.MSet(ctx, &testUser{Name: "tom", Age: 3}))
+	f, err := c.IncrByFloat(ctx, "a", 0.5)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, f)
+	// an unknown request.
+	_, err = c.Incr(ctx, "a")
+	assert.Equal(t, Error("ERR unexpected INCR a"), err)
+
+	// bitmaps and HyperLogLogs.
+	bit, err := c.SetBit(ctx, "bits", 7, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, bit)
+	n, err = c.BitOp(ctx, "AND", "dest", "a", "b")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	ok, err = c.PFAdd(ctx, "hll", "x", "y")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	n, err = c.PFCount(ctx, "hll")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// hashes.
+	m, err := c.HGetAll(ctx, "user")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"name": "tom", "age": "3"}, m)
+	var u testUser
+	assert.Nil(t, c.HGetAllStruct(ctx, "user", &u))
+	assert.Equal(t, testUser{Name: "tom", Age: 3}, u)
+	assert.Equal(t, ErrNil, c.HGetAllStruct(ctx, "none", &u))
+	n, err = c.HSetAll(ctx, "user", &u)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	values, err = c.HMGet(ctx, "user", "name", "sex")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("tom"), nil}, values)
+	ok, err = c.HExists(ctx, "user", "name")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// lists.
+	n, err = c.RPush(ctx, "list", "x", "y")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	list, err := c.LRange(ctx, "list", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"x", "y"}, list)
+	key, value, err := c.BLPop(ctx, 1500*time.Millisecond, "l1", "l2")
+	assert.Nil(t, err)
+	assert.Equal(t, "l2", key)
+	assert.Equal(t, "x", value)
+	_, _, err = c.BRPop(ctx, time.Second, "l1")
+	assert.Equal(t, ErrNil, err)
+	n, err = c.LInsertBefore(ctx, "list", "y", "z")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+
+	// sets.
+	n, err = c.SAdd(ctx, "set", "x", "y")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	ok, err = c.SIsMember(ctx, "set", "z")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	n, err = c.SInterStore(ctx, "dest", "s1", "s2")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	// sorted sets.
+	n, err = c.ZAdd(ctx, "zset", Z{Member: "x", Score: 1}, Z{Member: "y", Score: 2.5})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	f, err = c.ZScore(ctx, "zset", "y")
+	assert.Nil(t, err)
+	assert.Equal(t, 2.5, f)
+	_, err = c.ZScore(ctx, "zset", "z")
+	assert.Equal(t, ErrNil, err)
+	zs, err := c.ZRangeWithScores(ctx, "zset", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []Z{{"x", 1}, {"y", 2.5}}, zs)
+	list, err = c.ZRevRangeByScore(ctx, "zset", ZRangeBy{Min: "(1", Max: "+inf", Count: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"y"}, list)
+	zs, err = c.ZRangeByScoreWithScores(ctx, "zset", ZRangeBy{Min: "-inf", Max: "+inf"})
+	assert.Nil(t, err)
+	assert.Equal(t, []Z{{"x", 1}}, zs)
+	zs, err = c.ZRevRangeByScoreWithScores(ctx, "zset", ZRangeBy{Min: "1", Max: "3", Offset: 1, Count: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []Z{{"x", 1}}, zs)
+	// the pairs of RESP3.
+	zs, err = c.ZPopMin(ctx, "zset", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []Z{{"x", 1}, {"y", 2.5}}, zs)
+
+	// the commands on a conn.
+	conn := r.Conn(ctx)
+	defer conn.Close()
+	rank, err := NewCommands(ConnDoer(conn)).ZRank(ctx, "zset", "x")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), rank)
+}
@@ -0,0 +1,180 @@
+package redis
+
+import (
+	"context"
+
+	pkgerr "github.com/pkg/errors"
+)
+
+// Z is a member of a sorted set with its score.
+type Z struct {
+	Member string
+	Score  float64
+}
+
+// ZRangeBy is a range of scores, e.g. "(1" or "-inf", with a LIMIT of Count
+// members from Offset, no LIMIT if Count is 0.
+type ZRangeBy struct {
+	Min, Max      string
+	Offset, Count int64
+}
+
+func (by ZRangeBy) args(key string, rev bool, withScores bool) Args {
+	args := Args{}.Add(key)
+	if rev {
+		args = args.Add(by.Max, by.Min)
+	} else {
+		args = args.Add(by.Min, by.Max)
+	}
+	if withScores {
+		args = args.Add("WITHSCORES")
+	}
+	if by.Count != 0 {
+		args = args.Add("LIMIT", by.Offset, by.Count)
+	}
+	return args
+}
+
+// zs converts the members with their scores, either flat in RESP2 or as
+// pairs in RESP3.
+func zs(reply interface{}, err error) ([]Z, error) {
+	values, err := Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) > 0 {
+		if _, ok := values[0].([]interface{}); ok {
+			var flat []interface{}
+			for _, v := range values {
+				pair, _ := v.([]interface{})
+				flat = append(flat, pair...)
+			}
+			values = flat
+		}
+	}
+	if len(values)%2 != 0 {
+		return nil, pkgerr.New("redigo: expects even number of values for sorted set members with scores")
+	}
+	members := make([]Z, len(values)/2)
+	for i := range members {
+		if members[i].Member, err = String(values[2*i], nil); err != nil {
+			return nil, err
+		}
+		if members[i].Score, err = Float64(values[2*i+1], nil); err != nil {
+			return nil, err
+		}
+	}
+	return members, nil
+}
+
+// ZAdd adds the members or updates their scores, and returns how many are
+// new.
+func (c *Commands) ZAdd(ctx context.Context, key string, members ...Z) (int64, error) {
+	args := Args{}.Add(key)
+	for _, m := range members {
+		args = args.Add(m.Score, m.Member)
+	}
+	return Int64(c.d.Do(ctx, "ZADD", args...))
+}
+
+// ZIncrBy increments the score of member by incr and returns it.
+func (c *Commands) ZIncrBy(ctx context.Context, key string, incr float64, member string) (float64, error) {
+	return Float64(c.d.Do(ctx, "ZINCRBY", key, incr, member))
+}
+
+// ZScore returns the score of member.
+func (c *Commands) ZScore(ctx context.Context, key, member string) (float64, error) {
+	return Float64(c.d.Do(ctx, "ZSCORE", key, member))
+}
+
+// ZRem removes the members and returns how many existed.
+func (c *Commands) ZRem(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	return Int64(c.d.Do(ctx, "ZREM", Args{}.Add(key).Add(members...)...))
+}
+
+// ZCard returns how many members the sorted set of key has.
+func (c *Commands) ZCard(ctx context.Context, key string) (int64, error) {
+	return Int64(c.d.Do(ctx, "ZCARD", key))
+}
+
+// ZCount returns how many members have a score between min and max.
+func (c *Commands) ZCount(ctx context.Context, key, min, max string) (int64, error) {
+	return Int64(c.d.Do(ctx, "ZCOUNT", key, min, max))
+}
+
+// ZRank returns the rank of member by ascending score.
+func (c *Commands) ZRank(ctx context.Context, key, member string) (int64, error) {
+	return Int64(c.d.Do(ctx, "ZRANK", key, member))
+}
+
+// ZRevRank returns the rank of member by descending score.
+func (c *Commands) ZRevRank(ctx context.Context, key, member string) (int64, error) {
+	return Int64(c.d.Do(ctx, "ZREVRANK", key, member))
+}
+
+// ZRange returns the members between the ranks start and stop by ascending
+// score, both included.
+func (c *Commands) ZRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return Strings(c.d.Do(ctx, "ZRANGE", key, start, stop))
+}
+
+// ZRangeWithScores returns the members with their scores like ZRange.
+func (c *Commands) ZRangeWithScores(ctx context.Context, key string, start, stop int64) ([]Z, error) {
+	return zs(c.d.Do(ctx, "ZRANGE", key, start, stop, "WITHSCORES"))
+}
+
+// ZRevRange returns the members between the ranks start and stop by
+// descending score, both included.
+func (c *Commands) ZRevRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return Strings(c.d.Do(ctx, "ZREVRANGE", key, start, stop))
+}
+
+// ZRevRangeWithScores returns the members with their scores like ZRevRange.
+func (c *Commands) ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) ([]Z, error) {
+	return zs(c.d.Do(ctx, "ZREVRANGE", key, start, stop, "WITHSCORES"))
+}
+
+// ZRangeByScore returns the members with a score in by by ascending score.
+func (c *Commands) ZRangeByScore(ctx context.Context, key string, by ZRangeBy) ([]string, error) {
+	return Strings(c.d.Do(ctx, "ZRANGEBYSCORE", by.args(key, false, false)...))
+}
+
+// ZRangeByScoreWithScores returns the members with their scores like
+// ZRangeByScore.
+func (c *Commands) ZRangeByScoreWithScores(ctx context.Context, key string, by ZRangeBy) ([]Z, error) {
+	return zs(c.d.Do(ctx, "ZRANGEBYSCORE", by.args(key, false, true)...))
+}
+
+// ZRevRangeByScore returns the members with a score in by by descending
+// score.
+func (c *Commands) ZRevRangeByScore(ctx context.Context, key string, by ZRangeBy) ([]string, error) {
+	return Strings(c.d.Do(ctx, "ZREVRANGEBYSCORE", by.args(key, true, false)...))
+}
+
+// ZRevRangeByScoreWithScores returns the members with their scores like
+// ZRevRangeByScore.
+func (c *Commands) ZRevRangeByScoreWithScores(ctx context.Context, key string, by ZRangeBy) ([]Z, error) {
+	return zs(c.d.Do(ctx, "ZREVRANGEBYSCORE", by.args(key, true, true)...))
+}
+
+// ZRemRangeByRank removes the members between the ranks start and stop and
+// returns how many are removed.
+func (c *Commands) ZRemRangeByRank(ctx context.Context, key string, start, stop int64) (int64, error) {
+	return Int64(c.d.Do(ctx, "ZREMRANGEBYRANK", key, start, stop))
+}
+
+// ZRemRangeByScore removes the members with a score between min and max and
+// returns how many are removed.
+func (c *Commands) ZRemRangeByScore(ctx context.Context, key, min, max string) (int64, error) {
+	return Int64(c.d.Do(ctx, "ZREMRANGEBYSCORE", key, min, max))
+}
+
+// ZPopMin removes and returns count members with the lowest scores.
+func (c *Commands) ZPopMin(ctx context.Context, key string, count int64) ([]Z, error) {
+	return zs(c.d.Do(ctx, "ZPOPMIN", key, count))
+}
+
+// ZPopMax removes and returns count members with the highest scores.
+func (c *Commands) ZPopMax(ctx context.Context, key string, count int64) ([]Z, error) {
+	return zs(c.d.Do(ctx, "ZPOPMAX", key, count))
+}
@@ -18,8 +18,10 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
+	"math/big"
 	"net"
 	"net/url"
 	"regexp"
@@ -81,6 +83,9 @@ type conn struct {
 
 	// Scratch space for formatting integers and floats.
 	numScratch [40]byte
+
+	// push receives the RESP3 push frames other than pub/sub.
+	push func(Push)
 }
 
 // DialTimeout acts like Dial but takes timeouts for establishing the
@@ -100,11 +105,19 @@ type DialOption struct {
 }
 
 type dialOptions struct {
-	readTimeout  time.Duration
-	writeTimeout time.Duration
-	dial         func(network, addr string) (net.Conn, error)
-	db           int
-	password     string
+	readTimeout    time.Duration
+	writeTimeout   time.Duration
+	dial           func(network, addr string) (net.Conn, error)
+	connectTimeout time.Duration
+	db             int
+	username       string
+	password       string
+	clientName     string
+	useTLS         bool
+	tlsConfig      *tls.Config
+	skipVerify     bool
+	resp3          bool
+	push           func(Push)
 }
 
 // DialReadTimeout specifies the timeout for reading a single command reply.
@@ -126,6 +139,7 @@ func DialConnectTimeout(d time.Duration) DialOption {
 	return DialOption{func(do *dialOptions) {
 		dialer := net.Dialer{Timeout: d}
 		do.dial = dialer.Dial
+		do.connectTimeout = d
 	}}
 }
 
@@ -153,6 +167,65 @@ func DialPassword(password string) DialOption {
 	}}
 }
 
+// DialUsername specifies the ACL user to authenticate as with
+// AUTH <username> <password>, the server must be redis 6 or later.
+func DialUsername(username string) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.username = username
+	}}
+}
+
+// DialClientName specifies the name set by CLIENT SETNAME, it is listed by
+// CLIENT LIST.
+func DialClientName(name string) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.clientName = name
+	}}
+}
+
+// DialUseTLS specifies whether TLS should be used when connecting to the
+// server.
+func DialUseTLS(useTLS bool) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.useTLS = useTLS
+	}}
+}
+
+// DialTLSConfig specifies the config to use when a TLS connection is dialed,
+// the server name defaults to the host of the address. It has no effect
+// unless DialUseTLS is set.
+func DialTLSConfig(c *tls.Config) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.tlsConfig = c
+	}}
+}
+
+// DialTLSSkipVerify disables the verification of the server certificate
+// when connecting over TLS, only for tests.
+func DialTLSSkipVerify(skip bool) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.skipVerify = skip
+	}}
+}
+
+// DialRESP3 specifies the connection negotiates RESP3 with HELLO 3, the
+// server must be redis 6 or later.
+func DialRESP3() DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.resp3 = true
+	}}
+}
+
+// DialPushHandler specifies the function the RESP3 push frames are delivered
+// to, e.g. the CLIENT TRACKING invalidations. The pub/sub frames are replies
+// of the connection and are not delivered. If this option is left out, the
+// frames are dropped. fn runs on the reading goroutine and must not block.
+func DialPushHandler(fn func(Push)) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.push = fn
+	}}
+}
+
 // Dial connects to the Redis server at the given network and
 // address using the specified options.
 func Dial(network, address string, options ...DialOption) (Conn, error) {
@@ -167,16 +240,40 @@ func Dial(network, address string, options ...DialOption) (Conn, error) {
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	if do.useTLS {
+		if netConn, err = dialTLS(netConn, address, &do); err != nil {
+			return nil, err
+		}
+	}
 	c := &conn{
 		conn:         netConn,
 		bw:           bufio.NewWriter(netConn),
 		br:           bufio.NewReader(netConn),
 		readTimeout:  do.readTimeout,
 		writeTimeout: do.writeTimeout,
+		push:         do.push,
 	}
 
 	if do.password != "" {
-		if _, err := c.Do("AUTH", do.password); err != nil {
+		authArgs := []interface{}{do.password}
+		if do.username != "" {
+			authArgs = []interface{}{do.username, do.password}
+		}
+		if _, err := c.Do("AUTH", authArgs...); err != nil {
+			netConn.Close()
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	if do.resp3 {
+		if _, err := c.Do("HELLO", 3); err != nil {
+			netConn.Close()
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	if do.clientName != "" {
+		if _, err := c.Do("CLIENT", "SETNAME", do.clientName); err != nil {
 			netConn.Close()
 			return nil, errors.WithStack(err)
 		}
@@ -196,13 +293,14 @@ var pathDBRegexp = regexp.MustCompile(`/(\d+)\z`)
 // DialURL connects to a Redis server at the given URL using the Redis
 // URI scheme. URLs should follow the draft IANA specification for the
 // scheme (https://www.iana.org/assignments/uri-schemes/prov/redis).
+// A rediss:// URL is dialed over TLS.
 func DialURL(rawurl string, options ...DialOption) (Conn, error) {
 	u, err := url.Parse(rawurl)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	if u.Scheme != "redis" {
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
 		return nil, fmt.Errorf("invalid redis URL scheme: %s", u.Scheme)
 	}
 
@@ -224,6 +322,10 @@ func DialURL(rawurl string, options ...DialOption) (Conn, error) {
 		if isSet {
 			options = append(options, DialPassword(password))
 		}
+		// a username authenticates as an ACL user, redis 6 or later.
+		if username := u.User.Username(); username != "" {
+			options = append(options, DialUsername(username))
+		}
 	}
 
 	match := pathDBRegexp.FindStringSubmatch(u.Path)
@@ -239,6 +341,8 @@ func DialURL(rawurl string, options ...DialOption) (Conn, error) {
 		return nil, errors.Errorf("invalid database: %s", u.Path[1:])
 	}
 
+	// prepended so the options passed in take precedence.
+	options = append([]DialOption{DialUseTLS(u.Scheme == "rediss")}, options...)
 	return Dial("tcp", address, options...)
 }
 
@@ -441,7 +545,25 @@ var (
 	pongReply interface{} = "PONG"
 )
 
+// readReply reads a reply, the RESP3 push frames other than pub/sub are
+// delivered to the push handler and skipped.
 func (c *conn) readReply() (interface{}, error) {
+	for {
+		reply, err := c.readValue()
+		if err != nil {
+			return nil, err
+		}
+		if p, ok := reply.(Push); ok && !p.pubsub() {
+			if c.push != nil {
+				c.push(p)
+			}
+			continue
+		}
+		return reply, nil
+	}
+}
+
+func (c *conn) readValue() (interface{}, error) {
 	line, err := c.readLine()
 	if err != nil {
 		return nil, err
@@ -466,37 +588,115 @@ func (c *conn) readReply() (interface{}, error) {
 	case ':':
 		return parseInt(line[1:])
 	case '$':
+		p, err := c.readBulk(line[1:])
+		if p == nil || err != nil {
+			return nil, err
+		}
+		return p, nil
+	case '*':
 		n, err := parseLen(line[1:])
 		if n < 0 || err != nil {
 			return nil, err
 		}
-		p := make([]byte, n)
-		_, err = io.ReadFull(c.br, p)
+		return c.readValues(n)
+	case '_':
+		return nil, nil
+	case ',':
+		f, err := strconv.ParseFloat(string(line[1:]), 64)
 		if err != nil {
-			return nil, errors.WithStack(err)
+			return nil, errors.WithStack(protocolError("malformed double"))
+		}
+		return f, nil
+	case '#':
+		if len(line) != 2 || (line[1] != 't' && line[1] != 'f') {
+			return nil, errors.WithStack(protocolError("malformed boolean"))
 		}
-		if line1, err := c.readLine(); err != nil {
+		return line[1] == 't', nil
+	case '(':
+		n, ok := new(big.Int).SetString(string(line[1:]), 10)
+		if !ok {
+			return nil, errors.WithStack(protocolError("malformed big number"))
+		}
+		return n, nil
+	case '!':
+		p, err := c.readBulk(line[1:])
+		if err != nil {
 			return nil, err
-		} else if len(line1) != 0 {
-			return nil, errors.WithStack(protocolError("bad bulk string format"))
 		}
-		return p, nil
-	case '*':
+		return Error(p), nil
+	case '=':
+		// the text is prefixed by its format, e.g. "txt:".
+		p, err := c.readBulk(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if len(p) < 4 || p[3] != ':' {
+			return nil, errors.WithStack(protocolError("malformed verbatim string"))
+		}
+		return p[4:], nil
+	case '%', '|':
 		n, err := parseLen(line[1:])
 		if n < 0 || err != nil {
 			return nil, err
 		}
-		r := make([]interface{}, n)
-		for i := range r {
-			r[i], err = c.readReply()
-			if err != nil {
-				return nil, err
-			}
+		values, err := c.readValues(2 * n)
+		if err != nil {
+			return nil, err
 		}
-		return r, nil
+		if line[0] == '|' {
+			// the attributes describe the reply following them, they are
+			// dropped.
+			return c.readValue()
+		}
+		return Map(values), nil
+	case '~':
+		n, err := parseLen(line[1:])
+		if n < 0 || err != nil {
+			return nil, err
+		}
+		values, err := c.readValues(n)
+		return Set(values), err
+	case '>':
+		n, err := parseLen(line[1:])
+		if n < 0 || err != nil {
+			return nil, err
+		}
+		values, err := c.readValues(n)
+		return Push(values), err
 	}
 	return nil, errors.WithStack(protocolError("unexpected response line"))
 }
+
+// readBulk reads the string of a bulk line, nil for a null bulk string.
+func (c *conn) readBulk(line []byte) ([]byte, error) {
+	n, err := parseLen(line)
+	if n < 0 || err != nil {
+		return nil, err
+	}
+	p := make([]byte, n)
+	_, err = io.ReadFull(c.br, p)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if line1, err := c.readLine(); err != nil {
+		return nil, err
+	} else if len(line1) != 0 {
+		return nil, errors.WithStack(protocolError("bad bulk string format"))
+	}
+	return p, nil
+}
+
+func (c *conn) readValues(n int) ([]interface{}, error) {
+	r := make([]interface{}, n)
+	for i := range r {
+		var err error
+		if r[i], err = c.readValue(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
 func (c *conn) Send(cmd string, args ...interface{}) (err error) {
 	c.mu.Lock()
 	c.pending++
@@ -600,6 +800,7 @@ func (c *conn) copy() *conn {
 		br:           c.br,
 		readTimeout:  c.readTimeout,
 		writeTimeout: c.writeTimeout,
+		push:         c.push,
 	}
 }
 
@@ -0,0 +1,94 @@
+package redis
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/zombie-k/kylin/library/log"
+)
+
+const _defaultCampaignInterval = time.Second
+
+// Election elects a leader among the instances campaigning for a key, so
+// only one instance runs a job at a time.
+type Election struct {
+	r        *Redis
+	key      string
+	options  []LockOption
+	interval time.Duration
+	leader   int32
+}
+
+// NewElection new an election of key, the options apply to the lock of the
+// leader. LockRetry specifies the interval of the campaigns, 1s by default.
+func NewElection(r *Redis, key string, options ...LockOption) *Election {
+	options = append([]LockOption{LockRetry(_defaultCampaignInterval)}, options...)
+	interval := newLockOptions(options).retry
+	if interval <= 0 {
+		interval = _defaultCampaignInterval
+	}
+	return &Election{
+		r:        r,
+		key:      key,
+		options:  options,
+		interval: interval,
+	}
+}
+
+// IsLeader reports whether the instance is the leader.
+func (e *Election) IsLeader() bool {
+	return atomic.LoadInt32(&e.leader) == 1
+}
+
+// Run campaigns until the instance is the leader, then runs fn with a
+// context cancelled when the leadership is lost. fn must return when its
+// context is done, then the instance campaigns again. Run returns the result
+// of fn once it returns as the leader, or the error of ctx once it is done.
+func (e *Election) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	for {
+		lock, err := e.r.Obtain(ctx, e.key, e.options...)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Warn("redis: election %s campaign error(%v)", e.key, err)
+			select {
+			case <-time.After(e.interval):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		log.Info("redis: election %s elected", e.key)
+		atomic.StoreInt32(&e.leader, 1)
+		err = e.lead(ctx, lock, fn)
+		atomic.StoreInt32(&e.leader, 0)
+		lost := lock.Context().Err() != nil
+		if rerr := lock.Release(context.Background()); rerr != nil && rerr != ErrLockNotHeld {
+			log.Warn("redis: election %s resign error(%v)", e.key, rerr)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !lost {
+			return err
+		}
+		log.Warn("redis: election %s leadership lost", e.key)
+	}
+}
+
+// lead runs fn with a context cancelled when the lock is lost or ctx is
+// done.
+func (e *Election) lead(ctx context.Context, lock *Lock, fn func(ctx context.Context) error) error {
+	lctx, cancel := context.WithCancel(lock.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-lctx.Done():
+		}
+	}()
+	return fn(lctx)
+}
@@ -1,6 +1,9 @@
 package redis
 
 import (
+	"context"
+	"io"
+	"net"
 	"strings"
 
 	pkgerr "github.com/pkg/errors"
@@ -10,9 +13,6 @@ func formatErr(err error, name, addr string) string {
 	e := pkgerr.Cause(err)
 	switch e {
 	case ErrNil, nil:
-		if e == ErrNil {
-			_metricMisses.Inc(name, addr)
-		}
 		return ""
 	default:
 		es := e.Error()
@@ -41,3 +41,33 @@ func formatErr(err error, name, addr string) string {
 		}
 	}
 }
+
+// errClass classifies err for the error class metric.
+func errClass(err error) string {
+	e := pkgerr.Cause(err)
+	switch e {
+	case nil:
+		return ""
+	case ErrNil:
+		return "not_found"
+	case context.DeadlineExceeded:
+		return "timeout"
+	case io.EOF, io.ErrUnexpectedEOF, errConnClosed:
+		return "network"
+	}
+	switch e := e.(type) {
+	case Error:
+		return "server"
+	case protocolError:
+		return "protocol"
+	case net.Error:
+		if e.Timeout() {
+			return "timeout"
+		}
+		return "network"
+	}
+	if es := e.Error(); strings.Contains(es, "pool exhausted") || strings.Contains(es, "pool closed") {
+		return "pool"
+	}
+	return "other"
+}
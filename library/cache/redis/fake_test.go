@@ -0,0 +1,64 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// fakeWriter writes the replies of a connection of a fake server.
+type fakeWriter struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+func (w *fakeWriter) write(reply interface{}) {
+	w.mu.Lock()
+	writeFakeReply(w.w, reply)
+	w.w.Flush()
+	w.mu.Unlock()
+}
+
+// serveFake serves the requests of every connection of ln with handle.
+func serveFake(ln net.Listener, handle func(w *fakeWriter, req []string)) {
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer nc.Close()
+			c := &conn{conn: nc, br: bufio.NewReader(nc)}
+			w := &fakeWriter{w: bufio.NewWriter(nc)}
+			for {
+				req, err := Strings(c.readReply())
+				if err != nil {
+					return
+				}
+				handle(w, req)
+			}
+		}()
+	}
+}
+
+// writeFakeReply writes reply in RESP2.
+func writeFakeReply(w *bufio.Writer, reply interface{}) {
+	switch reply := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case string:
+		w.WriteString("+" + reply + "\r\n")
+	case Error:
+		w.WriteString("-" + string(reply) + "\r\n")
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", reply)
+	case []byte:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(reply), reply)
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(reply))
+		for _, r := range reply {
+			writeFakeReply(w, r)
+		}
+	}
+}
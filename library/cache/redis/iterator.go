@@ -0,0 +1,380 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	pkgerr "github.com/pkg/errors"
+)
+
+// ScanOption specifies an option of the scan iterators.
+type ScanOption struct {
+	f func(*scanOptions)
+}
+
+type scanOptions struct {
+	match    string
+	count    int
+	typ      string
+	rate     int
+	parallel int
+}
+
+// ScanMatch specifies the MATCH glob pattern of the elements.
+func ScanMatch(pattern string) ScanOption {
+	return ScanOption{func(o *scanOptions) {
+		o.match = pattern
+	}}
+}
+
+// ScanCount specifies the COUNT hint of the elements returned by a call,
+// redis defaults to 10.
+func ScanCount(n int) ScanOption {
+	return ScanOption{func(o *scanOptions) {
+		o.count = n
+	}}
+}
+
+// ScanType specifies the TYPE of the keys, e.g. "string" or "zset", it only
+// applies to Scan and needs redis 6.
+func ScanType(typ string) ScanOption {
+	return ScanOption{func(o *scanOptions) {
+		o.typ = typ
+	}}
+}
+
+// ScanRate limits the calls to n per second, shared by the nodes of a
+// parallel scan. Unlimited by default.
+func ScanRate(n int) ScanOption {
+	return ScanOption{func(o *scanOptions) {
+		o.rate = n
+	}}
+}
+
+// ScanParallel specifies how many nodes are scanned at once by a scan of
+// several nodes, 1 by default.
+func ScanParallel(n int) ScanOption {
+	return ScanOption{func(o *scanOptions) {
+		o.parallel = n
+	}}
+}
+
+// ScanIterator iterates the elements of the SCAN family commands, calling
+// them with the returned cursor until it is 0:
+//
+//	it := r.Commands().Scan(ctx, redis.ScanMatch("user:*"), redis.ScanCount(100))
+//	defer it.Close()
+//	for it.Next() {
+//		key := it.Val()
+//	}
+//	if err := it.Err(); err != nil {
+//		// handle the error
+//	}
+//
+// Like SCAN, an element may be returned more than once.
+type ScanIterator struct {
+	// fetch returns the next page of elements, more is false after the
+	// last one.
+	fetch  func() (page []string, more bool, err error)
+	cancel func()
+	pairs  bool
+
+	page       []string
+	val, value string
+	done       bool
+	err        error
+}
+
+// Next advances to the next element, it returns false at the end of the
+// iteration or on error.
+func (it *ScanIterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		var more bool
+		it.page, more, it.err = it.fetch()
+		it.done = !more
+	}
+	it.val, it.page = it.page[0], it.page[1:]
+	if it.pairs && len(it.page) > 0 {
+		it.value, it.page = it.page[0], it.page[1:]
+	}
+	return true
+}
+
+// Val returns the current key, field or member.
+func (it *ScanIterator) Val() string {
+	return it.val
+}
+
+// Value returns the value of the current field of HScan or the score of
+// the current member of ZScan.
+func (it *ScanIterator) Value() string {
+	return it.value
+}
+
+// Err returns the error stopping the iteration, the error of the context
+// if it is done.
+func (it *ScanIterator) Err() error {
+	return it.err
+}
+
+// Close stops the iteration, it must be called by a scan of several nodes
+// stopped before the end.
+func (it *ScanIterator) Close() error {
+	if it.cancel != nil {
+		it.cancel()
+	}
+	it.page, it.done = nil, true
+	return nil
+}
+
+// Scan iterates the keys of the database, the keys of every master node if
+// the commands are executed by a Cluster.
+func (c *Commands) Scan(ctx context.Context, options ...ScanOption) *ScanIterator {
+	if cl, ok := c.d.(*Cluster); ok {
+		return cl.Scan(ctx, options...)
+	}
+	return newScanIterator(ctx, c.d, "SCAN", "", options)
+}
+
+// HScan iterates the fields of a hash, Value is the value of the field.
+func (c *Commands) HScan(ctx context.Context, key string, options ...ScanOption) *ScanIterator {
+	return newScanIterator(ctx, c.d, "HSCAN", key, options)
+}
+
+// SScan iterates the members of a set.
+func (c *Commands) SScan(ctx context.Context, key string, options ...ScanOption) *ScanIterator {
+	return newScanIterator(ctx, c.d, "SSCAN", key, options)
+}
+
+// ZScan iterates the members of a sorted set, Value is the score of the
+// member.
+func (c *Commands) ZScan(ctx context.Context, key string, options ...ScanOption) *ScanIterator {
+	return newScanIterator(ctx, c.d, "ZSCAN", key, options)
+}
+
+// Scan iterates the keys of every master node of the cluster.
+func (c *Cluster) Scan(ctx context.Context, options ...ScanOption) *ScanIterator {
+	addrs := c.masters()
+	nodes := make([]Doer, len(addrs))
+	for i, addr := range addrs {
+		nodes[i] = nodeDoer{c: c, addr: addr}
+	}
+	return ScanNodes(ctx, nodes, options...)
+}
+
+// masters returns the nodes serving the slots, the seed nodes if the slot
+// map is unknown.
+func (c *Cluster) masters() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var addrs []string
+	seen := make(map[string]struct{})
+	for _, addr := range c.slots {
+		if _, ok := seen[addr]; ok || addr == "" {
+			continue
+		}
+		seen[addr] = struct{}{}
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		return c.c.Addrs
+	}
+	return addrs
+}
+
+// nodeDoer executes the commands on a node of a cluster, not following
+// the redirects.
+type nodeDoer struct {
+	c    *Cluster
+	addr string
+}
+
+func (d nodeDoer) Do(ctx context.Context, commandName string, args ...interface{}) (interface{}, error) {
+	return d.c.doNode(ctx, d.addr, false, commandName, args...)
+}
+
+func newScanIterator(ctx context.Context, d Doer, commandName, key string, options []ScanOption) *ScanIterator {
+	o := newScanOptions(options)
+	cur := newCursor(d, commandName, key, o, newPacer(o.rate))
+	return &ScanIterator{
+		fetch: func() ([]string, bool, error) {
+			page, err := cur.next(ctx)
+			return page, !cur.done && err == nil, err
+		},
+		pairs: commandName == "HSCAN" || commandName == "ZSCAN",
+	}
+}
+
+// ScanNodes iterates the keys of several nodes, e.g. the shards of a
+// sharded setup, by the option ScanParallel nodes at once.
+func ScanNodes(parent context.Context, nodes []Doer, options ...ScanOption) *ScanIterator {
+	o := newScanOptions(options)
+	p := newPacer(o.rate)
+	ctx, cancel := context.WithCancel(parent)
+	pages := make(chan []string)
+	errs := make(chan error, 1)
+	sem := make(chan struct{}, o.parallel)
+	var wg sync.WaitGroup
+	for _, d := range nodes {
+		wg.Add(1)
+		go func(d Doer) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+			cur := newCursor(d, "SCAN", "", o, p)
+			for !cur.done {
+				page, err := cur.next(ctx)
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					cancel()
+					return
+				}
+				if len(page) == 0 {
+					continue
+				}
+				select {
+				case pages <- page:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(d)
+	}
+	go func() {
+		wg.Wait()
+		close(pages)
+	}()
+	return &ScanIterator{
+		fetch: func() ([]string, bool, error) {
+			if page, ok := <-pages; ok {
+				return page, true, nil
+			}
+			cancel()
+			select {
+			case err := <-errs:
+				return nil, false, err
+			default:
+				// the nodes stopped by a done context post no error.
+				return nil, false, parent.Err()
+			}
+		},
+		cancel: cancel,
+	}
+}
+
+func newScanOptions(options []ScanOption) scanOptions {
+	o := scanOptions{parallel: 1}
+	for _, option := range options {
+		option.f(&o)
+	}
+	if o.parallel < 1 {
+		o.parallel = 1
+	}
+	return o
+}
+
+// cursor walks the pages of a SCAN family command.
+type cursor struct {
+	d           Doer
+	commandName string
+	key         string
+	o           scanOptions
+	p           *pacer
+
+	cursor string
+	done   bool
+}
+
+func newCursor(d Doer, commandName, key string, o scanOptions, p *pacer) *cursor {
+	return &cursor{d: d, commandName: commandName, key: key, o: o, p: p, cursor: "0"}
+}
+
+// next returns the next page, done is set after the last one.
+func (c *cursor) next(ctx context.Context) ([]string, error) {
+	if err := c.p.wait(ctx); err != nil {
+		return nil, err
+	}
+	args := Args{}
+	if c.commandName != "SCAN" {
+		args = args.Add(c.key)
+	}
+	args = args.Add(c.cursor)
+	if c.o.match != "" {
+		args = args.Add("MATCH", c.o.match)
+	}
+	if c.o.count > 0 {
+		args = args.Add("COUNT", c.o.count)
+	}
+	if c.o.typ != "" && c.commandName == "SCAN" {
+		args = args.Add("TYPE", c.o.typ)
+	}
+	values, err := Values(c.d.Do(ctx, c.commandName, args...))
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 2 {
+		return nil, pkgerr.Errorf("redis: unexpected %s reply of %d elements", c.commandName, len(values))
+	}
+	if c.cursor, err = String(values[0], nil); err != nil {
+		return nil, err
+	}
+	page, err := Strings(values[1], nil)
+	if err != nil {
+		return nil, err
+	}
+	c.done = c.cursor == "0"
+	return page, nil
+}
+
+// pacer spaces the calls of a scan by an interval, a nil pacer does not
+// wait.
+type pacer struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newPacer(rate int) *pacer {
+	if rate <= 0 {
+		return nil
+	}
+	return &pacer{interval: time.Second / time.Duration(rate)}
+}
+
+// wait waits for the turn of a call.
+func (p *pacer) wait(ctx context.Context) error {
+	if p == nil {
+		return ctx.Err()
+	}
+	p.mu.Lock()
+	now := time.Now()
+	at := p.next
+	if at.Before(now) {
+		at = now
+	}
+	p.next = at.Add(p.interval)
+	p.mu.Unlock()
+	if at.Equal(now) {
+		return ctx.Err()
+	}
+	t := time.NewTimer(at.Sub(now))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,186 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache/redis/redistest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newScanServer starts a redistest server holding the string keys and a
+// Redis of it.
+func newScanServer(t *testing.T, keys ...string) (*redistest.Server, *Redis) {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRedis("test_scan", s.Addr())
+	for _, key := range keys {
+		if _, err = r.Do(context.Background(), "SET", key, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s, r
+}
+
+func collect(it *ScanIterator) (vals []string) {
+	for it.Next() {
+		vals = append(vals, it.Val())
+	}
+	sort.Strings(vals)
+	return
+}
+
+func TestScanIterator(t *testing.T) {
+	s, r := newScanServer(t, "a1", "a2", "b1", "a3", "b2")
+	defer s.Close()
+	defer r.Close()
+	ctx := context.Background()
+	c := r.Commands()
+	for i, field := range []string{"a1", "a2", "a3", "b1", "b2"} {
+		_, err := r.Do(ctx, "HSET", "hash", field, i)
+		assert.Nil(t, err)
+		_, err = r.Do(ctx, "SADD", "set", field)
+		assert.Nil(t, err)
+		_, err = r.Do(ctx, "ZADD", "zset", i, field)
+		assert.Nil(t, err)
+	}
+
+	it := c.Scan(ctx, ScanCount(2))
+	assert.Equal(t, []string{"a1", "a2", "a3", "b1", "b2", "hash", "set", "zset"}, collect(it))
+	assert.Nil(t, it.Err())
+
+	it = c.Scan(ctx, ScanMatch("a*"), ScanCount(3), ScanType("string"))
+	assert.Equal(t, []string{"a1", "a2", "a3"}, collect(it))
+	it = c.Scan(ctx, ScanType("hash"))
+	assert.Equal(t, []string{"hash"}, collect(it))
+
+	it = c.HScan(ctx, "hash", ScanCount(2))
+	var pairs []string
+	for it.Next() {
+		pairs = append(pairs, it.Val()+"="+it.Value())
+	}
+	assert.Nil(t, it.Err())
+	assert.Equal(t, []string{"a1=0", "a2=1", "a3=2", "b1=3", "b2=4"}, pairs)
+
+	it = c.SScan(ctx, "set", ScanMatch("b*"))
+	assert.Equal(t, []string{"b1", "b2"}, collect(it))
+
+	// an error stops the iteration.
+	s.SetFaults(redistest.Faults{Error: "LOADING Redis is loading the dataset in memory"})
+	it = c.ZScan(ctx, "zset")
+	assert.False(t, it.Next())
+	assert.EqualError(t, it.Err(), "LOADING Redis is loading the dataset in memory")
+	s.SetFaults(redistest.Faults{})
+
+	// a done context stops the iteration.
+	cctx, cancel := context.WithCancel(ctx)
+	it = c.Scan(cctx, ScanCount(2))
+	assert.True(t, it.Next())
+	cancel()
+	assert.True(t, it.Next())
+	assert.False(t, it.Next())
+	assert.Equal(t, context.Canceled, it.Err())
+}
+
+func TestScanIteratorRate(t *testing.T) {
+	s, r := newScanServer(t, "a", "b", "c", "d", "e", "f")
+	defer s.Close()
+	defer r.Close()
+
+	start := time.Now()
+	it := r.Commands().Scan(context.Background(), ScanCount(2), ScanRate(20))
+	assert.Len(t, collect(it), 6)
+	// 3 calls spaced by 50ms.
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+}
+
+func TestScanNodes(t *testing.T) {
+	var (
+		nodes   []Doer
+		servers []*redistest.Server
+		want    []string
+	)
+	for i := 0; i < 3; i++ {
+		var keys []string
+		for j := 0; j < 5; j++ {
+			keys = append(keys, fmt.Sprintf("n%d:k%d", i, j))
+		}
+		want = append(want, keys...)
+		s, r := newScanServer(t, keys...)
+		defer s.Close()
+		defer r.Close()
+		servers = append(servers, s)
+		nodes = append(nodes, r)
+	}
+	ctx := context.Background()
+
+	it := ScanNodes(ctx, nodes, ScanParallel(2), ScanCount(2))
+	assert.Equal(t, want, collect(it))
+	assert.Nil(t, it.Err())
+
+	// a node failing stops the iteration.
+	servers[1].SetFaults(redistest.Faults{Error: "LOADING Redis is loading the dataset in memory"})
+	it = ScanNodes(ctx, nodes, ScanParallel(3))
+	collect(it)
+	assert.EqualError(t, it.Err(), "LOADING Redis is loading the dataset in memory")
+
+	// closing stops the scans of the nodes.
+	servers[1].SetFaults(redistest.Faults{})
+	it = ScanNodes(ctx, nodes, ScanCount(1))
+	assert.True(t, it.Next())
+	assert.Nil(t, it.Close())
+	assert.False(t, it.Next())
+}
+
+func TestScanNodesCancel(t *testing.T) {
+	var nodes []Doer
+	for i := 0; i < 2; i++ {
+		var keys []string
+		for j := 0; j < 20; j++ {
+			keys = append(keys, fmt.Sprintf("n%d:k%d", i, j))
+		}
+		s, r := newScanServer(t, keys...)
+		defer s.Close()
+		defer r.Close()
+		nodes = append(nodes, r)
+	}
+
+	// the scan stopped by the context is not complete.
+	ctx, cancel := context.WithCancel(context.Background())
+	it := ScanNodes(ctx, nodes, ScanCount(1))
+	assert.True(t, it.Next())
+	cancel()
+	n := 1
+	for it.Next() {
+		n++
+	}
+	assert.True(t, n < 40)
+	assert.Equal(t, context.Canceled, it.Err())
+}
+
+func TestClusterScan(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	defer fc.close()
+	c := newTestCluster(fc)
+	defer c.Close()
+	ctx := context.Background()
+
+	var want []string
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		_, err := c.Do(ctx, "SET", key, i)
+		assert.Nil(t, err)
+		want = append(want, key)
+	}
+	sort.Strings(want)
+	assert.Len(t, c.masters(), 3)
+	it := c.Commands().Scan(ctx, ScanParallel(3))
+	assert.Equal(t, want, collect(it))
+	assert.Nil(t, it.Err())
+}
@@ -0,0 +1,245 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/zombie-k/kylin/library/log"
+)
+
+const (
+	_defaultLockTTL = 10 * time.Second
+	// _lockDriftFactor and _lockMinDrift bound the clock drift between the
+	// client and redis, like Redlock: 1% of the TTL plus 2ms.
+	_lockDriftFactor = 100
+	_lockMinDrift    = 2 * time.Millisecond
+)
+
+var (
+	// ErrLockNotObtained is returned by Obtain when the lock is held by
+	// another owner.
+	ErrLockNotObtained = errors.New("redis: lock not obtained")
+	// ErrLockNotHeld is returned when the lock expired or is taken by another
+	// owner.
+	ErrLockNotHeld = errors.New("redis: lock not held")
+)
+
+var (
+	releaseScript = NewScript(1, `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`)
+	extendScript  = NewScript(1, `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) else return 0 end`)
+)
+
+// LockOption specifies an option of a lock.
+type LockOption struct {
+	f func(*lockOptions)
+}
+
+type lockOptions struct {
+	ttl   time.Duration
+	renew time.Duration
+	retry time.Duration
+}
+
+// LockTTL specifies how long the lock lives without being renewed, 10s by
+// default.
+func LockTTL(d time.Duration) LockOption {
+	return LockOption{func(o *lockOptions) {
+		o.ttl = d
+	}}
+}
+
+// LockRenewInterval specifies the interval of the renewals, a third of the
+// TTL by default. A negative interval disables the renewals, the lock then
+// expires after its TTL unless Extend is called.
+func LockRenewInterval(d time.Duration) LockOption {
+	return LockOption{func(o *lockOptions) {
+		o.renew = d
+	}}
+}
+
+// LockRetry specifies the interval of the attempts to obtain a held lock
+// until the ctx of Obtain is done. By default Obtain tries once.
+// The ctx only bounds the attempts, the lock obtained outlives it.
+func LockRetry(d time.Duration) LockOption {
+	return LockOption{func(o *lockOptions) {
+		o.retry = d
+	}}
+}
+
+func newLockOptions(options []LockOption) lockOptions {
+	o := lockOptions{ttl: _defaultLockTTL}
+	for _, option := range options {
+		option.f(&o)
+	}
+	if o.renew == 0 {
+		o.renew = o.ttl / 3
+	}
+	return o
+}
+
+// Lock is a lock of a key obtained by SET NX with a random token, only the
+// owner of the token can extend or release it. The lock is renewed in
+// background until it is released, its Context is cancelled if it is lost,
+// e.g. not renewed within its TTL.
+type Lock struct {
+	r     *Redis
+	key   string
+	token string
+	o     lockOptions
+
+	ctx    context.Context
+	cancel func()
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// Obtain obtains the lock of key, ErrLockNotObtained is returned if it is
+// held by another owner.
+func (r *Redis) Obtain(ctx context.Context, key string, options ...LockOption) (*Lock, error) {
+	o := newLockOptions(options)
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(b)
+	var start time.Time
+	for {
+		// the TTL runs from when SET is sent, not from its reply.
+		start = time.Now()
+		_, err := String(r.Do(ctx, "SET", key, token, "NX", "PX", int64(o.ttl/time.Millisecond)))
+		if err == nil {
+			break
+		}
+		if err != ErrNil {
+			return nil, err
+		}
+		if o.retry <= 0 {
+			return nil, ErrLockNotObtained
+		}
+		select {
+		case <-time.After(o.retry):
+		case <-ctx.Done():
+			return nil, ErrLockNotObtained
+		}
+	}
+	l := &Lock{r: r, key: key, token: token, o: o, stop: make(chan struct{})}
+	l.ctx, l.cancel = context.WithCancel(detachedContext{ctx})
+	if o.renew > 0 {
+		l.wg.Add(1)
+		go l.renew(start)
+	}
+	return l, nil
+}
+
+// Key returns the key of the lock.
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Token returns the random token of the owner.
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Context returns a context carrying the values of the ctx of Obtain, it is
+// cancelled when the lock is lost or released, not when that ctx is done.
+func (l *Lock) Context() context.Context {
+	return l.ctx
+}
+
+// Extend resets the TTL of the lock.
+func (l *Lock) Extend(ctx context.Context) error {
+	conn := l.r.Conn(ctx)
+	defer conn.Close()
+	n, err := Int(extendScript.Do(conn, l.key, l.token, int64(l.o.ttl/time.Millisecond)))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Release stops the renewals and releases the lock, ErrLockNotHeld is
+// returned if it was lost.
+func (l *Lock) Release(ctx context.Context) error {
+	l.stopRenew()
+	defer l.cancel()
+	conn := l.r.Conn(ctx)
+	defer conn.Close()
+	n, err := Int(releaseScript.Do(conn, l.key, l.token))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// detachedContext is the values of a context, without its deadline and
+// cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+func (l *Lock) stopRenew() {
+	l.once.Do(func() { close(l.stop) })
+	l.wg.Wait()
+}
+
+// lockValidity returns how long a lock is held after its SET or extension
+// is sent, the TTL less the clock drift.
+func lockValidity(ttl time.Duration) time.Duration {
+	return ttl - ttl/_lockDriftFactor - _lockMinDrift
+}
+
+// renew extends the lock at every interval, it is lost when the owner
+// changed, or when no extension succeeded within the validity: the TTL
+// counted from when the last SET or extension was sent, less the clock
+// drift.
+func (l *Lock) renew(extended time.Time) {
+	defer l.wg.Done()
+	ticker := time.NewTicker(l.o.renew)
+	defer ticker.Stop()
+	validity := lockValidity(l.o.ttl)
+	for {
+		select {
+		case <-ticker.C:
+		case <-l.stop:
+			return
+		case <-l.ctx.Done():
+			return
+		}
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), l.o.renew)
+		err := l.Extend(ctx)
+		cancel()
+		switch {
+		case err == nil:
+			extended = start
+			continue
+		case err == ErrLockNotHeld:
+		case time.Since(extended) < validity:
+			log.Warn("redis: lock %s renew error(%v), retry", l.key, err)
+			continue
+		}
+		log.Error("redis: lock %s lost error(%v)", l.key, err)
+		l.cancel()
+		return
+	}
+}
@@ -0,0 +1,236 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLockNode serves SET NX PX, GET and the lock scripts with real expiry,
+// it can refuse every command to simulate an outage.
+type fakeLockNode struct {
+	ln      net.Listener
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+	scripts map[string]bool
+	down    bool
+}
+
+func newFakeLockNode(t *testing.T) *fakeLockNode {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &fakeLockNode{ln: ln, values: make(map[string]string), expires: make(map[string]time.Time), scripts: make(map[string]bool)}
+	go serveFake(ln, func(w *fakeWriter, req []string) {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		w.write(n.handle(req))
+	})
+	return n
+}
+
+func (n *fakeLockNode) get(key string) (string, bool) {
+	if exp, ok := n.expires[key]; ok && time.Now().After(exp) {
+		delete(n.values, key)
+		delete(n.expires, key)
+	}
+	v, ok := n.values[key]
+	return v, ok
+}
+
+func (n *fakeLockNode) handle(req []string) interface{} {
+	if n.down {
+		return Error("LOADING Redis is loading the dataset in memory")
+	}
+	switch req[0] {
+	case "SET":
+		// SET key value NX PX ttl
+		if _, ok := n.get(req[1]); ok {
+			return nil
+		}
+		ttl, _ := strconv.Atoi(req[5])
+		n.values[req[1]] = req[2]
+		n.expires[req[1]] = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+		return "OK"
+	case "GET":
+		if v, ok := n.get(req[1]); ok {
+			return []byte(v)
+		}
+		return nil
+	case "EVALSHA":
+		if !n.scripts[req[1]] {
+			return Error("NOSCRIPT No matching script. Please use EVAL.")
+		}
+		return n.eval(req[1], req[3:])
+	case "EVAL":
+		s := NewScript(1, req[1])
+		n.scripts[s.hash] = true
+		return n.eval(s.hash, req[3:])
+	}
+	return Error("ERR unknown command " + req[0])
+}
+
+func (n *fakeLockNode) eval(hash string, keysAndArgs []string) interface{} {
+	if v, ok := n.get(keysAndArgs[0]); !ok || v != keysAndArgs[1] {
+		return int64(0)
+	}
+	switch hash {
+	case releaseScript.hash:
+		delete(n.values, keysAndArgs[0])
+		delete(n.expires, keysAndArgs[0])
+	case extendScript.hash:
+		ttl, _ := strconv.Atoi(keysAndArgs[2])
+		n.expires[keysAndArgs[0]] = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+	}
+	return int64(1)
+}
+
+func (n *fakeLockNode) set(key, value string) {
+	n.mu.Lock()
+	n.values[key] = value
+	n.mu.Unlock()
+}
+
+func (n *fakeLockNode) setDown(down bool) {
+	n.mu.Lock()
+	n.down = down
+	n.mu.Unlock()
+}
+
+func TestLock(t *testing.T) {
+	n := newFakeLockNode(t)
+	defer n.ln.Close()
+	r := newTestRedis("test_lock", n.ln.Addr().String())
+	defer r.Close()
+	ctx := context.Background()
+
+	l, err := r.Obtain(ctx, "job", LockTTL(100*time.Millisecond), LockRenewInterval(20*time.Millisecond))
+	assert.Nil(t, err)
+	_, err = r.Obtain(ctx, "job")
+	assert.Equal(t, ErrLockNotObtained, err)
+	// the renewals keep the lock past its TTL.
+	time.Sleep(250 * time.Millisecond)
+	assert.Nil(t, l.Context().Err())
+	_, err = r.Obtain(ctx, "job")
+	assert.Equal(t, ErrLockNotObtained, err)
+	assert.Nil(t, l.Release(ctx))
+	assert.NotNil(t, l.Context().Err())
+	assert.Equal(t, ErrLockNotHeld, l.Release(ctx))
+
+	// a waiting owner obtains the released lock.
+	l, err = r.Obtain(ctx, "job", LockTTL(time.Second))
+	assert.Nil(t, err)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		l.Release(ctx)
+	}()
+	wctx, cancel := context.WithTimeout(ctx, time.Second)
+	l2, err := r.Obtain(wctx, "job", LockRetry(10*time.Millisecond))
+	cancel()
+	assert.Nil(t, err)
+
+	// the lock outlives the ctx of Obtain, and keeps its values.
+	type ctxKey struct{}
+	wctx, cancel = context.WithTimeout(context.WithValue(ctx, ctxKey{}, "v"), time.Second)
+	l4, err := r.Obtain(wctx, "wait", LockTTL(100*time.Millisecond), LockRenewInterval(20*time.Millisecond), LockRetry(10*time.Millisecond))
+	assert.Nil(t, err)
+	cancel()
+	time.Sleep(250 * time.Millisecond)
+	assert.Nil(t, l4.Context().Err())
+	assert.Equal(t, "v", l4.Context().Value(ctxKey{}))
+	_, err = r.Obtain(ctx, "wait")
+	assert.Equal(t, ErrLockNotObtained, err)
+	assert.Nil(t, l4.Release(ctx))
+
+	// a lock taken over is lost.
+	n.set("job", "other")
+	select {
+	case <-l2.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock not lost")
+	}
+	assert.Equal(t, ErrLockNotHeld, l2.Extend(ctx))
+
+	// a lock not renewed within its TTL is lost.
+	l3, err := r.Obtain(ctx, "outage", LockTTL(100*time.Millisecond), LockRenewInterval(20*time.Millisecond))
+	assert.Nil(t, err)
+	n.setDown(true)
+	select {
+	case <-l3.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("lock not lost")
+	}
+	n.setDown(false)
+}
+
+func TestLockValidity(t *testing.T) {
+	assert.Equal(t, 97*time.Millisecond, lockValidity(100*time.Millisecond))
+	assert.Equal(t, 9898*time.Millisecond, lockValidity(10*time.Second))
+}
+
+func TestElection(t *testing.T) {
+	n := newFakeLockNode(t)
+	defer n.ln.Close()
+	r := newTestRedis("test_lock", n.ln.Addr().String())
+	defer r.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var (
+		running int32
+		runs    int32
+		wg      sync.WaitGroup
+	)
+	elections := make([]*Election, 3)
+	errs := make([]error, len(elections))
+	for i := range elections {
+		elections[i] = NewElection(r, "leader", LockTTL(100*time.Millisecond), LockRetry(10*time.Millisecond))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = elections[i].Run(ctx, func(ctx context.Context) error {
+				assert.Equal(t, int32(1), atomic.AddInt32(&running, 1))
+				defer atomic.AddInt32(&running, -1)
+				if atomic.AddInt32(&runs, 1) == 1 {
+					// the first leader resigns.
+					return errors.New("done")
+				}
+				<-ctx.Done()
+				return ctx.Err()
+			})
+		}(i)
+	}
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) == 2 }, time.Second, 10*time.Millisecond)
+	leaders := 0
+	for _, e := range elections {
+		if e.IsLeader() {
+			leaders++
+		}
+	}
+	assert.Equal(t, 1, leaders)
+
+	// the leader campaigns again once the leadership is lost, the key taken
+	// over expires after its TTL.
+	n.set("leader", "stolen")
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 3 }, time.Second, 10*time.Millisecond)
+
+	cancel()
+	wg.Wait()
+	done := 0
+	for _, err := range errs {
+		if err != nil && err.Error() == "done" {
+			done++
+		} else {
+			assert.Equal(t, context.Canceled, err)
+		}
+	}
+	assert.Equal(t, 1, done)
+}
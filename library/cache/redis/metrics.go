@@ -22,6 +22,13 @@ var (
 		Help:      "redis client requests error count.",
 		Labels:    []string{"name", "addr", "command", "error"},
 	})
+	_metricReqErrClass = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "requests",
+		Name:      "error_class_total",
+		Help:      "redis client requests error count by class: timeout, network, protocol, server, pool, not_found or other.",
+		Labels:    []string{"name", "addr", "command", "class"},
+	})
 	_metricConnTotal = metric.NewCounterVec(&metric.CounterVecOpts{
 		Namespace: namespace,
 		Subsystem: "connections",
@@ -50,4 +57,60 @@ var (
 		Help:      "redis client misses total.",
 		Labels:    []string{"name", "addr"},
 	})
+	_metricClusterRedirects = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "cluster",
+		Name:      "redirects_total",
+		Help:      "redis cluster client redirects total by kind: moved or ask.",
+		Labels:    []string{"name", "kind"},
+	})
+	_metricClusterRefreshes = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "cluster",
+		Name:      "refreshes_total",
+		Help:      "redis cluster client slot map refreshes total by result: ok or error.",
+		Labels:    []string{"name", "result"},
+	})
+	_metricSentinelFailovers = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "sentinel",
+		Name:      "failovers_total",
+		Help:      "redis sentinel master switches total.",
+		Labels:    []string{"name", "master"},
+	})
+	_metricTxConflicts = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "tx",
+		Name:      "conflicts_total",
+		Help:      "redis client transactions aborted by a watched key change.",
+		Labels:    []string{"name"},
+	})
+	_metricSubscriberMessages = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "subscriber",
+		Name:      "messages_total",
+		Help:      "redis subscriber messages total by result: delivered, late or dropped.",
+		Labels:    []string{"name", "result"},
+	})
+	_metricSubscriberReconnects = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "subscriber",
+		Name:      "reconnects_total",
+		Help:      "redis subscriber reconnects total.",
+		Labels:    []string{"name"},
+	})
+	_metricTrackingRequests = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "tracking",
+		Name:      "requests_total",
+		Help:      "redis client-side cache requests total by result: hit or miss.",
+		Labels:    []string{"name", "result"},
+	})
+	_metricTrackingInvalidations = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "tracking",
+		Name:      "invalidations_total",
+		Help:      "redis client-side cache invalidations total by kind: key or flush.",
+		Labels:    []string{"name", "kind"},
+	})
 )
@@ -0,0 +1,64 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	pkgerr "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplyHitMiss(t *testing.T) {
+	tests := []struct {
+		cmd    string
+		reply  interface{}
+		hits   int
+		misses int
+	}{
+		{"GET", []byte("v"), 1, 0},
+		{"get", nil, 0, 1},
+		{"HGET", nil, 0, 1},
+		{"MGET", []interface{}{[]byte("v"), nil, []byte("v")}, 2, 1},
+		{"hmget", []interface{}{nil, nil}, 0, 2},
+		{"HGETALL", []interface{}{}, 0, 1},
+		{"HGETALL", []interface{}{[]byte("k"), []byte("v")}, 1, 0},
+		{"SET", []byte("OK"), 0, 0},
+		{"DEL", int64(0), 0, 0},
+	}
+	for _, test := range tests {
+		hits, misses := replyHitMiss(test.cmd, test.reply)
+		assert.Equal(t, test.hits, hits, test.cmd)
+		assert.Equal(t, test.misses, misses, test.cmd)
+	}
+}
+
+func TestErrClass(t *testing.T) {
+	timeout := &net.OpError{Op: "read", Err: &timeoutError{}}
+	tests := []struct {
+		err   error
+		class string
+	}{
+		{nil, ""},
+		{ErrNil, "not_found"},
+		{pkgerr.WithStack(timeout), "timeout"},
+		{context.DeadlineExceeded, "timeout"},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "network"},
+		{pkgerr.WithStack(io.EOF), "network"},
+		{Error("WRONGTYPE Operation against a key holding the wrong kind of value"), "server"},
+		{pkgerr.WithStack(protocolError("malformed length")), "protocol"},
+		{errors.New("redigo: connection pool exhausted"), "pool"},
+		{errors.New("something else"), "other"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.class, errClass(test.err), "%v", test.err)
+	}
+}
+
+type timeoutError struct{}
+
+func (*timeoutError) Error() string   { return "i/o timeout" }
+func (*timeoutError) Timeout() bool   { return true }
+func (*timeoutError) Temporary() bool { return true }
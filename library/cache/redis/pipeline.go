@@ -18,7 +18,7 @@ var (
 )
 
 type pipeliner struct {
-	pool *Pool
+	pool connPool
 	cmds []*cmd
 }
 
@@ -54,31 +54,34 @@ func (p *pipeliner) Send(commandName string, args ...interface{}) {
 }
 
 func (p *pipeliner) Exec(ctx context.Context) (rs *Replies, err error) {
-	n := len(p.cmds)
-	if n == 0 {
+	if len(p.cmds) == 0 {
 		return &Replies{}, nil
 	}
+	cmds := p.cmds
+	p.cmds = nil
 	c := p.pool.Get(ctx)
 	defer c.Close()
-	for len(p.cmds) > 0 {
-		cmd := p.cmds[0]
-		p.cmds = p.cmds[1:]
-		if err = c.Send(cmd.commandName, cmd.args...); err != nil {
-			p.cmds = p.cmds[:0]
+	rps, err := execCmds(c, cmds)
+	if err != nil {
+		return nil, err
+	}
+	return &Replies{replies: rps}, nil
+}
+
+// execCmds sends cmds on c in one flush and receives their replies.
+func execCmds(c Conn, cmds []*cmd) ([]*reply, error) {
+	for _, cmd := range cmds {
+		if err := c.Send(cmd.commandName, cmd.args...); err != nil {
 			return nil, err
 		}
 	}
-	if err = c.Flush(); err != nil {
-		p.cmds = p.cmds[:0]
+	if err := c.Flush(); err != nil {
 		return nil, err
 	}
-	rps := make([]*reply, 0, n)
-	for i := 0; i < n; i++ {
+	rps := make([]*reply, 0, len(cmds))
+	for range cmds {
 		rp, err := c.Receive()
 		rps = append(rps, &reply{reply: rp, err: err})
 	}
-	rs = &Replies{
-		replies: rps,
-	}
-	return
+	return rps, nil
 }
@@ -22,9 +22,12 @@ import (
 	"errors"
 	"io"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/zombie-k/kylin/library/cache"
+	"github.com/zombie-k/kylin/library/cache/hotkey"
 	"github.com/zombie-k/kylin/library/container/pool"
 	"github.com/zombie-k/kylin/library/net/trace"
 	xtime "github.com/zombie-k/kylin/library/time"
@@ -53,15 +56,9 @@ func NewPool(c *Config, options ...DialOption) (p *Pool) {
 	if c.SlowLog <= 0 {
 		c.SlowLog = xtime.Duration(250 * time.Millisecond)
 	}
-	ops := []DialOption{
-		DialConnectTimeout(time.Duration(c.DialTimeout)),
-		DialReadTimeout(time.Duration(c.ReadTimeout)),
-		DialWriteTimeout(time.Duration(c.WriteTimeout)),
-		DialPassword(c.Auth),
-		DialDatabase(c.Db),
-	}
-	ops = append(ops, options...)
+	ops := append(c.dialOptions(), options...)
 	p1 := pool.NewSlice(c.Config)
+	hot := hotkey.Get(c.Name)
 
 	// new pool
 	p1.New = func(ctx context.Context) (io.Closer, error) {
@@ -73,12 +70,27 @@ func NewPool(c *Config, options ...DialOption) (p *Pool) {
 			Conn:             conn,
 			connTags:         []trace.Tag{trace.TagString(trace.TagPeerAddress, c.Addr)},
 			slowLogThreshold: time.Duration(c.SlowLog),
+			hot:              hot,
 		}, nil
 	}
 	p = &Pool{Slice: p1, c: c, statfunc: pstat}
 	return
 }
 
+// dialOptions returns the dial options of the connections of c.
+func (c *Config) dialOptions() []DialOption {
+	ops := []DialOption{
+		DialConnectTimeout(time.Duration(c.DialTimeout)),
+		DialReadTimeout(time.Duration(c.ReadTimeout)),
+		DialWriteTimeout(time.Duration(c.WriteTimeout)),
+		DialUsername(c.Username),
+		DialPassword(c.Auth),
+		DialClientName(c.ClientName),
+		DialDatabase(c.Db),
+	}
+	return append(ops, c.tlsOptions()...)
+}
+
 // Get gets a connection. The application must close the returned connection.
 // This method always returns a valid connection so that applications can defer
 // error handling to the first use of the connection. If there is an error
@@ -99,13 +111,16 @@ func (p *Pool) Close() error {
 }
 
 type pooledConnection struct {
-	p     *Pool
-	rc    Conn
-	c     Conn
-	state int
+	p  *Pool
+	rc Conn
+	c  Conn
 
-	now  time.Time
-	cmds []string
+	// mu guards state, now and cmds, the sends may run concurrently with the
+	// receives.
+	mu    sync.Mutex
+	state int
+	now   time.Time
+	cmds  []string
 }
 
 var (
@@ -137,10 +152,82 @@ func pstat(name, addr, cmd string, t time.Time, err error) func() {
 			if msg := formatErr(err, name, addr); msg != "" {
 				_metricReqErr.Inc(name, addr, cmd, msg)
 			}
-			return
+			if class := errClass(err); class != "" {
+				_metricReqErrClass.Inc(name, addr, cmd, class)
+			}
+		}
+	}
+}
+
+// how the reply of a read command maps to hits and misses of its keys.
+const (
+	// a nil reply is a miss of the key.
+	_hitMissValue = iota + 1
+	// every nil element of the reply is a miss of a key.
+	_hitMissValues
+	// an empty reply is a miss of the key.
+	_hitMissHash
+)
+
+var hitMissCommands = map[string]int{
+	"GET":     _hitMissValue,
+	"GETEX":   _hitMissValue,
+	"GETDEL":  _hitMissValue,
+	"HGET":    _hitMissValue,
+	"MGET":    _hitMissValues,
+	"HMGET":   _hitMissValues,
+	"HGETALL": _hitMissHash,
+}
+
+func init() {
+	for n, kind := range hitMissCommands {
+		hitMissCommands[strings.ToLower(n)] = kind
+	}
+}
+
+// hitMiss counts the keys found and missing by the reply of a read command,
+// by the cache name and by the server address.
+func hitMiss(name, addr, cmd string, reply interface{}) {
+	hits, misses := replyHitMiss(cmd, reply)
+	if hits > 0 {
+		_metricHits.Add(float64(hits), name, addr)
+		cache.MetricHits.Add(float64(hits), name)
+	}
+	if misses > 0 {
+		_metricMisses.Add(float64(misses), name, addr)
+		cache.MetricMisses.Add(float64(misses), name)
+	}
+}
+
+// replyHitMiss returns the keys found and missing by the reply of cmd,
+// zeros for commands other than hitMissCommands.
+func replyHitMiss(cmd string, reply interface{}) (hits, misses int) {
+	kind, ok := hitMissCommands[cmd]
+	if !ok {
+		kind = hitMissCommands[strings.ToUpper(cmd)]
+	}
+	switch kind {
+	case _hitMissValue:
+		if reply == nil {
+			return 0, 1
+		}
+		return 1, 0
+	case _hitMissValues:
+		values, _ := array(reply)
+		for _, v := range values {
+			if v == nil {
+				misses++
+			} else {
+				hits++
+			}
 		}
-		_metricHits.Inc(name, addr)
+	case _hitMissHash:
+		if values, _ := array(reply); len(values) == 0 {
+			return 0, 1
+		}
+		return 1, 0
 	}
+	return
 }
 
 func (pc *pooledConnection) Close() error {
@@ -188,22 +275,29 @@ func (pc *pooledConnection) Err() error {
 func (pc *pooledConnection) Do(commandName string, args ...interface{}) (reply interface{}, err error) {
 	now := time.Now()
 	ci := LookupCommandInfo(commandName)
+	pc.mu.Lock()
 	pc.state = (pc.state | ci.Set) &^ ci.Clear
+	pc.mu.Unlock()
 	reply, err = pc.c.Do(commandName, args...)
 	if pc.p.statfunc != nil {
 		pc.p.statfunc(pc.p.c.Name, pc.p.c.Addr, commandName, now, err)()
+		if err == nil {
+			hitMiss(pc.p.c.Name, pc.p.c.Addr, commandName, reply)
+		}
 	}
 	return
 }
 
 func (pc *pooledConnection) Send(commandName string, args ...interface{}) (err error) {
 	ci := LookupCommandInfo(commandName)
+	pc.mu.Lock()
 	pc.state = (pc.state | ci.Set) &^ ci.Clear
 	if pc.now.Equal(beginTime) {
 		// mark first send time
 		pc.now = time.Now()
 	}
 	pc.cmds = append(pc.cmds, commandName)
+	pc.mu.Unlock()
 	return pc.c.Send(commandName, args...)
 }
 
@@ -213,11 +307,21 @@ func (pc *pooledConnection) Flush() error {
 
 func (pc *pooledConnection) Receive() (reply interface{}, err error) {
 	reply, err = pc.c.Receive()
-	if len(pc.cmds) > 0 {
-		cmd := pc.cmds[0]
+	pc.mu.Lock()
+	var cmd string
+	sent := len(pc.cmds) > 0
+	if sent {
+		cmd = pc.cmds[0]
 		pc.cmds = pc.cmds[1:]
+	}
+	now := pc.now
+	pc.mu.Unlock()
+	if sent {
 		if pc.p.statfunc != nil {
-			pc.p.statfunc(pc.p.c.Name, pc.p.c.Addr, cmd, pc.now, err)()
+			pc.p.statfunc(pc.p.c.Name, pc.p.c.Addr, cmd, now, err)()
+			if err == nil {
+				hitMiss(pc.p.c.Name, pc.p.c.Addr, cmd, reply)
+			}
 		}
 	}
 	return
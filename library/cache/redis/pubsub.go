@@ -111,7 +111,12 @@ func (c PubSubConn) Ping(data string) error {
 // or error. The return value is intended to be used directly in a type switch
 // as illustrated in the PubSubConn example.
 func (c PubSubConn) Receive() interface{} {
-	reply, err := Values(c.Conn.Receive())
+	r, err := c.Conn.Receive()
+	if p, ok := r.([]byte); ok && err == nil {
+		// RESP3 replies PING with the data in the subscribed state.
+		return Pong{Data: string(p)}
+	}
+	reply, err := Values(r, err)
 	if err != nil {
 		return err
 	}
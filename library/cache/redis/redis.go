@@ -33,8 +33,11 @@ type Config struct {
 	Name         string // redis name, for trace
 	Proto        string
 	Addr         string
+	Username     string // ACL user of redis 6, Auth is its password
 	Auth         string
 	Db           int
+	ClientName   string // CLIENT SETNAME of the connections
+	TLS          *TLSConfig
 	DialTimeout  xtime.Duration
 	ReadTimeout  xtime.Duration
 	WriteTimeout xtime.Duration
@@ -42,20 +45,36 @@ type Config struct {
 }
 
 type Redis struct {
-	pool *Pool
-	conf *Config
+	pool    connPool
+	conf    *Config
+	options []DialOption
+	// tracking is the client-side cache enabled by EnableTracking.
+	tracking *Tracking
+}
+
+// connPool is the source of connections used by Redis, either a Pool of a
+// fixed server or a SentinelPool following the master.
+type connPool interface {
+	Get(ctx context.Context) Conn
+	Close() error
 }
 
 func NewRedis(c *Config, options ...DialOption) *Redis {
 	return &Redis{
-		pool: NewPool(c, options...),
-		conf: c,
+		pool:    NewPool(c, options...),
+		conf:    c,
+		options: options,
 	}
 }
 
 // Do gets a new conn from pool, then execute Do with this conn, finally close this conn.
-// ATTENTION: Don't use this method with transaction command like MULTI etc. Because every Do will close conn automatically, use r.Conn to get a raw conn for this situation.
+// ATTENTION: Don't use this method with transaction command like MULTI etc. Because every Do will close conn automatically, use r.Tx or r.Conn to get a raw conn for this situation.
 func (r *Redis) Do(ctx context.Context, commandName string, args ...interface{}) (reply interface{}, err error) {
+	if r.tracking != nil {
+		if reply, err, ok := r.tracking.do(ctx, commandName, args); ok {
+			return reply, err
+		}
+	}
 	conn := r.pool.Get(ctx)
 	defer conn.Close()
 	reply, err = conn.Do(commandName, args...)
@@ -64,6 +83,9 @@ func (r *Redis) Do(ctx context.Context, commandName string, args ...interface{})
 
 // Close closes connection pool
 func (r *Redis) Close() error {
+	if r.tracking != nil {
+		r.tracking.Close()
+	}
 	return r.pool.Close()
 }
 
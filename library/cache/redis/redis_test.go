@@ -321,3 +321,21 @@ func BenchmarkRedisDoGET(b *testing.B) {
 		}
 	}
 }
+
+// newFakeConfig new a Config of the fake server at addr.
+func newFakeConfig(name, addr string) *Config {
+	return &Config{
+		Config:       &pool.Config{Active: 10, Idle: 2, IdleTimeout: xtime.Duration(time.Minute)},
+		Name:         name,
+		Proto:        "tcp",
+		Addr:         addr,
+		DialTimeout:  xtime.Duration(time.Second),
+		ReadTimeout:  xtime.Duration(time.Second),
+		WriteTimeout: xtime.Duration(time.Second),
+	}
+}
+
+// newTestRedis new a Redis of the fake server at addr.
+func newTestRedis(name, addr string) *Redis {
+	return NewRedis(newFakeConfig(name, addr))
+}
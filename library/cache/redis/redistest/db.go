@@ -0,0 +1,394 @@
+package redistest
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The values of the keys by type.
+type (
+	hash map[string][]byte
+	list struct{ items [][]byte }
+	set  map[string]struct{}
+	zset map[string]float64
+)
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case []byte:
+		return "string"
+	case hash:
+		return "hash"
+	case *list:
+		return "list"
+	case set:
+		return "set"
+	case zset:
+		return "zset"
+	}
+	return "none"
+}
+
+// db is a database, guarded by the mutex of the server.
+type db struct {
+	s       *Server
+	values  map[string]interface{}
+	expires map[string]time.Time
+	// versions are bumped by every change of a key, for WATCH.
+	versions map[string]uint64
+}
+
+func newDB(s *Server) *db {
+	return &db{
+		s:        s,
+		values:   make(map[string]interface{}),
+		expires:  make(map[string]time.Time),
+		versions: make(map[string]uint64),
+	}
+}
+
+// get returns the value of key not expired, an expired key is removed.
+func (d *db) get(key string) (interface{}, bool) {
+	if exp, ok := d.expires[key]; ok && !d.s.now().Before(exp) {
+		d.del(key)
+	}
+	v, ok := d.values[key]
+	return v, ok
+}
+
+// set sets the value of key, removing its TTL.
+func (d *db) set(key string, v interface{}) {
+	d.values[key] = v
+	delete(d.expires, key)
+	d.touch(key)
+}
+
+func (d *db) del(key string) bool {
+	if _, ok := d.values[key]; !ok {
+		return false
+	}
+	delete(d.values, key)
+	delete(d.expires, key)
+	d.touch(key)
+	return true
+}
+
+// touch marks key as changed.
+func (d *db) touch(key string) {
+	d.s.version++
+	d.versions[key] = d.s.version
+}
+
+// changed marks key as changed after an update in place, an empty
+// collection is removed.
+func (d *db) changed(key string) {
+	empty := false
+	switch v := d.values[key].(type) {
+	case hash:
+		empty = len(v) == 0
+	case *list:
+		empty = len(v.items) == 0
+	case set:
+		empty = len(v) == 0
+	case zset:
+		empty = len(v) == 0
+	}
+	if empty {
+		d.del(key)
+		return
+	}
+	d.touch(key)
+}
+
+func (d *db) flush() {
+	for key := range d.values {
+		d.del(key)
+	}
+}
+
+func (d *db) keys() []string {
+	keys := make([]string, 0, len(d.values))
+	for key := range d.values {
+		if _, ok := d.get(key); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (d *db) getString(key string) ([]byte, interface{}) {
+	v, ok := d.get(key)
+	if !ok {
+		return nil, nil
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, errWrongType
+	}
+	return b, nil
+}
+
+func (d *db) getHash(key string, create bool) (hash, interface{}) {
+	v, ok := d.get(key)
+	if !ok {
+		if !create {
+			return nil, nil
+		}
+		h := make(hash)
+		d.values[key] = h
+		return h, nil
+	}
+	h, ok := v.(hash)
+	if !ok {
+		return nil, errWrongType
+	}
+	return h, nil
+}
+
+func (d *db) getList(key string, create bool) (*list, interface{}) {
+	v, ok := d.get(key)
+	if !ok {
+		if !create {
+			return nil, nil
+		}
+		l := &list{}
+		d.values[key] = l
+		return l, nil
+	}
+	l, ok := v.(*list)
+	if !ok {
+		return nil, errWrongType
+	}
+	return l, nil
+}
+
+func (d *db) getSet(key string, create bool) (set, interface{}) {
+	v, ok := d.get(key)
+	if !ok {
+		if !create {
+			return nil, nil
+		}
+		s := make(set)
+		d.values[key] = s
+		return s, nil
+	}
+	s, ok := v.(set)
+	if !ok {
+		return nil, errWrongType
+	}
+	return s, nil
+}
+
+func (d *db) getZSet(key string, create bool) (zset, interface{}) {
+	v, ok := d.get(key)
+	if !ok {
+		if !create {
+			return nil, nil
+		}
+		z := make(zset)
+		d.values[key] = z
+		return z, nil
+	}
+	z, ok := v.(zset)
+	if !ok {
+		return nil, errWrongType
+	}
+	return z, nil
+}
+
+var keyCommands = map[string]*command{
+	"DEL":       {fn: del, arity: -2},
+	"UNLINK":    {fn: del, arity: -2},
+	"EXISTS":    {fn: exists, arity: -2},
+	"TYPE":      {fn: typeCmd, arity: 2},
+	"KEYS":      {fn: keys, arity: 2},
+	"SCAN":      {fn: scan, arity: -2},
+	"RENAME":    {fn: rename, arity: 3},
+	"RENAMENX":  {fn: renamenx, arity: 3},
+	"EXPIRE":    {fn: expire(time.Second, false), arity: 3},
+	"PEXPIRE":   {fn: expire(time.Millisecond, false), arity: 3},
+	"EXPIREAT":  {fn: expire(time.Second, true), arity: 3},
+	"PEXPIREAT": {fn: expire(time.Millisecond, true), arity: 3},
+	"TTL":       {fn: ttl(time.Second), arity: 2},
+	"PTTL":      {fn: ttl(time.Millisecond), arity: 2},
+	"PERSIST":   {fn: persist, arity: 2},
+}
+
+func del(c *client, args [][]byte) interface{} {
+	var n int64
+	for _, key := range args {
+		if _, ok := c.db().get(string(key)); ok && c.db().del(string(key)) {
+			n++
+		}
+	}
+	return n
+}
+
+func exists(c *client, args [][]byte) interface{} {
+	var n int64
+	for _, key := range args {
+		if _, ok := c.db().get(string(key)); ok {
+			n++
+		}
+	}
+	return n
+}
+
+func typeCmd(c *client, args [][]byte) interface{} {
+	v, _ := c.db().get(string(args[0]))
+	return status(typeName(v))
+}
+
+func keys(c *client, args [][]byte) interface{} {
+	keys := []interface{}{}
+	for _, key := range c.db().keys() {
+		if match(string(args[0]), key) {
+			keys = append(keys, []byte(key))
+		}
+	}
+	return keys
+}
+
+// scanArgs parses the cursor and the options MATCH, COUNT and TYPE of the
+// SCAN family.
+func scanArgs(args [][]byte, typ bool) (cursor int, pattern string, count int, kind string, err interface{}) {
+	n, ok := parseInt(args[0])
+	if !ok || n < 0 {
+		return 0, "", 0, "", errReply("ERR invalid cursor")
+	}
+	cursor, pattern, count = int(n), "*", 10
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return 0, "", 0, "", errSyntax
+		}
+		switch opt := strings.ToUpper(string(args[i])); {
+		case opt == "MATCH":
+			pattern = string(args[i+1])
+		case opt == "COUNT":
+			if n, ok = parseInt(args[i+1]); !ok || n < 1 {
+				return 0, "", 0, "", errSyntax
+			}
+			count = int(n)
+		case opt == "TYPE" && typ:
+			kind = strings.ToLower(string(args[i+1]))
+		default:
+			return 0, "", 0, "", errSyntax
+		}
+	}
+	return
+}
+
+// scanReply replies count elements from cursor of the sorted names, the
+// next cursor is their index, 0 at the end.
+func scanReply(names []string, cursor, count int, filter func(name string) []interface{}) interface{} {
+	var elements []interface{}
+	end := cursor + count
+	if end > len(names) {
+		end = len(names)
+	}
+	for i := cursor; i < end; i++ {
+		elements = append(elements, filter(names[i])...)
+	}
+	next := int64(end)
+	if end >= len(names) {
+		next = 0
+	}
+	if elements == nil {
+		elements = []interface{}{}
+	}
+	return []interface{}{[]byte(strconv.FormatInt(next, 10)), elements}
+}
+
+func scan(c *client, args [][]byte) interface{} {
+	cursor, pattern, count, kind, err := scanArgs(args, true)
+	if err != nil {
+		return err
+	}
+	return scanReply(c.db().keys(), cursor, count, func(key string) []interface{} {
+		v, _ := c.db().get(key)
+		if !match(pattern, key) || (kind != "" && typeName(v) != kind) {
+			return nil
+		}
+		return []interface{}{[]byte(key)}
+	})
+}
+
+func rename(c *client, args [][]byte) interface{} {
+	d := c.db()
+	key, newKey := string(args[0]), string(args[1])
+	v, ok := d.get(key)
+	if !ok {
+		return errNoSuchKey
+	}
+	exp, hasTTL := d.expires[key]
+	d.del(key)
+	d.set(newKey, v)
+	if hasTTL {
+		d.expires[newKey] = exp
+	}
+	return replyOK
+}
+
+func renamenx(c *client, args [][]byte) interface{} {
+	if _, ok := c.db().get(string(args[0])); !ok {
+		return errNoSuchKey
+	}
+	if _, ok := c.db().get(string(args[1])); ok {
+		return int64(0)
+	}
+	rename(c, args)
+	return int64(1)
+}
+
+func expire(unit time.Duration, at bool) func(c *client, args [][]byte) interface{} {
+	return func(c *client, args [][]byte) interface{} {
+		n, ok := parseInt(args[1])
+		if !ok {
+			return errNotInteger
+		}
+		d, key := c.db(), string(args[0])
+		if _, ok = d.get(key); !ok {
+			return int64(0)
+		}
+		t := d.s.now().Add(time.Duration(n) * unit)
+		if at {
+			t = time.Unix(0, 0).Add(time.Duration(n) * unit)
+		}
+		d.expires[key] = t
+		d.touch(key)
+		// an expire in the past deletes the key.
+		d.get(key)
+		return int64(1)
+	}
+}
+
+func ttl(unit time.Duration) func(c *client, args [][]byte) interface{} {
+	return func(c *client, args [][]byte) interface{} {
+		d, key := c.db(), string(args[0])
+		if _, ok := d.get(key); !ok {
+			return int64(-2)
+		}
+		exp, ok := d.expires[key]
+		if !ok {
+			return int64(-1)
+		}
+		// rounded like redis.
+		return int64((exp.Sub(d.s.now()) + unit/2) / unit)
+	}
+}
+
+func persist(c *client, args [][]byte) interface{} {
+	d, key := c.db(), string(args[0])
+	if _, ok := d.get(key); !ok {
+		return int64(0)
+	}
+	if _, ok := d.expires[key]; !ok {
+		return int64(0)
+	}
+	delete(d.expires, key)
+	d.touch(key)
+	return int64(1)
+}
@@ -0,0 +1,242 @@
+package redistest
+
+import (
+	"sort"
+	"strconv"
+)
+
+var hashCommands = map[string]*command{
+	"HGET":         {fn: hget, arity: 3},
+	"HSET":         {fn: hset, arity: -4},
+	"HMSET":        {fn: hmset, arity: -4},
+	"HSETNX":       {fn: hsetnx, arity: 4},
+	"HGETALL":      {fn: hgetall, arity: 2},
+	"HMGET":        {fn: hmget, arity: -3},
+	"HDEL":         {fn: hdel, arity: -3},
+	"HEXISTS":      {fn: hexists, arity: 3},
+	"HINCRBY":      {fn: hincrby, arity: 4},
+	"HINCRBYFLOAT": {fn: hincrbyfloat, arity: 4},
+	"HLEN":         {fn: hlen, arity: 2},
+	"HKEYS":        {fn: hkeys, arity: 2},
+	"HVALS":        {fn: hvals, arity: 2},
+	"HSCAN":        {fn: hscan, arity: -3},
+}
+
+func (h hash) fields() []string {
+	fields := make([]string, 0, len(h))
+	for f := range h {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func hget(c *client, args [][]byte) interface{} {
+	h, err := c.db().getHash(string(args[0]), false)
+	if err != nil {
+		return err
+	}
+	if v, ok := h[string(args[1])]; ok {
+		return v
+	}
+	return nil
+}
+
+func hset(c *client, args [][]byte) interface{} {
+	if len(args)%2 != 1 {
+		return errWrongArgs("HSET")
+	}
+	d, key := c.db(), string(args[0])
+	h, err := d.getHash(key, true)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for i := 1; i < len(args); i += 2 {
+		if _, ok := h[string(args[i])]; !ok {
+			n++
+		}
+		h[string(args[i])] = args[i+1]
+	}
+	d.changed(key)
+	return n
+}
+
+func hmset(c *client, args [][]byte) interface{} {
+	reply := hset(c, args)
+	if _, ok := reply.(int64); ok {
+		return replyOK
+	}
+	return reply
+}
+
+func hsetnx(c *client, args [][]byte) interface{} {
+	d, key := c.db(), string(args[0])
+	h, err := d.getHash(key, true)
+	if err != nil {
+		return err
+	}
+	if _, ok := h[string(args[1])]; ok {
+		return int64(0)
+	}
+	h[string(args[1])] = args[2]
+	d.changed(key)
+	return int64(1)
+}
+
+func hgetall(c *client, args [][]byte) interface{} {
+	h, err := c.db().getHash(string(args[0]), false)
+	if err != nil {
+		return err
+	}
+	values := []interface{}{}
+	for _, f := range h.fields() {
+		values = append(values, []byte(f), h[f])
+	}
+	return values
+}
+
+func hmget(c *client, args [][]byte) interface{} {
+	h, err := c.db().getHash(string(args[0]), false)
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(args)-1)
+	for i, f := range args[1:] {
+		if v, ok := h[string(f)]; ok {
+			values[i] = v
+		}
+	}
+	return values
+}
+
+func hdel(c *client, args [][]byte) interface{} {
+	d, key := c.db(), string(args[0])
+	h, err := d.getHash(key, false)
+	if err != nil || h == nil {
+		return orZero(err)
+	}
+	var n int64
+	for _, f := range args[1:] {
+		if _, ok := h[string(f)]; ok {
+			delete(h, string(f))
+			n++
+		}
+	}
+	if n > 0 {
+		d.changed(key)
+	}
+	return n
+}
+
+// orZero replies err, or 0 if it is nil.
+func orZero(err interface{}) interface{} {
+	if err != nil {
+		return err
+	}
+	return int64(0)
+}
+
+func hexists(c *client, args [][]byte) interface{} {
+	h, err := c.db().getHash(string(args[0]), false)
+	if err != nil {
+		return err
+	}
+	if _, ok := h[string(args[1])]; ok {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+func hincrby(c *client, args [][]byte) interface{} {
+	delta, ok := parseInt(args[2])
+	if !ok {
+		return errNotInteger
+	}
+	d, key := c.db(), string(args[0])
+	h, err := d.getHash(key, true)
+	if err != nil {
+		return err
+	}
+	var n int64
+	if v, exists := h[string(args[1])]; exists {
+		if n, ok = parseInt(v); !ok {
+			return errReply("ERR hash value is not an integer")
+		}
+	}
+	n += delta
+	h[string(args[1])] = []byte(strconv.FormatInt(n, 10))
+	d.changed(key)
+	return n
+}
+
+func hincrbyfloat(c *client, args [][]byte) interface{} {
+	delta, ok := parseFloat(args[2])
+	if !ok {
+		return errNotFloat
+	}
+	d, key := c.db(), string(args[0])
+	h, err := d.getHash(key, true)
+	if err != nil {
+		return err
+	}
+	var f float64
+	if v, exists := h[string(args[1])]; exists {
+		if f, ok = parseFloat(v); !ok {
+			return errReply("ERR hash value is not a float")
+		}
+	}
+	value := formatFloat(f + delta)
+	h[string(args[1])] = value
+	d.changed(key)
+	return value
+}
+
+func hlen(c *client, args [][]byte) interface{} {
+	h, err := c.db().getHash(string(args[0]), false)
+	if err != nil {
+		return err
+	}
+	return int64(len(h))
+}
+
+func hkeys(c *client, args [][]byte) interface{} {
+	h, err := c.db().getHash(string(args[0]), false)
+	if err != nil {
+		return err
+	}
+	fields := []interface{}{}
+	for _, f := range h.fields() {
+		fields = append(fields, []byte(f))
+	}
+	return fields
+}
+
+func hvals(c *client, args [][]byte) interface{} {
+	h, err := c.db().getHash(string(args[0]), false)
+	if err != nil {
+		return err
+	}
+	values := []interface{}{}
+	for _, f := range h.fields() {
+		values = append(values, h[f])
+	}
+	return values
+}
+
+func hscan(c *client, args [][]byte) interface{} {
+	h, err := c.db().getHash(string(args[0]), false)
+	if err != nil {
+		return err
+	}
+	cursor, pattern, count, _, err := scanArgs(args[1:], false)
+	if err != nil {
+		return err
+	}
+	return scanReply(h.fields(), cursor, count, func(f string) []interface{} {
+		if !match(pattern, f) {
+			return nil
+		}
+		return []interface{}{[]byte(f), h[f]}
+	})
+}
@@ -0,0 +1,277 @@
+package redistest
+
+import (
+	"bytes"
+	"strings"
+)
+
+var listCommands = map[string]*command{
+	"LPUSH":     {fn: push(true, false), arity: -3},
+	"RPUSH":     {fn: push(false, false), arity: -3},
+	"LPUSHX":    {fn: push(true, true), arity: -3},
+	"RPUSHX":    {fn: push(false, true), arity: -3},
+	"LPOP":      {fn: pop(true), arity: 2},
+	"RPOP":      {fn: pop(false), arity: 2},
+	"BLPOP":     {fn: bpop(true), arity: -3},
+	"BRPOP":     {fn: bpop(false), arity: -3},
+	"RPOPLPUSH": {fn: rpoplpush, arity: 3},
+	"LRANGE":    {fn: lrange, arity: 4},
+	"LLEN":      {fn: llen, arity: 2},
+	"LINDEX":    {fn: lindex, arity: 3},
+	"LSET":      {fn: lset, arity: 4},
+	"LINSERT":   {fn: linsert, arity: 5},
+	"LREM":      {fn: lrem, arity: 4},
+	"LTRIM":     {fn: ltrim, arity: 4},
+}
+
+func push(left, exists bool) func(c *client, args [][]byte) interface{} {
+	return func(c *client, args [][]byte) interface{} {
+		d, key := c.db(), string(args[0])
+		l, err := d.getList(key, !exists)
+		if err != nil || l == nil {
+			return orZero(err)
+		}
+		for _, v := range args[1:] {
+			if left {
+				l.items = append([][]byte{v}, l.items...)
+			} else {
+				l.items = append(l.items, v)
+			}
+		}
+		d.changed(key)
+		return int64(len(l.items))
+	}
+}
+
+// popList pops an element of the list of key, nil if there is none.
+func popList(d *db, key string, left bool) ([]byte, interface{}) {
+	l, err := d.getList(key, false)
+	if err != nil || l == nil {
+		return nil, err
+	}
+	var v []byte
+	if left {
+		v, l.items = l.items[0], l.items[1:]
+	} else {
+		v, l.items = l.items[len(l.items)-1], l.items[:len(l.items)-1]
+	}
+	d.changed(key)
+	return v, nil
+}
+
+func pop(left bool) func(c *client, args [][]byte) interface{} {
+	return func(c *client, args [][]byte) interface{} {
+		v, err := popList(c.db(), string(args[0]), left)
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return nil
+		}
+		return v
+	}
+}
+
+// bpop executes BLPOP|BRPOP key [key ...] timeout, errBlocked is returned
+// while the lists are empty.
+func bpop(left bool) func(c *client, args [][]byte) interface{} {
+	return func(c *client, args [][]byte) interface{} {
+		if f, ok := parseFloat(args[len(args)-1]); !ok || f < 0 {
+			return errReply("ERR timeout is not a float or out of range")
+		}
+		for _, key := range args[:len(args)-1] {
+			v, err := popList(c.db(), string(key), left)
+			if err != nil {
+				return err
+			}
+			if v != nil {
+				return []interface{}{key, v}
+			}
+		}
+		return errBlocked
+	}
+}
+
+func rpoplpush(c *client, args [][]byte) interface{} {
+	d := c.db()
+	if _, err := d.getList(string(args[1]), false); err != nil {
+		return err
+	}
+	v, err := popList(d, string(args[0]), false)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	push(true, false)(c, [][]byte{args[1], v})
+	return v
+}
+
+func lrange(c *client, args [][]byte) interface{} {
+	start, ok1 := parseInt(args[1])
+	stop, ok2 := parseInt(args[2])
+	if !ok1 || !ok2 {
+		return errNotInteger
+	}
+	l, err := c.db().getList(string(args[0]), false)
+	if err != nil {
+		return err
+	}
+	values := []interface{}{}
+	if l == nil {
+		return values
+	}
+	lo, hi := rangeIndexes(start, stop, len(l.items))
+	for _, v := range l.items[lo:hi] {
+		values = append(values, v)
+	}
+	return values
+}
+
+func llen(c *client, args [][]byte) interface{} {
+	l, err := c.db().getList(string(args[0]), false)
+	if err != nil || l == nil {
+		return orZero(err)
+	}
+	return int64(len(l.items))
+}
+
+// index converts an index of the list, negative from the end, -1 if it is
+// out of range.
+func (l *list) index(b []byte) (int, bool) {
+	i, ok := parseInt(b)
+	if !ok {
+		return 0, false
+	}
+	if i < 0 {
+		i += int64(len(l.items))
+	}
+	if i < 0 || i >= int64(len(l.items)) {
+		return -1, true
+	}
+	return int(i), true
+}
+
+func lindex(c *client, args [][]byte) interface{} {
+	if _, ok := parseInt(args[1]); !ok {
+		return errNotInteger
+	}
+	l, err := c.db().getList(string(args[0]), false)
+	if err != nil || l == nil {
+		return err
+	}
+	i, _ := l.index(args[1])
+	if i < 0 {
+		return nil
+	}
+	return l.items[i]
+}
+
+func lset(c *client, args [][]byte) interface{} {
+	if _, ok := parseInt(args[1]); !ok {
+		return errNotInteger
+	}
+	d, key := c.db(), string(args[0])
+	l, err := d.getList(key, false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return errNoSuchKey
+	}
+	i, _ := l.index(args[1])
+	if i < 0 {
+		return errOutOfRange
+	}
+	l.items[i] = args[2]
+	d.changed(key)
+	return replyOK
+}
+
+// linsert executes LINSERT key BEFORE|AFTER pivot element.
+func linsert(c *client, args [][]byte) interface{} {
+	where := strings.ToUpper(string(args[1]))
+	if where != "BEFORE" && where != "AFTER" {
+		return errSyntax
+	}
+	d, key := c.db(), string(args[0])
+	l, err := d.getList(key, false)
+	if err != nil || l == nil {
+		return orZero(err)
+	}
+	for i, v := range l.items {
+		if !bytes.Equal(v, args[2]) {
+			continue
+		}
+		if where == "AFTER" {
+			i++
+		}
+		items := append([][]byte{}, l.items[:i]...)
+		items = append(items, args[3])
+		l.items = append(items, l.items[i:]...)
+		d.changed(key)
+		return int64(len(l.items))
+	}
+	return int64(-1)
+}
+
+func lrem(c *client, args [][]byte) interface{} {
+	count, ok := parseInt(args[1])
+	if !ok {
+		return errNotInteger
+	}
+	d, key := c.db(), string(args[0])
+	l, err := d.getList(key, false)
+	if err != nil || l == nil {
+		return orZero(err)
+	}
+	var removed int64
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	keep := make([][]byte, 0, len(l.items))
+	if count >= 0 {
+		for _, v := range l.items {
+			if bytes.Equal(v, args[2]) && (limit == 0 || removed < limit) {
+				removed++
+				continue
+			}
+			keep = append(keep, v)
+		}
+	} else {
+		for i := len(l.items) - 1; i >= 0; i-- {
+			if bytes.Equal(l.items[i], args[2]) && removed < limit {
+				removed++
+				continue
+			}
+			keep = append([][]byte{l.items[i]}, keep...)
+		}
+	}
+	if removed > 0 {
+		l.items = keep
+		d.changed(key)
+	}
+	return removed
+}
+
+func ltrim(c *client, args [][]byte) interface{} {
+	start, ok1 := parseInt(args[1])
+	stop, ok2 := parseInt(args[2])
+	if !ok1 || !ok2 {
+		return errNotInteger
+	}
+	d, key := c.db(), string(args[0])
+	l, err := d.getList(key, false)
+	if err != nil || l == nil {
+		if err != nil {
+			return err
+		}
+		return replyOK
+	}
+	lo, hi := rangeIndexes(start, stop, len(l.items))
+	l.items = append([][]byte{}, l.items[lo:hi]...)
+	d.changed(key)
+	return replyOK
+}
@@ -0,0 +1,110 @@
+package redistest
+
+// The confirmations of (P)SUBSCRIBE and (P)UNSUBSCRIBE are sent while the
+// server is locked, so that they precede the messages published to the new
+// subscriptions, and an empty multiReply is returned.
+
+func subscribe(c *client, args [][]byte) interface{} {
+	return c.subscribe("subscribe", c.s.channels, c.channels, args)
+}
+
+func psubscribe(c *client, args [][]byte) interface{} {
+	return c.subscribe("psubscribe", c.s.patterns, c.patterns, args)
+}
+
+func unsubscribe(c *client, args [][]byte) interface{} {
+	return c.unsubscribe("unsubscribe", c.s.channels, c.channels, args)
+}
+
+func punsubscribe(c *client, args [][]byte) interface{} {
+	return c.unsubscribe("punsubscribe", c.s.patterns, c.patterns, args)
+}
+
+func (c *client) subscribe(kind string, all map[string]map[*client]struct{}, mine map[string]struct{}, args [][]byte) interface{} {
+	var replies multiReply
+	for _, name := range args {
+		mine[string(name)] = struct{}{}
+		if all[string(name)] == nil {
+			all[string(name)] = make(map[*client]struct{})
+		}
+		all[string(name)][c] = struct{}{}
+		replies = append(replies, c.confirm(kind, name))
+	}
+	c.send(replies)
+	return multiReply{}
+}
+
+// unsubscribe unsubscribes from the names of args, from all when empty.
+func (c *client) unsubscribe(kind string, all map[string]map[*client]struct{}, mine map[string]struct{}, args [][]byte) interface{} {
+	names := args
+	if len(names) == 0 {
+		for _, name := range sortedKeys(mine) {
+			names = append(names, []byte(name))
+		}
+	}
+	if len(names) == 0 {
+		c.send([]interface{}{[]byte(kind), nil, int64(c.count())})
+		return multiReply{}
+	}
+	var replies multiReply
+	for _, name := range names {
+		delete(mine, string(name))
+		if subs := all[string(name)]; subs != nil {
+			delete(subs, c)
+			if len(subs) == 0 {
+				delete(all, string(name))
+			}
+		}
+		replies = append(replies, c.confirm(kind, name))
+	}
+	c.send(replies)
+	return multiReply{}
+}
+
+func (c *client) count() int {
+	return len(c.channels) + len(c.patterns)
+}
+
+func (c *client) confirm(kind string, name []byte) []interface{} {
+	return []interface{}{[]byte(kind), name, int64(c.count())}
+}
+
+func publish(c *client, args [][]byte) interface{} {
+	return int64(c.s.publish(string(args[0]), args[1]))
+}
+
+// publish sends msg to the subscribers of channel, the server is locked.
+func (s *Server) publish(channel string, msg []byte) int {
+	n := 0
+	for c := range s.channels[channel] {
+		c.send([]interface{}{[]byte("message"), []byte(channel), msg})
+		n++
+	}
+	for pattern, subs := range s.patterns {
+		if !match(pattern, channel) {
+			continue
+		}
+		for c := range subs {
+			c.send([]interface{}{[]byte("pmessage"), []byte(pattern), []byte(channel), msg})
+			n++
+		}
+	}
+	return n
+}
+
+// unsubscribeAll removes the subscriptions of a closed client, the server
+// is locked.
+func (s *Server) unsubscribeAll(c *client) {
+	for name := range c.channels {
+		delete(s.channels[name], c)
+		if len(s.channels[name]) == 0 {
+			delete(s.channels, name)
+		}
+	}
+	for name := range c.patterns {
+		delete(s.patterns[name], c)
+		if len(s.patterns[name]) == 0 {
+			delete(s.patterns, name)
+		}
+	}
+}
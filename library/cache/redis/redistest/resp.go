@@ -0,0 +1,214 @@
+package redistest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The replies of the commands are Go values written by writeReply:
+//
+//	status, errReply    simple string and error
+//	int64               integer
+//	[]byte, float64     bulk string
+//	nil                 nil bulk string
+//	nilArray            nil array
+//	[]interface{}       array
+//	multiReply          consecutive replies, none if empty
+type (
+	status     string
+	errReply   string
+	nilArray   struct{}
+	multiReply []interface{}
+	blocked    struct{}
+)
+
+var (
+	replyOK = status("OK")
+	// errBlocked is returned by the blocking commands until they can be
+	// executed.
+	errBlocked = blocked{}
+
+	errSyntax      = errReply("ERR syntax error")
+	errNotInteger  = errReply("ERR value is not an integer or out of range")
+	errNotFloat    = errReply("ERR value is not a valid float")
+	errWrongType   = errReply("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNoSuchKey   = errReply("ERR no such key")
+	errOutOfRange  = errReply("ERR index out of range")
+	errMinMaxFloat = errReply("ERR min or max is not a float")
+)
+
+func errWrongArgs(name string) errReply {
+	return errReply("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch reply := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case status:
+		w.WriteString("+" + string(reply) + "\r\n")
+	case errReply:
+		w.WriteString("-" + string(reply) + "\r\n")
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", reply)
+	case []byte:
+		fmt.Fprintf(w, "$%d\r\n", len(reply))
+		w.Write(reply)
+		w.WriteString("\r\n")
+	case float64:
+		writeReply(w, formatFloat(reply))
+	case nilArray:
+		w.WriteString("*-1\r\n")
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(reply))
+		for _, r := range reply {
+			writeReply(w, r)
+		}
+	}
+}
+
+// readRequest reads a request, an array of bulk strings or an inline command.
+func readRequest(r *bufio.Reader) ([][]byte, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		fields := strings.Fields(string(line))
+		args := make([][]byte, len(fields))
+		for i, f := range fields {
+			args[i] = []byte(f)
+		}
+		return args, nil
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("redistest: bad request length %q", line)
+	}
+	args := make([][]byte, n)
+	for i := range args {
+		if line, err = readLine(r); err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("redistest: expected bulk string, got %q", line)
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("redistest: bad bulk string length %q", line)
+		}
+		arg := make([]byte, size+2)
+		if _, err = io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		args[i] = arg[:size]
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+func formatFloat(f float64) []byte {
+	return []byte(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+func parseInt(b []byte) (int64, bool) {
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	return n, err == nil
+}
+
+func parseFloat(b []byte) (float64, bool) {
+	s := strings.ToLower(string(b))
+	switch s {
+	case "inf", "+inf":
+		s = "+Inf"
+	case "-inf":
+		s = "-Inf"
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+// match reports whether str matches the glob-style pattern of KEYS and
+// PSUBSCRIBE: * ? [abc] [^a] [a-z] and \ escapes.
+func match(pattern, str string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(str); i++ {
+				if match(pattern[1:], str[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(str) == 0 {
+				return false
+			}
+		case '[':
+			if len(str) == 0 {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				// an unclosed class matches literally.
+				if str[0] != '[' {
+					return false
+				}
+				break
+			}
+			class := pattern[1 : end+1]
+			negate := len(class) > 0 && class[0] == '^'
+			if negate {
+				class = class[1:]
+			}
+			matched := false
+			for i := 0; i < len(class); i++ {
+				if class[i] == '\\' && i+1 < len(class) {
+					i++
+					matched = matched || class[i] == str[0]
+				} else if i+2 < len(class) && class[i+1] == '-' {
+					lo, hi := class[i], class[i+2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					matched = matched || (str[0] >= lo && str[0] <= hi)
+					i += 2
+				} else {
+					matched = matched || class[i] == str[0]
+				}
+			}
+			if matched == negate {
+				return false
+			}
+			pattern = pattern[end+1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(str) == 0 || pattern[0] != str[0] {
+				return false
+			}
+		}
+		pattern, str = pattern[1:], str[1:]
+	}
+	return len(str) == 0
+}
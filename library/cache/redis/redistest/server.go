@@ -0,0 +1,494 @@
+// Package redistest provides an in-process redis server speaking RESP2, for
+// tests of code using the redis package without a real redis. It implements
+// the common commands of strings, hashes, lists, sets, sorted sets and keys
+// with their expiry, pub/sub and MULTI/EXEC transactions, but no scripting.
+// Its clock can be advanced and faults injected into its replies.
+package redistest
+
+import (
+	"bufio"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache/internal/fakeserver"
+)
+
+const (
+	// _databases databases selectable by SELECT.
+	_databases = 16
+	// _blockInterval interval of the attempts of the blocking commands.
+	_blockInterval = 5 * time.Millisecond
+)
+
+// Faults are injected into the replies of the server, the zero value
+// injects none.
+type Faults struct {
+	// Latency delays every reply.
+	Latency time.Duration
+	// Error replies "-<Error>" instead of executing commands, e.g.
+	// "LOADING Redis is loading the dataset in memory".
+	Error string
+	// Drop closes the connection instead of replying.
+	Drop bool
+	// Commands limits faults to these commands, e.g. "GET" or "SET", all
+	// commands are affected when empty.
+	Commands []string
+}
+
+// Server is an in-process redis server.
+type Server struct {
+	// Password required by AUTH before any other command if not empty. Set
+	// before use.
+	Password string
+
+	l *fakeserver.Listener
+
+	mu       sync.Mutex
+	dbs      [_databases]*db
+	version  uint64
+	channels map[string]map[*client]struct{}
+	patterns map[string]map[*client]struct{}
+}
+
+// NewServer starts a server listening on a random local port.
+func NewServer() (*Server, error) {
+	l, err := fakeserver.Listen()
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		l:        l,
+		channels: make(map[string]map[*client]struct{}),
+		patterns: make(map[string]map[*client]struct{}),
+	}
+	for i := range s.dbs {
+		s.dbs[i] = newDB(s)
+	}
+	l.Serve(func(nc net.Conn) { s.serveConn(newClient(s, nc)) })
+	return s, nil
+}
+
+// Addr returns the "host:port" address of the server.
+func (s *Server) Addr() string {
+	return s.l.Addr()
+}
+
+// Close stops the server and closes all its connections.
+func (s *Server) Close() error {
+	return s.l.Close()
+}
+
+// Now returns the time of the server clock.
+func (s *Server) Now() time.Time {
+	return s.l.Now()
+}
+
+func (s *Server) now() time.Time {
+	return s.l.Now()
+}
+
+// Advance moves the server clock forward by d, expiring keys.
+func (s *Server) Advance(d time.Duration) {
+	s.l.Advance(d)
+}
+
+// SetFaults replaces the injected faults.
+func (s *Server) SetFaults(f Faults) {
+	s.l.SetFaults(fakeserver.Faults{
+		Latency:  f.Latency,
+		Error:    f.Error,
+		Drop:     f.Drop,
+		Commands: f.Commands,
+	})
+}
+
+// CloseConns closes all current client connections, the server keeps
+// accepting new ones.
+func (s *Server) CloseConns() {
+	s.l.CloseConns()
+}
+
+// Flush removes the keys of all databases.
+func (s *Server) Flush() {
+	s.mu.Lock()
+	for _, d := range s.dbs {
+		d.flush()
+	}
+	s.mu.Unlock()
+}
+
+// Keys returns the sorted keys of database 0 not expired.
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dbs[0].keys()
+}
+
+// Publish publishes message to channel like PUBLISH and returns the number
+// of clients receiving it.
+func (s *Server) Publish(channel, message string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.publish(channel, []byte(message))
+}
+
+// Subscribers returns the number of clients subscribed to name, a channel
+// or a pattern.
+func (s *Server) Subscribers(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.channels[name]) + len(s.patterns[name])
+}
+
+func (s *Server) serveConn(c *client) {
+	defer func() {
+		s.mu.Lock()
+		s.unsubscribeAll(c)
+		s.mu.Unlock()
+	}()
+	for {
+		args, err := readRequest(c.r)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		name := strings.ToUpper(string(args[0]))
+		var reply interface{}
+		drop, errText := s.l.Inject(name)
+		if drop {
+			return
+		}
+		if errText != "" {
+			reply = errReply(errText)
+		}
+		if reply == nil {
+			reply = s.execBlocking(c, name, args)
+		}
+		if err = c.send(reply); err != nil || name == "QUIT" {
+			return
+		}
+	}
+}
+
+// execBlocking executes a command, a blocking one is attempted again until
+// its timeout, the last argument in seconds, 0 for ever.
+func (s *Server) execBlocking(c *client, name string, args [][]byte) interface{} {
+	var deadline time.Time
+	for {
+		reply := s.exec(c, name, args)
+		if reply != errBlocked {
+			return reply
+		}
+		if deadline.IsZero() {
+			timeout, _ := strconv.ParseFloat(string(args[len(args)-1]), 64)
+			deadline = time.Now().Add(time.Duration(timeout * float64(time.Second)))
+			if timeout == 0 {
+				deadline = time.Now().Add(365 * 24 * time.Hour)
+			}
+		}
+		if !time.Now().Before(deadline) {
+			return nilArray{}
+		}
+		if s.l.Closed() {
+			return nilArray{}
+		}
+		time.Sleep(_blockInterval)
+	}
+}
+
+// exec executes a command of c or queues it in a transaction.
+func (s *Server) exec(c *client, name string, args [][]byte) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cmd, ok := commands[name]
+	if !ok {
+		c.dirty = c.multi
+		return errReply("ERR unknown command '" + string(args[0]) + "'")
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		c.dirty = c.multi
+		return errWrongArgs(name)
+	}
+	if s.Password != "" && !c.authed && name != "AUTH" && name != "QUIT" {
+		return errReply("NOAUTH Authentication required.")
+	}
+	if c.subscribed() && !cmd.pubsub {
+		return errReply("ERR Can't execute '" + strings.ToLower(name) + "': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context")
+	}
+	if c.multi && !cmd.tx {
+		c.queued = append(c.queued, args)
+		return status("QUEUED")
+	}
+	return cmd.fn(c, args[1:])
+}
+
+type command struct {
+	fn    func(c *client, args [][]byte) interface{}
+	arity int // exact number of arguments with the name, -n for at least n
+	// pubsub allowed while subscribed.
+	pubsub bool
+	// tx executed even in a transaction.
+	tx bool
+}
+
+var commands map[string]*command
+
+func init() {
+	commands = map[string]*command{
+		// connection
+		"PING":   {fn: ping, arity: -1, pubsub: true},
+		"ECHO":   {fn: echo, arity: 2},
+		"QUIT":   {fn: quit, arity: 1, pubsub: true, tx: true},
+		"AUTH":   {fn: auth, arity: -2},
+		"SELECT": {fn: selectDB, arity: 2},
+		"CLIENT": {fn: clientCmd, arity: -2},
+		"TIME":   {fn: timeCmd, arity: 1},
+		// server
+		"DBSIZE":   {fn: dbsize, arity: 1},
+		"FLUSHDB":  {fn: flushdb, arity: -1},
+		"FLUSHALL": {fn: flushall, arity: -1},
+		// transactions
+		"MULTI":   {fn: multi, arity: 1, tx: true},
+		"EXEC":    {fn: execTx, arity: 1, tx: true},
+		"DISCARD": {fn: discard, arity: 1, tx: true},
+		"WATCH":   {fn: watch, arity: -2, tx: true},
+		"UNWATCH": {fn: unwatch, arity: 1},
+		// pub/sub
+		"SUBSCRIBE":    {fn: subscribe, arity: -2, pubsub: true},
+		"UNSUBSCRIBE":  {fn: unsubscribe, arity: -1, pubsub: true},
+		"PSUBSCRIBE":   {fn: psubscribe, arity: -2, pubsub: true},
+		"PUNSUBSCRIBE": {fn: punsubscribe, arity: -1, pubsub: true},
+		"PUBLISH":      {fn: publish, arity: 3},
+	}
+	for _, cmds := range []map[string]*command{keyCommands, stringCommands, hashCommands, listCommands, setCommands, zsetCommands} {
+		for name, cmd := range cmds {
+			commands[name] = cmd
+		}
+	}
+}
+
+// client is the state of a connection.
+type client struct {
+	s  *Server
+	nc net.Conn
+	r  *bufio.Reader
+
+	wmu sync.Mutex
+	w   *bufio.Writer
+
+	// the fields below are guarded by the mutex of the server.
+	selected int // the database selected
+	name     string
+	authed   bool
+	multi    bool
+	dirty    bool // a command failed to queue
+	queued   [][][]byte
+	watched  map[watchKey]uint64
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+type watchKey struct {
+	db  int
+	key string
+}
+
+func newClient(s *Server, nc net.Conn) *client {
+	return &client{
+		s:        s,
+		nc:       nc,
+		r:        bufio.NewReader(nc),
+		w:        bufio.NewWriter(nc),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+}
+
+func (c *client) db() *db {
+	return c.s.dbs[c.selected]
+}
+
+func (c *client) subscribed() bool {
+	return len(c.channels)+len(c.patterns) > 0
+}
+
+// send writes reply to the connection, it is safe with the messages
+// published concurrently.
+func (c *client) send(reply interface{}) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if replies, ok := reply.(multiReply); ok {
+		for _, r := range replies {
+			writeReply(c.w, r)
+		}
+	} else {
+		writeReply(c.w, reply)
+	}
+	c.nc.SetWriteDeadline(time.Now().Add(time.Second))
+	return c.w.Flush()
+}
+
+func ping(c *client, args [][]byte) interface{} {
+	if c.subscribed() {
+		msg := []byte{}
+		if len(args) > 0 {
+			msg = args[0]
+		}
+		return []interface{}{[]byte("pong"), msg}
+	}
+	if len(args) > 0 {
+		return args[0]
+	}
+	return status("PONG")
+}
+
+func echo(c *client, args [][]byte) interface{} {
+	return args[0]
+}
+
+func quit(c *client, args [][]byte) interface{} {
+	return replyOK
+}
+
+func auth(c *client, args [][]byte) interface{} {
+	// AUTH [username] password, the username is ignored.
+	if c.s.Password == "" {
+		return errReply("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	}
+	if string(args[len(args)-1]) != c.s.Password {
+		return errReply("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	c.authed = true
+	return replyOK
+}
+
+func selectDB(c *client, args [][]byte) interface{} {
+	n, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return errNotInteger
+	}
+	if n < 0 || n >= _databases {
+		return errReply("ERR DB index is out of range")
+	}
+	c.selected = n
+	return replyOK
+}
+
+func clientCmd(c *client, args [][]byte) interface{} {
+	switch strings.ToUpper(string(args[0])) {
+	case "SETNAME":
+		if len(args) != 2 {
+			return errWrongArgs("CLIENT|SETNAME")
+		}
+		c.name = string(args[1])
+		return replyOK
+	case "GETNAME":
+		if c.name == "" {
+			return nil
+		}
+		return []byte(c.name)
+	}
+	return errReply("ERR unknown subcommand '" + string(args[0]) + "'")
+}
+
+func timeCmd(c *client, args [][]byte) interface{} {
+	now := c.s.now()
+	return []interface{}{
+		[]byte(strconv.FormatInt(now.Unix(), 10)),
+		[]byte(strconv.FormatInt(int64(now.Nanosecond()/1000), 10)),
+	}
+}
+
+func dbsize(c *client, args [][]byte) interface{} {
+	return int64(len(c.db().keys()))
+}
+
+func flushdb(c *client, args [][]byte) interface{} {
+	c.db().flush()
+	return replyOK
+}
+
+func flushall(c *client, args [][]byte) interface{} {
+	for _, d := range c.s.dbs {
+		d.flush()
+	}
+	return replyOK
+}
+
+func multi(c *client, args [][]byte) interface{} {
+	if c.multi {
+		return errReply("ERR MULTI calls can not be nested")
+	}
+	c.multi = true
+	return replyOK
+}
+
+func execTx(c *client, args [][]byte) interface{} {
+	if !c.multi {
+		return errReply("ERR EXEC without MULTI")
+	}
+	queued, dirty, watched := c.queued, c.dirty, c.watched
+	c.multi, c.dirty, c.queued, c.watched = false, false, nil, nil
+	if dirty {
+		return errReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+	for k, v := range watched {
+		c.s.dbs[k.db].get(k.key)
+		if c.s.dbs[k.db].versions[k.key] != v {
+			return nilArray{}
+		}
+	}
+	replies := make([]interface{}, len(queued))
+	for i, args := range queued {
+		reply := commands[strings.ToUpper(string(args[0]))].fn(c, args[1:])
+		if reply == errBlocked {
+			reply = nilArray{}
+		}
+		replies[i] = reply
+	}
+	return replies
+}
+
+func discard(c *client, args [][]byte) interface{} {
+	if !c.multi {
+		return errReply("ERR DISCARD without MULTI")
+	}
+	c.multi, c.dirty, c.queued, c.watched = false, false, nil, nil
+	return replyOK
+}
+
+func watch(c *client, args [][]byte) interface{} {
+	if c.multi {
+		return errReply("ERR WATCH inside MULTI is not allowed")
+	}
+	if c.watched == nil {
+		c.watched = make(map[watchKey]uint64)
+	}
+	d := c.db()
+	for _, key := range args {
+		d.get(string(key))
+		c.watched[watchKey{db: c.selected, key: string(key)}] = d.versions[string(key)]
+	}
+	return replyOK
+}
+
+func unwatch(c *client, args [][]byte) interface{} {
+	c.watched = nil
+	return replyOK
+}
+
+// sortedKeys returns the sorted keys of a set of names.
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
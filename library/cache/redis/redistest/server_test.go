@@ -0,0 +1,387 @@
+package redistest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache/redis"
+	"github.com/zombie-k/kylin/library/container/pool"
+	xtime "github.com/zombie-k/kylin/library/time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testConfig(s *Server) *redis.Config {
+	return &redis.Config{
+		Config: &pool.Config{
+			Active:      10,
+			Idle:        5,
+			IdleTimeout: xtime.Duration(time.Minute),
+		},
+		Name:         "redistest",
+		Proto:        "tcp",
+		Addr:         s.Addr(),
+		DialTimeout:  xtime.Duration(time.Second),
+		ReadTimeout:  xtime.Duration(2 * time.Second),
+		WriteTimeout: xtime.Duration(time.Second),
+	}
+}
+
+func newTestRedis(t *testing.T) (*Server, *redis.Redis) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, redis.NewRedis(testConfig(s))
+}
+
+func TestServerStrings(t *testing.T) {
+	s, r := newTestRedis(t)
+	defer s.Close()
+	defer r.Close()
+	ctx := context.Background()
+	c := r.Commands()
+
+	assert.Nil(t, c.Set(ctx, "a", "hello", 0))
+	v, err := c.Get(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", v)
+	_, err = c.Get(ctx, "miss")
+	assert.Equal(t, redis.ErrNil, err)
+	ok, err := c.SetNX(ctx, "a", "world", 0)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	n, err := c.Append(ctx, "a", " world")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), n)
+	v, err = c.GetRange(ctx, "a", -5, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, "world", v)
+
+	n, err = c.IncrBy(ctx, "n", 5)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), n)
+	f, err := c.IncrByFloat(ctx, "n", 0.5)
+	assert.Nil(t, err)
+	assert.Equal(t, 5.5, f)
+	_, err = c.Incr(ctx, "n")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, c.MSet(ctx, map[string]string{"b": "1", "c": "2"}))
+	vs, err := c.MGet(ctx, "b", "miss", "c")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("1"), nil, []byte("2")}, vs)
+
+	_, err = c.SetBit(ctx, "bits", 7, 1)
+	assert.Nil(t, err)
+	n, err = c.BitCount(ctx, "bits")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	_, err = c.LPush(ctx, "a", "x")
+	assert.EqualError(t, err, "WRONGTYPE Operation against a key holding the wrong kind of value")
+	assert.Equal(t, []string{"a", "b", "bits", "c", "n"}, s.Keys())
+}
+
+func TestServerCollections(t *testing.T) {
+	s, r := newTestRedis(t)
+	defer s.Close()
+	defer r.Close()
+	ctx := context.Background()
+	c := r.Commands()
+
+	_, err := c.HSetAll(ctx, "h", map[string]int{"x": 1, "y": 2})
+	assert.Nil(t, err)
+	n, err := c.HIncrBy(ctx, "h", "x", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), n)
+	h, err := c.HGetAll(ctx, "h")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"x": "11", "y": "2"}, h)
+
+	_, err = c.RPush(ctx, "l", "a", "b", "c", "b")
+	assert.Nil(t, err)
+	n, err = c.LRem(ctx, "l", -1, "b")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	_, err = c.LInsertAfter(ctx, "l", "a", "z")
+	assert.Nil(t, err)
+	l, err := c.LRange(ctx, "l", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "z", "b", "c"}, l)
+	v, err := c.RPopLPush(ctx, "l", "l")
+	assert.Nil(t, err)
+	assert.Equal(t, "c", v)
+	v, err = c.LIndex(ctx, "l", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "c", v)
+
+	_, err = c.SAdd(ctx, "s1", "a", "b", "c")
+	assert.Nil(t, err)
+	_, err = c.SAdd(ctx, "s2", "b", "c", "d")
+	assert.Nil(t, err)
+	m, err := c.SInter(ctx, "s1", "s2")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "c"}, m)
+	n, err = c.SDiffStore(ctx, "s3", "s1", "s2")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	m, err = c.SMembers(ctx, "s3")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a"}, m)
+
+	_, err = c.ZAdd(ctx, "z", redis.Z{Member: "a", Score: 3}, redis.Z{Member: "b", Score: 1}, redis.Z{Member: "c", Score: 2})
+	assert.Nil(t, err)
+	zs, err := c.ZRangeWithScores(ctx, "z", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []redis.Z{{Member: "b", Score: 1}, {Member: "c", Score: 2}, {Member: "a", Score: 3}}, zs)
+	m, err = c.ZRevRangeByScore(ctx, "z", redis.ZRangeBy{Min: "(1", Max: "+inf"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "c"}, m)
+	n, err = c.ZRank(ctx, "z", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	zs, err = c.ZPopMin(ctx, "z", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []redis.Z{{Member: "b", Score: 1}}, zs)
+
+	// empty collections are removed.
+	_, err = c.SRem(ctx, "s3", "a")
+	assert.Nil(t, err)
+	kind, err := c.Type(ctx, "s3")
+	assert.Nil(t, err)
+	assert.Equal(t, "none", kind)
+}
+
+func TestServerExpire(t *testing.T) {
+	s, r := newTestRedis(t)
+	defer s.Close()
+	defer r.Close()
+	ctx := context.Background()
+	c := r.Commands()
+
+	assert.Nil(t, c.Set(ctx, "a", "v", 10*time.Second))
+	ttl, err := c.TTL(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Second, ttl)
+	s.Advance(5 * time.Second)
+	ttl, err = c.TTL(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, 5*time.Second, ttl)
+	s.Advance(5 * time.Second)
+	_, err = c.Get(ctx, "a")
+	assert.Equal(t, redis.ErrNil, err)
+	assert.Empty(t, s.Keys())
+
+	assert.Nil(t, c.Set(ctx, "b", "v", time.Second))
+	ok, err := c.Persist(ctx, "b")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	s.Advance(time.Hour)
+	assert.Equal(t, []string{"b"}, s.Keys())
+}
+
+func TestServerFaults(t *testing.T) {
+	s, r := newTestRedis(t)
+	defer s.Close()
+	defer r.Close()
+	ctx := context.Background()
+	c := r.Commands()
+
+	s.SetFaults(Faults{Error: "LOADING Redis is loading the dataset in memory", Commands: []string{"get"}})
+	_, err := c.Get(ctx, "a")
+	assert.EqualError(t, err, "LOADING Redis is loading the dataset in memory")
+	assert.Nil(t, c.Set(ctx, "a", "v", 0))
+
+	s.SetFaults(Faults{Latency: 50 * time.Millisecond})
+	start := time.Now()
+	_, err = c.Get(ctx, "a")
+	assert.Nil(t, err)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	s.SetFaults(Faults{Drop: true})
+	_, err = c.Get(ctx, "a")
+	assert.NotNil(t, err)
+
+	s.SetFaults(Faults{})
+	v, err := c.Get(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", v)
+}
+
+func TestServerTx(t *testing.T) {
+	s, r := newTestRedis(t)
+	defer s.Close()
+	defer r.Close()
+	ctx := context.Background()
+
+	rs, err := r.Tx(ctx, []string{"a"}, func(tx *redis.Tx) error {
+		tx.Send("INCR", "a")
+		tx.Send("INCR", "a")
+		return nil
+	})
+	assert.Nil(t, err)
+	n, err := redis.Int64(rs.Scan())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = redis.Int64(rs.Scan())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// another client changes the watched key in every attempt.
+	other := redis.NewRedis(testConfig(s))
+	defer other.Close()
+	_, err = r.Tx(ctx, []string{"a"}, func(tx *redis.Tx) error {
+		if _, err := other.Do(ctx, "INCR", "a"); err != nil {
+			return err
+		}
+		tx.Send("SET", "a", 0)
+		return nil
+	}, redis.TxRetries(1), redis.TxBackoff(time.Millisecond, time.Millisecond))
+	assert.Equal(t, redis.ErrTxConflict, err)
+
+	// an unknown command aborts the transaction.
+	_, err = r.Tx(ctx, nil, func(tx *redis.Tx) error {
+		tx.Send("SET", "a", 0)
+		tx.Send("NOPE")
+		return nil
+	})
+	assert.NotNil(t, err)
+	v, err := r.Commands().Get(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "4", v)
+}
+
+func TestServerPipeline(t *testing.T) {
+	s, r := newTestRedis(t)
+	defer s.Close()
+	defer r.Close()
+	ctx := context.Background()
+
+	p := r.Pipeline()
+	p.Send("SET", "a", "1")
+	p.Send("INCR", "a")
+	p.Send("HGET", "a", "f")
+	p.Send("GET", "a")
+	rs, err := p.Exec(ctx)
+	assert.Nil(t, err)
+	v, err := redis.String(rs.Scan())
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", v)
+	n, err := redis.Int64(rs.Scan())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	_, err = rs.Scan()
+	assert.NotNil(t, err)
+	v, err = redis.String(rs.Scan())
+	assert.Nil(t, err)
+	assert.Equal(t, "2", v)
+}
+
+func TestServerPubSub(t *testing.T) {
+	s, r := newTestRedis(t)
+	defer s.Close()
+	defer r.Close()
+	ctx := context.Background()
+
+	psc := redis.PubSubConn{Conn: r.Conn(ctx)}
+	defer psc.Close()
+	assert.Nil(t, psc.Subscribe("news"))
+	assert.Equal(t, redis.Subscription{Kind: "subscribe", Channel: "news", Count: 1}, psc.Receive())
+	assert.Nil(t, psc.PSubscribe("news.*"))
+	assert.Equal(t, redis.Subscription{Kind: "psubscribe", Channel: "news.*", Count: 2}, psc.Receive())
+	assert.Equal(t, 1, s.Subscribers("news"))
+	assert.Equal(t, 1, s.Subscribers("news.*"))
+	assert.Equal(t, 0, s.Subscribers("other"))
+
+	assert.Equal(t, 1, s.Publish("news", "hello"))
+	assert.Equal(t, redis.Message{Channel: "news", Data: []byte("hello")}, psc.Receive())
+	n, err := redis.Int(r.Do(ctx, "PUBLISH", "news.sport", "goal"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, redis.PMessage{Pattern: "news.*", Channel: "news.sport", Data: []byte("goal")}, psc.Receive())
+
+	assert.Nil(t, psc.Ping("p"))
+	assert.Equal(t, redis.Pong{Data: "p"}, psc.Receive())
+	assert.Nil(t, psc.Unsubscribe())
+	assert.Equal(t, redis.Subscription{Kind: "unsubscribe", Channel: "news", Count: 1}, psc.Receive())
+	assert.Equal(t, 0, s.Publish("news", "bye"))
+	assert.Equal(t, 0, s.Subscribers("news"))
+}
+
+func TestServerBlocking(t *testing.T) {
+	s, r := newTestRedis(t)
+	defer s.Close()
+	defer r.Close()
+	ctx := context.Background()
+	c := r.Commands()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		r.Do(ctx, "RPUSH", "queue", "job")
+	}()
+	key, v, err := c.BLPop(ctx, time.Second, "other", "queue")
+	assert.Nil(t, err)
+	assert.Equal(t, "queue", key)
+	assert.Equal(t, "job", v)
+
+	_, _, err = c.BRPop(ctx, time.Second, "queue")
+	assert.Equal(t, redis.ErrNil, err)
+}
+
+func TestServerConn(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Password = "secret"
+	ctx := context.Background()
+
+	conf := testConfig(s)
+	r := redis.NewRedis(conf)
+	_, err = r.Do(ctx, "GET", "a")
+	assert.EqualError(t, err, "NOAUTH Authentication required.")
+	r.Close()
+
+	conf.Auth, conf.Db = "secret", 1
+	r = redis.NewRedis(conf)
+	defer r.Close()
+	_, err = r.Do(ctx, "SET", "a", "1")
+	assert.Nil(t, err)
+	assert.Empty(t, s.Keys())
+	n, err := redis.Int(r.Do(ctx, "DBSIZE"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	for i := 0; i < 25; i++ {
+		_, err = r.Do(ctx, "SADD", "set", i)
+		assert.Nil(t, err)
+	}
+	var (
+		cursor  int64
+		members []string
+	)
+	for {
+		values, err := redis.Values(r.Do(ctx, "SSCAN", "set", cursor, "MATCH", "1*"))
+		assert.Nil(t, err)
+		cursor, _ = redis.Int64(values[0], nil)
+		page, _ := redis.Strings(values[1], nil)
+		members = append(members, page...)
+		if cursor == 0 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"1", "10", "11", "12", "13", "14", "15", "16", "17", "18", "19"}, members)
+	values, err := redis.Values(r.Do(ctx, "SCAN", 0, "TYPE", "string"))
+	assert.Nil(t, err)
+	keys, _ := redis.Strings(values[1], nil)
+	assert.Equal(t, []string{"a"}, keys)
+
+	s.CloseConns()
+	_, err = r.Do(ctx, "PING")
+	assert.NotNil(t, err)
+	_, err = r.Do(ctx, "PING")
+	assert.Nil(t, err)
+}
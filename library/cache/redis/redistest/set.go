@@ -0,0 +1,298 @@
+package redistest
+
+import (
+	"math/rand"
+	"sort"
+)
+
+var setCommands = map[string]*command{
+	"SADD":        {fn: sadd, arity: -3},
+	"SREM":        {fn: srem, arity: -3},
+	"SMEMBERS":    {fn: smembers, arity: 2},
+	"SISMEMBER":   {fn: sismember, arity: 3},
+	"SCARD":       {fn: scard, arity: 2},
+	"SPOP":        {fn: spop, arity: -2},
+	"SRANDMEMBER": {fn: srandmember, arity: -2},
+	"SMOVE":       {fn: smove, arity: 4},
+	"SINTER":      {fn: setOp(inter, false), arity: -2},
+	"SUNION":      {fn: setOp(union, false), arity: -2},
+	"SDIFF":       {fn: setOp(diff, false), arity: -2},
+	"SINTERSTORE": {fn: setOp(inter, true), arity: -3},
+	"SUNIONSTORE": {fn: setOp(union, true), arity: -3},
+	"SDIFFSTORE":  {fn: setOp(diff, true), arity: -3},
+	"SSCAN":       {fn: sscan, arity: -3},
+}
+
+func (s set) members() []string {
+	members := make([]string, 0, len(s))
+	for m := range s {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members
+}
+
+func bulks(names []string) []interface{} {
+	values := make([]interface{}, len(names))
+	for i, name := range names {
+		values[i] = []byte(name)
+	}
+	return values
+}
+
+func sadd(c *client, args [][]byte) interface{} {
+	d, key := c.db(), string(args[0])
+	s, err := d.getSet(key, true)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for _, m := range args[1:] {
+		if _, ok := s[string(m)]; !ok {
+			s[string(m)] = struct{}{}
+			n++
+		}
+	}
+	d.changed(key)
+	return n
+}
+
+func srem(c *client, args [][]byte) interface{} {
+	d, key := c.db(), string(args[0])
+	s, err := d.getSet(key, false)
+	if err != nil || s == nil {
+		return orZero(err)
+	}
+	var n int64
+	for _, m := range args[1:] {
+		if _, ok := s[string(m)]; ok {
+			delete(s, string(m))
+			n++
+		}
+	}
+	if n > 0 {
+		d.changed(key)
+	}
+	return n
+}
+
+func smembers(c *client, args [][]byte) interface{} {
+	s, err := c.db().getSet(string(args[0]), false)
+	if err != nil {
+		return err
+	}
+	return bulks(s.members())
+}
+
+func sismember(c *client, args [][]byte) interface{} {
+	s, err := c.db().getSet(string(args[0]), false)
+	if err != nil {
+		return err
+	}
+	if _, ok := s[string(args[1])]; ok {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+func scard(c *client, args [][]byte) interface{} {
+	s, err := c.db().getSet(string(args[0]), false)
+	if err != nil {
+		return err
+	}
+	return int64(len(s))
+}
+
+// random returns count random members of s, distinct unless dup.
+func (s set) random(count int, dup bool) []string {
+	members := s.members()
+	if len(members) == 0 {
+		return nil
+	}
+	if dup {
+		picked := make([]string, count)
+		for i := range picked {
+			picked[i] = members[rand.Intn(len(members))]
+		}
+		return picked
+	}
+	rand.Shuffle(len(members), func(i, j int) { members[i], members[j] = members[j], members[i] })
+	if count < len(members) {
+		members = members[:count]
+	}
+	return members
+}
+
+// spop executes SPOP key [count].
+func spop(c *client, args [][]byte) interface{} {
+	if len(args) > 2 {
+		return errSyntax
+	}
+	count := int64(1)
+	if len(args) == 2 {
+		var ok bool
+		if count, ok = parseInt(args[1]); !ok || count < 0 {
+			return errReply("ERR value is out of range, must be positive")
+		}
+	}
+	d, key := c.db(), string(args[0])
+	s, err := d.getSet(key, false)
+	if err != nil {
+		return err
+	}
+	popped := s.random(int(count), false)
+	for _, m := range popped {
+		delete(s, m)
+	}
+	if len(popped) > 0 {
+		d.changed(key)
+	}
+	if len(args) == 2 {
+		return bulks(popped)
+	}
+	if len(popped) == 0 {
+		return nil
+	}
+	return []byte(popped[0])
+}
+
+// srandmember executes SRANDMEMBER key [count], a negative count allows
+// the same member several times.
+func srandmember(c *client, args [][]byte) interface{} {
+	if len(args) > 2 {
+		return errSyntax
+	}
+	count := int64(1)
+	if len(args) == 2 {
+		var ok bool
+		if count, ok = parseInt(args[1]); !ok {
+			return errNotInteger
+		}
+	}
+	s, err := c.db().getSet(string(args[0]), false)
+	if err != nil {
+		return err
+	}
+	var picked []string
+	if count < 0 {
+		picked = s.random(int(-count), true)
+	} else {
+		picked = s.random(int(count), false)
+	}
+	if len(args) == 2 {
+		return bulks(picked)
+	}
+	if len(picked) == 0 {
+		return nil
+	}
+	return []byte(picked[0])
+}
+
+func smove(c *client, args [][]byte) interface{} {
+	d, src, dst, m := c.db(), string(args[0]), string(args[1]), string(args[2])
+	from, err := d.getSet(src, false)
+	if err != nil {
+		return err
+	}
+	if _, err = d.getSet(dst, false); err != nil {
+		return err
+	}
+	if _, ok := from[m]; !ok {
+		return int64(0)
+	}
+	delete(from, m)
+	d.changed(src)
+	to, _ := d.getSet(dst, true)
+	to[m] = struct{}{}
+	d.changed(dst)
+	return int64(1)
+}
+
+func inter(sets []set) set {
+	result := make(set)
+	if len(sets) == 0 {
+		return result
+	}
+next:
+	for m := range sets[0] {
+		for _, s := range sets[1:] {
+			if _, ok := s[m]; !ok {
+				continue next
+			}
+		}
+		result[m] = struct{}{}
+	}
+	return result
+}
+
+func union(sets []set) set {
+	result := make(set)
+	for _, s := range sets {
+		for m := range s {
+			result[m] = struct{}{}
+		}
+	}
+	return result
+}
+
+func diff(sets []set) set {
+	result := make(set)
+	if len(sets) == 0 {
+		return result
+	}
+	for m := range sets[0] {
+		result[m] = struct{}{}
+	}
+	for _, s := range sets[1:] {
+		for m := range s {
+			delete(result, m)
+		}
+	}
+	return result
+}
+
+// setOp executes SINTER, SUNION, SDIFF and, storing the result in the
+// first key, their STORE variants.
+func setOp(op func([]set) set, store bool) func(c *client, args [][]byte) interface{} {
+	return func(c *client, args [][]byte) interface{} {
+		d, keys := c.db(), args
+		if store {
+			keys = args[1:]
+		}
+		sets := make([]set, len(keys))
+		for i, key := range keys {
+			s, err := d.getSet(string(key), false)
+			if err != nil {
+				return err
+			}
+			sets[i] = s
+		}
+		result := op(sets)
+		if !store {
+			return bulks(result.members())
+		}
+		dst := string(args[0])
+		d.del(dst)
+		if len(result) > 0 {
+			d.set(dst, result)
+		}
+		return int64(len(result))
+	}
+}
+
+func sscan(c *client, args [][]byte) interface{} {
+	s, err := c.db().getSet(string(args[0]), false)
+	if err != nil {
+		return err
+	}
+	cursor, pattern, count, _, err := scanArgs(args[1:], false)
+	if err != nil {
+		return err
+	}
+	return scanReply(s.members(), cursor, count, func(m string) []interface{} {
+		if !match(pattern, m) {
+			return nil
+		}
+		return []interface{}{[]byte(m)}
+	})
+}
@@ -0,0 +1,397 @@
+package redistest
+
+import (
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var stringCommands = map[string]*command{
+	"GET":         {fn: get, arity: 2},
+	"GETDEL":      {fn: getdel, arity: 2},
+	"SET":         {fn: setCmd, arity: -3},
+	"SETNX":       {fn: setnx, arity: 3},
+	"SETEX":       {fn: setex(time.Second), arity: 4},
+	"PSETEX":      {fn: setex(time.Millisecond), arity: 4},
+	"GETSET":      {fn: getset, arity: 3},
+	"MGET":        {fn: mget, arity: -2},
+	"MSET":        {fn: mset, arity: -3},
+	"MSETNX":      {fn: msetnx, arity: -3},
+	"INCR":        {fn: incrBy(1, false), arity: 2},
+	"DECR":        {fn: incrBy(-1, false), arity: 2},
+	"INCRBY":      {fn: incrBy(1, true), arity: 3},
+	"DECRBY":      {fn: incrBy(-1, true), arity: 3},
+	"INCRBYFLOAT": {fn: incrByFloat, arity: 3},
+	"APPEND":      {fn: appendCmd, arity: 3},
+	"STRLEN":      {fn: strlen, arity: 2},
+	"GETRANGE":    {fn: getrange, arity: 4},
+	"SETRANGE":    {fn: setrange, arity: 4},
+	"SETBIT":      {fn: setbit, arity: 4},
+	"GETBIT":      {fn: getbit, arity: 3},
+	"BITCOUNT":    {fn: bitcount, arity: -2},
+}
+
+func get(c *client, args [][]byte) interface{} {
+	b, err := c.db().getString(string(args[0]))
+	if err != nil {
+		return err
+	}
+	if b == nil {
+		return nil
+	}
+	return b
+}
+
+func getdel(c *client, args [][]byte) interface{} {
+	reply := get(c, args)
+	if _, ok := reply.([]byte); ok {
+		c.db().del(string(args[0]))
+	}
+	return reply
+}
+
+// setCmd executes SET key value [EX s|PX ms] [NX|XX] [KEEPTTL] [GET].
+func setCmd(c *client, args [][]byte) interface{} {
+	d, key := c.db(), string(args[0])
+	var (
+		ttl              time.Duration
+		nx, xx, keep, gt bool
+	)
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); opt {
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			n, ok := parseInt(args[i+1])
+			if !ok {
+				return errNotInteger
+			}
+			if n <= 0 {
+				return errReply("ERR invalid expire time in 'set' command")
+			}
+			if ttl = time.Duration(n) * time.Millisecond; opt == "EX" {
+				ttl = time.Duration(n) * time.Second
+			}
+			i++
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keep = true
+		case "GET":
+			gt = true
+		default:
+			return errSyntax
+		}
+	}
+	if nx && xx || keep && ttl > 0 {
+		return errSyntax
+	}
+	old, err := d.getString(key)
+	if err != nil && gt {
+		return err
+	}
+	_, exists := d.get(key)
+	if nx && exists || xx && !exists {
+		if gt && old != nil {
+			return old
+		}
+		return nil
+	}
+	exp, hasTTL := d.expires[key]
+	d.set(key, args[1])
+	if ttl > 0 {
+		d.expires[key] = d.s.now().Add(ttl)
+	} else if keep && hasTTL {
+		d.expires[key] = exp
+	}
+	if gt {
+		if old == nil {
+			return nil
+		}
+		return old
+	}
+	return replyOK
+}
+
+func setnx(c *client, args [][]byte) interface{} {
+	if _, ok := c.db().get(string(args[0])); ok {
+		return int64(0)
+	}
+	c.db().set(string(args[0]), args[1])
+	return int64(1)
+}
+
+func setex(unit time.Duration) func(c *client, args [][]byte) interface{} {
+	return func(c *client, args [][]byte) interface{} {
+		n, ok := parseInt(args[1])
+		if !ok {
+			return errNotInteger
+		}
+		if n <= 0 {
+			return errReply("ERR invalid expire time in 'setex' command")
+		}
+		d, key := c.db(), string(args[0])
+		d.set(key, args[2])
+		d.expires[key] = d.s.now().Add(time.Duration(n) * unit)
+		return replyOK
+	}
+}
+
+func getset(c *client, args [][]byte) interface{} {
+	old, err := c.db().getString(string(args[0]))
+	if err != nil {
+		return err
+	}
+	c.db().set(string(args[0]), args[1])
+	if old == nil {
+		return nil
+	}
+	return old
+}
+
+func mget(c *client, args [][]byte) interface{} {
+	values := make([]interface{}, len(args))
+	for i, key := range args {
+		// the values of the other types are nil.
+		if b, _ := c.db().getString(string(key)); b != nil {
+			values[i] = b
+		}
+	}
+	return values
+}
+
+func mset(c *client, args [][]byte) interface{} {
+	if len(args)%2 != 0 {
+		return errWrongArgs("MSET")
+	}
+	for i := 0; i < len(args); i += 2 {
+		c.db().set(string(args[i]), args[i+1])
+	}
+	return replyOK
+}
+
+func msetnx(c *client, args [][]byte) interface{} {
+	if len(args)%2 != 0 {
+		return errWrongArgs("MSETNX")
+	}
+	for i := 0; i < len(args); i += 2 {
+		if _, ok := c.db().get(string(args[i])); ok {
+			return int64(0)
+		}
+	}
+	mset(c, args)
+	return int64(1)
+}
+
+// update sets the value of key keeping its TTL.
+func update(d *db, key string, value []byte) {
+	exp, hasTTL := d.expires[key]
+	d.set(key, value)
+	if hasTTL {
+		d.expires[key] = exp
+	}
+}
+
+func incrBy(sign int64, arg bool) func(c *client, args [][]byte) interface{} {
+	return func(c *client, args [][]byte) interface{} {
+		delta := int64(1)
+		if arg {
+			var ok bool
+			if delta, ok = parseInt(args[1]); !ok {
+				return errNotInteger
+			}
+		}
+		d, key := c.db(), string(args[0])
+		b, err := d.getString(key)
+		if err != nil {
+			return err
+		}
+		var n int64
+		if b != nil {
+			var ok bool
+			if n, ok = parseInt(b); !ok {
+				return errNotInteger
+			}
+		}
+		sum := n + sign*delta
+		if (sign*delta > 0 && sum < n) || (sign*delta < 0 && sum > n) {
+			return errReply("ERR increment or decrement would overflow")
+		}
+		update(d, key, []byte(strconv.FormatInt(sum, 10)))
+		return sum
+	}
+}
+
+func incrByFloat(c *client, args [][]byte) interface{} {
+	delta, ok := parseFloat(args[1])
+	if !ok {
+		return errNotFloat
+	}
+	d, key := c.db(), string(args[0])
+	b, err := d.getString(key)
+	if err != nil {
+		return err
+	}
+	var f float64
+	if b != nil {
+		if f, ok = parseFloat(b); !ok {
+			return errNotFloat
+		}
+	}
+	value := formatFloat(f + delta)
+	update(d, key, value)
+	return value
+}
+
+func appendCmd(c *client, args [][]byte) interface{} {
+	d, key := c.db(), string(args[0])
+	b, err := d.getString(key)
+	if err != nil {
+		return err
+	}
+	value := append(append([]byte{}, b...), args[1]...)
+	update(d, key, value)
+	return int64(len(value))
+}
+
+func strlen(c *client, args [][]byte) interface{} {
+	b, err := c.db().getString(string(args[0]))
+	if err != nil {
+		return err
+	}
+	return int64(len(b))
+}
+
+// rangeIndexes converts the inclusive indexes start and end, negative from
+// the end, to a slice range of n elements, empty if lo >= hi.
+func rangeIndexes(start, end int64, n int) (lo, hi int) {
+	if start < 0 {
+		start += int64(n)
+	}
+	if end < 0 {
+		end += int64(n)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= int64(n) {
+		end = int64(n) - 1
+	}
+	if start > end {
+		return 0, 0
+	}
+	return int(start), int(end) + 1
+}
+
+func getrange(c *client, args [][]byte) interface{} {
+	start, ok1 := parseInt(args[1])
+	end, ok2 := parseInt(args[2])
+	if !ok1 || !ok2 {
+		return errNotInteger
+	}
+	b, err := c.db().getString(string(args[0]))
+	if err != nil {
+		return err
+	}
+	lo, hi := rangeIndexes(start, end, len(b))
+	return append([]byte{}, b[lo:hi]...)
+}
+
+func setrange(c *client, args [][]byte) interface{} {
+	offset, ok := parseInt(args[1])
+	if !ok || offset < 0 {
+		return errOutOfRange
+	}
+	d, key := c.db(), string(args[0])
+	b, err := d.getString(key)
+	if err != nil {
+		return err
+	}
+	if len(args[2]) == 0 {
+		return int64(len(b))
+	}
+	value := append([]byte{}, b...)
+	if need := int(offset) + len(args[2]); need > len(value) {
+		value = append(value, make([]byte, need-len(value))...)
+	}
+	copy(value[offset:], args[2])
+	update(d, key, value)
+	return int64(len(value))
+}
+
+func setbit(c *client, args [][]byte) interface{} {
+	offset, ok := parseInt(args[1])
+	if !ok || offset < 0 {
+		return errReply("ERR bit offset is not an integer or out of range")
+	}
+	bit := string(args[2])
+	if bit != "0" && bit != "1" {
+		return errReply("ERR bit is not an integer or out of range")
+	}
+	d, key := c.db(), string(args[0])
+	b, err := d.getString(key)
+	if err != nil {
+		return err
+	}
+	value := append([]byte{}, b...)
+	if need := int(offset/8) + 1; need > len(value) {
+		value = append(value, make([]byte, need-len(value))...)
+	}
+	mask := byte(0x80) >> uint(offset%8)
+	old := int64(0)
+	if value[offset/8]&mask != 0 {
+		old = 1
+	}
+	if bit == "1" {
+		value[offset/8] |= mask
+	} else {
+		value[offset/8] &^= mask
+	}
+	update(d, key, value)
+	return old
+}
+
+func getbit(c *client, args [][]byte) interface{} {
+	offset, ok := parseInt(args[1])
+	if !ok || offset < 0 {
+		return errReply("ERR bit offset is not an integer or out of range")
+	}
+	b, err := c.db().getString(string(args[0]))
+	if err != nil {
+		return err
+	}
+	if int(offset/8) >= len(b) || b[offset/8]&(byte(0x80)>>uint(offset%8)) == 0 {
+		return int64(0)
+	}
+	return int64(1)
+}
+
+// bitcount executes BITCOUNT key [start end], the range is of bytes.
+func bitcount(c *client, args [][]byte) interface{} {
+	b, err := c.db().getString(string(args[0]))
+	if err != nil {
+		return err
+	}
+	switch len(args) {
+	case 1:
+	case 3:
+		start, ok1 := parseInt(args[1])
+		end, ok2 := parseInt(args[2])
+		if !ok1 || !ok2 {
+			return errNotInteger
+		}
+		lo, hi := rangeIndexes(start, end, len(b))
+		b = b[lo:hi]
+	default:
+		return errSyntax
+	}
+	var n int64
+	for _, x := range b {
+		n += int64(bits.OnesCount8(x))
+	}
+	return n
+}
@@ -0,0 +1,421 @@
+package redistest
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+var zsetCommands = map[string]*command{
+	"ZADD":             {fn: zadd, arity: -4},
+	"ZINCRBY":          {fn: zincrby, arity: 4},
+	"ZSCORE":           {fn: zscore, arity: 3},
+	"ZREM":             {fn: zrem, arity: -3},
+	"ZCARD":            {fn: zcard, arity: 2},
+	"ZCOUNT":           {fn: zcount, arity: 4},
+	"ZRANK":            {fn: zrank(false), arity: 3},
+	"ZREVRANK":         {fn: zrank(true), arity: 3},
+	"ZRANGE":           {fn: zrange(false), arity: -4},
+	"ZREVRANGE":        {fn: zrange(true), arity: -4},
+	"ZRANGEBYSCORE":    {fn: zrangebyscore(false), arity: -4},
+	"ZREVRANGEBYSCORE": {fn: zrangebyscore(true), arity: -4},
+	"ZREMRANGEBYRANK":  {fn: zremrangebyrank, arity: 4},
+	"ZREMRANGEBYSCORE": {fn: zremrangebyscore, arity: 4},
+	"ZPOPMIN":          {fn: zpop(false), arity: -2},
+	"ZPOPMAX":          {fn: zpop(true), arity: -2},
+	"ZSCAN":            {fn: zscan, arity: -3},
+}
+
+// members returns the members of z ordered by score, then by member.
+func (z zset) members() []string {
+	members := make([]string, 0, len(z))
+	for m := range z {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if si, sj := z[members[i]], z[members[j]]; si != sj {
+			return si < sj
+		}
+		return members[i] < members[j]
+	})
+	return members
+}
+
+// reply replies members, with their scores if withScores.
+func (z zset) reply(members []string, withScores bool) []interface{} {
+	values := []interface{}{}
+	for _, m := range members {
+		values = append(values, []byte(m))
+		if withScores {
+			values = append(values, z[m])
+		}
+	}
+	return values
+}
+
+// zadd executes ZADD key [NX|XX] [CH] [INCR] score member [score member ...].
+func zadd(c *client, args [][]byte) interface{} {
+	var nx, xx, ch, incr bool
+	i := 1
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			goto pairs
+		}
+	}
+pairs:
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 || nx && xx {
+		return errSyntax
+	}
+	if incr && len(pairs) != 2 {
+		return errReply("ERR INCR option supports a single increment-element pair")
+	}
+	scores := make([]float64, len(pairs)/2)
+	for j := range scores {
+		f, ok := parseFloat(pairs[2*j])
+		if !ok {
+			return errNotFloat
+		}
+		scores[j] = f
+	}
+	d, key := c.db(), string(args[0])
+	z, err := d.getZSet(key, !xx)
+	if err != nil {
+		return err
+	}
+	if z == nil {
+		if incr {
+			return nil
+		}
+		return int64(0)
+	}
+	var added, changed int64
+	var result interface{}
+	for j, score := range scores {
+		m := string(pairs[2*j+1])
+		old, exists := z[m]
+		if nx && exists || xx && !exists {
+			continue
+		}
+		if incr {
+			score += old
+			result = score
+		}
+		if !exists {
+			added++
+		} else if old != score {
+			changed++
+		}
+		z[m] = score
+	}
+	d.changed(key)
+	if incr {
+		return result
+	}
+	if ch {
+		return added + changed
+	}
+	return added
+}
+
+func zincrby(c *client, args [][]byte) interface{} {
+	return zadd(c, [][]byte{args[0], []byte("INCR"), args[1], args[2]})
+}
+
+func zscore(c *client, args [][]byte) interface{} {
+	z, err := c.db().getZSet(string(args[0]), false)
+	if err != nil {
+		return err
+	}
+	if score, ok := z[string(args[1])]; ok {
+		return score
+	}
+	return nil
+}
+
+func zrem(c *client, args [][]byte) interface{} {
+	d, key := c.db(), string(args[0])
+	z, err := d.getZSet(key, false)
+	if err != nil || z == nil {
+		return orZero(err)
+	}
+	var n int64
+	for _, m := range args[1:] {
+		if _, ok := z[string(m)]; ok {
+			delete(z, string(m))
+			n++
+		}
+	}
+	if n > 0 {
+		d.changed(key)
+	}
+	return n
+}
+
+func zcard(c *client, args [][]byte) interface{} {
+	z, err := c.db().getZSet(string(args[0]), false)
+	if err != nil {
+		return err
+	}
+	return int64(len(z))
+}
+
+// scoreRange is a range of scores, a bound prefixed with "(" is exclusive.
+type scoreRange struct {
+	min, max       float64
+	minExc, maxExc bool
+}
+
+func parseScoreRange(min, max []byte) (r scoreRange, ok bool) {
+	if r.min, r.minExc, ok = parseBound(min); !ok {
+		return
+	}
+	r.max, r.maxExc, ok = parseBound(max)
+	return
+}
+
+func parseBound(b []byte) (float64, bool, bool) {
+	exc := len(b) > 0 && b[0] == '('
+	if exc {
+		b = b[1:]
+	}
+	f, ok := parseFloat(b)
+	return f, exc, ok && !math.IsNaN(f)
+}
+
+func (r scoreRange) contains(score float64) bool {
+	if score < r.min || r.minExc && score == r.min {
+		return false
+	}
+	return score < r.max || !r.maxExc && score == r.max
+}
+
+// inRange returns the members of z in r ordered by score.
+func (z zset) inRange(r scoreRange) []string {
+	var members []string
+	for _, m := range z.members() {
+		if r.contains(z[m]) {
+			members = append(members, m)
+		}
+	}
+	return members
+}
+
+func zcount(c *client, args [][]byte) interface{} {
+	r, ok := parseScoreRange(args[1], args[2])
+	if !ok {
+		return errMinMaxFloat
+	}
+	z, err := c.db().getZSet(string(args[0]), false)
+	if err != nil {
+		return err
+	}
+	return int64(len(z.inRange(r)))
+}
+
+func zrank(rev bool) func(c *client, args [][]byte) interface{} {
+	return func(c *client, args [][]byte) interface{} {
+		z, err := c.db().getZSet(string(args[0]), false)
+		if err != nil {
+			return err
+		}
+		if _, ok := z[string(args[1])]; !ok {
+			return nil
+		}
+		members := z.members()
+		for i, m := range members {
+			if m == string(args[1]) {
+				if rev {
+					i = len(members) - 1 - i
+				}
+				return int64(i)
+			}
+		}
+		return nil
+	}
+}
+
+func reverse(members []string) {
+	for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+		members[i], members[j] = members[j], members[i]
+	}
+}
+
+// zrange executes ZRANGE|ZREVRANGE key start stop [WITHSCORES].
+func zrange(rev bool) func(c *client, args [][]byte) interface{} {
+	return func(c *client, args [][]byte) interface{} {
+		start, ok1 := parseInt(args[1])
+		stop, ok2 := parseInt(args[2])
+		if !ok1 || !ok2 {
+			return errNotInteger
+		}
+		withScores := false
+		switch {
+		case len(args) == 4 && strings.EqualFold(string(args[3]), "WITHSCORES"):
+			withScores = true
+		case len(args) > 3:
+			return errSyntax
+		}
+		z, err := c.db().getZSet(string(args[0]), false)
+		if err != nil {
+			return err
+		}
+		members := z.members()
+		if rev {
+			reverse(members)
+		}
+		lo, hi := rangeIndexes(start, stop, len(members))
+		return z.reply(members[lo:hi], withScores)
+	}
+}
+
+// zrangebyscore executes ZRANGEBYSCORE key min max [WITHSCORES]
+// [LIMIT offset count], ZREVRANGEBYSCORE takes max before min.
+func zrangebyscore(rev bool) func(c *client, args [][]byte) interface{} {
+	return func(c *client, args [][]byte) interface{} {
+		min, max := args[1], args[2]
+		if rev {
+			min, max = max, min
+		}
+		r, ok := parseScoreRange(min, max)
+		if !ok {
+			return errMinMaxFloat
+		}
+		withScores, offset, count := false, int64(0), int64(-1)
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(string(args[i])) {
+			case "WITHSCORES":
+				withScores = true
+			case "LIMIT":
+				if i+2 >= len(args) {
+					return errSyntax
+				}
+				var ok1, ok2 bool
+				offset, ok1 = parseInt(args[i+1])
+				count, ok2 = parseInt(args[i+2])
+				if !ok1 || !ok2 {
+					return errNotInteger
+				}
+				i += 2
+			default:
+				return errSyntax
+			}
+		}
+		z, err := c.db().getZSet(string(args[0]), false)
+		if err != nil {
+			return err
+		}
+		members := z.inRange(r)
+		if rev {
+			reverse(members)
+		}
+		if offset < 0 || offset >= int64(len(members)) {
+			return []interface{}{}
+		}
+		members = members[offset:]
+		if count >= 0 && count < int64(len(members)) {
+			members = members[:count]
+		}
+		return z.reply(members, withScores)
+	}
+}
+
+// remove removes members of the zset of key.
+func (z zset) remove(d *db, key string, members []string) int64 {
+	for _, m := range members {
+		delete(z, m)
+	}
+	if len(members) > 0 {
+		d.changed(key)
+	}
+	return int64(len(members))
+}
+
+func zremrangebyrank(c *client, args [][]byte) interface{} {
+	start, ok1 := parseInt(args[1])
+	stop, ok2 := parseInt(args[2])
+	if !ok1 || !ok2 {
+		return errNotInteger
+	}
+	d, key := c.db(), string(args[0])
+	z, err := d.getZSet(key, false)
+	if err != nil {
+		return err
+	}
+	members := z.members()
+	lo, hi := rangeIndexes(start, stop, len(members))
+	return z.remove(d, key, members[lo:hi])
+}
+
+func zremrangebyscore(c *client, args [][]byte) interface{} {
+	r, ok := parseScoreRange(args[1], args[2])
+	if !ok {
+		return errMinMaxFloat
+	}
+	d, key := c.db(), string(args[0])
+	z, err := d.getZSet(key, false)
+	if err != nil {
+		return err
+	}
+	return z.remove(d, key, z.inRange(r))
+}
+
+// zpop executes ZPOPMIN|ZPOPMAX key [count].
+func zpop(max bool) func(c *client, args [][]byte) interface{} {
+	return func(c *client, args [][]byte) interface{} {
+		if len(args) > 2 {
+			return errSyntax
+		}
+		count := int64(1)
+		if len(args) == 2 {
+			var ok bool
+			if count, ok = parseInt(args[1]); !ok {
+				return errNotInteger
+			}
+		}
+		d, key := c.db(), string(args[0])
+		z, err := d.getZSet(key, false)
+		if err != nil {
+			return err
+		}
+		members := z.members()
+		if max {
+			reverse(members)
+		}
+		if count < 0 {
+			count = 0
+		}
+		if count < int64(len(members)) {
+			members = members[:count]
+		}
+		reply := z.reply(members, true)
+		z.remove(d, key, members)
+		return reply
+	}
+}
+
+func zscan(c *client, args [][]byte) interface{} {
+	z, err := c.db().getZSet(string(args[0]), false)
+	if err != nil {
+		return err
+	}
+	cursor, pattern, count, _, err := scanArgs(args[1:], false)
+	if err != nil {
+		return err
+	}
+	return scanReply(z.members(), cursor, count, func(m string) []interface{} {
+		if !match(pattern, m) {
+			return nil
+		}
+		return []interface{}{[]byte(m), z[m]}
+	})
+}
@@ -16,6 +16,7 @@ package redis
 
 import (
 	"errors"
+	"math/big"
 	"strconv"
 
 	pkgerr "github.com/pkg/errors"
@@ -30,6 +31,7 @@ var ErrNil = errors.New("redigo: nil returned")
 //
 //  Reply type    Result
 //  integer       int(reply), nil
+//  big number    int(reply), nil
 //  bulk string   parsed reply, nil
 //  nil           0, ErrNil
 //  other         0, error
@@ -44,6 +46,12 @@ func Int(reply interface{}, err error) (int, error) {
 			return 0, pkgerr.WithStack(strconv.ErrRange)
 		}
 		return x, nil
+	case *big.Int:
+		x := int(reply.Int64())
+		if !reply.IsInt64() || int64(x) != reply.Int64() {
+			return 0, pkgerr.WithStack(strconv.ErrRange)
+		}
+		return x, nil
 	case []byte:
 		n, err := strconv.ParseInt(string(reply), 10, 0)
 		return int(n), pkgerr.WithStack(err)
@@ -61,6 +69,7 @@ func Int(reply interface{}, err error) (int, error) {
 //
 //  Reply type    Result
 //  integer       reply, nil
+//  big number    reply.Int64(), nil
 //  bulk string   parsed reply, nil
 //  nil           0, ErrNil
 //  other         0, error
@@ -71,6 +80,11 @@ func Int64(reply interface{}, err error) (int64, error) {
 	switch reply := reply.(type) {
 	case int64:
 		return reply, nil
+	case *big.Int:
+		if !reply.IsInt64() {
+			return 0, pkgerr.WithStack(strconv.ErrRange)
+		}
+		return reply.Int64(), nil
 	case []byte:
 		n, err := strconv.ParseInt(string(reply), 10, 64)
 		return n, pkgerr.WithStack(err)
@@ -90,6 +104,7 @@ var errNegativeInt = errors.New("redigo: unexpected value for Uint64")
 //
 //  Reply type    Result
 //  integer       reply, nil
+//  big number    reply.Uint64(), nil
 //  bulk string   parsed reply, nil
 //  nil           0, ErrNil
 //  other         0, error
@@ -103,6 +118,14 @@ func Uint64(reply interface{}, err error) (uint64, error) {
 			return 0, pkgerr.WithStack(errNegativeInt)
 		}
 		return uint64(reply), nil
+	case *big.Int:
+		if reply.Sign() < 0 {
+			return 0, pkgerr.WithStack(errNegativeInt)
+		}
+		if !reply.IsUint64() {
+			return 0, pkgerr.WithStack(strconv.ErrRange)
+		}
+		return reply.Uint64(), nil
 	case []byte:
 		n, err := strconv.ParseUint(string(reply), 10, 64)
 		return n, err
@@ -119,6 +142,8 @@ func Uint64(reply interface{}, err error) (uint64, error) {
 // the reply to an int as follows:
 //
 //  Reply type    Result
+//  double        reply, nil
+//  integer       float64(reply), nil
 //  bulk string   parsed reply, nil
 //  nil           0, ErrNil
 //  other         0, error
@@ -127,6 +152,10 @@ func Float64(reply interface{}, err error) (float64, error) {
 		return 0, err
 	}
 	switch reply := reply.(type) {
+	case float64:
+		return reply, nil
+	case int64:
+		return float64(reply), nil
 	case []byte:
 		n, err := strconv.ParseFloat(string(reply), 64)
 		return n, pkgerr.WithStack(err)
@@ -145,6 +174,8 @@ func Float64(reply interface{}, err error) (float64, error) {
 //  Reply type      Result
 //  bulk string     string(reply), nil
 //  simple string   reply, nil
+//  double          formatted reply, nil
+//  big number      reply.String(), nil
 //  nil             "",  ErrNil
 //  other           "",  error
 func String(reply interface{}, err error) (string, error) {
@@ -156,6 +187,10 @@ func String(reply interface{}, err error) (string, error) {
 		return string(reply), nil
 	case string:
 		return reply, nil
+	case float64:
+		return strconv.FormatFloat(reply, 'g', -1, 64), nil
+	case *big.Int:
+		return reply.String(), nil
 	case nil:
 		return "", ErrNil
 	case Error:
@@ -171,6 +206,8 @@ func String(reply interface{}, err error) (string, error) {
 //  Reply type      Result
 //  bulk string     reply, nil
 //  simple string   []byte(reply), nil
+//  double          formatted reply, nil
+//  big number      []byte(reply.String()), nil
 //  nil             nil, ErrNil
 //  other           nil, error
 func Bytes(reply interface{}, err error) ([]byte, error) {
@@ -182,6 +219,10 @@ func Bytes(reply interface{}, err error) ([]byte, error) {
 		return reply, nil
 	case string:
 		return []byte(reply), nil
+	case float64:
+		return strconv.AppendFloat(nil, reply, 'g', -1, 64), nil
+	case *big.Int:
+		return []byte(reply.String()), nil
 	case nil:
 		return nil, ErrNil
 	case Error:
@@ -196,6 +237,7 @@ func Bytes(reply interface{}, err error) ([]byte, error) {
 //
 //  Reply type      Result
 //  integer         value != 0, nil
+//  boolean         reply, nil
 //  bulk string     strconv.ParseBool(reply)
 //  nil             false, ErrNil
 //  other           false, error
@@ -206,6 +248,8 @@ func Bool(reply interface{}, err error) (bool, error) {
 	switch reply := reply.(type) {
 	case int64:
 		return reply != 0, nil
+	case bool:
+		return reply, nil
 	case []byte:
 		b, e := strconv.ParseBool(string(reply))
 		return b, pkgerr.WithStack(e)
@@ -228,15 +272,17 @@ func MultiBulk(reply interface{}, err error) ([]interface{}, error) { return Val
 //
 //  Reply type      Result
 //  array           reply, nil
+//  map, set, push  []interface{}(reply), nil
 //  nil             nil, ErrNil
 //  other           nil, error
 func Values(reply interface{}, err error) ([]interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
+	if values, ok := array(reply); ok {
+		return values, nil
+	}
 	switch reply := reply.(type) {
-	case []interface{}:
-		return reply, nil
 	case nil:
 		return nil, ErrNil
 	case Error:
@@ -253,6 +299,9 @@ func Strings(reply interface{}, err error) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
+	if values, ok := array(reply); ok {
+		reply = values
+	}
 	switch reply := reply.(type) {
 	case []interface{}:
 		result := make([]string, len(reply))
@@ -283,6 +332,9 @@ func ByteSlices(reply interface{}, err error) ([][]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if values, ok := array(reply); ok {
+		reply = values
+	}
 	switch reply := reply.(type) {
 	case []interface{}:
 		result := make([][]byte, len(reply))
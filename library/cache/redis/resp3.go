@@ -0,0 +1,89 @@
+package redis
+
+import (
+	"math/big"
+	"strconv"
+)
+
+// The RESP3 aggregate replies, a connection dialed with DialRESP3 returns
+// them besides the RESP2 replies. The reply helpers and Scan treat them as
+// arrays. The other RESP3 types are returned as:
+//
+//	RESP3 type        Reply type
+//	null              nil
+//	double            float64
+//	boolean           bool
+//	big number        *big.Int
+//	verbatim string   []byte without the format
+//	blob error        Error
+//
+// The attributes are dropped.
+type (
+	// Map is a map reply, the keys and values alternate like the HGETALL
+	// reply of RESP2.
+	Map []interface{}
+	// Set is a set reply.
+	Set []interface{}
+	// Push is an out of band push frame. The pub/sub frames are returned by
+	// Receive, the others are delivered to the DialPushHandler function.
+	Push []interface{}
+)
+
+// Kind returns the kind of the push frame, e.g. "message" or "invalidate".
+func (p Push) Kind() string {
+	if len(p) == 0 {
+		return ""
+	}
+	switch kind := p[0].(type) {
+	case []byte:
+		return string(kind)
+	case string:
+		return kind
+	}
+	return ""
+}
+
+func (p Push) pubsub() bool {
+	switch p.Kind() {
+	case "message", "pmessage", "smessage", "subscribe", "psubscribe", "ssubscribe",
+		"unsubscribe", "punsubscribe", "sunsubscribe", "pong":
+		return true
+	}
+	return false
+}
+
+// array returns the values of an array-like reply.
+func array(reply interface{}) ([]interface{}, bool) {
+	switch reply := reply.(type) {
+	case []interface{}:
+		return reply, true
+	case Map:
+		return reply, true
+	case Set:
+		return reply, true
+	case Push:
+		return reply, true
+	}
+	return nil, false
+}
+
+// resp2 converts the RESP3 replies to the RESP2 replies of the same
+// commands, so they scan alike: a double or big number to its bulk string, a
+// boolean to 1 or 0 and an aggregate to an array.
+func resp2(reply interface{}) interface{} {
+	switch r := reply.(type) {
+	case float64:
+		return strconv.AppendFloat(nil, r, 'g', -1, 64)
+	case *big.Int:
+		return []byte(r.String())
+	case bool:
+		if r {
+			return int64(1)
+		}
+		return int64(0)
+	}
+	if values, ok := array(reply); ok {
+		return values
+	}
+	return reply
+}
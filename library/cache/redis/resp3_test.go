@@ -0,0 +1,98 @@
+package redis
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func bigInt(s string) *big.Int {
+	n, _ := new(big.Int).SetString(s, 10)
+	return n
+}
+
+func TestDialRESP3(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := Dial("", "", DialPassword("pw"), DialDatabase(3), DialRESP3(),
+		dialTestConn(strings.NewReader("+OK\r\n%1\r\n+proto\r\n:3\r\n+OK\r\n"), &buf))
+	assert.Nil(t, err)
+	assert.Equal(t, "*2\r\n$4\r\nAUTH\r\n$2\r\npw\r\n"+
+		"*2\r\n$5\r\nHELLO\r\n$1\r\n3\r\n"+
+		"*2\r\n$6\r\nSELECT\r\n$1\r\n3\r\n", buf.String())
+
+	_, err = Dial("", "", DialRESP3(), dialTestConn(strings.NewReader("-NOPROTO unsupported protocol version\r\n"), &buf))
+	assert.NotNil(t, err)
+}
+
+func TestPushHandler(t *testing.T) {
+	var pushes []Push
+	c, err := Dial("", "", DialPushHandler(func(p Push) { pushes = append(pushes, p) }),
+		dialTestConn(strings.NewReader(">2\r\n$10\r\ninvalidate\r\n*1\r\n$1\r\nk\r\n$1\r\nv\r\n!21\r\nSYNTAX invalid syntax\r\n"), nil))
+	assert.Nil(t, err)
+	v, err := String(c.Receive())
+	assert.Nil(t, err)
+	assert.Equal(t, "v", v)
+	assert.Len(t, pushes, 1)
+	assert.Equal(t, "invalidate", pushes[0].Kind())
+	_, err = c.Receive()
+	assert.Equal(t, Error("SYNTAX invalid syntax"), err)
+	keys, err := Strings(pushes[0][1], nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"k"}, keys)
+}
+
+func TestRESP3Reply(t *testing.T) {
+	n, err := Int(bigInt("42"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 42, n)
+	_, err = Int64(bigInt("3492890328409238509324850943850943825024385"), nil)
+	assert.NotNil(t, err)
+	u, err := Uint64(bigInt("18446744073709551615"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(18446744073709551615), u)
+	f, err := Float64(1.5, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, f)
+	s, err := String(1.5, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.5", s)
+	b, err := Bool(true, nil)
+	assert.Nil(t, err)
+	assert.True(t, b)
+	ss, err := Strings(Set{[]byte("a"), []byte("b")}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, ss)
+	m, err := Int64Map(Map{[]byte("a"), int64(1)}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int64{"a": 1}, m)
+
+	var (
+		score float64
+		ok    bool
+		vs    []string
+		raw   interface{}
+	)
+	_, err = Scan([]interface{}{2.5, true, Set{[]byte("x")}, 2.5}, &score, &ok, &vs, &raw)
+	assert.Nil(t, err)
+	assert.Equal(t, 2.5, score)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"x"}, vs)
+	assert.Equal(t, 2.5, raw)
+
+	var st struct {
+		Name  string  `redis:"name"`
+		Score float64 `redis:"score"`
+		Big   int64   `redis:"big"`
+		On    bool    `redis:"on"`
+	}
+	values, err := Values(Map{"name", []byte("n"), "score", 0.5, "big", bigInt("7"), "on", true}, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, ScanStruct(values, &st))
+	assert.Equal(t, "n", st.Name)
+	assert.Equal(t, 0.5, st.Score)
+	assert.Equal(t, int64(7), st.Big)
+	assert.True(t, st.On)
+}
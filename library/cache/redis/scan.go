@@ -114,7 +114,7 @@ func convertAssignInt(d reflect.Value, s int64) (err error) {
 }
 
 func convertAssignValue(d reflect.Value, s interface{}) (err error) {
-	switch s := s.(type) {
+	switch s := resp2(s).(type) {
 	case []byte:
 		err = convertAssignBulkString(d, s)
 	case int64:
@@ -141,6 +141,9 @@ func convertAssignArray(d reflect.Value, s []interface{}) error {
 func convertAssign(d interface{}, s interface{}) (err error) {
 	// Handle the most common destination types using type switches and
 	// fall back to reflection for all other types.
+	if _, ok := d.(*interface{}); !ok {
+		s = resp2(s)
+	}
 	switch s := s.(type) {
 	case nil:
 		// ingore
@@ -212,7 +215,11 @@ func convertAssign(d interface{}, s interface{}) (err error) {
 	case Error:
 		err = s
 	default:
-		err = cannotConvert(reflect.ValueOf(d), s)
+		if d, ok := d.(*interface{}); ok {
+			*d = s
+		} else {
+			err = cannotConvert(reflect.ValueOf(d), s)
+		}
 	}
 	err = pkgerr.WithStack(err)
 	return
@@ -384,6 +391,9 @@ func ScanStruct(src []interface{}, dest interface{}) error {
 			continue
 		}
 		name, ok := src[i].([]byte)
+		if key, isString := src[i].(string); isString {
+			name, ok = []byte(key), true
+		}
 		if !ok {
 			return pkgerr.Errorf("redigo.ScanStruct: key %d not a bulk string value", i)
 		}
@@ -0,0 +1,521 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zombie-k/kylin/library/log"
+
+	pkgerr "github.com/pkg/errors"
+)
+
+const (
+	_sentinelResubscribeInterval = time.Second
+)
+
+var (
+	// ErrNoMaster is returned when no sentinel knows the master.
+	ErrNoMaster = errors.New("redis: sentinel master unknown")
+)
+
+// commands served by the replicas when SentinelConfig.ReadReplicas is set.
+var readOnlyCommands = map[string]struct{}{
+	"GET":              {},
+	"MGET":             {},
+	"STRLEN":           {},
+	"GETRANGE":         {},
+	"EXISTS":           {},
+	"TTL":              {},
+	"PTTL":             {},
+	"TYPE":             {},
+	"HGET":             {},
+	"HMGET":            {},
+	"HGETALL":          {},
+	"HLEN":             {},
+	"HEXISTS":          {},
+	"HKEYS":            {},
+	"HVALS":            {},
+	"HSTRLEN":          {},
+	"LRANGE":           {},
+	"LLEN":             {},
+	"LINDEX":           {},
+	"SMEMBERS":         {},
+	"SISMEMBER":        {},
+	"SCARD":            {},
+	"SRANDMEMBER":      {},
+	"ZRANGE":           {},
+	"ZRANGEBYSCORE":    {},
+	"ZREVRANGE":        {},
+	"ZREVRANGEBYSCORE": {},
+	"ZSCORE":           {},
+	"ZCARD":            {},
+	"ZCOUNT":           {},
+	"ZRANK":            {},
+	"ZREVRANK":         {},
+	"GETBIT":           {},
+	"BITCOUNT":         {},
+	"PFCOUNT":          {},
+	"XRANGE":           {},
+	"XREVRANGE":        {},
+	"XLEN":             {},
+	"SCAN":             {},
+	"HSCAN":            {},
+	"SSCAN":            {},
+	"ZSCAN":            {},
+}
+
+func init() {
+	for n := range readOnlyCommands {
+		readOnlyCommands[strings.ToLower(n)] = struct{}{}
+	}
+}
+
+// SentinelConfig redis sentinel config. Config.Addr is unused, the master
+// and the replicas get a pool of Config dialing their address.
+type SentinelConfig struct {
+	*Config
+
+	// MasterName is the name the sentinels monitor the master by.
+	MasterName string
+	// Sentinels are the sentinel addresses.
+	Sentinels []string
+	// SentinelAuth is the password of the sentinels.
+	SentinelAuth string
+	// ReadReplicas routes the read-only commands of a connection to the
+	// replicas, until the connection sends another command.
+	ReadReplicas bool
+}
+
+// SentinelPool is a pool of the master the sentinels report. It subscribes
+// to the sentinel events and swaps the pool on +switch-master, the pool of
+// the old master is closed so its connections are drained, not reused.
+type SentinelPool struct {
+	c       *SentinelConfig
+	options []DialOption
+	tls     []DialOption
+
+	mu           sync.RWMutex
+	master       *Pool
+	masterAddr   string
+	replicas     []*Pool
+	replicaAddrs []string
+	next         uint32
+
+	resolving int32
+
+	ctx    context.Context
+	cancel func()
+	wg     sync.WaitGroup
+	subMu  sync.Mutex
+	sub    *PubSubConn
+}
+
+// NewSentinelPool new a pool of the master of c.MasterName.
+func NewSentinelPool(c *SentinelConfig, options ...DialOption) *SentinelPool {
+	if c.MasterName == "" || len(c.Sentinels) == 0 {
+		panic("redis: sentinel needs a master name and sentinel addrs")
+	}
+	if c.DialTimeout <= 0 || c.ReadTimeout <= 0 || c.WriteTimeout <= 0 {
+		panic("must config redis timeout")
+	}
+	// the TLS config is built once for the sentinels and the pools of every
+	// node.
+	tls := c.tlsOptions()
+	p := &SentinelPool{c: c, options: append(tls, options...), tls: tls}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	if err := p.resolve(); err != nil {
+		log.Error("redis: sentinel %s resolve master %s error(%v)", c.Name, c.MasterName, err)
+	}
+	p.wg.Add(1)
+	go p.watch()
+	return p
+}
+
+// NewSentinelRedis new a redis client of the master of c.MasterName.
+func NewSentinelRedis(c *SentinelConfig, options ...DialOption) *Redis {
+	return &Redis{
+		pool:    NewSentinelPool(c, options...),
+		conf:    c.Config,
+		options: options,
+	}
+}
+
+// Get gets a connection of the master, or of a replica for the read-only
+// commands if SentinelConfig.ReadReplicas is set.
+func (p *SentinelPool) Get(ctx context.Context) Conn {
+	return &sentinelConn{p: p, ctx: ctx}
+}
+
+// MasterAddr returns the address of the current master.
+func (p *SentinelPool) MasterAddr() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.masterAddr
+}
+
+// Close stops watching the sentinels and closes the pools.
+func (p *SentinelPool) Close() error {
+	p.cancel()
+	p.subMu.Lock()
+	if p.sub != nil {
+		// the reader returns on the unsubscribe replies.
+		p.sub.Unsubscribe()
+	}
+	p.subMu.Unlock()
+	p.wg.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.master != nil {
+		p.master.Close()
+	}
+	for _, r := range p.replicas {
+		r.Close()
+	}
+	p.master, p.replicas = nil, nil
+	return nil
+}
+
+func (p *SentinelPool) getMaster(ctx context.Context) Conn {
+	p.mu.RLock()
+	master := p.master
+	p.mu.RUnlock()
+	if master == nil {
+		p.resolveAsync()
+		return errorConnection{pkgerr.WithStack(ErrNoMaster)}
+	}
+	return master.Get(ctx)
+}
+
+// getReplica gets a connection of the replicas round robin, of the master if
+// there is none.
+func (p *SentinelPool) getReplica(ctx context.Context) Conn {
+	p.mu.RLock()
+	var replica *Pool
+	if n := len(p.replicas); n > 0 {
+		replica = p.replicas[atomic.AddUint32(&p.next, 1)%uint32(n)]
+	}
+	p.mu.RUnlock()
+	if replica == nil {
+		return p.getMaster(ctx)
+	}
+	return replica.Get(ctx)
+}
+
+func (p *SentinelPool) newPool(addr string) *Pool {
+	conf := *p.c.Config
+	conf.Addr = addr
+	conf.TLS = nil
+	return NewPool(&conf, p.options...)
+}
+
+func (p *SentinelPool) dialSentinel(addr string) (Conn, error) {
+	ops := []DialOption{
+		DialConnectTimeout(time.Duration(p.c.DialTimeout)),
+		DialReadTimeout(time.Duration(p.c.ReadTimeout)),
+		DialWriteTimeout(time.Duration(p.c.WriteTimeout)),
+		DialPassword(p.c.SentinelAuth),
+	}
+	return Dial(p.c.Proto, addr, append(ops, p.tls...)...)
+}
+
+// resolveAsync resolves the master in background, once at a time.
+func (p *SentinelPool) resolveAsync() {
+	if !atomic.CompareAndSwapInt32(&p.resolving, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&p.resolving, 0)
+		if err := p.resolve(); err != nil {
+			log.Error("redis: sentinel %s resolve master %s error(%v)", p.c.Name, p.c.MasterName, err)
+		}
+	}()
+}
+
+// resolve asks the sentinels for the master and the replicas until one
+// answers.
+func (p *SentinelPool) resolve() (err error) {
+	for _, addr := range p.c.Sentinels {
+		var (
+			conn     Conn
+			master   []string
+			replicas []string
+		)
+		if conn, err = p.dialSentinel(addr); err != nil {
+			continue
+		}
+		master, err = Strings(conn.Do("SENTINEL", "get-master-addr-by-name", p.c.MasterName))
+		if err == nil && len(master) != 2 {
+			err = pkgerr.WithStack(ErrNoMaster)
+		}
+		if err == nil && p.c.ReadReplicas {
+			replicas, err = sentinelReplicas(conn, p.c.MasterName)
+		}
+		conn.Close()
+		if err != nil {
+			continue
+		}
+		p.setMaster(net.JoinHostPort(master[0], master[1]))
+		if p.c.ReadReplicas {
+			p.setReplicas(replicas)
+		}
+		return nil
+	}
+	return
+}
+
+// sentinelReplicas returns the addresses of the replicas not down.
+func sentinelReplicas(conn Conn, name string) ([]string, error) {
+	values, err := Values(conn.Do("SENTINEL", "replicas", name))
+	if err != nil {
+		// sentinels before 5.0 only know the slaves subcommand.
+		if values, err = Values(conn.Do("SENTINEL", "slaves", name)); err != nil {
+			return nil, err
+		}
+	}
+	var addrs []string
+	for _, v := range values {
+		replica, err := StringMap(v, nil)
+		if err != nil {
+			return nil, err
+		}
+		if flags := replica["flags"]; strings.Contains(flags, "s_down") || strings.Contains(flags, "o_down") || strings.Contains(flags, "disconnected") {
+			continue
+		}
+		addrs = append(addrs, net.JoinHostPort(replica["ip"], replica["port"]))
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+// setMaster swaps the pool of the master, the pool of the old master is
+// closed.
+func (p *SentinelPool) setMaster(addr string) {
+	p.mu.Lock()
+	if p.ctx.Err() != nil || addr == p.masterAddr {
+		p.mu.Unlock()
+		return
+	}
+	old, oldAddr := p.master, p.masterAddr
+	p.master, p.masterAddr = p.newPool(addr), addr
+	p.mu.Unlock()
+	if old == nil {
+		log.Info("redis: sentinel %s master %s at %s", p.c.Name, p.c.MasterName, addr)
+		return
+	}
+	old.Close()
+	log.Warn("redis: sentinel %s master %s switched from %s to %s", p.c.Name, p.c.MasterName, oldAddr, addr)
+	_metricSentinelFailovers.Inc(p.c.Name, p.c.MasterName)
+}
+
+func (p *SentinelPool) setReplicas(addrs []string) {
+	p.mu.Lock()
+	if p.ctx.Err() != nil || strings.Join(addrs, ",") == strings.Join(p.replicaAddrs, ",") {
+		p.mu.Unlock()
+		return
+	}
+	olds := make(map[string]*Pool, len(p.replicas))
+	for i, addr := range p.replicaAddrs {
+		olds[addr] = p.replicas[i]
+	}
+	replicas := make([]*Pool, len(addrs))
+	for i, addr := range addrs {
+		if r, ok := olds[addr]; ok {
+			replicas[i] = r
+			delete(olds, addr)
+			continue
+		}
+		replicas[i] = p.newPool(addr)
+	}
+	p.replicas, p.replicaAddrs = replicas, addrs
+	p.mu.Unlock()
+	for _, r := range olds {
+		r.Close()
+	}
+	log.Info("redis: sentinel %s master %s replicas %v", p.c.Name, p.c.MasterName, addrs)
+}
+
+// watch follows the sentinel events, the master is resolved again whenever
+// the subscription breaks as the events published meanwhile are lost.
+func (p *SentinelPool) watch() {
+	defer p.wg.Done()
+	for {
+		err := p.subscribe()
+		if p.ctx.Err() != nil {
+			return
+		}
+		log.Warn("redis: sentinel %s subscribe error(%v), resubscribe", p.c.Name, err)
+		select {
+		case <-time.After(_sentinelResubscribeInterval):
+		case <-p.ctx.Done():
+			return
+		}
+		if err = p.resolve(); err != nil {
+			log.Error("redis: sentinel %s resolve master %s error(%v)", p.c.Name, p.c.MasterName, err)
+		}
+	}
+}
+
+func (p *SentinelPool) subscribe() (err error) {
+	var conn Conn
+	for _, addr := range p.c.Sentinels {
+		if conn, err = p.dialSentinel(addr); err == nil {
+			break
+		}
+	}
+	if conn == nil {
+		return
+	}
+	defer func() {
+		p.subMu.Lock()
+		p.sub = nil
+		p.subMu.Unlock()
+		conn.Close()
+	}()
+	psc := &PubSubConn{Conn: conn}
+	p.subMu.Lock()
+	if p.ctx.Err() != nil {
+		p.subMu.Unlock()
+		return nil
+	}
+	p.sub = psc
+	err = psc.Subscribe("+switch-master", "+slave", "+sdown", "-sdown")
+	p.subMu.Unlock()
+	if err != nil {
+		return
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// keep the subscription reading within the read timeout.
+		ticker := time.NewTicker(time.Duration(p.c.ReadTimeout) / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.subMu.Lock()
+				err := psc.Ping("")
+				p.subMu.Unlock()
+				if err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	for {
+		switch v := psc.Receive().(type) {
+		case Message:
+			p.event(v.Channel, string(v.Data))
+		case Subscription:
+			if v.Kind == "unsubscribe" && v.Count == 0 {
+				return nil
+			}
+		case error:
+			return v
+		}
+	}
+}
+
+func (p *SentinelPool) event(channel, data string) {
+	fields := strings.Fields(data)
+	switch channel {
+	case "+switch-master":
+		// <master name> <old ip> <old port> <new ip> <new port>
+		if len(fields) != 5 || fields[0] != p.c.MasterName {
+			return
+		}
+		p.setMaster(net.JoinHostPort(fields[3], fields[4]))
+		if p.c.ReadReplicas {
+			p.resolveAsync()
+		}
+	default:
+		// <instance type> <name> <ip> <port> @ <master name> <master ip> <master port>
+		if p.c.ReadReplicas && len(fields) >= 6 && fields[0] == "slave" && fields[5] == p.c.MasterName {
+			p.resolveAsync()
+		}
+	}
+}
+
+// sentinelConn gets a replica connection for the read-only commands until
+// another command is sent, from then on every command goes to the master.
+type sentinelConn struct {
+	p       *SentinelPool
+	ctx     context.Context
+	master  Conn
+	replica Conn
+}
+
+func (sc *sentinelConn) conn(commandName string) Conn {
+	if sc.master == nil && sc.p.c.ReadReplicas {
+		if _, ok := readOnlyCommands[commandName]; ok {
+			if sc.replica == nil {
+				sc.replica = sc.p.getReplica(sc.ctx)
+			}
+			return sc.replica
+		}
+	}
+	if sc.master == nil {
+		sc.master = sc.p.getMaster(sc.ctx)
+	}
+	return sc.master
+}
+
+// check resolves the master again if it was demoted to a replica.
+func (sc *sentinelConn) check(err error) error {
+	if e, ok := pkgerr.Cause(err).(Error); ok && strings.HasPrefix(string(e), "READONLY") {
+		sc.p.resolveAsync()
+	}
+	return err
+}
+
+func (sc *sentinelConn) Close() (err error) {
+	if sc.master != nil {
+		err = sc.master.Close()
+	}
+	if sc.replica != nil {
+		if e := sc.replica.Close(); e != nil {
+			err = e
+		}
+	}
+	return
+}
+
+func (sc *sentinelConn) Err() error {
+	if sc.master != nil {
+		return sc.master.Err()
+	}
+	if sc.replica != nil {
+		return sc.replica.Err()
+	}
+	return nil
+}
+
+func (sc *sentinelConn) Do(commandName string, args ...interface{}) (reply interface{}, err error) {
+	reply, err = sc.conn(commandName).Do(commandName, args...)
+	return reply, sc.check(err)
+}
+
+func (sc *sentinelConn) Send(commandName string, args ...interface{}) error {
+	return sc.conn("").Send(commandName, args...)
+}
+
+func (sc *sentinelConn) Flush() error {
+	return sc.conn("").Flush()
+}
+
+func (sc *sentinelConn) Receive() (reply interface{}, err error) {
+	reply, err = sc.conn("").Receive()
+	return reply, sc.check(err)
+}
+
+func (sc *sentinelConn) WithContext(ctx context.Context) Conn {
+	sc.ctx = ctx
+	return sc
+}
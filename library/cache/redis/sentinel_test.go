@@ -0,0 +1,168 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache/redis/redistest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newSentinelNode starts a data node, a replica refuses the writes.
+func newSentinelNode(t *testing.T, replica bool) *redistest.Server {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	setReplica(s, replica)
+	return s
+}
+
+func setReplica(s *redistest.Server, replica bool) {
+	var f redistest.Faults
+	if replica {
+		f = redistest.Faults{Error: "READONLY You can't write against a read only replica.", Commands: []string{"SET"}}
+	}
+	s.SetFaults(f)
+}
+
+// nodeGet reads key straight from the node s.
+func nodeGet(t *testing.T, s *redistest.Server, key string) []byte {
+	c, err := Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	v, err := Bytes(c.Do("GET", key))
+	if err != nil && err != ErrNil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// fakeSentinel reports a master and replicas and publishes events to its
+// subscribers.
+type fakeSentinel struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	master   string
+	replicas []string
+	subs     []*fakeWriter
+}
+
+func newFakeSentinel(t *testing.T, master string, replicas ...string) *fakeSentinel {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSentinel{ln: ln, master: master, replicas: replicas}
+	go serveFake(ln, func(w *fakeWriter, req []string) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch req[0] {
+		case "SENTINEL":
+			if req[1] == "get-master-addr-by-name" {
+				host, port, _ := net.SplitHostPort(s.master)
+				w.write([]interface{}{[]byte(host), []byte(port)})
+				return
+			}
+			var replicas []interface{}
+			for _, r := range s.replicas {
+				host, port, _ := net.SplitHostPort(r)
+				replicas = append(replicas, []interface{}{
+					[]byte("ip"), []byte(host), []byte("port"), []byte(port), []byte("flags"), []byte("slave"),
+				})
+			}
+			w.write(replicas)
+		case "SUBSCRIBE":
+			for i, ch := range req[1:] {
+				w.write([]interface{}{[]byte("subscribe"), []byte(ch), int64(i + 1)})
+			}
+			s.subs = append(s.subs, w)
+		case "UNSUBSCRIBE":
+			w.write([]interface{}{[]byte("unsubscribe"), nil, int64(0)})
+		case "PING":
+			w.write([]interface{}{[]byte("pong"), []byte("")})
+		}
+	})
+	return s
+}
+
+func (s *fakeSentinel) failover(master string, replicas ...string) (old string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, s.master, s.replicas = s.master, master, replicas
+	return
+}
+
+func (s *fakeSentinel) publish(channel, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.subs {
+		w.write([]interface{}{[]byte("message"), []byte(channel), []byte(msg)})
+	}
+}
+
+func TestSentinel(t *testing.T) {
+	a, b := newSentinelNode(t, false), newSentinelNode(t, true)
+	defer a.Close()
+	defer b.Close()
+	s := newFakeSentinel(t, a.Addr(), b.Addr())
+	defer s.ln.Close()
+	r := NewSentinelRedis(&SentinelConfig{
+		Config:       newFakeConfig("test_sentinel", ""),
+		MasterName:   "mymaster",
+		Sentinels:    []string{s.ln.Addr().String()},
+		ReadReplicas: true,
+	})
+	defer r.Close()
+	sp := r.pool.(*SentinelPool)
+	ctx := context.Background()
+
+	_, err := r.Do(ctx, "SET", "key", "master")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("master"), nodeGet(t, a, "key"))
+	// the reads are served by the replica.
+	_, err = String(r.Do(ctx, "GET", "key"))
+	assert.Equal(t, ErrNil, err)
+	// a connection sticks to the master once it writes.
+	conn := r.Conn(ctx)
+	_, err = conn.Do("SET", "key", "v")
+	assert.Nil(t, err)
+	v, err := String(conn.Do("GET", "key"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v", v)
+	conn.Close()
+
+	// +switch-master swaps the master.
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.subs) == 1
+	}, time.Second, 10*time.Millisecond)
+	setReplica(b, false)
+	setReplica(a, true)
+	old := s.failover(b.Addr(), a.Addr())
+	oldHost, oldPort, _ := net.SplitHostPort(old)
+	newHost, newPort, _ := net.SplitHostPort(b.Addr())
+	s.publish("+switch-master", "mymaster "+oldHost+" "+oldPort+" "+newHost+" "+newPort)
+	assert.Eventually(t, func() bool { return sp.MasterAddr() == b.Addr() }, time.Second, 10*time.Millisecond)
+	_, err = r.Do(ctx, "SET", "key", "failover")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("failover"), nodeGet(t, b, "key"))
+
+	// a READONLY reply resolves the master again, the event may be lost.
+	setReplica(a, false)
+	setReplica(b, true)
+	s.failover(a.Addr(), b.Addr())
+	_, err = r.Do(ctx, "SET", "key", "readonly")
+	assert.NotNil(t, err)
+	assert.Eventually(t, func() bool { return sp.MasterAddr() == a.Addr() }, time.Second, 10*time.Millisecond)
+	_, err = r.Do(ctx, "SET", "key", "readonly")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("readonly"), nodeGet(t, a, "key"))
+}
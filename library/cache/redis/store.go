@@ -0,0 +1,49 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache"
+)
+
+type store struct {
+	r *Redis
+}
+
+// NewStore adapts r to a cache.Store, the values are stored as strings.
+func NewStore(r *Redis) cache.Store {
+	return &store{r: r}
+}
+
+func (s *store) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	replies, err := ByteSlices(s.r.Do(ctx, "MGET", args...))
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string][]byte, len(keys))
+	for i, reply := range replies {
+		if reply != nil {
+			values[keys[i]] = reply
+		}
+	}
+	return values, nil
+}
+
+func (s *store) Set(ctx context.Context, key string, value []byte, ttl time.Duration) (err error) {
+	if ttl > 0 {
+		_, err = s.r.Do(ctx, "SET", key, value, "PX", int64(ttl/time.Millisecond))
+	} else {
+		_, err = s.r.Do(ctx, "SET", key, value)
+	}
+	return
+}
+
+func (s *store) Delete(ctx context.Context, key string) (err error) {
+	_, err = s.r.Do(ctx, "DEL", key)
+	return
+}
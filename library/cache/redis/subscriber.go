@@ -0,0 +1,358 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zombie-k/kylin/library/log"
+)
+
+const (
+	_defaultSubscriberBuffer    = 100
+	_defaultSubscriberPing      = time.Second
+	_defaultSubscriberReconnect = time.Second
+)
+
+// SubscriberOption specifies an option of a Subscriber.
+type SubscriberOption struct {
+	f func(*subscriberOptions)
+}
+
+type subscriberOptions struct {
+	buffer      int
+	ping        time.Duration
+	reconnect   time.Duration
+	sendTimeout time.Duration
+}
+
+// SubscriberBuffer specifies the buffer of the message channel, 100 by
+// default.
+func SubscriberBuffer(n int) SubscriberOption {
+	return SubscriberOption{func(o *subscriberOptions) {
+		o.buffer = n
+	}}
+}
+
+// SubscriberPingInterval specifies the interval of the pings detecting a
+// dead link, 1s by default. It must be shorter than the read timeout of the
+// connections, which breaks a link without any reply.
+func SubscriberPingInterval(d time.Duration) SubscriberOption {
+	return SubscriberOption{func(o *subscriberOptions) {
+		o.ping = d
+	}}
+}
+
+// SubscriberReconnectInterval specifies the wait before reconnecting a
+// broken link, 1s by default.
+func SubscriberReconnectInterval(d time.Duration) SubscriberOption {
+	return SubscriberOption{func(o *subscriberOptions) {
+		o.reconnect = d
+	}}
+}
+
+// SubscriberSendTimeout specifies how long a message waits for room in a
+// full channel before it is dropped, a message delivered after waiting is
+// late. By default the messages are dropped at once.
+func SubscriberSendTimeout(d time.Duration) SubscriberOption {
+	return SubscriberOption{func(o *subscriberOptions) {
+		o.sendTimeout = d
+	}}
+}
+
+// SubscriberStats is the counters of a Subscriber.
+type SubscriberStats struct {
+	Delivered  uint64 // delivered at once
+	Late       uint64 // delivered after waiting for a full channel
+	Dropped    uint64 // dropped on a full channel
+	Reconnects uint64
+}
+
+// Subscriber is a subscription of channels and patterns which survives the
+// broken links: it owns a connection of the Redis pool, pings it to detect
+// a dead link, then reconnects and subscribes again to all the channels and
+// patterns. The messages published meanwhile are lost.
+type Subscriber struct {
+	r    *Redis
+	name string
+	o    subscriberOptions
+	ch   chan interface{}
+	wake chan struct{}
+
+	ctx    context.Context
+	cancel func()
+	wg     sync.WaitGroup
+
+	// mu guards the subscriptions and the sends on psc, which run
+	// concurrently with the receives.
+	mu       sync.Mutex
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	psc      *PubSubConn
+
+	delivered, late, dropped, reconnects uint64
+}
+
+// NewSubscriber new a subscriber on the connections of r, it subscribes
+// nothing until Subscribe or PSubscribe is called.
+func NewSubscriber(r *Redis, options ...SubscriberOption) *Subscriber {
+	o := subscriberOptions{
+		buffer:    _defaultSubscriberBuffer,
+		ping:      _defaultSubscriberPing,
+		reconnect: _defaultSubscriberReconnect,
+	}
+	for _, option := range options {
+		option.f(&o)
+	}
+	s := &Subscriber{
+		r:        r,
+		name:     r.conf.Name,
+		o:        o,
+		ch:       make(chan interface{}, o.buffer),
+		wake:     make(chan struct{}, 1),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Messages returns the channel of the Message and PMessage received, it is
+// closed by Close.
+func (s *Subscriber) Messages() <-chan interface{} {
+	return s.ch
+}
+
+// Subscribe subscribes the channels, now and after every reconnection.
+func (s *Subscriber) Subscribe(channels ...string) error {
+	return s.update(s.channels, true, channels, func(psc *PubSubConn, args []interface{}) error {
+		return psc.Subscribe(args...)
+	})
+}
+
+// PSubscribe subscribes the patterns, now and after every reconnection.
+func (s *Subscriber) PSubscribe(patterns ...string) error {
+	return s.update(s.patterns, true, patterns, func(psc *PubSubConn, args []interface{}) error {
+		return psc.PSubscribe(args...)
+	})
+}
+
+// Unsubscribe unsubscribes the channels.
+func (s *Subscriber) Unsubscribe(channels ...string) error {
+	return s.update(s.channels, false, channels, func(psc *PubSubConn, args []interface{}) error {
+		return psc.Unsubscribe(args...)
+	})
+}
+
+// PUnsubscribe unsubscribes the patterns.
+func (s *Subscriber) PUnsubscribe(patterns ...string) error {
+	return s.update(s.patterns, false, patterns, func(psc *PubSubConn, args []interface{}) error {
+		return psc.PUnsubscribe(args...)
+	})
+}
+
+// update records the change of the subscriptions and sends it on the
+// current link, a failed send is retried by the reconnection.
+func (s *Subscriber) update(set map[string]struct{}, add bool, names []string, send func(*PubSubConn, []interface{}) error) error {
+	if len(names) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range names {
+		if add {
+			set[name] = struct{}{}
+		} else {
+			delete(set, name)
+		}
+	}
+	if s.psc == nil {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+	return send(s.psc, stringArgs(names))
+}
+
+// Stats returns the counters of the subscriber.
+func (s *Subscriber) Stats() SubscriberStats {
+	return SubscriberStats{
+		Delivered:  atomic.LoadUint64(&s.delivered),
+		Late:       atomic.LoadUint64(&s.late),
+		Dropped:    atomic.LoadUint64(&s.dropped),
+		Reconnects: atomic.LoadUint64(&s.reconnects),
+	}
+}
+
+// Close stops the subscription and closes the message channel.
+func (s *Subscriber) Close() error {
+	s.cancel()
+	s.mu.Lock()
+	if s.psc != nil {
+		// the reader returns on the unsubscribe reply.
+		s.psc.Unsubscribe()
+		s.psc.PUnsubscribe()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	close(s.ch)
+	return nil
+}
+
+func (s *Subscriber) serve() {
+	defer s.wg.Done()
+	connected := false
+	for {
+		if !s.idle() {
+			if err := s.subscribe(connected); err != nil {
+				if s.ctx.Err() != nil {
+					return
+				}
+				log.Warn("redis: subscriber %s error(%v), reconnect", s.name, err)
+				atomic.AddUint64(&s.reconnects, 1)
+				_metricSubscriberReconnects.Inc(s.name)
+				connected = true
+				select {
+				case <-time.After(s.o.reconnect):
+				case <-s.ctx.Done():
+					return
+				}
+				continue
+			}
+		}
+		if s.ctx.Err() != nil {
+			return
+		}
+		// nothing is subscribed, wait for a subscription.
+		select {
+		case <-s.wake:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Subscriber) idle() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.channels) == 0 && len(s.patterns) == 0
+}
+
+// subscribe subscribes everything on a new link and delivers the messages
+// until it breaks, or until nothing is subscribed.
+func (s *Subscriber) subscribe(reconnect bool) error {
+	psc := &PubSubConn{Conn: s.r.Conn(s.ctx)}
+	defer func() {
+		s.mu.Lock()
+		s.psc = nil
+		s.mu.Unlock()
+		psc.Close()
+	}()
+	s.mu.Lock()
+	if s.ctx.Err() != nil {
+		s.mu.Unlock()
+		return nil
+	}
+	var err error
+	if len(s.channels) > 0 {
+		err = psc.Subscribe(stringArgs(setNames(s.channels))...)
+	}
+	if err == nil && len(s.patterns) > 0 {
+		err = psc.PSubscribe(stringArgs(setNames(s.patterns))...)
+	}
+	if err == nil {
+		s.psc = psc
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if reconnect {
+		log.Info("redis: subscriber %s resubscribed", s.name)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go s.ping(psc, done)
+	for {
+		switch v := psc.Receive().(type) {
+		case Message, PMessage:
+			s.deliver(v)
+		case Subscription:
+			if v.Count == 0 && s.unsubscribed() {
+				return nil
+			}
+		case error:
+			return v
+		}
+	}
+}
+
+// unsubscribed reports whether the link is unsubscribed for good, it is
+// detached from the subscriber then.
+func (s *Subscriber) unsubscribed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() == nil && (len(s.channels) > 0 || len(s.patterns) > 0) {
+		// a subscription is sent after the unsubscriptions.
+		return false
+	}
+	s.psc = nil
+	return true
+}
+
+func (s *Subscriber) deliver(msg interface{}) {
+	select {
+	case s.ch <- msg:
+		atomic.AddUint64(&s.delivered, 1)
+		_metricSubscriberMessages.Inc(s.name, "delivered")
+		return
+	default:
+	}
+	if s.o.sendTimeout > 0 {
+		timer := time.NewTimer(s.o.sendTimeout)
+		defer timer.Stop()
+		select {
+		case s.ch <- msg:
+			atomic.AddUint64(&s.late, 1)
+			_metricSubscriberMessages.Inc(s.name, "late")
+			return
+		case <-timer.C:
+		case <-s.ctx.Done():
+		}
+	}
+	atomic.AddUint64(&s.dropped, 1)
+	_metricSubscriberMessages.Inc(s.name, "dropped")
+}
+
+// ping keeps the link reading within the read timeout, a dead link fails
+// the receive.
+func (s *Subscriber) ping(psc *PubSubConn, done chan struct{}) {
+	ticker := time.NewTicker(s.o.ping)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			err := psc.Ping("")
+			s.mu.Unlock()
+			if err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func setNames(set map[string]struct{}) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	return names
+}
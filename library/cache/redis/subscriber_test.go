@@ -0,0 +1,71 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache/redis/redistest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriber(t *testing.T) {
+	ps, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.Close()
+	r := newTestRedis("test_subscriber", ps.Addr())
+	defer r.Close()
+	s := NewSubscriber(r, SubscriberBuffer(1), SubscriberPingInterval(100*time.Millisecond),
+		SubscriberReconnectInterval(10*time.Millisecond), SubscriberSendTimeout(50*time.Millisecond))
+	subscribed := func(channel string) func() bool {
+		return func() bool { return ps.Subscribers(channel) == 1 }
+	}
+
+	assert.Nil(t, s.Subscribe("a", "b"))
+	assert.Nil(t, s.PSubscribe("p.*"))
+	assert.Eventually(t, subscribed("a"), time.Second, 10*time.Millisecond)
+	assert.Eventually(t, subscribed("p.*"), time.Second, 10*time.Millisecond)
+	ps.Publish("a", "1")
+	assert.Equal(t, Message{Channel: "a", Data: []byte("1")}, <-s.Messages())
+	ps.Publish("p.x", "2")
+	assert.Equal(t, PMessage{Pattern: "p.*", Channel: "p.x", Data: []byte("2")}, <-s.Messages())
+
+	// the subscriptions change while running.
+	assert.Nil(t, s.Unsubscribe("b"))
+	assert.Nil(t, s.Subscribe("c"))
+	assert.Eventually(t, subscribed("c"), time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, ps.Subscribers("b"))
+
+	// a killed link is reconnected with all the subscriptions.
+	ps.CloseConns()
+	assert.Eventually(t, func() bool { return s.Stats().Reconnects == 1 }, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, subscribed("c"), time.Second, 10*time.Millisecond)
+	assert.Eventually(t, subscribed("p.*"), time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, ps.Subscribers("a"))
+	ps.Publish("c", "3")
+	assert.Equal(t, Message{Channel: "c", Data: []byte("3")}, <-s.Messages())
+
+	// a full channel delays then drops the messages.
+	ps.Publish("a", "4")
+	ps.Publish("a", "5")
+	ps.Publish("a", "6")
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, Message{Channel: "a", Data: []byte("4")}, <-s.Messages())
+	assert.Eventually(t, func() bool { return s.Stats().Dropped == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, Message{Channel: "a", Data: []byte("5")}, <-s.Messages())
+	assert.Equal(t, uint64(1), s.Stats().Late)
+
+	// unsubscribing everything releases the link.
+	assert.Nil(t, s.Unsubscribe("a", "c"))
+	assert.Nil(t, s.PUnsubscribe("p.*"))
+	assert.Eventually(t, func() bool { return ps.Subscribers("a")+ps.Subscribers("c")+ps.Subscribers("p.*") == 0 }, time.Second, 10*time.Millisecond)
+	assert.Nil(t, s.Subscribe("d"))
+	assert.Eventually(t, subscribed("d"), time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, s.Close())
+	_, ok := <-s.Messages()
+	assert.False(t, ok)
+	assert.Equal(t, 0, ps.Subscribers("d"))
+}
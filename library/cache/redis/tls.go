@@ -0,0 +1,91 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TLSConfig is the TLS settings of the connections.
+type TLSConfig struct {
+	CAFile     string // PEM file of the CAs verifying the server, the system CAs if empty
+	CertFile   string // PEM file of the client certificate
+	KeyFile    string // PEM file of the client key
+	ServerName string // server name verified, the host of Addr if empty
+	// SkipVerify skips the verification of the server certificate, only for
+	// tests.
+	SkipVerify bool
+}
+
+// Build returns the tls.Config of c.
+func (c *TLSConfig) Build() (*tls.Config, error) {
+	tc := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.SkipVerify,
+	}
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("redis: no certificate in ca file %s", c.CAFile)
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+// tlsOptions returns the dial options of c.TLS, it panics on a bad config
+// like the other config errors.
+func (c *Config) tlsOptions() []DialOption {
+	if c.TLS == nil {
+		return nil
+	}
+	tc, err := c.TLS.Build()
+	if err != nil {
+		panic(err)
+	}
+	return []DialOption{DialUseTLS(true), DialTLSConfig(tc)}
+}
+
+// dialTLS runs the TLS handshake on netConn, within the connect timeout.
+func dialTLS(netConn net.Conn, address string, do *dialOptions) (net.Conn, error) {
+	tc := &tls.Config{}
+	if do.tlsConfig != nil {
+		tc = do.tlsConfig.Clone()
+	}
+	if do.skipVerify {
+		tc.InsecureSkipVerify = true
+	}
+	if tc.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		tc.ServerName = host
+	}
+	tlsConn := tls.Client(netConn, tc)
+	if do.connectTimeout > 0 {
+		tlsConn.SetDeadline(time.Now().Add(do.connectTimeout))
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		netConn.Close()
+		return nil, errors.WithStack(err)
+	}
+	if do.connectTimeout > 0 {
+		tlsConn.SetDeadline(time.Time{})
+	}
+	return tlsConn, nil
+}
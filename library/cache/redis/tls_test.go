@@ -0,0 +1,78 @@
+package redis
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTLSFake serves PING over TLS with the certificate of httptest, valid
+// for 127.0.0.1.
+func newTLSFake(t *testing.T) (addr, caFile string, closer func()) {
+	srv := httptest.NewTLSServer(nil)
+	cert := srv.TLS.Certificates[0]
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	srv.Close()
+
+	f, err := ioutil.TempFile("", "redis_ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(ca)
+	f.Close()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serveFake(ln, func(w *fakeWriter, req []string) {
+		w.write("PONG")
+	})
+	return ln.Addr().String(), f.Name(), func() {
+		ln.Close()
+		os.Remove(f.Name())
+	}
+}
+
+func TestDialTLS(t *testing.T) {
+	addr, caFile, closer := newTLSFake(t)
+	defer closer()
+
+	// the certificate is not trusted.
+	_, err := DialURL("rediss://" + addr)
+	assert.NotNil(t, err)
+
+	c, err := DialURL("rediss://"+addr, DialTLSSkipVerify(true))
+	assert.Nil(t, err)
+	s, err := String(c.Do("PING"))
+	assert.Nil(t, err)
+	assert.Equal(t, "PONG", s)
+	c.Close()
+
+	tc, err := (&TLSConfig{CAFile: caFile}).Build()
+	assert.Nil(t, err)
+	c, err = Dial("tcp", addr, DialUseTLS(true), DialTLSConfig(tc))
+	assert.Nil(t, err)
+	s, err = String(c.Do("PING"))
+	assert.Nil(t, err)
+	assert.Equal(t, "PONG", s)
+	c.Close()
+
+	_, err = (&TLSConfig{CAFile: caFile, CertFile: "nonexistent.pem", KeyFile: "nonexistent.pem"}).Build()
+	assert.NotNil(t, err)
+}
+
+func TestDialACL(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := Dial("", "", DialUsername("user"), DialPassword("pw"), DialClientName("svc"),
+		dialTestConn(strings.NewReader("+OK\r\n+OK\r\n"), &buf))
+	assert.Nil(t, err)
+	assert.Equal(t, "*3\r\n$4\r\nAUTH\r\n$4\r\nuser\r\n$2\r\npw\r\n"+
+		"*3\r\n$6\r\nCLIENT\r\n$7\r\nSETNAME\r\n$3\r\nsvc\r\n", buf.String())
+}
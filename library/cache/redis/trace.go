@@ -3,8 +3,10 @@ package redis
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/zombie-k/kylin/library/cache/hotkey"
 	"github.com/zombie-k/kylin/library/log"
 	"github.com/zombie-k/kylin/library/net/trace"
 )
@@ -24,6 +26,9 @@ var _internalTags = []trace.Tag{
 type traceConn struct {
 	// tr parent trace.
 	tr trace.Trace
+	// mu guards trPipe and pending, the sends may run concurrently with the
+	// receives.
+	mu sync.Mutex
 	// trPipe for pipeline, if trPipe != nil meaning on pipeline.
 	trPipe trace.Trace
 
@@ -35,17 +40,22 @@ type traceConn struct {
 	pending int
 	// TODO: split slow log from trace.
 	slowLogThreshold time.Duration
+	// hot is the hot key detector of the redis, nil if disabled.
+	hot *hotkey.Detector
 }
 
 func (t *traceConn) Do(commandName string, args ...interface{}) (reply interface{}, err error) {
 	statement := getStatement(commandName, args...)
 	defer t.slowLog(statement, time.Now())
+	defer func() { t.observe(commandName, args, reply) }()
 
 	// NOTE: ignored empty commandName
 	// current sdk will Do empty command after pipeline finished
 	if commandName == "" {
+		t.mu.Lock()
 		t.pending = 0
 		t.trPipe = nil
+		t.mu.Unlock()
 		return t.Conn.Do(commandName, args...)
 	}
 	if t.tr == nil {
@@ -63,8 +73,11 @@ func (t *traceConn) Do(commandName string, args ...interface{}) (reply interface
 func (t *traceConn) Send(commandName string, args ...interface{}) (err error) {
 	statement := getStatement(commandName, args...)
 	defer t.slowLog(statement, time.Now())
+	t.observe(commandName, args, nil)
+	t.mu.Lock()
 	t.pending++
 	if t.tr == nil {
+		t.mu.Unlock()
 		return t.Conn.Send(commandName, args...)
 	}
 
@@ -73,13 +86,15 @@ func (t *traceConn) Send(commandName string, args ...interface{}) (err error) {
 		t.trPipe.SetTag(_internalTags...)
 		t.trPipe.SetTag(t.connTags...)
 	}
-	t.trPipe.SetLog(
+	trPipe := t.trPipe
+	t.mu.Unlock()
+	trPipe.SetLog(
 		trace.Log(trace.LogEvent, "Send"),
 		trace.Log("db.statement", statement),
 	)
 	if err = t.Conn.Send(commandName, args...); err != nil {
-		t.trPipe.SetTag(trace.TagBool(trace.TagError, true))
-		t.trPipe.SetLog(
+		trPipe.SetTag(trace.TagBool(trace.TagError, true))
+		trPipe.SetLog(
 			trace.Log(trace.LogEvent, "Send Fail"),
 			trace.Log(trace.LogMessage, err.Error()),
 		)
@@ -89,14 +104,17 @@ func (t *traceConn) Send(commandName string, args ...interface{}) (err error) {
 
 func (t *traceConn) Flush() error {
 	defer t.slowLog("Flush", time.Now())
-	if t.trPipe == nil {
+	t.mu.Lock()
+	trPipe := t.trPipe
+	t.mu.Unlock()
+	if trPipe == nil {
 		return t.Conn.Flush()
 	}
-	t.trPipe.SetLog(trace.Log(trace.LogEvent, "Flush"))
+	trPipe.SetLog(trace.Log(trace.LogEvent, "Flush"))
 	err := t.Conn.Flush()
 	if err != nil {
-		t.trPipe.SetTag(trace.TagBool(trace.TagError, true))
-		t.trPipe.SetLog(
+		trPipe.SetTag(trace.TagBool(trace.TagError, true))
+		trPipe.SetLog(
 			trace.Log(trace.LogEvent, "Flush Fail"),
 			trace.Log(trace.LogMessage, err.Error()),
 		)
@@ -106,33 +124,40 @@ func (t *traceConn) Flush() error {
 
 func (t *traceConn) Receive() (reply interface{}, err error) {
 	defer t.slowLog("Receive", time.Now())
-	if t.trPipe == nil {
+	t.mu.Lock()
+	trPipe := t.trPipe
+	t.mu.Unlock()
+	if trPipe == nil {
 		return t.Conn.Receive()
 	}
-	t.trPipe.SetLog(trace.Log(trace.LogEvent, "Receive"))
+	trPipe.SetLog(trace.Log(trace.LogEvent, "Receive"))
 	reply, err = t.Conn.Receive()
 	if err != nil {
-		t.trPipe.SetTag(trace.TagBool(trace.TagError, true))
-		t.trPipe.SetLog(
+		trPipe.SetTag(trace.TagBool(trace.TagError, true))
+		trPipe.SetLog(
 			trace.Log(trace.LogEvent, "Receive Fail"),
 			trace.Log(trace.LogMessage, err.Error()),
 		)
 	}
+	t.mu.Lock()
 	if t.pending > 0 {
 		t.pending--
 	}
-	if t.pending == 0 {
-		t.trPipe.Finish(nil)
+	if t.pending == 0 && t.trPipe == trPipe {
+		trPipe.Finish(nil)
 		t.trPipe = nil
 	}
+	t.mu.Unlock()
 	return reply, err
 }
 
 func (t *traceConn) WithContext(ctx context.Context) Conn {
 	t.Conn = t.Conn.WithContext(ctx)
 	t.tr, _ = trace.FromContext(ctx)
+	t.mu.Lock()
 	t.pending = 0
 	t.trPipe = nil
+	t.mu.Unlock()
 	return t
 }
 
@@ -143,6 +168,51 @@ func (t *traceConn) slowLog(statement string, now time.Time) {
 	}
 }
 
+// observe feeds the hot key detector with the key of a command, the size
+// of its value is the largest of the size of the arguments after the key and
+// the size of the reply.
+func (t *traceConn) observe(commandName string, args []interface{}, reply interface{}) {
+	if t.hot == nil || len(args) == 0 {
+		return
+	}
+	size := replySize(reply)
+	if n := argsSize(args[1:]); n > size {
+		size = n
+	}
+	if !t.hot.Sample(size) {
+		return
+	}
+	if key, ok := commandKey(commandName, args); ok {
+		t.hot.Add(key, size)
+	}
+}
+
+func argsSize(args []interface{}) (n int) {
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case string:
+			n += len(arg)
+		case []byte:
+			n += len(arg)
+		}
+	}
+	return
+}
+
+func replySize(reply interface{}) (n int) {
+	switch reply := reply.(type) {
+	case []byte:
+		return len(reply)
+	case string:
+		return len(reply)
+	case []interface{}:
+		for _, r := range reply {
+			n += replySize(r)
+		}
+	}
+	return
+}
+
 func getStatement(commandName string, args ...interface{}) (res string) {
 	res = commandName
 	if len(args) > 0 {
@@ -8,6 +8,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/zombie-k/kylin/library/cache/hotkey"
 	"github.com/zombie-k/kylin/library/net/trace"
 )
 
@@ -211,3 +212,20 @@ func TestTraceConnPending(t *testing.T) {
 	tc.Do("")
 	assert.Equal(t, 0, tc.pending)
 }
+
+func TestTraceHotKey(t *testing.T) {
+	hotkey.Init(&hotkey.Config{Sample: 1, Enable: true})
+	defer hotkey.Init(nil)
+	hot := hotkey.Get("test_trace_hotkey")
+	tc := &traceConn{Conn: &mockConn{}, slowLogThreshold: testTraceSlowLogThreshold, hot: hot}
+	conn := tc.WithContext(context.Background())
+
+	conn.Do("SET", "a", "value")
+	conn.Do("GET", "a")
+	conn.Send("GET", "b")
+	conn.Do("PING")
+
+	s := hot.Snapshot()
+	assert.Equal(t, []hotkey.Key{{Key: "a", Count: 2, Size: 5}, {Key: "b", Count: 1}}, s.Hot)
+	assert.Equal(t, []hotkey.Key{{Key: "a", Count: 2, Size: 5}}, s.Big)
+}
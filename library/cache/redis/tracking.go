@@ -0,0 +1,575 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zombie-k/kylin/library/log"
+
+	pkgerr "github.com/pkg/errors"
+)
+
+const (
+	_defaultTrackingMaxKeys   = 10000
+	_defaultTrackingReaders   = 4
+	_defaultTrackingPing      = time.Second
+	_defaultTrackingReconnect = time.Second
+
+	_invalidateChannel = "__redis__:invalidate"
+)
+
+var errTrackingBroken = errors.New("redis: tracking reader conn broken")
+
+// TrackingOption specifies an option of the client-side cache.
+type TrackingOption struct {
+	f func(*trackingOptions)
+}
+
+type trackingOptions struct {
+	commands  []string
+	bcast     bool
+	prefixes  []string
+	resp3     bool
+	maxKeys   int
+	readers   int
+	ttl       time.Duration
+	ping      time.Duration
+	reconnect time.Duration
+}
+
+// TrackingCommands specifies the read commands served from the cache, GET
+// and HGETALL by default. Their first argument must be the key and their
+// replies depend only on the key, e.g. HGET or SMEMBERS.
+func TrackingCommands(names ...string) TrackingOption {
+	return TrackingOption{func(o *trackingOptions) {
+		o.commands = names
+	}}
+}
+
+// TrackingBroadcast specifies the BCAST mode: redis invalidates every key
+// starting with one of the prefixes, or every key without prefixes, rather
+// than remembering the keys read. Only the keys of the prefixes are cached.
+func TrackingBroadcast(prefixes ...string) TrackingOption {
+	return TrackingOption{func(o *trackingOptions) {
+		o.bcast = true
+		o.prefixes = prefixes
+	}}
+}
+
+// TrackingRESP3 specifies the invalidations are received as RESP3 push
+// frames, rather than as messages of the __redis__:invalidate channel, on a
+// connection dialed with HELLO 3. The server must be redis 6 or later.
+func TrackingRESP3() TrackingOption {
+	return TrackingOption{func(o *trackingOptions) {
+		o.resp3 = true
+	}}
+}
+
+// TrackingMaxKeys specifies the max keys cached, 10000 by default. A random
+// key is evicted to cache another one.
+func TrackingMaxKeys(n int) TrackingOption {
+	return TrackingOption{func(o *trackingOptions) {
+		o.maxKeys = n
+	}}
+}
+
+// TrackingReaders specifies the max reader connections reading the misses
+// concurrently, 4 by default. They are taken from the pool of the Redis
+// while tracking.
+func TrackingReaders(n int) TrackingOption {
+	return TrackingOption{func(o *trackingOptions) {
+		o.readers = n
+	}}
+}
+
+// TrackingTTL specifies the expiration of the cached replies, a bound of
+// their staleness if an invalidation is lost. They expire only when
+// invalidated by default.
+func TrackingTTL(d time.Duration) TrackingOption {
+	return TrackingOption{func(o *trackingOptions) {
+		o.ttl = d
+	}}
+}
+
+// TrackingPingInterval specifies the interval of the pings detecting a dead
+// redirect connection, 1s by default. It must be shorter than the read
+// timeout of the connections.
+func TrackingPingInterval(d time.Duration) TrackingOption {
+	return TrackingOption{func(o *trackingOptions) {
+		o.ping = d
+	}}
+}
+
+// TrackingReconnectInterval specifies the wait before tracking again after
+// a connection broke, 1s by default.
+func TrackingReconnectInterval(d time.Duration) TrackingOption {
+	return TrackingOption{func(o *trackingOptions) {
+		o.reconnect = d
+	}}
+}
+
+// TrackingStats is the counters of a Tracking.
+type TrackingStats struct {
+	Hits          uint64
+	Misses        uint64
+	Invalidations uint64 // keys invalidated
+	Flushes       uint64 // whole cache flushed
+	Reconnects    uint64
+}
+
+// Tracking is a client-side cache of redis 6 CLIENT TRACKING, enabled by
+// Redis.EnableTracking. The whitelisted read commands of Redis.Do are served
+// from a local cache, the misses are read on reader connections whose
+// tracked keys redis invalidates on a redirect connection: a subscriber of
+// the __redis__:invalidate channel, or a RESP3 connection receiving push
+// frames.
+//
+// The invalidations sent while a connection is broken are lost, so the
+// cache is flushed and the commands are sent to redis until the
+// connections are tracking again. The cached replies are shared, the
+// callers must not modify them.
+type Tracking struct {
+	r        *Redis
+	name     string
+	o        trackingOptions
+	commands map[string]struct{}
+
+	ctx    context.Context
+	cancel func()
+	wg     sync.WaitGroup
+
+	// mu guards the fields below.
+	mu sync.Mutex
+	// readers is nil while not tracking.
+	readers *trackingReaders
+	entries map[string]map[string]*trackingEntry
+	// seq counts the invalidations, the fills of the keys invalidated
+	// since they started are not cached.
+	seq      uint64
+	flushSeq uint64
+	fills    map[string]*trackingFill
+
+	hits, misses, invalidations, flushes, reconnects uint64
+}
+
+type trackingEntry struct {
+	reply  interface{}
+	expire time.Time
+}
+
+// trackingReaders is the reader connections tracked with the redirect
+// connection of a track, their idle list is guarded by Tracking.mu.
+type trackingReaders struct {
+	args  Args
+	slots chan struct{}
+	wg    sync.WaitGroup
+	idle  []Conn
+	conns []Conn
+}
+
+// trackingFill is the reads of a key in flight.
+type trackingFill struct {
+	n   int
+	seq uint64 // of the last invalidation of the key
+}
+
+// EnableTracking enables the client-side cache of r, it must be called
+// before r is used. Tracking a SentinelConfig.ReadReplicas redis is not
+// supported.
+func (r *Redis) EnableTracking(options ...TrackingOption) *Tracking {
+	o := trackingOptions{
+		commands:  []string{"GET", "HGETALL"},
+		maxKeys:   _defaultTrackingMaxKeys,
+		readers:   _defaultTrackingReaders,
+		ping:      _defaultTrackingPing,
+		reconnect: _defaultTrackingReconnect,
+	}
+	for _, option := range options {
+		option.f(&o)
+	}
+	if o.readers <= 0 {
+		o.readers = _defaultTrackingReaders
+	}
+	t := &Tracking{
+		r:        r,
+		name:     r.conf.Name,
+		o:        o,
+		commands: make(map[string]struct{}),
+		entries:  make(map[string]map[string]*trackingEntry),
+		fills:    make(map[string]*trackingFill),
+	}
+	for _, name := range o.commands {
+		t.commands[strings.ToUpper(name)] = struct{}{}
+	}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	r.tracking = t
+	t.wg.Add(1)
+	go t.serve()
+	return t
+}
+
+// Stats returns the counters of the cache.
+func (t *Tracking) Stats() TrackingStats {
+	return TrackingStats{
+		Hits:          atomic.LoadUint64(&t.hits),
+		Misses:        atomic.LoadUint64(&t.misses),
+		Invalidations: atomic.LoadUint64(&t.invalidations),
+		Flushes:       atomic.LoadUint64(&t.flushes),
+		Reconnects:    atomic.LoadUint64(&t.reconnects),
+	}
+}
+
+// Close stops tracking, the commands are sent to redis afterwards.
+func (t *Tracking) Close() error {
+	t.cancel()
+	t.wg.Wait()
+	return nil
+}
+
+// do serves a whitelisted command from the cache, ok is false if the
+// command is not cached.
+func (t *Tracking) do(ctx context.Context, commandName string, args []interface{}) (reply interface{}, err error, ok bool) {
+	name := strings.ToUpper(commandName)
+	if _, ok = t.commands[name]; !ok || len(args) == 0 {
+		return nil, nil, false
+	}
+	key := argString(args[0])
+	if t.o.bcast && !t.prefixed(key) {
+		return nil, nil, false
+	}
+	sub := name
+	for _, arg := range args[1:] {
+		sub += "\x00" + argString(arg)
+	}
+	t.mu.Lock()
+	rs := t.readers
+	if rs == nil {
+		t.mu.Unlock()
+		return nil, nil, false
+	}
+	if e, hit := t.entries[key][sub]; hit && (e.expire.IsZero() || time.Now().Before(e.expire)) {
+		t.mu.Unlock()
+		atomic.AddUint64(&t.hits, 1)
+		_metricTrackingRequests.Inc(t.name, "hit")
+		return e.reply, nil, true
+	}
+	f := t.fills[key]
+	if f == nil {
+		f = &trackingFill{}
+		t.fills[key] = f
+	}
+	f.n++
+	seq := t.seq
+	t.mu.Unlock()
+	atomic.AddUint64(&t.misses, 1)
+	_metricTrackingRequests.Inc(t.name, "miss")
+
+	// the readers may be closed meanwhile, the command is sent to redis.
+	reader, err := t.get(ctx, rs)
+	if ok = err == nil; ok {
+		reply, err = reader.WithContext(ctx).Do(commandName, args...)
+	}
+
+	t.mu.Lock()
+	if ok && err == nil && t.readers == rs && f.seq <= seq && t.flushSeq <= seq {
+		t.set(key, sub, reply)
+	}
+	if f.n--; f.n == 0 {
+		delete(t.fills, key)
+	}
+	if ok {
+		if _, server := pkgerr.Cause(err).(Error); err != nil && !server {
+			// the state of the reader is unknown, track again.
+			if t.readers == rs {
+				t.stop()
+			}
+		} else {
+			rs.idle = append(rs.idle, reader)
+		}
+		rs.wg.Done()
+		<-rs.slots
+	}
+	t.mu.Unlock()
+	return reply, err, ok
+}
+
+// get returns a reader of rs, a new one tracked with the same redirect
+// connection if none is idle.
+func (t *Tracking) get(ctx context.Context, rs *trackingReaders) (Conn, error) {
+	select {
+	case rs.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	t.mu.Lock()
+	if t.readers != rs {
+		t.mu.Unlock()
+		<-rs.slots
+		return nil, errTrackingBroken
+	}
+	rs.wg.Add(1)
+	if n := len(rs.idle); n > 0 {
+		c := rs.idle[n-1]
+		rs.idle = rs.idle[:n-1]
+		t.mu.Unlock()
+		return c, nil
+	}
+	t.mu.Unlock()
+	c, err := t.dialReader(rs)
+	t.mu.Lock()
+	if err == nil {
+		rs.conns = append(rs.conns, c)
+	}
+	t.mu.Unlock()
+	if err != nil {
+		log.Warn("redis: tracking %s reader error(%v)", t.name, err)
+		rs.wg.Done()
+		<-rs.slots
+	}
+	return c, err
+}
+
+// dialReader connects a reader tracked with the redirect connection of rs.
+func (t *Tracking) dialReader(rs *trackingReaders) (Conn, error) {
+	c := t.r.Conn(t.ctx)
+	if _, err := c.Do("CLIENT", rs.args...); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (t *Tracking) prefixed(key string) bool {
+	if len(t.o.prefixes) == 0 {
+		return true
+	}
+	for _, p := range t.o.prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// set caches a reply, t.mu is held.
+func (t *Tracking) set(key, sub string, reply interface{}) {
+	subs, ok := t.entries[key]
+	if !ok {
+		if len(t.entries) >= t.o.maxKeys {
+			for evicted := range t.entries {
+				delete(t.entries, evicted)
+				break
+			}
+		}
+		subs = make(map[string]*trackingEntry)
+		t.entries[key] = subs
+	}
+	e := &trackingEntry{reply: reply}
+	if t.o.ttl > 0 {
+		e.expire = time.Now().Add(t.o.ttl)
+	}
+	subs[sub] = e
+}
+
+// invalidate removes keys from the cache, nil keys flush it.
+func (t *Tracking) invalidate(keys []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seq++
+	if keys == nil {
+		t.flush()
+		return
+	}
+	for _, key := range keys {
+		delete(t.entries, key)
+		if f, ok := t.fills[key]; ok {
+			f.seq = t.seq
+		}
+	}
+	atomic.AddUint64(&t.invalidations, uint64(len(keys)))
+	_metricTrackingInvalidations.Add(float64(len(keys)), t.name, "key")
+}
+
+// flush empties the cache, t.mu is held.
+func (t *Tracking) flush() {
+	t.seq++
+	t.flushSeq = t.seq
+	t.entries = make(map[string]map[string]*trackingEntry)
+	atomic.AddUint64(&t.flushes, 1)
+	_metricTrackingInvalidations.Inc(t.name, "flush")
+}
+
+// stop stops serving from the cache until tracking again, t.mu is held.
+func (t *Tracking) stop() {
+	t.readers = nil
+	t.flush()
+}
+
+func (t *Tracking) serve() {
+	defer t.wg.Done()
+	for {
+		err := t.track()
+		if t.ctx.Err() != nil {
+			return
+		}
+		log.Warn("redis: tracking %s error(%v), reconnect", t.name, err)
+		atomic.AddUint64(&t.reconnects, 1)
+		select {
+		case <-time.After(t.o.reconnect):
+		case <-t.ctx.Done():
+			return
+		}
+	}
+}
+
+// track connects the redirect connection and a first reader, then applies
+// the invalidations until a connection breaks.
+func (t *Tracking) track() error {
+	redirect, err := t.dialRedirect()
+	if err != nil {
+		return err
+	}
+	defer redirect.Close()
+	id, err := Int64(redirect.Do("CLIENT", "ID"))
+	if err != nil {
+		return err
+	}
+	if !t.o.resp3 {
+		if err = redirect.Send("SUBSCRIBE", _invalidateChannel); err == nil {
+			err = redirect.Flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	args := Args{}.Add("TRACKING", "on", "REDIRECT", id)
+	if t.o.bcast {
+		args = args.Add("BCAST")
+		for _, p := range t.o.prefixes {
+			args = args.Add("PREFIX", p)
+		}
+	}
+	rs := &trackingReaders{args: args, slots: make(chan struct{}, t.o.readers)}
+	reader, err := t.dialReader(rs)
+	if err != nil {
+		return err
+	}
+	rs.idle = append(rs.idle, reader)
+	rs.conns = append(rs.conns, reader)
+	t.mu.Lock()
+	t.flush()
+	t.readers = rs
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		if t.readers == rs {
+			t.stop()
+		}
+		t.mu.Unlock()
+		// no reader is taken once stopped, wait the ones reading.
+		rs.wg.Wait()
+		for _, c := range rs.conns {
+			c.Do("CLIENT", "TRACKING", "off")
+			c.Close()
+		}
+	}()
+
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		t.ping(redirect, done)
+	}()
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+	for {
+		reply, err := redirect.Receive()
+		if t.ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !t.o.resp3 {
+			t.message(reply)
+		}
+		t.mu.Lock()
+		broken := t.readers != rs
+		t.mu.Unlock()
+		if broken {
+			return errTrackingBroken
+		}
+	}
+}
+
+// dialRedirect connects the redirect connection, a RESP3 one delivering the
+// invalidations to its push handler.
+func (t *Tracking) dialRedirect() (Conn, error) {
+	if !t.o.resp3 {
+		return t.r.Conn(t.ctx), nil
+	}
+	addr := t.r.conf.Addr
+	if sp, ok := t.r.pool.(*SentinelPool); ok {
+		addr = sp.MasterAddr()
+	}
+	options := append(t.r.conf.dialOptions(), t.r.options...)
+	options = append(options, DialRESP3(), DialPushHandler(t.push))
+	return Dial(t.r.conf.Proto, addr, options...)
+}
+
+// message applies an invalidation message of the __redis__:invalidate
+// channel, the other replies are skipped.
+func (t *Tracking) message(reply interface{}) {
+	values, err := Values(reply, nil)
+	if err != nil || len(values) != 3 {
+		return
+	}
+	if kind, _ := String(values[0], nil); kind != "message" {
+		return
+	}
+	t.invalidateReply(values[2])
+}
+
+// push applies an invalidate push frame.
+func (t *Tracking) push(p Push) {
+	if p.Kind() == "invalidate" && len(p) == 2 {
+		t.invalidateReply(p[1])
+	}
+}
+
+// invalidateReply applies the keys of an invalidation, nil after a FLUSHALL
+// or FLUSHDB.
+func (t *Tracking) invalidateReply(reply interface{}) {
+	if reply == nil {
+		t.invalidate(nil)
+		return
+	}
+	keys, err := Strings(reply, nil)
+	if err != nil {
+		return
+	}
+	t.invalidate(keys)
+}
+
+// ping keeps the redirect connection reading within the read timeout, a
+// dead link fails the receive. A last ping returns the receive on Close.
+func (t *Tracking) ping(c Conn, done chan struct{}) {
+	ticker := time.NewTicker(t.o.ping)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-t.ctx.Done():
+		case <-done:
+			return
+		}
+		if c.Send("PING") != nil || c.Flush() != nil || t.ctx.Err() != nil {
+			return
+		}
+	}
+}
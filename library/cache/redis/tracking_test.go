@@ -0,0 +1,259 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTracking serves GET, HGETALL, SET and FLUSHALL, and sends the
+// invalidations of SET and FLUSHALL to the last subscriber of the
+// __redis__:invalidate channel. Like redis, a key is invalidated once after
+// it was read. The reads are delayed by delay nanoseconds.
+type fakeTracking struct {
+	ln    net.Listener
+	delay int64
+
+	mu       sync.Mutex
+	ids      int64
+	values   map[string]string
+	read     map[string]bool
+	gets     int
+	tracking []string
+	sub      *fakeWriter
+}
+
+func newFakeTracking(t *testing.T) *fakeTracking {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeTracking{ln: ln, values: make(map[string]string), read: make(map[string]bool)}
+	go serveFake(ln, f.handle)
+	return f
+}
+
+func (f *fakeTracking) handle(w *fakeWriter, req []string) {
+	if strings.ToUpper(req[0]) == "GET" {
+		time.Sleep(time.Duration(atomic.LoadInt64(&f.delay)))
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch strings.ToUpper(req[0]) {
+	case "CLIENT":
+		if strings.ToUpper(req[1]) == "ID" {
+			f.ids++
+			w.write(f.ids)
+			return
+		}
+		f.tracking = append(f.tracking, strings.Join(req[2:], " "))
+		w.write("OK")
+	case "SUBSCRIBE":
+		f.sub = w
+		w.write([]interface{}{[]byte("subscribe"), []byte(req[1]), int64(1)})
+	case "GET":
+		f.gets++
+		f.read[req[1]] = true
+		if v, ok := f.values[req[1]]; ok {
+			w.write([]byte(v))
+			return
+		}
+		w.write(nil)
+	case "HGETALL":
+		f.gets++
+		f.read[req[1]] = true
+		w.write([]interface{}{[]byte("field"), []byte(f.values[req[1]])})
+	case "SET":
+		f.values[req[1]] = req[2]
+		if f.read[req[1]] {
+			delete(f.read, req[1])
+			f.invalidate([]interface{}{[]byte(req[1])})
+		}
+		w.write("OK")
+	case "FLUSHALL":
+		f.values = make(map[string]string)
+		f.read = make(map[string]bool)
+		f.invalidate(nil)
+		w.write("OK")
+	case "PING":
+		w.write("PONG")
+	default:
+		w.write(Error("ERR unknown command"))
+	}
+}
+
+// invalidate sends an invalidation message, f.mu is held.
+func (f *fakeTracking) invalidate(keys interface{}) {
+	if f.sub != nil {
+		f.sub.write([]interface{}{[]byte("message"), []byte(_invalidateChannel), keys})
+	}
+}
+
+// breakSub sends a malformed reply to the subscriber.
+func (f *fakeTracking) breakSub() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sub.mu.Lock()
+	f.sub.w.WriteString("?\r\n")
+	f.sub.w.Flush()
+	f.sub.mu.Unlock()
+	f.sub = nil
+}
+
+func (f *fakeTracking) stats() (gets int, tracking []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.gets, append([]string(nil), f.tracking...)
+}
+
+// waitTracking waits until the cache is served.
+func waitTracking(t *testing.T, tr *Tracking) {
+	for i := 0; i < 100; i++ {
+		tr.mu.Lock()
+		ok := tr.readers != nil
+		tr.mu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("not tracking")
+}
+
+func TestTracking(t *testing.T) {
+	f := newFakeTracking(t)
+	defer f.ln.Close()
+	r := newTestRedis("test_tracking", f.ln.Addr().String())
+	defer r.Close()
+	tr := r.EnableTracking(TrackingPingInterval(100*time.Millisecond), TrackingReconnectInterval(10*time.Millisecond))
+	waitTracking(t, tr)
+	ctx := context.Background()
+	_, tracking := f.stats()
+	assert.Equal(t, []string{"on REDIRECT 1"}, tracking)
+
+	_, err := r.Do(ctx, "SET", "a", "1")
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		v, err := String(r.Do(ctx, "GET", "a"))
+		assert.Nil(t, err)
+		assert.Equal(t, "1", v)
+	}
+	m, err := StringMap(r.Do(ctx, "hgetall", "a"))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"field": "1"}, m)
+	_, err = r.Do(ctx, "HGETALL", "a")
+	assert.Nil(t, err)
+	gets, _ := f.stats()
+	assert.Equal(t, 2, gets)
+	assert.Equal(t, uint64(3), tr.Stats().Hits)
+	assert.Equal(t, uint64(2), tr.Stats().Misses)
+
+	// a write invalidates the key.
+	_, err = r.Do(ctx, "SET", "a", "2")
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		v, _ := String(r.Do(ctx, "GET", "a"))
+		return v == "2"
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint64(1), tr.Stats().Invalidations)
+
+	// a nil payload flushes the cache.
+	flushes := tr.Stats().Flushes
+	_, err = r.Do(ctx, "FLUSHALL")
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := String(r.Do(ctx, "GET", "a"))
+		return err == ErrNil
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, flushes+1, tr.Stats().Flushes)
+
+	// a broken redirect connection flushes the cache and tracks again.
+	_, err = r.Do(ctx, "SET", "b", "1")
+	assert.Nil(t, err)
+	_, err = r.Do(ctx, "GET", "b")
+	assert.Nil(t, err)
+	gets, _ = f.stats()
+	f.breakSub()
+	assert.Eventually(t, func() bool {
+		return tr.Stats().Reconnects == 1
+	}, time.Second, 10*time.Millisecond)
+	waitTracking(t, tr)
+	_, err = r.Do(ctx, "GET", "b")
+	assert.Nil(t, err)
+	n, tracking := f.stats()
+	assert.Equal(t, gets+1, n)
+	assert.Equal(t, "on REDIRECT 2", tracking[len(tracking)-1])
+
+	// closed, the commands are sent to redis.
+	assert.Nil(t, tr.Close())
+	_, err = r.Do(ctx, "GET", "b")
+	assert.Nil(t, err)
+	gets, tracking = f.stats()
+	assert.Equal(t, n+1, gets)
+	assert.Equal(t, "off", tracking[len(tracking)-1])
+}
+
+func TestTrackingBroadcast(t *testing.T) {
+	f := newFakeTracking(t)
+	defer f.ln.Close()
+	r := newTestRedis("test_tracking", f.ln.Addr().String())
+	defer r.Close()
+	tr := r.EnableTracking(TrackingBroadcast("user:"), TrackingCommands("GET"), TrackingTTL(50*time.Millisecond))
+	waitTracking(t, tr)
+	ctx := context.Background()
+	_, tracking := f.stats()
+	assert.Equal(t, []string{"on REDIRECT 1 BCAST PREFIX user:"}, tracking)
+
+	for _, key := range []string{"user:1", "user:1", "item:1", "item:1"} {
+		reply, err := r.Do(ctx, "GET", key)
+		assert.Nil(t, err)
+		assert.Nil(t, reply)
+	}
+	gets, _ := f.stats()
+	assert.Equal(t, 3, gets)
+	_, err := r.Do(ctx, "HGETALL", "user:1")
+	assert.Nil(t, err)
+
+	// an expired reply is read again.
+	time.Sleep(60 * time.Millisecond)
+	_, err = String(r.Do(ctx, "GET", "user:1"))
+	assert.Equal(t, ErrNil, err)
+	gets, _ = f.stats()
+	assert.Equal(t, 5, gets)
+}
+
+func TestTrackingReaders(t *testing.T) {
+	f := newFakeTracking(t)
+	defer f.ln.Close()
+	r := newTestRedis("test_tracking", f.ln.Addr().String())
+	defer r.Close()
+	tr := r.EnableTracking(TrackingReaders(2))
+	waitTracking(t, tr)
+	atomic.StoreInt64(&f.delay, int64(100*time.Millisecond))
+
+	// the misses are read concurrently, on at most 2 readers tracked with
+	// the same redirect connection.
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := r.Do(context.Background(), "GET", fmt.Sprintf("key%d", i))
+			assert.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+	assert.True(t, time.Since(start) < 400*time.Millisecond)
+	gets, tracking := f.stats()
+	assert.Equal(t, 4, gets)
+	assert.Equal(t, []string{"on REDIRECT 1", "on REDIRECT 1"}, tracking)
+	assert.Equal(t, uint64(4), tr.Stats().Misses)
+}
@@ -0,0 +1,172 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	_defaultTxRetries    = 3
+	_defaultTxBackoff    = 5 * time.Millisecond
+	_defaultTxMaxBackoff = 100 * time.Millisecond
+)
+
+// ErrTxConflict is returned by Tx when a watched key is changed by another
+// client in every attempt.
+var ErrTxConflict = errors.New("redis: transaction conflict, watched keys changed")
+
+// TxOption specifies an option of Tx.
+type TxOption struct {
+	f func(*txOptions)
+}
+
+type txOptions struct {
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// TxRetries specifies how many times a conflicting transaction is retried,
+// 3 by default.
+func TxRetries(n int) TxOption {
+	return TxOption{func(o *txOptions) {
+		o.retries = n
+	}}
+}
+
+// TxBackoff specifies the wait before the first retry, it doubles at every
+// retry up to max. The defaults are 5ms and 100ms.
+func TxBackoff(backoff, max time.Duration) TxOption {
+	return TxOption{func(o *txOptions) {
+		o.backoff = backoff
+		o.maxBackoff = max
+	}}
+}
+
+// Tx is an optimistic transaction on the connection pinned by Redis.Tx.
+type Tx struct {
+	conn Conn
+	cmds []*cmd
+}
+
+// Do runs a command at once, before the queued commands, e.g. reading the
+// watched keys the queued commands depend on.
+func (tx *Tx) Do(commandName string, args ...interface{}) (interface{}, error) {
+	return tx.conn.Do(commandName, args...)
+}
+
+// Watch watches more keys, e.g. the keys read by Do.
+func (tx *Tx) Watch(keys ...string) error {
+	_, err := tx.conn.Do("WATCH", stringArgs(keys)...)
+	return err
+}
+
+// Send queues a command to run atomically by EXEC.
+func (tx *Tx) Send(commandName string, args ...interface{}) {
+	tx.cmds = append(tx.cmds, &cmd{commandName: commandName, args: args})
+}
+
+// Tx runs fn as an optimistic transaction: the keys are watched on a pinned
+// connection, fn reads with tx.Do and queues the writes with tx.Send, then
+// the queued commands run by MULTI and EXEC. If a watched key is changed
+// before EXEC, fn runs again after a backoff, up to the retry limit, then Tx
+// returns ErrTxConflict. fn must not keep state across runs.
+//
+// The replies of the queued commands are returned in order, with the error
+// of each command. If a command is refused when it is queued, nothing runs,
+// the refused command has its error and Tx returns the EXECABORT error.
+func (r *Redis) Tx(ctx context.Context, keys []string, fn func(tx *Tx) error, options ...TxOption) (*Replies, error) {
+	o := txOptions{
+		retries:    _defaultTxRetries,
+		backoff:    _defaultTxBackoff,
+		maxBackoff: _defaultTxMaxBackoff,
+	}
+	for _, option := range options {
+		option.f(&o)
+	}
+	watched := stringArgs(keys)
+	conn := r.pool.Get(ctx)
+	defer conn.Close()
+	backoff := o.backoff
+	for attempt := 0; ; attempt++ {
+		rps, err := execTx(conn, watched, fn)
+		if err != ErrTxConflict {
+			return rps, err
+		}
+		_metricTxConflicts.Inc(r.conf.Name)
+		if attempt >= o.retries {
+			return nil, err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if backoff *= 2; backoff > o.maxBackoff {
+			backoff = o.maxBackoff
+		}
+	}
+}
+
+// execTx runs one attempt of a transaction.
+func execTx(conn Conn, keys []interface{}, fn func(tx *Tx) error) (*Replies, error) {
+	if len(keys) > 0 {
+		if _, err := conn.Do("WATCH", keys...); err != nil {
+			return nil, err
+		}
+	}
+	tx := &Tx{conn: conn}
+	if err := fn(tx); err != nil {
+		conn.Do("UNWATCH")
+		return nil, err
+	}
+	if len(tx.cmds) == 0 {
+		_, err := conn.Do("UNWATCH")
+		return &Replies{}, err
+	}
+	cmds := make([]*cmd, 0, len(tx.cmds)+2)
+	cmds = append(cmds, &cmd{commandName: "MULTI"})
+	cmds = append(cmds, tx.cmds...)
+	cmds = append(cmds, &cmd{commandName: "EXEC"})
+	rps, err := execCmds(conn, cmds)
+	if err != nil {
+		return nil, err
+	}
+	if err = rps[0].err; err != nil {
+		return nil, err
+	}
+	queued, exec := rps[1:len(rps)-1], rps[len(rps)-1]
+	if exec.err != nil {
+		// the commands refused when queued have their errors.
+		replies := make([]*reply, len(queued))
+		for i, rp := range queued {
+			replies[i] = &reply{err: rp.err}
+		}
+		return &Replies{replies: replies}, exec.err
+	}
+	if exec.reply == nil {
+		return nil, ErrTxConflict
+	}
+	values, err := Values(exec.reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	replies := make([]*reply, len(values))
+	for i, v := range values {
+		if e, ok := v.(Error); ok {
+			replies[i] = &reply{err: e}
+		} else {
+			replies[i] = &reply{reply: v}
+		}
+	}
+	return &Replies{replies: replies}, nil
+}
+
+func stringArgs(ss []string) []interface{} {
+	args := make([]interface{}, len(ss))
+	for i, s := range ss {
+		args[i] = s
+	}
+	return args
+}
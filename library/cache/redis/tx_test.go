@@ -0,0 +1,97 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache/redis/redistest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTx(t *testing.T) {
+	srv, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	r := newTestRedis("test_tx", srv.Addr())
+	defer r.Close()
+	ctx := context.Background()
+
+	// a conflicting write is retried.
+	_, err = r.Do(ctx, "SET", "counter", "10")
+	assert.Nil(t, err)
+	runs := 0
+	rs, err := r.Tx(ctx, []string{"counter"}, func(tx *Tx) error {
+		runs++
+		v, err := Int(tx.Do("GET", "counter"))
+		if err != nil {
+			return err
+		}
+		if runs == 1 {
+			r.Do(ctx, "SET", "counter", "20")
+		}
+		tx.Send("SET", "counter", v*2)
+		tx.Send("INCR", "text")
+		return nil
+	}, TxBackoff(time.Millisecond, time.Millisecond))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, runs)
+	s, err := String(rs.Scan())
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", s)
+	i, err := Int(rs.Scan())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, i)
+	v, err := Int(r.Do(ctx, "GET", "counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, 40, v)
+
+	// the errors are per command.
+	_, err = r.Do(ctx, "SET", "text", "x")
+	assert.Nil(t, err)
+	rs, err = r.Tx(ctx, nil, func(tx *Tx) error {
+		tx.Send("INCR", "text")
+		tx.Send("SET", "other", "y")
+		return nil
+	})
+	assert.Nil(t, err)
+	_, err = rs.Scan()
+	assert.NotNil(t, err)
+	s, err = String(rs.Scan())
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", s)
+
+	// a command refused when queued aborts the transaction.
+	rs, err = r.Tx(ctx, nil, func(tx *Tx) error {
+		tx.Send("SET", "aborted", "y")
+		tx.Send("NOSUCH")
+		return nil
+	})
+	assert.Equal(t, Error("EXECABORT Transaction discarded because of previous errors."), err)
+	_, err = rs.Scan()
+	assert.Nil(t, err)
+	_, err = rs.Scan()
+	assert.Equal(t, Error("ERR unknown command 'NOSUCH'"), err)
+	_, err = String(r.Do(ctx, "GET", "aborted"))
+	assert.Equal(t, ErrNil, err)
+
+	// the conflicts end with ErrTxConflict.
+	runs = 0
+	_, err = r.Tx(ctx, []string{"counter"}, func(tx *Tx) error {
+		runs++
+		r.Do(ctx, "INCR", "counter")
+		tx.Send("SET", "counter", "0")
+		return nil
+	}, TxRetries(2), TxBackoff(time.Millisecond, time.Millisecond))
+	assert.Equal(t, ErrTxConflict, err)
+	assert.Equal(t, 3, runs)
+
+	// an error of fn is returned as is.
+	errFn := errors.New("fn")
+	_, err = r.Tx(ctx, []string{"counter"}, func(tx *Tx) error { return errFn })
+	assert.Equal(t, errFn, err)
+}
@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	xtime "github.com/zombie-k/kylin/library/time"
+)
+
+// The algorithms of a limit.
+const (
+	// GCRA is the generic cell rate algorithm: the requests are spread evenly
+	// over the period, bursts of up to Burst requests are allowed.
+	GCRA = "gcra"
+	// SlidingWindow is the sliding window log: at most Rate requests in any
+	// window of Period, the timestamps of the requests are kept in a zset.
+	SlidingWindow = "sliding"
+)
+
+// Limit is the limit of the keys with a prefix.
+type Limit struct {
+	// Algorithm is GCRA or SlidingWindow, GCRA if empty.
+	Algorithm string
+	// Rate is the requests allowed per Period.
+	Rate   int64
+	Period xtime.Duration
+	// Burst is the requests allowed at once by GCRA, Rate if zero.
+	Burst int64
+}
+
+// Config is the settings of a limiter.
+type Config struct {
+	Name string // limiter name, for metrics and logs
+	// KeyPrefix prefixes the redis keys, "ratelimit:" if empty.
+	KeyPrefix string
+	// Limits are the limits by key prefix, the limit of the longest prefix
+	// of a key applies, the "" prefix applies to every key. The keys without
+	// a limit are not limited.
+	Limits map[string]*Limit
+	// Degrade is how long the local token buckets serve the requests after
+	// redis failed, before redis is tried again.
+	Degrade xtime.Duration
+}
+
+const (
+	_defaultKeyPrefix = "ratelimit:"
+	_defaultDegrade   = xtime.Duration(time.Second)
+)
+
+// Builder checks c and fills the defaults.
+func (c *Config) Builder() error {
+	if c.Name == "" {
+		c.Name = "default"
+	}
+	if c.KeyPrefix == "" {
+		c.KeyPrefix = _defaultKeyPrefix
+	}
+	if c.Degrade <= 0 {
+		c.Degrade = _defaultDegrade
+	}
+	for prefix, l := range c.Limits {
+		if l == nil || l.Rate <= 0 || l.Period <= 0 {
+			return fmt.Errorf("ratelimit: limit of prefix %q requires rate and period", prefix)
+		}
+		switch l.Algorithm {
+		case "":
+			l.Algorithm = GCRA
+		case GCRA, SlidingWindow:
+		default:
+			return fmt.Errorf("ratelimit: limit of prefix %q unknown algorithm %q", prefix, l.Algorithm)
+		}
+		if l.Burst <= 0 {
+			l.Burst = l.Rate
+		}
+	}
+	return nil
+}
+
+type rule struct {
+	prefix string
+	limit  *Limit
+}
+
+// rules are the limits of a config sorted by descending prefix length.
+type rules struct {
+	c     *Config
+	rules []rule
+}
+
+func newRules(c *Config) *rules {
+	rs := &rules{c: c}
+	for prefix, l := range c.Limits {
+		rs.rules = append(rs.rules, rule{prefix: prefix, limit: l})
+	}
+	sort.Slice(rs.rules, func(i, j int) bool {
+		return len(rs.rules[i].prefix) > len(rs.rules[j].prefix)
+	})
+	return rs
+}
+
+// match returns the limit of key and its prefix, nil if key is not limited.
+func (rs *rules) match(key string) (string, *Limit) {
+	for _, r := range rs.rules {
+		if len(key) >= len(r.prefix) && key[:len(r.prefix)] == r.prefix {
+			return r.prefix, r.limit
+		}
+	}
+	return "", nil
+}
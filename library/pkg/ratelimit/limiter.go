@@ -0,0 +1,127 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache/redis"
+	"github.com/zombie-k/kylin/library/log"
+)
+
+// Result is the result of Allow.
+type Result struct {
+	// Allowed reports whether the n requests are allowed.
+	Allowed bool
+	// Remaining is the requests allowed right after, -1 if the key is not
+	// limited.
+	Remaining int64
+	// RetryAfter is how long until n requests are allowed if they are not,
+	// -1 if n exceeds the limit and they never are.
+	RetryAfter time.Duration
+}
+
+// Limiter limits the requests of keys across the instances sharing a redis,
+// the state of the keys is updated atomically by Lua scripts. While redis is
+// unreachable the requests are limited by local token buckets instead.
+type Limiter struct {
+	r     *redis.Redis
+	rules atomic.Value // *rules
+	local atomic.Value // *local
+	// degraded is the unix nano time until which the local buckets serve.
+	degraded int64
+}
+
+// New new a limiter.
+func New(c *Config, r *redis.Redis) (*Limiter, error) {
+	l := &Limiter{r: r}
+	if err := l.Reload(c); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload hot reloads the config, the local buckets are reset.
+func (l *Limiter) Reload(c *Config) error {
+	if err := c.Builder(); err != nil {
+		return err
+	}
+	l.rules.Store(newRules(c))
+	l.local.Store(newLocal())
+	return nil
+}
+
+// Allow takes n requests of key if they are allowed. The error is not nil
+// only if n is negative or ctx is done while calling redis, the other redis
+// failures degrade to the local buckets.
+func (l *Limiter) Allow(ctx context.Context, key string, n int64) (res Result, err error) {
+	if n < 0 {
+		return Result{}, fmt.Errorf("ratelimit: negative n %d", n)
+	}
+	rs := l.rules.Load().(*rules)
+	prefix, limit := rs.match(key)
+	if limit == nil {
+		return Result{Allowed: true, Remaining: -1}, nil
+	}
+	now := time.Now()
+	if now.UnixNano() < atomic.LoadInt64(&l.degraded) {
+		res = l.allowLocal(rs, key, limit, n, now)
+	} else if res, err = l.allowRedis(ctx, rs.c.KeyPrefix+key, limit, n); err != nil {
+		if ctx.Err() != nil {
+			return Result{}, ctx.Err()
+		}
+		log.Error("ratelimit: %s allow key %s error(%v), degrade to local buckets for %v", rs.c.Name, key, err, time.Duration(rs.c.Degrade))
+		atomic.StoreInt64(&l.degraded, now.Add(time.Duration(rs.c.Degrade)).UnixNano())
+		res, err = l.allowLocal(rs, key, limit, n, now), nil
+	}
+	if res.Allowed {
+		_metricRequests.Inc(rs.c.Name, prefix, "allowed")
+	} else {
+		_metricRequests.Inc(rs.c.Name, prefix, "limited")
+	}
+	return
+}
+
+func (l *Limiter) allowLocal(rs *rules, key string, limit *Limit, n int64, now time.Time) Result {
+	_metricDegraded.Inc(rs.c.Name)
+	return l.local.Load().(*local).allow(key, limit, n, now)
+}
+
+func (l *Limiter) allowRedis(ctx context.Context, key string, limit *Limit, n int64) (Result, error) {
+	period := int64(time.Duration(limit.Period) / time.Microsecond)
+	conn := l.r.Conn(ctx)
+	defer conn.Close()
+	var (
+		reply interface{}
+		err   error
+	)
+	switch limit.Algorithm {
+	case SlidingWindow:
+		b := make([]byte, 8)
+		if _, err = rand.Read(b); err != nil {
+			return Result{}, err
+		}
+		reply, err = slidingScript.Do(conn, key, limit.Rate, period, n, hex.EncodeToString(b))
+	default:
+		interval := period / limit.Rate
+		if interval == 0 {
+			interval = 1
+		}
+		reply, err = gcraScript.Do(conn, key, interval, interval*limit.Burst, n)
+	}
+	values, err := redis.Int64s(reply, err)
+	if err != nil {
+		return Result{}, err
+	}
+	if len(values) != 3 {
+		return Result{}, fmt.Errorf("ratelimit: unexpected reply %v", values)
+	}
+	res := Result{Allowed: values[0] == 1, Remaining: values[1], RetryAfter: -1}
+	if values[2] >= 0 {
+		res.RetryAfter = time.Duration(values[2]) * time.Microsecond
+	}
+	return res, nil
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+const _maxBuckets = 10000
+
+// bucket is a token bucket of Burst tokens refilled at Rate per Period.
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // when the bucket is full again
+}
+
+// local holds the token buckets serving the requests while redis is down,
+// each instance allows the limit on its own.
+type local struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func newLocal() *local {
+	return &local{buckets: make(map[string]*bucket)}
+}
+
+func (lc *local) allow(key string, l *Limit, n int64, now time.Time) Result {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	rate := float64(l.Rate) / float64(time.Duration(l.Period))
+	capacity := float64(l.Rate)
+	if l.Algorithm == GCRA {
+		capacity = float64(l.Burst)
+	}
+	b, ok := lc.buckets[key]
+	if !ok {
+		if len(lc.buckets) >= _maxBuckets {
+			lc.sweep(now)
+		}
+		b = &bucket{tokens: capacity, last: now}
+		lc.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += float64(elapsed) * rate
+		if b.tokens > capacity {
+			b.tokens = capacity
+		}
+		b.last = now
+	}
+	need := float64(n)
+	if need > capacity {
+		return Result{Remaining: int64(b.tokens), RetryAfter: -1}
+	}
+	if b.tokens < need {
+		return Result{Remaining: int64(b.tokens), RetryAfter: time.Duration((need - b.tokens) / rate)}
+	}
+	b.tokens -= need
+	b.full = now.Add(time.Duration((capacity - b.tokens) / rate))
+	return Result{Allowed: true, Remaining: int64(b.tokens)}
+}
+
+// sweep drops the buckets full again, which are the same as new ones, or
+// all of them if none is.
+func (lc *local) sweep(now time.Time) {
+	for key, b := range lc.buckets {
+		if !now.Before(b.full) {
+			delete(lc.buckets, key)
+		}
+	}
+	if len(lc.buckets) >= _maxBuckets {
+		lc.buckets = make(map[string]*bucket)
+	}
+}
@@ -0,0 +1,22 @@
+package ratelimit
+
+import "github.com/zombie-k/kylin/library/stat/metric"
+
+const namespace = "ratelimit"
+
+var (
+	_metricRequests = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "limiter",
+		Name:      "requests_total",
+		Help:      "rate limiter requests total by result: allowed or limited.",
+		Labels:    []string{"name", "prefix", "result"},
+	})
+	_metricDegraded = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "limiter",
+		Name:      "degraded_total",
+		Help:      "rate limiter requests total served by the local token buckets.",
+		Labels:    []string{"name"},
+	})
+)
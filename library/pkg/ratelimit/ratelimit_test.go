@@ -0,0 +1,315 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache/redis"
+	"github.com/zombie-k/kylin/library/container/pool"
+	xtime "github.com/zombie-k/kylin/library/time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedis evaluates the scripts of the limiter by their Go equivalents,
+// it can fail every command to simulate an outage.
+type fakeRedis struct {
+	ln      net.Listener
+	mu      sync.Mutex
+	tats    map[string]float64
+	logs    map[string][]float64
+	scripts map[string]string
+	evals   int
+	down    bool
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fr := &fakeRedis{ln: ln, tats: make(map[string]float64), logs: make(map[string][]float64), scripts: make(map[string]string)}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go fr.serveConn(nc)
+		}
+	}()
+	return fr
+}
+
+func (fr *fakeRedis) serveConn(nc net.Conn) {
+	defer nc.Close()
+	// a client conn reads the requests like replies.
+	rc, _ := redis.Dial("", "", redis.DialNetDial(func(string, string) (net.Conn, error) { return nc, nil }))
+	w := bufio.NewWriter(nc)
+	for {
+		req, err := redis.Strings(rc.Receive())
+		if err != nil {
+			return
+		}
+		fr.mu.Lock()
+		reply := fr.handle(req)
+		fr.mu.Unlock()
+		writeReply(w, reply)
+		if w.Flush() != nil {
+			return
+		}
+	}
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch reply := reply.(type) {
+	case redis.Error:
+		w.WriteString("-" + string(reply) + "\r\n")
+	case []int64:
+		fmt.Fprintf(w, "*%d\r\n", len(reply))
+		for _, v := range reply {
+			fmt.Fprintf(w, ":%d\r\n", v)
+		}
+	}
+}
+
+func (fr *fakeRedis) handle(req []string) interface{} {
+	if fr.down {
+		return redis.Error("LOADING Redis is loading the dataset in memory")
+	}
+	var src string
+	switch req[0] {
+	case "EVALSHA":
+		var ok bool
+		if src, ok = fr.scripts[req[1]]; !ok {
+			return redis.Error("NOSCRIPT No matching script. Please use EVAL.")
+		}
+	case "EVAL":
+		src = req[1]
+		h := sha1.Sum([]byte(src))
+		fr.scripts[hex.EncodeToString(h[:])] = src
+	default:
+		return redis.Error("ERR unknown command " + req[0])
+	}
+	fr.evals++
+	key, args := req[3], make([]float64, len(req)-4)
+	for i, a := range req[4:] {
+		args[i], _ = strconv.ParseFloat(a, 64)
+	}
+	now := float64(time.Now().UnixNano() / 1000)
+	switch src {
+	case _gcraSrc:
+		return fr.gcra(key, args[0], args[1], args[2], now)
+	case _slidingSrc:
+		return fr.sliding(key, args[0], args[1], args[2], now)
+	}
+	return redis.Error("ERR unknown script")
+}
+
+func (fr *fakeRedis) gcra(key string, interval, offset, n, now float64) interface{} {
+	tat, ok := fr.tats[key]
+	if !ok || tat < now {
+		tat = now
+	}
+	remaining := int64(math.Floor((now - (tat - offset)) / interval))
+	if n*interval > offset {
+		return []int64{0, remaining, -1}
+	}
+	newTat := tat + n*interval
+	diff := now - (newTat - offset)
+	if diff < 0 {
+		return []int64{0, remaining, int64(-diff)}
+	}
+	fr.tats[key] = newTat
+	return []int64{1, int64(math.Floor(diff / interval)), 0}
+}
+
+func (fr *fakeRedis) sliding(key string, limit, window, n, now float64) interface{} {
+	var log []float64
+	for _, t := range fr.logs[key] {
+		if t > now-window {
+			log = append(log, t)
+		}
+	}
+	count := float64(len(log))
+	if n > limit {
+		return []int64{0, int64(limit - count), -1}
+	}
+	if count+n > limit {
+		sort.Float64s(log)
+		return []int64{0, int64(limit - count), int64(log[int(count+n-limit-1)] + window - now)}
+	}
+	for i := 0; i < int(n); i++ {
+		log = append(log, now)
+	}
+	fr.logs[key] = log
+	return []int64{1, int64(limit - count - n), 0}
+}
+
+func (fr *fakeRedis) setDown(down bool) {
+	fr.mu.Lock()
+	fr.down = down
+	fr.mu.Unlock()
+}
+
+func (fr *fakeRedis) evaluated() int {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	return fr.evals
+}
+
+func newTestRedis(addr string) *redis.Redis {
+	return redis.NewRedis(&redis.Config{
+		Config:       &pool.Config{Active: 10, Idle: 2, IdleTimeout: xtime.Duration(time.Minute)},
+		Name:         "test_ratelimit",
+		Proto:        "tcp",
+		Addr:         addr,
+		DialTimeout:  xtime.Duration(time.Second),
+		ReadTimeout:  xtime.Duration(time.Second),
+		WriteTimeout: xtime.Duration(time.Second),
+	})
+}
+
+func TestGCRA(t *testing.T) {
+	fr := newFakeRedis(t)
+	defer fr.ln.Close()
+	r := newTestRedis(fr.ln.Addr().String())
+	defer r.Close()
+	ctx := context.Background()
+
+	l, err := New(&Config{Limits: map[string]*Limit{
+		"api:": {Rate: 10, Period: xtime.Duration(time.Second), Burst: 5},
+	}}, r)
+	assert.Nil(t, err)
+	for i := 4; i >= 0; i-- {
+		res, err := l.Allow(ctx, "api:login", 1)
+		assert.Nil(t, err)
+		assert.Equal(t, Result{Allowed: true, Remaining: int64(i)}, res)
+	}
+	res, err := l.Allow(ctx, "api:login", 1)
+	assert.Nil(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, int64(0), res.Remaining)
+	assert.True(t, res.RetryAfter > 0 && res.RetryAfter <= 100*time.Millisecond, "%v", res.RetryAfter)
+	res, err = l.Allow(ctx, "api:login", 6)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(-1), res.RetryAfter)
+	// the requests are spread over the period.
+	time.Sleep(110 * time.Millisecond)
+	res, err = l.Allow(ctx, "api:login", 1)
+	assert.Nil(t, err)
+	assert.True(t, res.Allowed)
+
+	res, err = l.Allow(ctx, "web:index", 100)
+	assert.Nil(t, err)
+	assert.Equal(t, Result{Allowed: true, Remaining: -1}, res)
+	_, err = l.Allow(ctx, "api:login", -1)
+	assert.NotNil(t, err)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	fr := newFakeRedis(t)
+	defer fr.ln.Close()
+	r := newTestRedis(fr.ln.Addr().String())
+	defer r.Close()
+	ctx := context.Background()
+
+	l, err := New(&Config{Limits: map[string]*Limit{
+		"": {Algorithm: SlidingWindow, Rate: 3, Period: xtime.Duration(200 * time.Millisecond)},
+	}}, r)
+	assert.Nil(t, err)
+	res, err := l.Allow(ctx, "user:1", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, Result{Allowed: true, Remaining: 1}, res)
+	res, err = l.Allow(ctx, "user:1", 2)
+	assert.Nil(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, int64(1), res.Remaining)
+	assert.True(t, res.RetryAfter > 0 && res.RetryAfter <= 200*time.Millisecond, "%v", res.RetryAfter)
+	res, err = l.Allow(ctx, "user:1", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, Result{Allowed: true, Remaining: 0}, res)
+	time.Sleep(210 * time.Millisecond)
+	res, err = l.Allow(ctx, "user:1", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, Result{Allowed: true, Remaining: 0}, res)
+}
+
+func TestReload(t *testing.T) {
+	fr := newFakeRedis(t)
+	defer fr.ln.Close()
+	r := newTestRedis(fr.ln.Addr().String())
+	defer r.Close()
+	ctx := context.Background()
+
+	l, err := New(&Config{Limits: map[string]*Limit{
+		"":       {Rate: 1, Period: xtime.Duration(time.Minute)},
+		"vip:":   {Rate: 10, Period: xtime.Duration(time.Minute)},
+		"vip:a:": {Rate: 2, Period: xtime.Duration(time.Minute)},
+	}}, r)
+	assert.Nil(t, err)
+	for key, remaining := range map[string]int64{"x": 0, "vip:b": 9, "vip:a:1": 1} {
+		res, err := l.Allow(ctx, key, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, remaining, res.Remaining, key)
+	}
+
+	assert.NotNil(t, l.Reload(&Config{Limits: map[string]*Limit{"": {Rate: 1}}}))
+	assert.NotNil(t, l.Reload(&Config{Limits: map[string]*Limit{"": {Algorithm: "leaky", Rate: 1, Period: xtime.Duration(time.Second)}}}))
+	assert.Nil(t, l.Reload(&Config{KeyPrefix: "rl:", Limits: map[string]*Limit{
+		"vip:": {Rate: 10, Period: xtime.Duration(time.Minute)},
+	}}))
+	res, err := l.Allow(ctx, "x", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), res.Remaining)
+	// the keys are new under the new key prefix.
+	res, err = l.Allow(ctx, "vip:a:1", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9), res.Remaining)
+}
+
+func TestDegrade(t *testing.T) {
+	fr := newFakeRedis(t)
+	defer fr.ln.Close()
+	r := newTestRedis(fr.ln.Addr().String())
+	defer r.Close()
+	ctx := context.Background()
+
+	l, err := New(&Config{
+		Limits:  map[string]*Limit{"": {Rate: 2, Period: xtime.Duration(time.Minute)}},
+		Degrade: xtime.Duration(100 * time.Millisecond),
+	}, r)
+	assert.Nil(t, err)
+	fr.setDown(true)
+	for i := 1; i >= 0; i-- {
+		res, err := l.Allow(ctx, "k", 1)
+		assert.Nil(t, err)
+		assert.Equal(t, Result{Allowed: true, Remaining: int64(i)}, res)
+	}
+	res, err := l.Allow(ctx, "k", 1)
+	assert.Nil(t, err)
+	assert.False(t, res.Allowed)
+	assert.True(t, res.RetryAfter > 29*time.Second && res.RetryAfter <= 30*time.Second, "%v", res.RetryAfter)
+	res, err = l.Allow(ctx, "k", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(-1), res.RetryAfter)
+
+	// redis is tried again after the degrade.
+	fr.setDown(false)
+	evals := fr.evaluated()
+	time.Sleep(110 * time.Millisecond)
+	res, err = l.Allow(ctx, "k", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, Result{Allowed: true, Remaining: 1}, res)
+	assert.Equal(t, evals+1, fr.evaluated())
+}
@@ -0,0 +1,65 @@
+package ratelimit
+
+import "github.com/zombie-k/kylin/library/cache/redis"
+
+// The scripts take the time of redis, so the instances need no synchronized
+// clocks, and reply {allowed, remaining, retry after in microseconds}. The
+// retry after is -1 if n exceeds the limit. The replicate_commands call lets
+// the scripts write after the non-deterministic TIME before redis 5.
+const (
+	// KEYS[1] holds the theoretical arrival time of the next request.
+	// ARGV: emission interval, burst offset (interval * burst), n.
+	_gcraSrc = `redis.replicate_commands()
+local interval = tonumber(ARGV[1])
+local offset = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if not tat or tat < now then
+	tat = now
+end
+local remaining = math.floor((now - (tat - offset)) / interval)
+if n * interval > offset then
+	return {0, remaining, -1}
+end
+local newTat = tat + n * interval
+local diff = now - (newTat - offset)
+if diff < 0 then
+	return {0, remaining, -diff}
+end
+if newTat > now then
+	redis.call("SET", KEYS[1], string.format("%.0f", newTat), "PX", math.ceil((newTat - now) / 1000))
+end
+return {1, math.floor(diff / interval), 0}`
+
+	// KEYS[1] is a zset of the requests scored by their time.
+	// ARGV: limit, window, n, a random token unique to the call.
+	_slidingSrc = `redis.replicate_commands()
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", string.format("%.0f", now - window))
+local count = redis.call("ZCARD", KEYS[1])
+if n > limit then
+	return {0, limit - count, -1}
+end
+if count + n > limit then
+	local i = count + n - limit - 1
+	local oldest = redis.call("ZRANGE", KEYS[1], i, i, "WITHSCORES")
+	return {0, limit - count, tonumber(oldest[2]) + window - now}
+end
+local score = string.format("%.0f", now)
+for i = 1, n do
+	redis.call("ZADD", KEYS[1], score, ARGV[4] .. ":" .. i)
+end
+redis.call("PEXPIRE", KEYS[1], math.ceil(window / 1000))
+return {1, limit - count - n, 0}`
+)
+
+var (
+	gcraScript    = redis.NewScript(1, _gcraSrc)
+	slidingScript = redis.NewScript(1, _slidingSrc)
+)
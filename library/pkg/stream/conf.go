@@ -0,0 +1,91 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	xtime "github.com/zombie-k/kylin/library/time"
+)
+
+// Config is the settings of a consumer of a stream in a consumer group.
+type Config struct {
+	Name     string // consumer name, for metrics and logs
+	Stream   string
+	Group    string
+	Consumer string // consumer in the group, hostname-pid if empty
+	// StartID is the ID the group created by the consumer starts after, "$"
+	// for the new entries only, "0" for the whole stream.
+	StartID string
+	// Count is the entries read or claimed at once.
+	Count int
+	// Block is how long XREADGROUP waits for new entries, it must be shorter
+	// than the read timeout of the redis connections.
+	Block xtime.Duration
+	// Visibility is how long an entry is pending before another consumer
+	// claims it, it must be longer than the handling of an entry.
+	Visibility xtime.Duration
+	// ClaimInterval is the interval of the scans of the pending entries.
+	ClaimInterval xtime.Duration
+	// MaxDeliveries is how many times an entry is delivered before it is
+	// moved to the dead letter stream.
+	MaxDeliveries int64
+	// DeadLetter is the dead letter stream, Stream + ":dead" if empty.
+	DeadLetter string
+
+	Job struct {
+		Worker int
+		Buffer int
+	}
+}
+
+const (
+	_defaultStartID       = "$"
+	_defaultCount         = 10
+	_defaultBlock         = xtime.Duration(time.Second)
+	_defaultVisibility    = xtime.Duration(30 * time.Second)
+	_defaultMaxDeliveries = 5
+)
+
+// Builder checks c and fills the defaults.
+func (c *Config) Builder() error {
+	if c.Stream == "" || c.Group == "" {
+		return errors.New("stream and group are required")
+	}
+	if c.Name == "" {
+		c.Name = c.Stream
+	}
+	if c.Consumer == "" {
+		host, _ := os.Hostname()
+		c.Consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if c.StartID == "" {
+		c.StartID = _defaultStartID
+	}
+	if c.Count <= 0 {
+		c.Count = _defaultCount
+	}
+	if c.Block <= 0 {
+		c.Block = _defaultBlock
+	}
+	if c.Visibility <= 0 {
+		c.Visibility = _defaultVisibility
+	}
+	if c.ClaimInterval <= 0 {
+		c.ClaimInterval = c.Visibility / 2
+	}
+	if c.MaxDeliveries <= 0 {
+		c.MaxDeliveries = _defaultMaxDeliveries
+	}
+	if c.DeadLetter == "" {
+		c.DeadLetter = c.Stream + ":dead"
+	}
+	if c.Job.Worker <= 0 {
+		c.Job.Worker = 1
+	}
+	if c.Job.Buffer <= 0 {
+		c.Job.Buffer = 1
+	}
+	return nil
+}
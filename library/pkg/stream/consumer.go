@@ -0,0 +1,284 @@
+package stream
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache/redis"
+	"github.com/zombie-k/kylin/library/log"
+	"github.com/zombie-k/kylin/library/sync/pipeline/fanout"
+
+	"github.com/pkg/errors"
+)
+
+const _retryInterval = time.Second
+
+// Handler handles a message, the message is acknowledged if it returns nil,
+// otherwise it is delivered again after the visibility timeout.
+type Handler func(ctx context.Context, msg *Message) error
+
+// Consumer consumes a stream in a consumer group: it reads the new entries
+// with XREADGROUP and hands them to the handler on the fanout workers. The
+// entries pending longer than the visibility timeout, e.g. of a crashed
+// consumer, are claimed by XCLAIM and delivered again, the entries delivered
+// MaxDeliveries times are moved to the dead letter stream.
+type Consumer struct {
+	c *Config
+	r *redis.Redis
+	h Handler
+
+	job      *fanout.Fanout
+	inflight sync.WaitGroup
+
+	ctx    context.Context
+	cancel func()
+	wg     sync.WaitGroup
+}
+
+// NewConsumer creates the group if needed and starts consuming.
+func NewConsumer(c *Config, r *redis.Redis, h Handler) (*Consumer, error) {
+	if err := c.Builder(); err != nil {
+		return nil, err
+	}
+	consumer := &Consumer{
+		c:   c,
+		r:   r,
+		h:   h,
+		job: fanout.New(c.Name, fanout.Worker(c.Job.Worker), fanout.Buffer(c.Job.Buffer)),
+	}
+	consumer.ctx, consumer.cancel = context.WithCancel(context.Background())
+	if err := consumer.createGroup(); err != nil {
+		consumer.job.Close()
+		return nil, err
+	}
+	consumer.wg.Add(2)
+	go consumer.read()
+	go consumer.claim()
+	return consumer, nil
+}
+
+// Close stops reading and waits for the messages read to be handled.
+func (c *Consumer) Close() error {
+	c.cancel()
+	c.wg.Wait()
+	c.inflight.Wait()
+	return c.job.Close()
+}
+
+// createGroup creates the group and the stream, an existing group is kept.
+func (c *Consumer) createGroup() error {
+	_, err := c.r.Do(c.ctx, "XGROUP", "CREATE", c.c.Stream, c.c.Group, c.c.StartID, "MKSTREAM")
+	if err != nil && !isError(err, "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+func (c *Consumer) read() {
+	defer c.wg.Done()
+	block := int64(time.Duration(c.c.Block) / time.Millisecond)
+	for c.ctx.Err() == nil {
+		reply, err := c.r.Do(c.ctx, "XREADGROUP", "GROUP", c.c.Group, c.c.Consumer,
+			"COUNT", c.c.Count, "BLOCK", block, "STREAMS", c.c.Stream, ">")
+		if err != nil {
+			if c.ctx.Err() != nil {
+				return
+			}
+			log.Error("stream: %s read stream %s group %s error(%v)", c.c.Name, c.c.Stream, c.c.Group, err)
+			if isError(err, "NOGROUP") {
+				// the stream is deleted with its groups.
+				if err = c.createGroup(); err != nil {
+					log.Error("stream: %s create group %s error(%v)", c.c.Name, c.c.Group, err)
+				}
+			}
+			c.sleep(_retryInterval)
+			continue
+		}
+		if reply == nil {
+			// timed out.
+			continue
+		}
+		streams, err := readEntries(reply)
+		if err != nil {
+			log.Error("stream: %s read stream %s error(%v)", c.c.Name, c.c.Stream, err)
+			continue
+		}
+		for _, entries := range streams {
+			msgs, err := parseEntries(c.c.Stream, entries, nil)
+			if err != nil {
+				log.Error("stream: %s read stream %s error(%v)", c.c.Name, c.c.Stream, err)
+				continue
+			}
+			for _, msg := range msgs {
+				msg.Deliveries = 1
+				c.dispatch(msg)
+			}
+		}
+	}
+}
+
+// readEntries returns the entries of every stream of a XREADGROUP reply,
+// an array of [stream, entries] pairs, or a map of stream to entries on a
+// RESP3 connection.
+func readEntries(reply interface{}) ([]interface{}, error) {
+	if m, ok := reply.(redis.Map); ok {
+		entries := make([]interface{}, 0, len(m)/2)
+		for i := 1; i < len(m); i += 2 {
+			entries = append(entries, m[i])
+		}
+		return entries, nil
+	}
+	streams, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]interface{}, 0, len(streams))
+	for _, stream := range streams {
+		values, err := redis.Values(stream, nil)
+		if err != nil || len(values) != 2 {
+			return nil, errors.Errorf("stream: unexpected reply %v", stream)
+		}
+		entries = append(entries, values[1])
+	}
+	return entries, nil
+}
+
+func (c *Consumer) dispatch(msg *Message) {
+	c.inflight.Add(1)
+	if err := c.job.DoWait(context.TODO(), func(ctx context.Context) {
+		defer c.inflight.Done()
+		c.handle(ctx, msg)
+	}); err != nil {
+		c.inflight.Done()
+	}
+}
+
+func (c *Consumer) handle(ctx context.Context, msg *Message) {
+	if err := c.h(ctx, msg); err != nil {
+		log.Warn("stream: %s handle entry %s of stream %s delivery %d error(%v)", c.c.Name, msg.ID, msg.Stream, msg.Deliveries, err)
+		_metricMessages.Inc(c.c.Name, "error")
+		return
+	}
+	_metricMessages.Inc(c.c.Name, "ok")
+	if _, err := c.r.Do(ctx, "XACK", c.c.Stream, c.c.Group, msg.ID); err != nil {
+		log.Error("stream: %s ack entry %s of stream %s error(%v)", c.c.Name, msg.ID, msg.Stream, err)
+	}
+}
+
+func (c *Consumer) claim() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(time.Duration(c.c.ClaimInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.claimPending(); err != nil && c.ctx.Err() == nil {
+				log.Error("stream: %s claim stream %s group %s error(%v)", c.c.Name, c.c.Stream, c.c.Group, err)
+			}
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// claimPending scans the pending entries of the group, claims those idle
+// longer than the visibility timeout and moves the poison ones to the dead
+// letter stream.
+func (c *Consumer) claimPending() error {
+	visibility := int64(time.Duration(c.c.Visibility) / time.Millisecond)
+	for start := "-"; c.ctx.Err() == nil; {
+		pending, err := redis.Values(c.r.Do(c.ctx, "XPENDING", c.c.Stream, c.c.Group, start, "+", c.c.Count))
+		if err != nil {
+			return err
+		}
+		var (
+			ids        []interface{}
+			deliveries = make(map[string]int64)
+			last       string
+		)
+		for _, p := range pending {
+			var (
+				id       string
+				consumer string
+				idle     int64
+				count    int64
+			)
+			values, err := redis.Values(p, nil)
+			if err != nil {
+				return err
+			}
+			if _, err = redis.Scan(values, &id, &consumer, &idle, &count); err != nil {
+				return err
+			}
+			last = id
+			if idle < visibility {
+				continue
+			}
+			if count >= c.c.MaxDeliveries {
+				if err = c.deadLetter(id, count); err != nil {
+					return err
+				}
+				continue
+			}
+			ids = append(ids, id)
+			deliveries[id] = count
+		}
+		if len(ids) > 0 {
+			args := redis.Args{}.Add(c.c.Stream, c.c.Group, c.c.Consumer, visibility).Add(ids...)
+			reply, err := c.r.Do(c.ctx, "XCLAIM", args...)
+			msgs, err := parseEntries(c.c.Stream, reply, err)
+			if err != nil {
+				return err
+			}
+			for _, msg := range msgs {
+				msg.Deliveries = deliveries[msg.ID] + 1
+				_metricMessages.Inc(c.c.Name, "claimed")
+				c.dispatch(msg)
+			}
+		}
+		if len(pending) < c.c.Count {
+			return nil
+		}
+		if start, err = nextID(last); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deadLetter moves the entry id to the dead letter stream with its origin.
+func (c *Consumer) deadLetter(id string, deliveries int64) error {
+	reply, err := c.r.Do(c.ctx, "XRANGE", c.c.Stream, id, id)
+	msgs, err := parseEntries(c.c.Stream, reply, err)
+	if err != nil {
+		return err
+	}
+	if len(msgs) == 1 {
+		args := redis.Args{}.Add(c.c.DeadLetter, "*").Add(msgs[0].Fields...).
+			Add("_stream", c.c.Stream, "_id", id, "_group", c.c.Group, "_deliveries", deliveries)
+		if _, err = c.r.Do(c.ctx, "XADD", args...); err != nil {
+			return err
+		}
+	}
+	// an entry deleted from the stream is dropped.
+	if _, err = c.r.Do(c.ctx, "XACK", c.c.Stream, c.c.Group, id); err != nil {
+		return err
+	}
+	log.Warn("stream: %s entry %s of stream %s delivered %d times moved to %s", c.c.Name, id, c.c.Stream, deliveries, c.c.DeadLetter)
+	_metricMessages.Inc(c.c.Name, "dead")
+	return nil
+}
+
+func (c *Consumer) sleep(d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-c.ctx.Done():
+	}
+}
+
+func isError(err error, code string) bool {
+	e, ok := errors.Cause(err).(redis.Error)
+	return ok && strings.HasPrefix(string(e), code)
+}
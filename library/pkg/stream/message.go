@@ -0,0 +1,97 @@
+package stream
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/zombie-k/kylin/library/cache/redis"
+
+	"github.com/pkg/errors"
+)
+
+// Message is an entry of a stream.
+type Message struct {
+	// Entry ID
+	ID string
+
+	// Stream of the entry
+	Stream string
+
+	// Alternating field names and values of the entry
+	Fields []interface{}
+
+	// Deliveries counts the deliveries of the entry, 1 for the first one
+	Deliveries int64
+}
+
+// Value returns the value of the field name.
+func (m *Message) Value(name string) ([]byte, bool) {
+	for i := 0; i+1 < len(m.Fields); i += 2 {
+		if key, _ := redis.String(m.Fields[i], nil); key == name {
+			value, err := redis.Bytes(m.Fields[i+1], nil)
+			return value, err == nil
+		}
+	}
+	return nil, false
+}
+
+// Scan copies the fields to the struct pointed by dest, see redis.ScanStruct.
+func (m *Message) Scan(dest interface{}) error {
+	return redis.ScanStruct(m.Fields, dest)
+}
+
+// parseEntries parses the entries replied by XRANGE, XREADGROUP and XCLAIM,
+// the deleted entries are nil and skipped.
+func parseEntries(stream string, reply interface{}, err error) ([]*Message, error) {
+	entries, err := redis.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]*Message, 0, len(entries))
+	for _, entry := range entries {
+		if entry == nil {
+			continue
+		}
+		values, err := redis.Values(entry, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != 2 {
+			return nil, errors.Errorf("stream: unexpected entry %v", values)
+		}
+		id, err := redis.String(values[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		if values[1] == nil {
+			// deleted while pending.
+			continue
+		}
+		fields, err := redis.Values(values[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, &Message{ID: id, Stream: stream, Fields: fields})
+	}
+	return msgs, nil
+}
+
+// nextID returns the smallest entry ID after id.
+func nextID(id string) (string, error) {
+	i := strings.IndexByte(id, '-')
+	if i < 0 {
+		return "", errors.Errorf("stream: malformed id %s", id)
+	}
+	ms, err := strconv.ParseUint(id[:i], 10, 64)
+	if err != nil {
+		return "", errors.Errorf("stream: malformed id %s", id)
+	}
+	seq, err := strconv.ParseUint(id[i+1:], 10, 64)
+	if err != nil {
+		return "", errors.Errorf("stream: malformed id %s", id)
+	}
+	if seq++; seq == 0 {
+		ms++
+	}
+	return strconv.FormatUint(ms, 10) + "-" + strconv.FormatUint(seq, 10), nil
+}
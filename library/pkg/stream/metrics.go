@@ -0,0 +1,22 @@
+package stream
+
+import "github.com/zombie-k/kylin/library/stat/metric"
+
+const namespace = "redis_stream"
+
+var (
+	_metricMessages = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "messages_total",
+		Help:      "redis stream consumer messages total by result: ok, error, claimed or dead.",
+		Labels:    []string{"name", "result"},
+	})
+	_metricProduced = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "producer",
+		Name:      "messages_total",
+		Help:      "redis stream producer messages total by result: ok or error.",
+		Labels:    []string{"stream", "result"},
+	})
+)
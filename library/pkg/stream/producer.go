@@ -0,0 +1,37 @@
+package stream
+
+import (
+	"context"
+
+	"github.com/zombie-k/kylin/library/cache/redis"
+)
+
+// Producer appends entries to a stream, trimmed to about MaxLen entries.
+type Producer struct {
+	r      *redis.Redis
+	stream string
+	maxLen int64
+}
+
+// NewProducer new a producer of stream, maxLen <= 0 disables the trimming.
+func NewProducer(r *redis.Redis, stream string, maxLen int64) *Producer {
+	return &Producer{r: r, stream: stream, maxLen: maxLen}
+}
+
+// Add appends an entry of the fields of v and returns its ID. v is flattened
+// by redis.Args.AddFlat: a map or a struct with redis field tags.
+func (p *Producer) Add(ctx context.Context, v interface{}) (string, error) {
+	args := redis.Args{}.Add(p.stream)
+	if p.maxLen > 0 {
+		// the approximate trimming removes whole macro nodes, cheaply.
+		args = args.Add("MAXLEN", "~", p.maxLen)
+	}
+	args = args.Add("*").AddFlat(v)
+	id, err := redis.String(p.r.Do(ctx, "XADD", args...))
+	if err != nil {
+		_metricProduced.Inc(p.stream, "error")
+		return "", err
+	}
+	_metricProduced.Inc(p.stream, "ok")
+	return id, nil
+}
@@ -0,0 +1,364 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zombie-k/kylin/library/cache/redis"
+	"github.com/zombie-k/kylin/library/container/pool"
+	xtime "github.com/zombie-k/kylin/library/time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeEntry struct {
+	id     string
+	fields []string
+}
+
+type fakePending struct {
+	consumer   string
+	delivered  time.Time
+	deliveries int64
+}
+
+type fakeGroup struct {
+	last    string
+	pending map[string]*fakePending
+}
+
+// fakeStreams serves the stream commands used by the consumer and the
+// producer, the idle times of the pending entries are real.
+type fakeStreams struct {
+	ln      net.Listener
+	mu      sync.Mutex
+	streams map[string][]*fakeEntry
+	groups  map[string]*fakeGroup
+	seq     int64
+	maxLens []string
+}
+
+func newFakeStreams(t *testing.T) *fakeStreams {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := &fakeStreams{ln: ln, streams: make(map[string][]*fakeEntry), groups: make(map[string]*fakeGroup)}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go fs.serveConn(nc)
+		}
+	}()
+	return fs
+}
+
+func (fs *fakeStreams) serveConn(nc net.Conn) {
+	defer nc.Close()
+	// a client conn reads the requests like replies.
+	rc, _ := redis.Dial("", "", redis.DialNetDial(func(string, string) (net.Conn, error) { return nc, nil }))
+	w := bufio.NewWriter(nc)
+	for {
+		req, err := redis.Strings(rc.Receive())
+		if err != nil {
+			return
+		}
+		fs.mu.Lock()
+		reply := fs.handle(req)
+		fs.mu.Unlock()
+		writeReply(w, reply)
+		if w.Flush() != nil {
+			return
+		}
+	}
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch reply := reply.(type) {
+	case nil:
+		w.WriteString("*-1\r\n")
+	case string:
+		w.WriteString("+" + reply + "\r\n")
+	case redis.Error:
+		w.WriteString("-" + string(reply) + "\r\n")
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", reply)
+	case []byte:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(reply), reply)
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(reply))
+		for _, r := range reply {
+			writeReply(w, r)
+		}
+	}
+}
+
+func (e *fakeEntry) reply() interface{} {
+	fields := make([]interface{}, len(e.fields))
+	for i, f := range e.fields {
+		fields[i] = []byte(f)
+	}
+	return []interface{}{[]byte(e.id), fields}
+}
+
+func idLess(a, b string) bool {
+	ams, aseq := splitID(a)
+	bms, bseq := splitID(b)
+	return ams < bms || ams == bms && aseq < bseq
+}
+
+func splitID(id string) (ms, seq uint64) {
+	fmt.Sscanf(id, "%d-%d", &ms, &seq)
+	return
+}
+
+func (fs *fakeStreams) handle(req []string) interface{} {
+	switch req[0] {
+	case "XGROUP":
+		key := req[2] + "/" + req[3]
+		if _, ok := fs.groups[key]; ok {
+			return redis.Error("BUSYGROUP Consumer Group name already exists")
+		}
+		last := "0-0"
+		if req[4] == "$" && len(fs.streams[req[2]]) > 0 {
+			entries := fs.streams[req[2]]
+			last = entries[len(entries)-1].id
+		}
+		fs.groups[key] = &fakeGroup{last: last, pending: make(map[string]*fakePending)}
+		return "OK"
+	case "XADD":
+		stream, args := req[1], req[2:]
+		maxLen := -1
+		if args[0] == "MAXLEN" {
+			fs.maxLens = append(fs.maxLens, args[1]+" "+args[2])
+			maxLen, _ = strconv.Atoi(args[2])
+			args = args[3:]
+		}
+		fs.seq++
+		e := &fakeEntry{id: fmt.Sprintf("%d-0", fs.seq), fields: args[1:]}
+		fs.streams[stream] = append(fs.streams[stream], e)
+		if maxLen >= 0 && len(fs.streams[stream]) > maxLen {
+			fs.streams[stream] = fs.streams[stream][len(fs.streams[stream])-maxLen:]
+		}
+		return []byte(e.id)
+	case "XREADGROUP":
+		// XREADGROUP GROUP g c COUNT n BLOCK ms STREAMS s >
+		g := fs.groups[req[9]+"/"+req[2]]
+		count, _ := strconv.Atoi(req[5])
+		var entries []interface{}
+		for _, e := range fs.streams[req[9]] {
+			if len(entries) == count {
+				break
+			}
+			if idLess(g.last, e.id) {
+				g.last = e.id
+				g.pending[e.id] = &fakePending{consumer: req[3], delivered: time.Now(), deliveries: 1}
+				entries = append(entries, e.reply())
+			}
+		}
+		if len(entries) == 0 {
+			fs.mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			fs.mu.Lock()
+			return nil
+		}
+		return []interface{}{[]interface{}{[]byte(req[9]), entries}}
+	case "XACK":
+		g := fs.groups[req[1]+"/"+req[2]]
+		var n int64
+		for _, id := range req[3:] {
+			if _, ok := g.pending[id]; ok {
+				delete(g.pending, id)
+				n++
+			}
+		}
+		return n
+	case "XPENDING":
+		// XPENDING s g start + count
+		g := fs.groups[req[1]+"/"+req[2]]
+		count, _ := strconv.Atoi(req[5])
+		var pending []interface{}
+		for _, e := range fs.streams[req[1]] {
+			p, ok := g.pending[e.id]
+			if !ok || (req[3] != "-" && idLess(e.id, req[3])) || len(pending) == count {
+				continue
+			}
+			idle := int64(time.Since(p.delivered) / time.Millisecond)
+			pending = append(pending, []interface{}{[]byte(e.id), []byte(p.consumer), idle, p.deliveries})
+		}
+		return pending
+	case "XCLAIM":
+		// XCLAIM s g c min-idle id...
+		g := fs.groups[req[1]+"/"+req[2]]
+		minIdle, _ := strconv.ParseInt(req[4], 10, 64)
+		var entries []interface{}
+		for _, id := range req[5:] {
+			p, ok := g.pending[id]
+			if !ok || int64(time.Since(p.delivered)/time.Millisecond) < minIdle {
+				continue
+			}
+			p.consumer, p.delivered = req[3], time.Now()
+			p.deliveries++
+			for _, e := range fs.streams[req[1]] {
+				if e.id == id {
+					entries = append(entries, e.reply())
+				}
+			}
+		}
+		return entries
+	case "XRANGE":
+		for _, e := range fs.streams[req[1]] {
+			if e.id == req[2] {
+				return []interface{}{e.reply()}
+			}
+		}
+		return []interface{}{}
+	}
+	return redis.Error("ERR unknown command " + req[0])
+}
+
+func (fs *fakeStreams) pending(stream, group string) int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return len(fs.groups[stream+"/"+group].pending)
+}
+
+func (fs *fakeStreams) entries(stream string) []*fakeEntry {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]*fakeEntry(nil), fs.streams[stream]...)
+}
+
+func newTestRedis(addr string) *redis.Redis {
+	return redis.NewRedis(&redis.Config{
+		Config:       &pool.Config{Active: 10, Idle: 2, IdleTimeout: xtime.Duration(time.Minute)},
+		Name:         "test_stream",
+		Proto:        "tcp",
+		Addr:         addr,
+		DialTimeout:  xtime.Duration(time.Second),
+		ReadTimeout:  xtime.Duration(time.Second),
+		WriteTimeout: xtime.Duration(time.Second),
+	})
+}
+
+type order struct {
+	ID   int64  `redis:"id"`
+	Item string `redis:"item"`
+}
+
+func TestConsumer(t *testing.T) {
+	fs := newFakeStreams(t)
+	defer fs.ln.Close()
+	r := newTestRedis(fs.ln.Addr().String())
+	defer r.Close()
+	ctx := context.Background()
+
+	c := &Config{
+		Stream:        "orders",
+		Group:         "billing",
+		Consumer:      "c1",
+		StartID:       "0",
+		Block:         xtime.Duration(10 * time.Millisecond),
+		Visibility:    xtime.Duration(30 * time.Millisecond),
+		ClaimInterval: xtime.Duration(10 * time.Millisecond),
+		MaxDeliveries: 3,
+	}
+	var (
+		mu         sync.Mutex
+		handled    []order
+		deliveries []int64
+	)
+	consumer, err := NewConsumer(c, r, func(ctx context.Context, msg *Message) error {
+		var o order
+		if err := msg.Scan(&o); err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if o.Item == "poison" {
+			deliveries = append(deliveries, msg.Deliveries)
+			return errors.New("poison")
+		}
+		handled = append(handled, o)
+		return nil
+	})
+	assert.Nil(t, err)
+
+	p := NewProducer(r, "orders", 100)
+	for i, item := range []string{"book", "poison", "pen"} {
+		_, err = p.Add(ctx, &order{ID: int64(i), Item: item})
+		assert.Nil(t, err)
+	}
+
+	// the poison entry is delivered MaxDeliveries times, then moved.
+	assert.Eventually(t, func() bool { return len(fs.entries("orders:dead")) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Nil(t, consumer.Close())
+	mu.Lock()
+	assert.Equal(t, []order{{0, "book"}, {2, "pen"}}, handled)
+	assert.Equal(t, []int64{1, 2, 3}, deliveries)
+	mu.Unlock()
+	assert.Equal(t, 0, fs.pending("orders", "billing"))
+	dead := fs.entries("orders:dead")[0]
+	assert.Equal(t, []string{"id", "1", "item", "poison", "_stream", "orders", "_id", "2-0", "_group", "billing", "_deliveries", "3"}, dead.fields)
+
+	// a second consumer keeps the group.
+	consumer, err = NewConsumer(&Config{Stream: "orders", Group: "billing"}, r, func(context.Context, *Message) error { return nil })
+	assert.Nil(t, err)
+	assert.Nil(t, consumer.Close())
+}
+
+func TestProducerTrim(t *testing.T) {
+	fs := newFakeStreams(t)
+	defer fs.ln.Close()
+	r := newTestRedis(fs.ln.Addr().String())
+	defer r.Close()
+
+	p := NewProducer(r, "events", 2)
+	for i := 0; i < 5; i++ {
+		_, err := p.Add(context.Background(), map[string]int{"n": i})
+		assert.Nil(t, err)
+	}
+	assert.Len(t, fs.entries("events"), 2)
+	assert.Equal(t, "~ 2", fs.maxLens[0])
+
+	_, err := NewProducer(r, "events", 0).Add(context.Background(), map[string]int{"n": 5})
+	assert.Nil(t, err)
+	assert.Len(t, fs.entries("events"), 3)
+}
+
+func TestNextID(t *testing.T) {
+	id, err := nextID("1526985054069-0")
+	assert.Nil(t, err)
+	assert.Equal(t, "1526985054069-1", id)
+	id, err = nextID("5-18446744073709551615")
+	assert.Nil(t, err)
+	assert.Equal(t, "6-0", id)
+	_, err = nextID("x")
+	assert.NotNil(t, err)
+}
+
+func TestReadEntries(t *testing.T) {
+	entries := []interface{}{[]interface{}{[]byte("1-0"), []interface{}{[]byte("n"), []byte("1")}}}
+	resp2 := []interface{}{[]interface{}{[]byte("events"), entries}}
+	resp3 := redis.Map{[]byte("events"), entries}
+	for _, reply := range []interface{}{resp2, resp3} {
+		streams, err := readEntries(reply)
+		assert.Nil(t, err)
+		assert.Len(t, streams, 1)
+		msgs, err := parseEntries("events", streams[0], nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "1-0", msgs[0].ID)
+	}
+	_, err := readEntries([]interface{}{[]byte("events")})
+	assert.NotNil(t, err)
+}